@@ -0,0 +1,30 @@
+// Comando backupschema: genera il JSON Schema del formato di backup dalle struct del
+// pacchetto tracker. Senza argomenti scrive su stdout, altrimenti nel file indicato.
+//
+//	go run ./cmd/backupschema docs/backup.schema.json
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"work-time-tracker-go/tracker"
+)
+
+func main() {
+	data, err := tracker.BackupSchemaJSON()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) < 2 {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(os.Args[1], data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "errore scrittura schema: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Schema backup %s scritto in %s\n", tracker.BackupVersion, os.Args[1])
+}
@@ -2,13 +2,16 @@
 import { GetProjects, CreateProject, ArchiveProject, GetProjectReport, GetArchivedProjects, ReactivateProject, DeleteProject, UpdateProject } from './wailsjs/go/main/App.js';
 import { GetSessions, CreateSession, UpdateSessionDuration, UpdateSessionActivityType, DeleteSession, SplitSession } from './wailsjs/go/main/App.js';
 import { UpdateProjectNote, MigrateLegacyNotes } from './wailsjs/go/main/App.js';
-import { GetActivityTypes, CreateActivityType, UpdateActivityType, DeleteActivityType, ReorderActivityTypes } from './wailsjs/go/main/App.js';
-import { GetTrackingState, StartTracking, StopTracking } from './wailsjs/go/main/App.js';
-import { CheckIdlePeriod, AttributeIdle } from './wailsjs/go/main/App.js';
+import { GetActivityTypes, GetArchivedActivityTypes, CreateActivityType, UpdateActivityType, ArchiveActivityType, ReactivateActivityType, ReorderActivityTypes } from './wailsjs/go/main/App.js';
+import { GetTrackingState, StartTracking, StopTracking, PauseTracking, ResumeTracking, SwitchTracking } from './wailsjs/go/main/App.js';
+import { CheckIdlePeriod, AttributeIdle, AttributeIdleSplit, CheckSuspendedPeriod, AttributeSuspended } from './wailsjs/go/main/App.js';
 import { ExportData, ImportData } from './wailsjs/go/main/App.js';
+import { CheckIntegrity } from './wailsjs/go/main/App.js';
 import { SaveReportJSON, SaveReportText, ImportProjectJSON } from './wailsjs/go/main/App.js';
+import { ExportSessionsCSV, ExportTimesheetXLSX } from './wailsjs/go/main/App.js';
 import { IsAutoStartEnabled, EnableAutoStart, DisableAutoStart } from './wailsjs/go/main/App.js';
 import { SetIdleThreshold, GetIdleThreshold, BringWindowToFront, RestoreNormalWindow } from './wailsjs/go/main/App.js';
+import { GetTimeZone, SetTimeZone } from './wailsjs/go/main/App.js';
 import { UpdateSessionComplete, GetSessionById } from './wailsjs/go/main/App.js';
 import { EventsOn } from './wailsjs/runtime/runtime.js';
 
@@ -50,7 +53,11 @@ const MAX_PROJECT_DESC_LENGTH = 500;
 // Variabili globali
 let currentReportProjectId = null;
 let isCurrentlyTracking = false;
+let isCurrentlyPaused = false;
+let pendingPeriodType = 'idle'; // tipo del periodo mostrato nel modale idle ('idle' o 'suspended')
+let idleSplitMode = false; // periodo idle diviso tra più progetti
 let activityTypes = [];
+let archivedActivityTypes = []; // Nascosti dalle scelte, ma ancora usati da sessioni esistenti
 let projectsCache = [];
 let statusCheckInProgress = false; // Debounce flag for status check
 
@@ -64,6 +71,10 @@ document.addEventListener('DOMContentLoaded', async function() {
     // Aggiorna stato ogni 2 secondi (ridotto per mostrare il modale idle più velocemente)
     setInterval(checkTrackingStatus, 2000);
 
+    // Cambio progetto o tipo attività durante il tracking: nuova sessione senza fermare il timer
+    document.getElementById('projectSelect').addEventListener('change', switchTracking);
+    document.getElementById('activityTypeSelect').addEventListener('change', switchTracking);
+
     // Ascolta evento auto-stop per inattività
     EventsOn('tracking-auto-stopped', async (data) => {
         console.log('[EVENT] Tracking auto-stopped:', data);
@@ -87,6 +98,7 @@ document.addEventListener('DOMContentLoaded', async function() {
 async function loadActivityTypes() {
     try {
         activityTypes = await GetActivityTypes();
+        archivedActivityTypes = (await GetArchivedActivityTypes()) || [];
         populateActivityTypeSelect();
     } catch (error) {
         console.error('Errore caricamento tipi attività:', error);
@@ -106,6 +118,12 @@ function populateActivityTypeSelect() {
     });
 }
 
+// Tipi selezionabili per una sessione: quelli attivi più quello archiviato già assegnato
+function selectableActivityTypes(currentName) {
+    const archived = archivedActivityTypes.find(t => t.name === currentName);
+    return archived ? [...activityTypes, archived] : activityTypes;
+}
+
 // === PROGETTI ===
 
 async function loadProjects() {
@@ -318,6 +336,47 @@ async function stopTracking() {
     }
 }
 
+async function switchTracking() {
+    if (!isCurrentlyTracking) {
+        return;
+    }
+
+    const projectSelect = document.getElementById('projectSelect');
+    const projectID = parseInt(projectSelect.value);
+    const activityType = document.getElementById('activityTypeSelect').value || null;
+
+    if (!projectID) {
+        return;
+    }
+
+    try {
+        await SwitchTracking(projectID, activityType);
+        const projectName = projectSelect.options[projectSelect.selectedIndex].text;
+        showNotification(`Tracking spostato su: ${projectName}`, 'success');
+        await checkTrackingStatus();
+        await loadTimeline();
+    } catch (error) {
+        console.error('Errore cambio tracking:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
+window.togglePause = async function() {
+    try {
+        if (isCurrentlyPaused) {
+            await ResumeTracking();
+            showNotification('Tracking ripreso', 'success');
+        } else {
+            await PauseTracking();
+            showNotification('Tracking in pausa', 'success');
+        }
+        await checkTrackingStatus();
+    } catch (error) {
+        console.error('Errore pausa tracking:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
 async function checkTrackingStatus() {
     // Debounce: skip if a check is already in progress
     if (statusCheckInProgress) {
@@ -331,7 +390,9 @@ async function checkTrackingStatus() {
         if (state.is_tracking) {
             isCurrentlyTracking = true;
             updateUIForTracking(true);
-            document.getElementById('statusText').textContent = `Tracking attivo: ${escapeHtml(state.project_name || 'Progetto')}`;
+            updatePauseButton(state.status === 'paused');
+            const statusLabel = state.status === 'paused' ? 'Tracking in pausa' : 'Tracking attivo';
+            document.getElementById('statusText').textContent = `${statusLabel}: ${escapeHtml(state.project_name || 'Progetto')}`;
 
             // Mostra tempo trascorso
             const liveStatsDiv = document.getElementById('liveStats');
@@ -372,6 +433,13 @@ async function checkForPendingIdle() {
         const idleData = await CheckIdlePeriod();
         if (idleData.has_pending) {
             showIdleModal(idleData);
+            return;
+        }
+
+        // Sospensione del computer (o salto dell'orologio) da attribuire
+        const suspendedData = await CheckSuspendedPeriod();
+        if (suspendedData.has_pending) {
+            showIdleModal(suspendedData);
         }
     } catch (error) {
         console.error('Errore check idle:', error);
@@ -390,6 +458,13 @@ function showIdleModal(idlePeriod) {
     // Porta la finestra in primo piano per mostrare il modal all'utente
     BringWindowToFront();
 
+    pendingPeriodType = idlePeriod.type || 'idle';
+    const isSuspended = pendingPeriodType === 'suspended';
+    document.getElementById('idleModalTitle').textContent = isSuspended ? 'Sospensione del Computer Rilevata' : 'Periodo di Inattività Rilevato';
+    document.getElementById('idleModalText').textContent = isSuspended
+        ? 'Il computer è stato sospeso (o l\'orologio è stato spostato). A quale progetto vuoi attribuire questo tempo?'
+        : 'È stato rilevato un periodo di inattività. A quale progetto vuoi attribuire questo tempo?';
+
     // Formatta durata
     const minutes = idlePeriod.minutes;
     const hours = Math.floor(minutes / 60);
@@ -397,7 +472,10 @@ function showIdleModal(idlePeriod) {
     let durationText = hours > 0 ? `${hours}h ${remainingMins}min` : `${minutes} minuti`;
 
     document.getElementById('idleDuration').textContent = durationText;
-    document.getElementById('idlePeriod').textContent = `${idlePeriod.start_time} - ${idlePeriod.end_time}`;
+    // I periodi rimasti da giorni precedenti (es. dopo un riavvio) mostrano anche la data
+    const today = formatDateYYYYMMDD(new Date());
+    const periodDate = idlePeriod.date && idlePeriod.date !== today ? `${idlePeriod.date} ` : '';
+    document.getElementById('idlePeriod').textContent = `${periodDate}${idlePeriod.start_time} - ${idlePeriod.end_time}`;
 
     // Popola select con progetti
     const idleSelect = document.getElementById('idleProjectSelect');
@@ -409,10 +487,101 @@ function showIdleModal(idlePeriod) {
         idleSelect.appendChild(option);
     });
 
+    // La divisione tra più progetti è disponibile solo per i periodi idle
+    idleSplitMode = false;
+    idleSelect.style.display = '';
+    document.getElementById('idleSplitRows').innerHTML = '';
+    document.getElementById('idleSplitSection').style.display = 'none';
+    const splitToggle = document.getElementById('idleSplitToggle');
+    splitToggle.style.display = isSuspended ? 'none' : '';
+    splitToggle.textContent = 'Dividi tra più progetti';
+
     modal.classList.add('show');
 }
 
+window.toggleIdleSplit = function() {
+    idleSplitMode = !idleSplitMode;
+    document.getElementById('idleProjectSelect').style.display = idleSplitMode ? 'none' : '';
+    document.getElementById('idleSplitSection').style.display = idleSplitMode ? '' : 'none';
+    document.getElementById('idleSplitToggle').textContent = idleSplitMode ? 'Attribuisci a un solo progetto' : 'Dividi tra più progetti';
+
+    if (idleSplitMode && document.getElementById('idleSplitRows').children.length === 0) {
+        addIdleSplitRow();
+        addIdleSplitRow();
+    }
+}
+
+window.addIdleSplitRow = function() {
+    const row = document.createElement('div');
+    row.className = 'idle-split-row';
+    row.style.cssText = 'display: flex; gap: 8px; margin-bottom: 8px;';
+
+    const projectSelect = document.createElement('select');
+    projectSelect.className = 'idle-split-project';
+    projectSelect.innerHTML = '<option value="">Progetto...</option>';
+    projectsCache.forEach(project => {
+        const option = document.createElement('option');
+        option.value = project.id;
+        option.textContent = project.name;
+        projectSelect.appendChild(option);
+    });
+
+    const typeSelect = document.createElement('select');
+    typeSelect.className = 'idle-split-type';
+    typeSelect.innerHTML = '<option value="">Tipo attività...</option>';
+    activityTypes.forEach(type => {
+        const option = document.createElement('option');
+        option.value = type.name;
+        option.textContent = type.name;
+        typeSelect.appendChild(option);
+    });
+
+    const minutesInput = document.createElement('input');
+    minutesInput.type = 'number';
+    minutesInput.min = '1';
+    minutesInput.placeholder = 'Minuti';
+    minutesInput.className = 'idle-split-minutes';
+    minutesInput.style.width = '90px';
+
+    row.append(projectSelect, typeSelect, minutesInput);
+    document.getElementById('idleSplitRows').appendChild(row);
+}
+
+// collectIdleSplitSegments legge le parti del periodo idle dal modale
+function collectIdleSplitSegments() {
+    const rows = document.querySelectorAll('#idleSplitRows .idle-split-row');
+    const segments = [];
+    for (const row of rows) {
+        const projectID = parseInt(row.querySelector('.idle-split-project').value);
+        const minutes = parseInt(row.querySelector('.idle-split-minutes').value) || 0;
+        if (!projectID) {
+            throw new Error('Seleziona un progetto per ogni parte');
+        }
+        segments.push({
+            project_id: projectID,
+            activity_type: row.querySelector('.idle-split-type').value,
+            seconds: minutes * 60,
+            end_time: ''
+        });
+    }
+    return segments;
+}
+
 window.attributeIdleToProject = async function() {
+    if (idleSplitMode && pendingPeriodType === 'idle') {
+        try {
+            const segments = collectIdleSplitSegments();
+            await AttributeIdleSplit(segments);
+            showNotification(`Tempo idle diviso tra ${segments.length} parti`, 'success');
+            hideIdleModal();
+            await loadTimeline();
+        } catch (error) {
+            console.error('Errore divisione idle:', error);
+            showNotification('Errore: ' + (error.message || error), 'error');
+        }
+        return;
+    }
+
     const projectID = parseInt(document.getElementById('idleProjectSelect').value);
 
     if (!projectID) {
@@ -421,9 +590,13 @@ window.attributeIdleToProject = async function() {
     }
 
     try {
-        await AttributeIdle(projectID, false);
+        if (pendingPeriodType === 'suspended') {
+            await AttributeSuspended(projectID, false);
+        } else {
+            await AttributeIdle(projectID, false);
+        }
         const projectName = projectsCache.find(p => p.id === projectID)?.name || 'Progetto';
-        showNotification(`Tempo idle attribuito a: ${projectName}`, 'success');
+        showNotification(`Tempo ${pendingPeriodType === 'suspended' ? 'sospeso' : 'idle'} attribuito a: ${projectName}`, 'success');
         hideIdleModal();
         await loadTimeline();
     } catch (error) {
@@ -434,8 +607,13 @@ window.attributeIdleToProject = async function() {
 
 window.attributeIdleAsBreak = async function() {
     try {
-        await AttributeIdle(0, true);
-        showNotification('Tempo idle registrato come pausa', 'success');
+        if (pendingPeriodType === 'suspended') {
+            await AttributeSuspended(0, true);
+            showNotification('Tempo sospeso scartato', 'success');
+        } else {
+            await AttributeIdle(0, true);
+            showNotification('Tempo idle registrato come pausa', 'success');
+        }
         hideIdleModal();
     } catch (error) {
         console.error('Errore attribuzione pausa:', error);
@@ -450,10 +628,24 @@ function hideIdleModal() {
     RestoreNormalWindow();
 }
 
+function updatePauseButton(isPaused) {
+    isCurrentlyPaused = isPaused;
+    const pauseBtn = document.getElementById('pauseBtn');
+    pauseBtn.textContent = isPaused ? 'Riprendi' : 'Pausa';
+    document.getElementById('statusIndicator').classList.toggle('active', !isPaused);
+}
+
 function updateUIForTracking(isTracking) {
     const trackingBtn = document.getElementById('trackingBtn');
+    const pauseBtn = document.getElementById('pauseBtn');
     const indicator = document.getElementById('statusIndicator');
 
+    pauseBtn.style.display = isTracking ? '' : 'none';
+    if (!isTracking) {
+        isCurrentlyPaused = false;
+        pauseBtn.textContent = 'Pausa';
+    }
+
     if (isTracking) {
         trackingBtn.textContent = 'Ferma Tracking';
         trackingBtn.style.background = '#dc2626';
@@ -631,8 +823,27 @@ function displayTimeline(sessions, startDate, endDate) {
         html += '<div class="timeline-bar">';
 
         projectSessions.forEach(session => {
+            // Sessioni registrate dal tracking: tratti con gli istanti reali di inizio e fine
+            if (session.segments && session.segments.length > 0) {
+                session.segments.forEach(seg => {
+                    if (seg.type === 'active') {
+                        const seconds = Math.round((parseLocalTimestamp(seg.end_time) - parseLocalTimestamp(seg.start_time)) / 1000);
+                        html += createTimelineSegment({ ...session, timestamp: seg.start_time }, startTime, totalMs, seconds);
+                    } else if (seg.type === 'paused') {
+                        html += createPauseSegment(seg, startTime, totalMs);
+                    } else {
+                        const label = seg.type === 'suspended' ? 'Computer sospeso' : 'Inattività';
+                        html += createPauseSegment(seg, startTime, totalMs, label, 'timeline-idle-gap');
+                    }
+                });
+                return;
+            }
+
             const segment = createTimelineSegment(session, startTime, totalMs);
             html += segment;
+            (session.pauses || []).forEach(pause => {
+                html += createPauseSegment(pause, startTime, totalMs);
+            });
         });
 
         html += '</div>';
@@ -696,7 +907,8 @@ function displayTimeline(sessions, startDate, endDate) {
     content.innerHTML = html;
 }
 
-function createTimelineSegment(session, startTime, totalMs) {
+// displaySeconds: durata disegnata, se diversa da quella della sessione (es. un suo tratto)
+function createTimelineSegment(session, startTime, totalMs, displaySeconds = session.seconds) {
     if (!session.timestamp) return '';
 
     // Parse timestamp trattandolo sempre come ora locale
@@ -738,7 +950,7 @@ function createTimelineSegment(session, startTime, totalMs) {
 
     const sessionMs = sessionTime - startTime;
     const left = (sessionMs / totalMs) * 100;
-    const sessionDurationMs = session.seconds * 1000;
+    const sessionDurationMs = displaySeconds * 1000;
     const width = (sessionDurationMs / totalMs) * 100;
 
     const timeStr = `${String(displayHours).padStart(2, '0')}:${String(displayMinutes).padStart(2, '0')}`;
@@ -748,7 +960,8 @@ function createTimelineSegment(session, startTime, totalMs) {
     const tooltipText = `${escapeHtml(activityTypeName)}\nInizio: ${dateStr} ${timeStr}\nDurata: ${Math.floor(session.seconds / 60)} min`;
 
     // Trova tipo attività per colore e pattern
-    const activityTypeObj = activityTypes.find(t => t.name === activityTypeName);
+    const activityTypeObj = activityTypes.find(t => t.name === activityTypeName)
+        || archivedActivityTypes.find(t => t.name === activityTypeName);
     let bgStyle = 'background: #ffffff;';
 
     // Se il tipo attività è "Nessuna" (null/vuoto), usa arancione semi-trasparente
@@ -792,6 +1005,32 @@ function createTimelineSegment(session, startTime, totalMs) {
     `;
 }
 
+// parseLocalTimestamp converte un timestamp "2025-01-15 14:30:00" (ora locale) in Date
+function parseLocalTimestamp(value) {
+    const [datePart, timePart] = value.split(' ');
+    const [year, month, day] = datePart.split('-').map(Number);
+    const [hours, minutes, seconds] = timePart.split(':').map(Number);
+    return new Date(year, month - 1, day, hours, minutes, seconds || 0);
+}
+
+function createPauseSegment(pause, startTime, totalMs, label = 'Pausa', cssClass = 'timeline-pause') {
+    const pauseStart = parseLocalTimestamp(pause.start_time);
+    // Pausa in corso: fino ad adesso
+    const pauseEnd = pause.end_time ? parseLocalTimestamp(pause.end_time) : new Date();
+
+    const left = ((pauseStart - startTime) / totalMs) * 100;
+    const width = ((pauseEnd - pauseStart) / totalMs) * 100;
+    const minutes = Math.floor((pauseEnd - pauseStart) / 60000);
+    const timeStr = `${String(pauseStart.getHours()).padStart(2, '0')}:${String(pauseStart.getMinutes()).padStart(2, '0')}`;
+
+    return `
+        <div class="${cssClass}"
+             style="left: ${left}%; width: ${Math.max(width, 0.2)}%;"
+             title="${label}\nInizio: ${timeStr}\nDurata: ${minutes} min">
+        </div>
+    `;
+}
+
 function formatDate(dateStr) {
     const date = new Date(dateStr);
     return `${date.getDate()}/${date.getMonth() + 1}/${date.getFullYear()}`;
@@ -1064,7 +1303,7 @@ window.splitSessionDialog = async function(sessionID, totalSeconds, currentActiv
     const secondSelect = document.getElementById('splitSessionSecondType');
     firstSelect.innerHTML = '<option value="">Nessuno</option>';
     secondSelect.innerHTML = '<option value="">Nessuno</option>';
-    activityTypes.forEach(type => {
+    selectableActivityTypes(currentActivityType).forEach(type => {
         const firstSelected = type.name === currentActivityType ? 'selected' : '';
         firstSelect.innerHTML += `<option value="${escapeHtml(type.name)}" ${firstSelected}>${escapeHtml(type.name)}</option>`;
         secondSelect.innerHTML += `<option value="${escapeHtml(type.name)}">${escapeHtml(type.name)}</option>`;
@@ -1135,7 +1374,7 @@ window.editActivityType = async function(sessionID, currentActivityType, project
     // Popola select con tipi attività
     const select = document.getElementById('editSessionActivitySelect');
     select.innerHTML = '<option value="">Nessuno</option>';
-    activityTypes.forEach(type => {
+    selectableActivityTypes(currentActivityType).forEach(type => {
         const selected = type.name === currentActivityType ? 'selected' : '';
         select.innerHTML += `<option value="${escapeHtml(type.name)}" ${selected}>${escapeHtml(type.name)}</option>`;
     });
@@ -1251,9 +1490,9 @@ window.openEditSessionUnifiedModal = async function(sessionID) {
         const startTime = parseSessionTimestamp(session.timestamp);
         const endTime = new Date(startTime.getTime() + session.seconds * 1000);
 
-        // Mostra periodo corrente
+        // Mostra periodo corrente con la fine reale, che include pause e inattività
         const startStr = formatTimeHHMM(startTime);
-        const endStr = formatTimeHHMM(endTime);
+        const endStr = formatTimeHHMM(session.ended_at ? parseSessionTimestamp(session.ended_at) : endTime);
         document.getElementById('editSessionUnifiedCurrentPeriod').textContent = `${startStr} - ${endStr}`;
 
         // Popola i selettori di ore e minuti
@@ -1284,7 +1523,7 @@ window.openEditSessionUnifiedModal = async function(sessionID) {
         firstTypeSelect.innerHTML = '<option value="">Nessuno</option>';
         secondTypeSelect.innerHTML = '<option value="">Nessuno</option>';
 
-        activityTypes.forEach(type => {
+        selectableActivityTypes(session.activity_type).forEach(type => {
             const selected = type.name === session.activity_type ? 'selected' : '';
             activitySelect.innerHTML += `<option value="${escapeHtml(type.name)}" ${selected}>${escapeHtml(type.name)}</option>`;
             const firstSelected = type.name === session.activity_type ? 'selected' : '';
@@ -1786,7 +2025,10 @@ window.showSection = function(section) {
         navSettings.classList.add('active');
         loadSettingsActivityTypes();
         loadIdleThreshold();
+        loadTimeZone();
         loadAutostartStatus();
+        loadCSVExportOptions();
+        loadTimesheetPeriod();
     }
 }
 
@@ -1801,6 +2043,15 @@ async function loadIdleThreshold() {
     }
 }
 
+// Carica il fuso orario configurato
+async function loadTimeZone() {
+    try {
+        document.getElementById('timeZoneSetting').value = await GetTimeZone();
+    } catch (error) {
+        console.error('Errore caricamento fuso orario:', error);
+    }
+}
+
 // === GESTIONE ARCHIVIO ===
 
 async function loadArchivedProjects() {
@@ -1936,6 +2187,9 @@ async function loadSettingsActivityTypes() {
         const types = await GetActivityTypes();
         activityTypes = types || [];
         displaySettingsActivityTypes(activityTypes);
+
+        archivedActivityTypes = (await GetArchivedActivityTypes()) || [];
+        displayArchivedActivityTypes(archivedActivityTypes);
     } catch (error) {
         console.error('Errore caricamento tipi attività:', error);
     }
@@ -1970,7 +2224,7 @@ function displaySettingsActivityTypes(types) {
                 </div>
                 <div style="display: flex; gap: 10px;">
                     <button class="btn" style="width: auto; padding: 8px 16px; margin: 0;" onclick="editActivityTypeInSettings(${type.id})">Modifica</button>
-                    <button class="btn" style="width: auto; padding: 8px 16px; margin: 0; background: #ef4444; color: white;" onclick="deleteActivityTypeById(${type.id}, '${type.name.replace(/'/g, "\\'")}')">Elimina</button>
+                    <button class="btn" style="width: auto; padding: 8px 16px; margin: 0; background: #ef4444; color: white;" onclick="archiveActivityTypeById(${type.id}, '${type.name.replace(/'/g, "\\'")}')">Archivia</button>
                 </div>
             </div>
         `;
@@ -1980,6 +2234,27 @@ function displaySettingsActivityTypes(types) {
     initializeDragAndDrop();
 }
 
+function displayArchivedActivityTypes(types) {
+    const container = document.getElementById('archivedActivityTypesList');
+    if (!container) return;
+
+    if (!types || types.length === 0) {
+        container.innerHTML = '<p style="color: #6b7280;">Nessun tipo di attività archiviato</p>';
+        return;
+    }
+
+    container.innerHTML = types.map(type => `
+        <div class="activity-type-item" data-id="${type.id}">
+            <div style="flex: 1;">
+                <strong style="font-size: 1.1em; color: #999999;">${escapeHtml(type.name)}</strong>
+            </div>
+            <div style="display: flex; gap: 10px;">
+                <button class="btn btn-success" style="width: auto; padding: 8px 16px; margin: 0;" onclick="reactivateActivityTypeById(${type.id})">Riattiva</button>
+            </div>
+        </div>
+    `).join('');
+}
+
 // Inizializza drag and drop
 function initializeDragAndDrop() {
     const items = document.querySelectorAll('.activity-type-item');
@@ -2177,14 +2452,26 @@ window.saveActivityType = async function() {
     }
 }
 
-window.deleteActivityTypeById = async function(id, name) {
+window.archiveActivityTypeById = async function(id, name) {
     try {
-        await DeleteActivityType(id);
-        showNotification('Tipo attività eliminato!', 'success');
+        await ArchiveActivityType(id);
+        showNotification(`Tipo attività "${name}" archiviato: le sessioni esistenti lo mantengono`, 'success');
         await loadSettingsActivityTypes();
         await loadActivityTypes();
     } catch (error) {
-        console.error('Errore eliminazione:', error);
+        console.error('Errore archiviazione:', error);
+        showNotification('Errore: ' + (error.message || error), 'error');
+    }
+}
+
+window.reactivateActivityTypeById = async function(id) {
+    try {
+        await ReactivateActivityType(id);
+        showNotification('Tipo attività riattivato!', 'success');
+        await loadSettingsActivityTypes();
+        await loadActivityTypes();
+    } catch (error) {
+        console.error('Errore riattivazione:', error);
         showNotification('Errore: ' + (error.message || error), 'error');
     }
 }
@@ -2206,6 +2493,68 @@ window.saveIdleThreshold = async function() {
     }
 }
 
+window.saveTimeZone = async function() {
+    const timeZone = document.getElementById('timeZoneSetting').value.trim();
+    try {
+        await SetTimeZone(timeZone);
+        await loadTimeZone();
+        showNotification('Fuso orario salvato!', 'success');
+        await loadTimeline();
+    } catch (error) {
+        console.error('Errore salvataggio fuso orario:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
+// === INTEGRITÀ DATI ===
+
+// Controlla l'integrità delle sessioni e mostra l'anteprima delle correzioni
+window.checkIntegrity = async function() {
+    try {
+        const report = await CheckIntegrity(false);
+        displayIntegrityReport(report);
+    } catch (error) {
+        console.error('Errore controllo integrità:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
+// Applica le correzioni mostrate nell'anteprima
+window.fixIntegrity = async function() {
+    try {
+        const report = await CheckIntegrity(true);
+        showNotification(`${report.fixable} correzioni applicate!`, 'success');
+        await window.checkIntegrity();
+        await loadTimeline();
+    } catch (error) {
+        console.error('Errore correzione integrità:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
+function displayIntegrityReport(report) {
+    const container = document.getElementById('integrityResults');
+    const fixButton = document.getElementById('integrityFixButton');
+    const issues = report.issues || [];
+
+    fixButton.style.display = report.fixable > 0 ? 'inline-block' : 'none';
+    fixButton.textContent = `Applica ${report.fixable} correzioni`;
+
+    if (issues.length === 0) {
+        container.innerHTML = '<p style="color: #10b981;">Nessun problema trovato</p>';
+        return;
+    }
+
+    container.innerHTML = issues.map(issue => `
+        <div style="padding: 10px 0; border-bottom: 1px solid #333333;">
+            <div style="color: #ffffff;">${escapeHtml(issue.description)}</div>
+            <div style="color: ${issue.fix ? '#f59e0b' : '#999999'}; font-size: 0.9em; margin-top: 4px;">
+                ${issue.fix ? '→ ' + escapeHtml(issue.fix) : 'Da correggere a mano'}
+            </div>
+        </div>
+    `).join('');
+}
+
 // === EXPORT/IMPORT ===
 
 window.exportData = async function() {
@@ -2225,15 +2574,132 @@ window.exportData = async function() {
     }
 }
 
+// === ESPORTAZIONE CSV ===
+
+// Prepara periodo (mese corrente) e progetti, anche archiviati, dell'esportazione CSV
+async function loadCSVExportOptions() {
+    const startInput = document.getElementById('csvStartDate');
+    const endInput = document.getElementById('csvEndDate');
+    if (!startInput.value || !endInput.value) {
+        const today = new Date();
+        const firstDay = new Date(today.getFullYear(), today.getMonth(), 1);
+        startInput.value = formatDateYYYYMMDD(firstDay);
+        endInput.value = formatDateYYYYMMDD(today);
+    }
+
+    try {
+        const [active, archived] = await Promise.all([GetProjects(), GetArchivedProjects()]);
+        const select = document.getElementById('csvProject');
+        const selected = select.value;
+        select.innerHTML = '<option value="">Tutti i progetti</option>';
+        [...(active || []), ...(archived || [])].forEach(project => {
+            const option = document.createElement('option');
+            option.value = project.id;
+            option.textContent = project.archived ? `${project.name} (archiviato)` : project.name;
+            select.appendChild(option);
+        });
+        select.value = selected;
+    } catch (error) {
+        console.error('Errore caricamento progetti per CSV:', error);
+    }
+}
+
+window.exportSessionsCSV = async function() {
+    const startDate = document.getElementById('csvStartDate').value;
+    const endDate = document.getElementById('csvEndDate').value;
+    if (!startDate || !endDate || startDate > endDate) {
+        showNotification('Seleziona un periodo valido', 'error');
+        return;
+    }
+
+    const columns = Array.from(document.querySelectorAll('#csvColumns input:checked')).map(input => input.value);
+    if (columns.length === 0) {
+        showNotification('Seleziona almeno una colonna', 'error');
+        return;
+    }
+
+    const projectValue = document.getElementById('csvProject').value;
+    try {
+        const filePath = await ExportSessionsCSV({
+            start_date: startDate,
+            end_date: endDate,
+            project_id: projectValue ? parseInt(projectValue) : null,
+            columns: columns,
+            duration_format: document.getElementById('csvDurationFormat').value,
+            locale: document.getElementById('csvLocale').value
+        });
+        if (filePath) {
+            showNotification('Sessioni esportate!', 'success');
+        }
+    } catch (error) {
+        console.error('Errore esportazione CSV:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
+// === TIMESHEET EXCEL ===
+
+// Propone come periodo del timesheet il mese precedente
+function loadTimesheetPeriod() {
+    const startInput = document.getElementById('timesheetStartDate');
+    const endInput = document.getElementById('timesheetEndDate');
+    if (startInput.value && endInput.value) return;
+
+    const today = new Date();
+    startInput.value = formatDateYYYYMMDD(new Date(today.getFullYear(), today.getMonth() - 1, 1));
+    endInput.value = formatDateYYYYMMDD(new Date(today.getFullYear(), today.getMonth(), 0));
+}
+
+window.exportTimesheetXLSX = async function() {
+    const startDate = document.getElementById('timesheetStartDate').value;
+    const endDate = document.getElementById('timesheetEndDate').value;
+    if (!startDate || !endDate || startDate > endDate) {
+        showNotification('Seleziona un periodo valido', 'error');
+        return;
+    }
+
+    try {
+        const filePath = await ExportTimesheetXLSX(startDate, endDate);
+        if (filePath) {
+            showNotification('Timesheet esportato!', 'success');
+        }
+    } catch (error) {
+        console.error('Errore esportazione timesheet:', error);
+        showNotification('Errore: ' + error, 'error');
+    }
+}
+
+// Contenuto del backup selezionato, in attesa di conferma dopo l'anteprima
+let pendingImport = null;
+
+// Legge il backup e mostra l'anteprima dell'unione con i dati esistenti
 window.importDataFromFile = async function(event) {
     const file = event.target.files[0];
     if (!file) return;
 
     try {
         const text = await file.text();
-        const data = JSON.parse(text);
+        const report = await ImportData(text, true);
+        pendingImport = text;
+        displayImportReport(report);
+    } catch (error) {
+        console.error('Errore import:', error);
+        showNotification('Errore import: ' + error, 'error');
+        pendingImport = null;
+        displayImportReport(null);
+    }
+
+    event.target.value = '';
+}
 
-        await ImportData(data);
+// Applica l'importazione mostrata nell'anteprima
+window.confirmImport = async function() {
+    if (!pendingImport) return;
+
+    try {
+        const report = await ImportData(pendingImport, false);
+        pendingImport = null;
+        displayImportReport(report);
         showNotification('Dati importati con successo!', 'success');
         await loadSettingsActivityTypes();
         await loadActivityTypes();
@@ -2242,8 +2708,40 @@ window.importDataFromFile = async function(event) {
         console.error('Errore import:', error);
         showNotification('Errore import: ' + error, 'error');
     }
+}
 
-    event.target.value = '';
+function displayImportReport(report) {
+    const container = document.getElementById('importResults');
+    const confirmButton = document.getElementById('importConfirmButton');
+
+    confirmButton.style.display = report && report.dry_run ? 'inline-block' : 'none';
+    if (!report) {
+        container.innerHTML = '';
+        return;
+    }
+
+    const rows = [
+        ['Progetti', report.projects],
+        ['Tipi attività', report.activity_types],
+        ['Sessioni', report.sessions],
+        ['Note', report.notes],
+        ['Impostazioni', report.settings],
+        ['Periodi idle in attesa', report.idle_periods]
+    ].map(([label, c]) => `
+        <div style="color: #ffffff; padding: 4px 0;">
+            ${label}: ${c.inserted} nuovi, ${c.updated} aggiornati, ${c.skipped} già presenti
+        </div>
+    `).join('');
+
+    const conflicts = (report.conflicts || []).map(c => `
+        <div style="color: #f59e0b; font-size: 0.9em; padding: 4px 0;">${escapeHtml(c.description)}</div>
+    `).join('');
+
+    container.innerHTML = `
+        <p style="color: #999999; margin-bottom: 8px;">${report.dry_run ? 'Anteprima importazione' : 'Importazione completata'}</p>
+        ${rows}
+        ${conflicts ? `<p style="color: #999999; margin: 10px 0 4px 0;">Conflitti (mantenuti i dati locali):</p>${conflicts}` : ''}
+    `;
 }
 
 // === AUTOSTART ===
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	_ "time/tzdata" // database dei fusi orari incluso: su Windows non è disponibile nel sistema
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -49,6 +50,11 @@ func main() {
 		log.Fatal("Errore DB:", err)
 	}
 
+	// Fuso orario in cui calcolare giorni, settimane e mesi
+	if err := tracker.CaricaFusoOrario(db); err != nil {
+		log.Printf("[STARTUP] Errore caricamento fuso orario: %v\n", err)
+	}
+
 	// Recupera sessioni pendenti da crash precedenti
 	recovered, err := tracker.RecoverPendingTracking(db)
 	if err != nil {
@@ -57,13 +63,18 @@ func main() {
 		log.Printf("[STARTUP] Recuperate %d sessioni da chiusure anomale precedenti\n", recovered)
 	}
 
+	// Periodi idle non ancora attribuiti prima della chiusura
+	pendingIdle, err := tracker.RecoverPendingIdlePeriods(db)
+	if err != nil {
+		log.Printf("[STARTUP] Errore recupero periodi idle pendenti: %v\n", err)
+	} else if pendingIdle > 0 {
+		log.Printf("[STARTUP] %d periodi idle in attesa di attribuzione\n", pendingIdle)
+	}
+
 	// Crea istanza App
 	app := NewApp()
 	app.SetDB(db)
 
-	// Inizializza variabili globali per tracking (carica anche idle threshold dal DB)
-	InitGlobalState(db)
-
 	// Crea applicazione Wails
 	err = wails.Run(&options.App{
 		Title:            "PrendiTempo",
@@ -79,10 +90,7 @@ func main() {
 		BackgroundColour: &options.RGBA{R: 26, G: 26, B: 26, A: 1},
 		OnStartup:        app.startup,
 		OnShutdown: func(ctx context.Context) {
-			// Ferma tracking se attivo
-			if globalIsTracking {
-				app.StopTracking()
-			}
+			app.shutdown(ctx)
 			db.Close()
 		},
 		Bind: []interface{}{
@@ -0,0 +1,367 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BackupVersion è la versione corrente del formato di backup. Storico:
+//   - 1.0: timestamp delle sessioni in ora locale
+//   - 1.1: timestamp in UTC RFC3339
+//   - 2.0: formato unico per backup completi e report di progetto, con impostazioni,
+//     periodi idle in attesa e note dei progetti; validato con BackupSchema
+//   - 2.1: identificativo globale (UUID) di progetti, sessioni, note e tipi di attività
+const BackupVersion = "2.1"
+
+// Tipi di export
+const (
+	ExportFull    = "full"    // backup completo
+	ExportProject = "project" // report di un singolo progetto
+)
+
+// legacyProjectReport è il tipo di export dei report di progetto prima della 2.0
+const legacyProjectReport = "project_report"
+
+// maxErroriValidazione è il numero massimo di errori di validazione riportati per esteso
+const maxErroriValidazione = 10
+
+// impostazioniEscluse sono le impostazioni legate al computer, non esportate
+var impostazioniEscluse = map[string]bool{
+	"auto_start": true,
+}
+
+// Backup è il contenuto di un file di backup o di report di progetto
+type Backup struct {
+	Version            string               `json:"version" desc:"Versione del formato" enum:"2.1"`
+	ExportType         string               `json:"export_type" enum:"full,project"`
+	ExportDate         string               `json:"export_date" format:"date-time"`
+	Projects           []BackupProject      `json:"projects,omitempty"`
+	Sessions           []BackupSession      `json:"sessions,omitempty"`
+	Notes              []BackupNote         `json:"notes,omitempty" desc:"Note legacy dei progetti"`
+	ActivityTypes      []BackupActivityType `json:"activity_types,omitempty"`
+	Settings           map[string]string    `json:"settings,omitempty" desc:"Impostazioni, solo nei backup completi"`
+	PendingIdlePeriods []BackupIdlePeriod   `json:"pending_idle_periods,omitempty" desc:"Periodi idle o sospesi in attesa di attribuzione"`
+	Report             *BackupReport        `json:"report,omitempty" desc:"Riepilogo, solo nei report di progetto"`
+}
+
+// BackupProject è un progetto nel backup
+type BackupProject struct {
+	ID          int    `json:"id" desc:"ID nel database di origine, usato dai riferimenti nel file"`
+	UUID        string `json:"uuid,omitempty" desc:"Identificativo globale, uguale su tutti i computer"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	NoteText    string `json:"note_text,omitempty" desc:"Note markdown del progetto"`
+	CreatedAt   string `json:"created_at,omitempty" format:"date-time"`
+	Archived    bool   `json:"archived"`
+	ClosedAt    string `json:"closed_at,omitempty" format:"date-time"`
+}
+
+// BackupSession è una sessione nel backup; ProjectID è l'ID del progetto nel backup
+type BackupSession struct {
+	ID           int     `json:"id"`
+	UUID         string  `json:"uuid,omitempty"`
+	AppName      string  `json:"app_name"`
+	Seconds      int     `json:"seconds"`
+	ProjectID    *int    `json:"project_id,omitempty"`
+	SessionType  string  `json:"session_type"`
+	ActivityType *string `json:"activity_type,omitempty" desc:"Nome del tipo di attività"`
+	Timestamp    string  `json:"timestamp" format:"date-time" desc:"Inizio della sessione"`
+	EndedAt      string  `json:"ended_at,omitempty" format:"date-time" desc:"Fine reale della sessione"`
+	TimeZone     string  `json:"time_zone,omitempty" desc:"Fuso orario IANA in cui è stata registrata"`
+}
+
+// BackupNote è una nota legacy di progetto nel backup
+type BackupNote struct {
+	ID        int    `json:"id"`
+	UUID      string `json:"uuid,omitempty"`
+	ProjectID int    `json:"project_id"`
+	NoteText  string `json:"note_text"`
+	Timestamp string `json:"timestamp" format:"date-time"`
+}
+
+// BackupActivityType è un tipo di attività nel backup
+type BackupActivityType struct {
+	ID           int     `json:"id"`
+	UUID         string  `json:"uuid,omitempty"`
+	Name         string  `json:"name"`
+	ColorVariant float64 `json:"color_variant"`
+	Pattern      string  `json:"pattern" desc:"Pattern di riempimento nella timeline (solid, stripes, dots)"`
+	DisplayOrder int     `json:"display_order"`
+	Archived     bool    `json:"archived"`
+}
+
+// BackupIdlePeriod è un periodo idle o sospeso in attesa di attribuzione
+type BackupIdlePeriod struct {
+	Type      string `json:"period_type" enum:"idle,suspended"`
+	StartTime string `json:"start_time" format:"date-time"`
+	EndTime   string `json:"end_time" format:"date-time"`
+	Seconds   int    `json:"seconds"`
+}
+
+// BackupReport è il riepilogo di un report di progetto (ricalcolato all'importazione)
+type BackupReport struct {
+	TotalHours        float64            `json:"total_hours"`
+	StartDate         string             `json:"start_date,omitempty" format:"date-time"`
+	EndDate           string             `json:"end_date,omitempty" format:"date-time"`
+	ActivityBreakdown map[string]float64 `json:"activity_breakdown,omitempty" desc:"Ore per tipo di attività"`
+}
+
+// === LETTURA E AGGIORNAMENTO ===
+
+// backupUpgrade aggiorna un backup da una versione alla successiva
+type backupUpgrade struct {
+	from, to string
+	apply    func(b *Backup) error
+}
+
+// backupUpgrades sono gli aggiornamenti di formato, applicati in ordine
+var backupUpgrades = []backupUpgrade{
+	{"1.0", "1.1", aggiornaBackupDa10},
+	{"1.1", "2.0", aggiornaBackupDa11},
+	{"2.0", "2.1", aggiornaBackupDa20},
+}
+
+// LeggiBackup decodifica, aggiorna alla versione corrente e valida un file di backup o di
+// report di progetto. I file nella versione corrente vengono prima validati con BackupSchema.
+func LeggiBackup(data []byte) (*Backup, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("backup non valido: %v", err)
+	}
+	header, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("backup non valido: il contenuto deve essere un oggetto JSON")
+	}
+	version, _ := header["version"].(string)
+	exportType, _ := header["export_type"].(string)
+
+	var b *Backup
+	var err error
+	switch {
+	case version == BackupVersion:
+		if errs := validaSchema(BackupSchema(), raw, "$"); len(errs) > 0 {
+			return nil, erroreValidazione(errs)
+		}
+		err = json.Unmarshal(data, &b)
+	case exportType == legacyProjectReport:
+		b, err = leggiReportProgettoLegacy(data)
+	default:
+		err = json.Unmarshal(data, &b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backup non valido: %v", err)
+	}
+
+	if err := aggiornaBackup(b); err != nil {
+		return nil, err
+	}
+	if err := b.valida(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// aggiornaBackup porta un backup alla versione corrente
+func aggiornaBackup(b *Backup) error {
+	if b.Version == "" {
+		b.Version = "1.0"
+	}
+	for _, u := range backupUpgrades {
+		if b.Version != u.from {
+			continue
+		}
+		if err := u.apply(b); err != nil {
+			return fmt.Errorf("errore aggiornamento backup dalla versione %s: %v", u.from, err)
+		}
+		b.Version = u.to
+	}
+	if b.Version != BackupVersion {
+		return fmt.Errorf("versione backup non supportata: %s", b.Version)
+	}
+	return nil
+}
+
+// aggiornaBackupDa10 converte in UTC gli orari delle sessioni, salvati in ora locale anche
+// quando terminano con "Z" (progetti e note erano già in UTC)
+func aggiornaBackupDa10(b *Backup) error {
+	for i := range b.Sessions {
+		s := &b.Sessions[i]
+		var err error
+		if s.Timestamp, err = NormalizzaTimestampEsportato(s.Timestamp, true); err != nil {
+			return fmt.Errorf("sessione %d: %v", i+1, err)
+		}
+		if s.EndedAt != "" {
+			if s.EndedAt, err = NormalizzaTimestampEsportato(s.EndedAt, true); err != nil {
+				return fmt.Errorf("sessione %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// aggiornaBackupDa11 assegna il tipo di export, introdotto con la 2.0
+func aggiornaBackupDa11(b *Backup) error {
+	if b.ExportType == "" {
+		b.ExportType = ExportFull
+	}
+	return nil
+}
+
+// aggiornaBackupDa20 non modifica i dati: senza UUID le entità vengono riconosciute per nome
+// (o per inizio, le sessioni) e ricevono un nuovo UUID all'importazione
+func aggiornaBackupDa20(b *Backup) error {
+	return nil
+}
+
+// leggiReportProgettoLegacy converte un report di progetto precedente la 2.0, con i dati del
+// progetto al primo livello, in un backup con un solo progetto
+func leggiReportProgettoLegacy(data []byte) (*Backup, error) {
+	var report struct {
+		Version            string          `json:"version"`
+		ExportDate         string          `json:"export_date"`
+		ProjectID          int             `json:"project_id"`
+		ProjectName        string          `json:"project_name"`
+		ProjectDescription string          `json:"project_description"`
+		NoteText           string          `json:"note_text"`
+		CreatedAt          string          `json:"created_at"`
+		ClosedAt           string          `json:"closed_at"`
+		Sessions           []BackupSession `json:"sessions"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	b := &Backup{
+		Version:    report.Version,
+		ExportType: ExportProject,
+		ExportDate: report.ExportDate,
+		Projects: []BackupProject{{
+			ID:          report.ProjectID,
+			Name:        report.ProjectName,
+			Description: report.ProjectDescription,
+			NoteText:    report.NoteText,
+			CreatedAt:   report.CreatedAt,
+			ClosedAt:    report.ClosedAt,
+		}},
+		Sessions: report.Sessions,
+	}
+	// Le sessioni del report appartengono tutte al progetto
+	for i := range b.Sessions {
+		projectID := report.ProjectID
+		b.Sessions[i].ProjectID = &projectID
+	}
+	return b, nil
+}
+
+// valida controlla la coerenza del backup e normalizza i timestamp, raccogliendo tutti gli errori
+func (b *Backup) valida() error {
+	var errs []string
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	normalize := func(value *string, format string, args ...interface{}) {
+		if *value == "" {
+			return
+		}
+		normalized, err := NormalizzaTimestamp(*value)
+		if err != nil {
+			addErr(format+": %v", append(args, err)...)
+			return
+		}
+		*value = normalized
+	}
+
+	if b.ExportType != ExportFull && b.ExportType != ExportProject {
+		addErr("tipo di export sconosciuto '%s'", b.ExportType)
+	}
+	if b.ExportType == ExportProject && len(b.Projects) != 1 {
+		addErr("un report di progetto deve contenere un solo progetto, trovati %d", len(b.Projects))
+	}
+
+	projectIDs := make(map[int]bool)
+	for i := range b.Projects {
+		p := &b.Projects[i]
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			addErr("progetto %d: nome mancante", i+1)
+		}
+		if projectIDs[p.ID] {
+			addErr("progetto '%s': ID %d duplicato", p.Name, p.ID)
+		}
+		projectIDs[p.ID] = true
+		normalize(&p.CreatedAt, "progetto '%s'", p.Name)
+		normalize(&p.ClosedAt, "progetto '%s'", p.Name)
+	}
+
+	typeNames := make(map[string]bool)
+	for i := range b.ActivityTypes {
+		t := &b.ActivityTypes[i]
+		t.Name = strings.TrimSpace(t.Name)
+		if t.Name == "" {
+			addErr("tipo attività %d: nome mancante", i+1)
+		}
+		if typeNames[t.Name] {
+			addErr("tipo attività '%s' duplicato", t.Name)
+		}
+		typeNames[t.Name] = true
+		if t.Pattern == "" {
+			t.Pattern = "solid"
+		}
+	}
+
+	for i := range b.Sessions {
+		s := &b.Sessions[i]
+		if s.Seconds < 0 {
+			addErr("sessione %d: durata negativa (%d secondi)", i+1, s.Seconds)
+		}
+		if s.Timestamp == "" {
+			addErr("sessione %d: inizio mancante", i+1)
+		}
+		if s.SessionType == "" {
+			s.SessionType = "manual"
+		}
+		if s.ActivityType != nil && strings.TrimSpace(*s.ActivityType) == "" {
+			s.ActivityType = nil
+		}
+		if s.TimeZone == "" {
+			// Sessioni senza fuso (export 1.0) sono state registrate nel fuso configurato
+			s.TimeZone = TimeZoneName()
+		}
+		normalize(&s.Timestamp, "sessione %d", i+1)
+		normalize(&s.EndedAt, "sessione %d", i+1)
+	}
+
+	for i := range b.Notes {
+		n := &b.Notes[i]
+		if n.Timestamp == "" {
+			addErr("nota %d: timestamp mancante", i+1)
+		}
+		normalize(&n.Timestamp, "nota %d", i+1)
+	}
+
+	for i := range b.PendingIdlePeriods {
+		p := &b.PendingIdlePeriods[i]
+		if p.Type != PeriodIdle && p.Type != PeriodSuspended {
+			addErr("periodo idle %d: tipo sconosciuto '%s'", i+1, p.Type)
+		}
+		if p.Seconds <= 0 {
+			addErr("periodo idle %d: durata non valida (%d secondi)", i+1, p.Seconds)
+		}
+		normalize(&p.StartTime, "periodo idle %d", i+1)
+		normalize(&p.EndTime, "periodo idle %d", i+1)
+	}
+
+	if len(errs) > 0 {
+		return erroreValidazione(errs)
+	}
+	return nil
+}
+
+// erroreValidazione riunisce gli errori di validazione in un unico errore
+func erroreValidazione(errs []string) error {
+	if len(errs) > maxErroriValidazione {
+		errs = append(errs[:maxErroriValidazione], fmt.Sprintf("e altri %d errori", len(errs)-maxErroriValidazione))
+	}
+	return fmt.Errorf("backup non valido: %s", strings.Join(errs, "; "))
+}
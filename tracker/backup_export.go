@@ -0,0 +1,209 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// EsportaBackup esporta tutti i dati nel formato di backup corrente
+func EsportaBackup(db *sql.DB) (*Backup, error) {
+	b := &Backup{
+		Version:    BackupVersion,
+		ExportType: ExportFull,
+		ExportDate: FormatTimestamp(now()),
+	}
+
+	var err error
+	if b.Projects, err = esportaProgetti(db, ``); err != nil {
+		return nil, err
+	}
+	if b.Sessions, err = esportaSessioni(db, ``); err != nil {
+		return nil, err
+	}
+	if b.Notes, err = esportaNote(db, ``); err != nil {
+		return nil, err
+	}
+	if b.ActivityTypes, err = esportaTipiAttivita(db, ``); err != nil {
+		return nil, err
+	}
+	if b.Settings, err = esportaImpostazioni(db); err != nil {
+		return nil, err
+	}
+	if b.PendingIdlePeriods, err = esportaPeriodiPendenti(db); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[DB] Backup esportato: %d progetti, %d sessioni, %d tipi attività\n", len(b.Projects), len(b.Sessions), len(b.ActivityTypes))
+	return b, nil
+}
+
+// EsportaProgetto esporta un progetto con sessioni, note, tipi di attività usati e riepilogo
+func EsportaProgetto(db *sql.DB, projectID int) (*Backup, error) {
+	b := &Backup{
+		Version:    BackupVersion,
+		ExportType: ExportProject,
+		ExportDate: FormatTimestamp(now()),
+	}
+
+	var err error
+	if b.Projects, err = esportaProgetti(db, `WHERE id = ?`, projectID); err != nil {
+		return nil, err
+	}
+	if len(b.Projects) == 0 {
+		return nil, fmt.Errorf("progetto con ID %d non trovato", projectID)
+	}
+	if b.Sessions, err = esportaSessioni(db, `WHERE s.project_id = ?`, projectID); err != nil {
+		return nil, err
+	}
+	if b.Notes, err = esportaNote(db, `WHERE project_id = ?`, projectID); err != nil {
+		return nil, err
+	}
+	b.ActivityTypes, err = esportaTipiAttivita(db, `WHERE id IN (SELECT activity_type_id FROM sessions WHERE project_id = ?)`, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := GeneraReportChiusura(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	b.Report = &BackupReport{}
+	b.Report.TotalHours, _ = report["total_hours"].(float64)
+	b.Report.StartDate, _ = report["start_date"].(string)
+	b.Report.EndDate, _ = report["end_date"].(string)
+	b.Report.ActivityBreakdown, _ = report["activity_breakdown"].(map[string]float64)
+
+	return b, nil
+}
+
+// esportaProgetti carica i progetti (where opzionale)
+func esportaProgetti(db *sql.DB, where string, args ...interface{}) ([]BackupProject, error) {
+	query := `SELECT id, COALESCE(uuid, ''), name, COALESCE(description, ''), COALESCE(note_text, ''), COALESCE(created_at, ''), archived, COALESCE(closed_at, '') FROM projects ` + where + ` ORDER BY id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore esportazione progetti: %v", err)
+	}
+	defer rows.Close()
+
+	var projects []BackupProject
+	for rows.Next() {
+		var p BackupProject
+		if err := rows.Scan(&p.ID, &p.UUID, &p.Name, &p.Description, &p.NoteText, &p.CreatedAt, &p.Archived, &p.ClosedAt); err != nil {
+			return nil, fmt.Errorf("errore lettura progetto: %v", err)
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// esportaSessioni carica le sessioni (where opzionale, alias s)
+func esportaSessioni(db *sql.DB, where string, args ...interface{}) ([]BackupSession, error) {
+	query := `
+	SELECT s.id, COALESCE(s.uuid, ''), COALESCE(s.app_name, ''), s.seconds, s.project_id, COALESCE(s.session_type, 'manual'), ` + sessionActivitySQL + `,
+		s.timestamp, COALESCE(s.ended_at, ''), COALESCE(s.time_zone, '')
+	FROM sessions s ` + where + `
+	ORDER BY s.timestamp, s.id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore esportazione sessioni: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []BackupSession
+	for rows.Next() {
+		var s BackupSession
+		var projectID sql.NullInt64
+		var activityType sql.NullString
+		if err := rows.Scan(&s.ID, &s.UUID, &s.AppName, &s.Seconds, &projectID, &s.SessionType, &activityType, &s.Timestamp, &s.EndedAt, &s.TimeZone); err != nil {
+			return nil, fmt.Errorf("errore lettura sessione: %v", err)
+		}
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			s.ProjectID = &id
+		}
+		if activityType.Valid {
+			s.ActivityType = &activityType.String
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// esportaNote carica le note legacy (where opzionale)
+func esportaNote(db *sql.DB, where string, args ...interface{}) ([]BackupNote, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(uuid, ''), project_id, note_text, timestamp FROM notes `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore esportazione note: %v", err)
+	}
+	defer rows.Close()
+
+	var notes []BackupNote
+	for rows.Next() {
+		var n BackupNote
+		if err := rows.Scan(&n.ID, &n.UUID, &n.ProjectID, &n.NoteText, &n.Timestamp); err != nil {
+			return nil, fmt.Errorf("errore lettura nota: %v", err)
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// esportaTipiAttivita carica i tipi di attività, anche archiviati (where opzionale)
+func esportaTipiAttivita(db *sql.DB, where string, args ...interface{}) ([]BackupActivityType, error) {
+	query := `SELECT id, COALESCE(uuid, ''), name, color_variant, COALESCE(pattern, 'solid'), display_order, archived FROM activity_types ` + where + ` ORDER BY display_order, id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore esportazione tipi attività: %v", err)
+	}
+	defer rows.Close()
+
+	var types []BackupActivityType
+	for rows.Next() {
+		var t BackupActivityType
+		if err := rows.Scan(&t.ID, &t.UUID, &t.Name, &t.ColorVariant, &t.Pattern, &t.DisplayOrder, &t.Archived); err != nil {
+			return nil, fmt.Errorf("errore lettura tipo attività: %v", err)
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// esportaImpostazioni carica le impostazioni, escluse quelle legate al computer
+func esportaImpostazioni(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(`SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, fmt.Errorf("errore esportazione impostazioni: %v", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("errore lettura impostazione: %v", err)
+		}
+		if !impostazioniEscluse[key] {
+			settings[key] = value
+		}
+	}
+	return settings, rows.Err()
+}
+
+// esportaPeriodiPendenti carica i periodi idle in attesa di attribuzione
+func esportaPeriodiPendenti(db *sql.DB) ([]BackupIdlePeriod, error) {
+	periods, err := CaricaPeriodiPendenti(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]BackupIdlePeriod, 0, len(periods))
+	for _, p := range periods {
+		result = append(result, BackupIdlePeriod{
+			Type:      p.Type,
+			StartTime: FormatTimestamp(p.StartTime),
+			EndTime:   FormatTimestamp(p.EndTime),
+			Seconds:   p.Duration,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,440 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// ImportCounts conta l'esito dell'importazione per un tipo di dato
+type ImportCounts struct {
+	Inserted int
+	Updated  int
+	Skipped  int // già presenti o in conflitto
+}
+
+// ImportConflict è un elemento del backup che differisce dai dati locali: si mantengono i
+// dati locali
+type ImportConflict struct {
+	Entity      string // "project", "activity_type", "session", "note", "setting" o "idle_period"
+	Description string
+}
+
+// ImportReport è l'esito (o l'anteprima) di un'importazione
+type ImportReport struct {
+	Projects      ImportCounts
+	ActivityTypes ImportCounts
+	Sessions      ImportCounts
+	Notes         ImportCounts
+	Settings      ImportCounts
+	IdlePeriods   ImportCounts
+	Conflicts     []ImportConflict
+	DryRun        bool
+}
+
+// ImportaBackup unisce il backup ai dati esistenti senza eliminare nulla. Ogni elemento
+// corrisponde prima a quello locale con lo stesso UUID e, se non c'è (o il backup è precedente
+// alla versione 2.1), secondo le regole seguenti:
+//   - progetti e tipi di attività corrispondono per nome; i campi vuoti in locale vengono
+//     completati dal backup, le differenze sono segnalate come conflitti (vince il dato locale)
+//   - una sessione corrisponde a una locale con lo stesso inizio: se identica viene saltata,
+//     altrimenti è un conflitto
+//   - una nota corrisponde a una dello stesso progetto con lo stesso timestamp
+//   - gli elementi inseriti mantengono l'UUID del backup
+//   - le impostazioni mancanti in locale vengono aggiunte, quelle diverse sono conflitti
+//   - un periodo idle in attesa corrisponde a uno dello stesso tipo con lo stesso inizio
+//
+// Con dryRun true l'importazione viene eseguita e annullata, restituendo solo l'anteprima.
+func ImportaBackup(db *sql.DB, b *Backup, dryRun bool) (*ImportReport, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("errore avvio importazione: %v", err)
+	}
+
+	report := &ImportReport{DryRun: dryRun}
+
+	projectIDs, err := importaProgetti(tx, report, b.Projects)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	typeIDs, err := importaTipiAttivita(tx, report, b.ActivityTypes)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := importaSessioni(tx, report, b.Sessions, projectIDs, typeIDs); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := importaNote(tx, report, b.Notes, projectIDs); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := importaImpostazioni(tx, report, b.Settings); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := importaPeriodiPendenti(tx, report, b.PendingIdlePeriods); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if dryRun {
+		tx.Rollback()
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("errore commit importazione: %v", err)
+	}
+
+	// Il fuso orario importato si applica subito; le altre impostazioni al prossimo avvio
+	if _, ok := b.Settings[timeZoneSettingKey]; ok {
+		if err := CaricaFusoOrario(db); err != nil {
+			fmt.Printf("[DB] Errore applicazione fuso orario importato: %v\n", err)
+		}
+	}
+
+	fmt.Printf("[DB] Importazione completata: %d progetti, %d tipi attività, %d sessioni, %d note inseriti, %d conflitti\n",
+		report.Projects.Inserted, report.ActivityTypes.Inserted, report.Sessions.Inserted, report.Notes.Inserted, len(report.Conflicts))
+	return report, nil
+}
+
+// conflitto aggiunge un conflitto al report
+func (r *ImportReport) conflitto(entity, format string, args ...interface{}) {
+	r.Conflicts = append(r.Conflicts, ImportConflict{Entity: entity, Description: fmt.Sprintf(format, args...)})
+}
+
+// importaProgetti unisce i progetti e restituisce la mappa ID del backup -> ID locale
+func importaProgetti(tx *sql.Tx, report *ImportReport, projects []BackupProject) (map[int]int64, error) {
+	ids := make(map[int]int64)
+	for _, p := range projects {
+		var id int64
+		var uuid, name, description, noteText, closedAt string
+		var archived bool
+		query := `
+		SELECT id, COALESCE(uuid, ''), name, COALESCE(description, ''), COALESCE(note_text, ''), archived, COALESCE(closed_at, '')
+		FROM projects WHERE uuid = ? OR name = ?
+		ORDER BY uuid = ? DESC LIMIT 1`
+		err := tx.QueryRow(query, p.UUID, p.Name, p.UUID).Scan(&id, &uuid, &name, &description, &noteText, &archived, &closedAt)
+
+		if err == sql.ErrNoRows {
+			createdAt := p.CreatedAt
+			if createdAt == "" {
+				createdAt = FormatTimestamp(now())
+			}
+			result, err := tx.Exec(`INSERT INTO projects (uuid, name, description, note_text, archived, closed_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				nullIfEmpty(p.UUID), p.Name, p.Description, p.NoteText, p.Archived, nullIfEmpty(p.ClosedAt), createdAt)
+			if err != nil {
+				return nil, fmt.Errorf("errore importazione progetto '%s': %v", p.Name, err)
+			}
+			if id, err = result.LastInsertId(); err != nil {
+				return nil, fmt.Errorf("errore recupero ID progetto '%s': %v", p.Name, err)
+			}
+			ids[p.ID] = id
+			report.Projects.Inserted++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("errore ricerca progetto '%s': %v", p.Name, err)
+		}
+		ids[p.ID] = id
+		if name != p.Name {
+			report.conflitto("project", "Progetto '%s': in locale si chiama '%s'", p.Name, name)
+		} else if p.UUID != "" && uuid != p.UUID {
+			report.conflitto("project", "Progetto '%s': stesso nome di un progetto locale con identificativo diverso, i dati vengono uniti", p.Name)
+		}
+
+		// Completa i campi vuoti in locale, segnala quelli diversi
+		updated := false
+		if description == "" && p.Description != "" {
+			description = p.Description
+			updated = true
+		} else if p.Description != "" && p.Description != description {
+			report.conflitto("project", "Progetto '%s': descrizione diversa da quella locale", p.Name)
+		}
+		if noteText == "" && p.NoteText != "" {
+			noteText = p.NoteText
+			updated = true
+		} else if p.NoteText != "" && p.NoteText != noteText {
+			report.conflitto("project", "Progetto '%s': note diverse da quelle locali", p.Name)
+		}
+		if closedAt == "" && p.ClosedAt != "" {
+			closedAt = p.ClosedAt
+			updated = true
+		}
+		if archived != p.Archived {
+			report.conflitto("project", "Progetto '%s': archiviato nel backup=%v, in locale=%v", p.Name, p.Archived, archived)
+		}
+
+		if !updated {
+			report.Projects.Skipped++
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE projects SET description = ?, note_text = ?, closed_at = ? WHERE id = ?`, description, noteText, nullIfEmpty(closedAt), id); err != nil {
+			return nil, fmt.Errorf("errore aggiornamento progetto '%s': %v", p.Name, err)
+		}
+		report.Projects.Updated++
+	}
+	return ids, nil
+}
+
+// importaTipiAttivita unisce i tipi di attività e restituisce la mappa nome -> ID locale.
+// I nuovi tipi vengono accodati a quelli esistenti, nell'ordine del backup.
+func importaTipiAttivita(tx *sql.Tx, report *ImportReport, types []BackupActivityType) (map[string]int64, error) {
+	ordered := make([]BackupActivityType, len(types))
+	copy(ordered, types)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].DisplayOrder < ordered[j].DisplayOrder })
+
+	// Anche i tipi locali assenti dal backup possono essere usati dalle sessioni importate
+	ids := make(map[string]int64)
+	rows, err := tx.Query(`SELECT id, name FROM activity_types`)
+	if err != nil {
+		return nil, fmt.Errorf("errore query tipi attività: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("errore lettura tipo attività: %v", err)
+		}
+		ids[name] = id
+	}
+	rows.Close()
+
+	for _, t := range ordered {
+		var id int64
+		var name string
+		var colorVariant float64
+		var pattern string
+		var archived bool
+		query := `
+		SELECT id, name, color_variant, COALESCE(pattern, 'solid'), archived
+		FROM activity_types WHERE uuid = ? OR name = ?
+		ORDER BY uuid = ? DESC LIMIT 1`
+		err := tx.QueryRow(query, t.UUID, t.Name, t.UUID).Scan(&id, &name, &colorVariant, &pattern, &archived)
+
+		if err == sql.ErrNoRows {
+			insertSQL := `
+			INSERT INTO activity_types (uuid, name, color_variant, pattern, display_order, created_at, archived)
+			VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(display_order), 0) + 1 FROM activity_types), ?, ?)`
+			result, err := tx.Exec(insertSQL, nullIfEmpty(t.UUID), t.Name, t.ColorVariant, t.Pattern, FormatTimestamp(now()), t.Archived)
+			if err != nil {
+				return nil, fmt.Errorf("errore importazione tipo attività '%s': %v", t.Name, err)
+			}
+			if id, err = result.LastInsertId(); err != nil {
+				return nil, fmt.Errorf("errore recupero ID tipo attività '%s': %v", t.Name, err)
+			}
+			ids[t.Name] = id
+			report.ActivityTypes.Inserted++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("errore ricerca tipo attività '%s': %v", t.Name, err)
+		}
+
+		// Le sessioni del backup usano il nome del backup, anche se in locale è stato rinominato
+		ids[t.Name] = id
+		report.ActivityTypes.Skipped++
+		if name != t.Name {
+			report.conflitto("activity_type", "Tipo attività '%s': in locale si chiama '%s'", t.Name, name)
+		}
+		if colorVariant != t.ColorVariant || pattern != t.Pattern || archived != t.Archived {
+			report.conflitto("activity_type", "Tipo attività '%s': colore, pattern o archiviazione diversi da quelli locali", t.Name)
+		}
+	}
+	return ids, nil
+}
+
+// importaSessioni inserisce le sessioni non ancora presenti
+func importaSessioni(tx *sql.Tx, report *ImportReport, sessions []BackupSession, projectIDs map[int]int64, typeIDs map[string]int64) error {
+	for _, s := range sessions {
+		// Una sessione di un progetto non presente nel backup resta non assegnata
+		var projectID sql.NullInt64
+		if s.ProjectID != nil {
+			if id, ok := projectIDs[*s.ProjectID]; ok {
+				projectID = sql.NullInt64{Int64: id, Valid: true}
+			}
+		}
+
+		// Tipi non presenti nel backup vengono creati archiviati, per non perdere l'informazione
+		var activityTypeID sql.NullInt64
+		if s.ActivityType != nil {
+			id, ok := typeIDs[*s.ActivityType]
+			if !ok {
+				var err error
+				if id, err = RisolviTipoAttivita(tx, *s.ActivityType); err != nil {
+					return err
+				}
+				typeIDs[*s.ActivityType] = id
+				report.ActivityTypes.Inserted++
+			}
+			activityTypeID = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		found, identical, err := sessioneEsistente(tx, s, projectID, activityTypeID)
+		if err != nil {
+			return err
+		}
+		if found {
+			report.Sessions.Skipped++
+			if !identical {
+				report.conflitto("session", "Sessione del %s: esiste già in locale con dati diversi", ToLocal(s.Timestamp))
+			}
+			continue
+		}
+
+		// Export precedenti non hanno la fine reale: si ricava da inizio più durata
+		insertSQL := `
+		INSERT INTO sessions (uuid, app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at, time_zone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, COALESCE(?, strftime(` + sqlTimestamp + `, ?, '+' || ? || ' seconds')), ?)`
+		_, err = tx.Exec(insertSQL, nullIfEmpty(s.UUID), s.AppName, s.Seconds, projectID, s.SessionType, activityTypeID,
+			s.Timestamp, nullIfEmpty(s.EndedAt), s.Timestamp, s.Seconds, nullIfEmpty(s.TimeZone))
+		if err != nil {
+			return fmt.Errorf("errore importazione sessione del %s: %v", ToLocal(s.Timestamp), err)
+		}
+		report.Sessions.Inserted++
+	}
+	return nil
+}
+
+// sessioneEsistente cerca la sessione locale con lo stesso UUID o, in mancanza, con lo stesso
+// inizio e indica se è identica
+func sessioneEsistente(tx *sql.Tx, s BackupSession, projectID, activityTypeID sql.NullInt64) (bool, bool, error) {
+	if s.UUID != "" {
+		var appName, timestamp string
+		var seconds int
+		var localProject, localType sql.NullInt64
+		err := tx.QueryRow(`SELECT app_name, seconds, project_id, activity_type_id, timestamp FROM sessions WHERE uuid = ?`, s.UUID).
+			Scan(&appName, &seconds, &localProject, &localType, &timestamp)
+		if err == nil {
+			identical := appName == s.AppName && seconds == s.Seconds && localProject == projectID &&
+				localType == activityTypeID && timestamp == s.Timestamp
+			return true, identical, nil
+		}
+		if err != sql.ErrNoRows {
+			return false, false, fmt.Errorf("errore ricerca sessione: %v", err)
+		}
+	}
+
+	rows, err := tx.Query(`SELECT app_name, seconds, project_id, activity_type_id FROM sessions WHERE timestamp = ?`, s.Timestamp)
+	if err != nil {
+		return false, false, fmt.Errorf("errore ricerca sessione: %v", err)
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var appName string
+		var seconds int
+		var localProject, localType sql.NullInt64
+		if err := rows.Scan(&appName, &seconds, &localProject, &localType); err != nil {
+			return false, false, fmt.Errorf("errore lettura sessione: %v", err)
+		}
+		found = true
+		if appName == s.AppName && seconds == s.Seconds && localProject == projectID && localType == activityTypeID {
+			return true, true, nil
+		}
+	}
+	return found, false, rows.Err()
+}
+
+// importaNote inserisce le note non ancora presenti
+func importaNote(tx *sql.Tx, report *ImportReport, notes []BackupNote, projectIDs map[int]int64) error {
+	for _, n := range notes {
+		projectID, ok := projectIDs[n.ProjectID]
+		if !ok {
+			report.Notes.Skipped++
+			report.conflitto("note", "Nota del %s: il progetto %d non è presente nel backup", ToLocal(n.Timestamp), n.ProjectID)
+			continue
+		}
+
+		var noteText string
+		query := `
+		SELECT note_text FROM notes WHERE uuid = ? OR (project_id = ? AND timestamp = ?)
+		ORDER BY uuid = ? DESC LIMIT 1`
+		err := tx.QueryRow(query, n.UUID, projectID, n.Timestamp, n.UUID).Scan(&noteText)
+		if err == nil {
+			report.Notes.Skipped++
+			if noteText != n.NoteText {
+				report.conflitto("note", "Nota del %s: esiste già in locale con testo diverso", ToLocal(n.Timestamp))
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("errore ricerca nota: %v", err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO notes (uuid, project_id, note_text, timestamp) VALUES (?, ?, ?, ?)`, nullIfEmpty(n.UUID), projectID, n.NoteText, n.Timestamp); err != nil {
+			return fmt.Errorf("errore importazione nota: %v", err)
+		}
+		report.Notes.Inserted++
+	}
+	return nil
+}
+
+// importaImpostazioni aggiunge le impostazioni mancanti in locale
+func importaImpostazioni(tx *sql.Tx, report *ImportReport, settings map[string]string) error {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if impostazioniEscluse[key] {
+			report.Settings.Skipped++
+			continue
+		}
+
+		var value string
+		err := tx.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+		if err == nil {
+			report.Settings.Skipped++
+			if value != settings[key] {
+				report.conflitto("setting", "Impostazione '%s': valore diverso da quello locale", key)
+			}
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("errore lettura impostazione '%s': %v", key, err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)`, key, settings[key]); err != nil {
+			return fmt.Errorf("errore importazione impostazione '%s': %v", key, err)
+		}
+		report.Settings.Inserted++
+	}
+	return nil
+}
+
+// importaPeriodiPendenti accoda i periodi idle in attesa non ancora presenti
+func importaPeriodiPendenti(tx *sql.Tx, report *ImportReport, periods []BackupIdlePeriod) error {
+	for _, p := range periods {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM pending_idle_periods WHERE period_type = ? AND start_time = ?)`, p.Type, p.StartTime).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("errore ricerca periodo pendente: %v", err)
+		}
+		if exists {
+			report.IdlePeriods.Skipped++
+			continue
+		}
+
+		insertSQL := `INSERT INTO pending_idle_periods (period_type, start_time, end_time, seconds, created_at) VALUES (?, ?, ?, ?, ?)`
+		if _, err := tx.Exec(insertSQL, p.Type, p.StartTime, p.EndTime, p.Seconds, FormatTimestamp(now())); err != nil {
+			return fmt.Errorf("errore importazione periodo pendente: %v", err)
+		}
+		report.IdlePeriods.Inserted++
+	}
+	return nil
+}
+
+// nullIfEmpty restituisce nil per una stringa vuota, per salvarla come NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
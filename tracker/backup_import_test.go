@@ -0,0 +1,284 @@
+package tracker
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportaBackupPeriodiPendentiNelServizio(t *testing.T) {
+	db := apriDBTest(t)
+	service := NewTrackingService(db, NewManualClock(testStart))
+
+	start := testStart.Add(-2 * time.Hour)
+	backup := &Backup{
+		Version:    BackupVersion,
+		ExportType: ExportFull,
+		ExportDate: FormatTimestamp(testStart),
+		PendingIdlePeriods: []BackupIdlePeriod{{
+			Type:      PeriodSuspended,
+			StartTime: FormatTimestamp(start),
+			EndTime:   FormatTimestamp(start.Add(time.Hour)),
+			Seconds:   3600,
+		}},
+	}
+
+	// L'anteprima non scrive nulla
+	if _, err := ImportaBackup(db, backup, true); err != nil {
+		t.Fatalf("errore anteprima importazione: %v", err)
+	}
+	if err := service.ReloadPendingPeriods(); err != nil {
+		t.Fatal(err)
+	}
+	if got := service.PendingPeriods(); len(got) != 0 {
+		t.Fatalf("periodi pendenti dopo l'anteprima = %d, attesi 0", len(got))
+	}
+
+	report, err := ImportaBackup(db, backup, false)
+	if err != nil {
+		t.Fatalf("errore importazione: %v", err)
+	}
+	if report.IdlePeriods.Inserted != 1 {
+		t.Fatalf("periodi importati = %d, atteso 1", report.IdlePeriods.Inserted)
+	}
+	if err := service.ReloadPendingPeriods(); err != nil {
+		t.Fatal(err)
+	}
+	suspended := service.PendingSuspended()
+	if suspended == nil || !suspended.StartTime.Equal(start) || suspended.Duration != 3600 {
+		t.Fatalf("sospensione pendente = %+v, attesa quella importata", suspended)
+	}
+
+	// Una seconda importazione dello stesso backup non duplica il periodo
+	if _, err := ImportaBackup(db, backup, false); err != nil {
+		t.Fatalf("errore seconda importazione: %v", err)
+	}
+	if err := service.ReloadPendingPeriods(); err != nil {
+		t.Fatal(err)
+	}
+	if got := service.PendingPeriods(); len(got) != 1 {
+		t.Errorf("periodi pendenti dopo la seconda importazione = %d, atteso 1", len(got))
+	}
+}
+
+// contaRighe restituisce il numero di righe di ogni tabella toccata dall'importazione
+func contaRighe(t *testing.T, db *sql.DB) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, table := range []string{"projects", "activity_types", "sessions", "notes", "settings", "pending_idle_periods"} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		counts[table] = n
+	}
+	return counts
+}
+
+// backupUnione prepara un database con dati locali e un backup che li incrocia in tutti i
+// modi previsti dall'unione
+func backupUnione(t *testing.T) (*sql.DB, *Backup) {
+	t.Helper()
+	db := apriDBTest(t)
+	clienteID, err := CreaProgetto(db, "Cliente", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	internoID, err := CreaProgetto(db, "Interno", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clienteUUID string
+	if err := db.QueryRow(`SELECT uuid FROM projects WHERE id = ?`, clienteID).Scan(&clienteUUID); err != nil {
+		t.Fatal(err)
+	}
+
+	cliente, interno := int(clienteID), int(internoID)
+	ricerca := "RICERCA"
+	for i, projectID := range []*int{&cliente, &interno} {
+		if err := CreaSessione(db, "Code.exe", 600, projectID, "computer", &ricerca, FormatTimestamp(testStart.Add(time.Duration(i)*time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sessionUUID string
+	if err := db.QueryRow(`SELECT uuid FROM sessions WHERE project_id = ?`, cliente).Scan(&sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSetting(db, "idle_threshold", "5"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nel backup i progetti hanno ID diversi da quelli locali
+	p1, p2, p3 := 11, 12, 13
+	b := &Backup{
+		Version:    BackupVersion,
+		ExportType: ExportFull,
+		ExportDate: FormatTimestamp(testStart),
+		Projects: []BackupProject{
+			{ID: p1, UUID: clienteUUID, Name: "Cliente SRL"},                  // stesso UUID, rinominato
+			{ID: p2, UUID: "altro-uuid", Name: "Interno", Description: "Ore"}, // stesso nome, completa la descrizione
+			{ID: p3, Name: "Nuovo"},
+		},
+		ActivityTypes: []BackupActivityType{{ID: 1, Name: "RICERCA", ColorVariant: 0.1, Pattern: "solid", DisplayOrder: 1}},
+		Sessions: []BackupSession{
+			// Identica a quella locale per UUID
+			{UUID: sessionUUID, AppName: "Code.exe", Seconds: 600, ProjectID: &p1, SessionType: "computer", ActivityType: &ricerca, Timestamp: FormatTimestamp(testStart)},
+			// Identica a quella locale per inizio e dati
+			{AppName: "Code.exe", Seconds: 600, ProjectID: &p2, SessionType: "computer", ActivityType: &ricerca, Timestamp: FormatTimestamp(testStart.Add(time.Hour))},
+			// Stesso inizio di una locale ma durata diversa: conflitto
+			{AppName: "Code.exe", Seconds: 900, ProjectID: &p2, SessionType: "computer", Timestamp: FormatTimestamp(testStart.Add(time.Hour))},
+			// Nuova, con tipo attività assente dal backup
+			{UUID: "nuova-sessione", AppName: "Excel.exe", Seconds: 300, ProjectID: &p3, SessionType: "computer", ActivityType: strPtr("CONSULENZA"), Timestamp: FormatTimestamp(testStart.Add(2 * time.Hour))},
+			// Duplicato nel backup stesso
+			{UUID: "nuova-sessione", AppName: "Excel.exe", Seconds: 300, ProjectID: &p3, SessionType: "computer", ActivityType: strPtr("CONSULENZA"), Timestamp: FormatTimestamp(testStart.Add(2 * time.Hour))},
+		},
+		Notes:    []BackupNote{{ProjectID: p3, NoteText: "nota", Timestamp: FormatTimestamp(testStart)}, {ProjectID: 99, NoteText: "orfana", Timestamp: FormatTimestamp(testStart)}},
+		Settings: map[string]string{"idle_threshold": "10", "suspend_handling": "discard", "auto_start": "true"},
+	}
+	if err := b.valida(); err != nil {
+		t.Fatal(err)
+	}
+	return db, b
+}
+
+// strPtr restituisce il puntatore a una stringa
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestImportaBackupUnione(t *testing.T) {
+	db, b := backupUnione(t)
+
+	report, err := ImportaBackup(db, b, false)
+	if err != nil {
+		t.Fatalf("errore importazione: %v", err)
+	}
+
+	want := ImportReport{
+		Projects:      ImportCounts{Inserted: 1, Updated: 1, Skipped: 1},
+		ActivityTypes: ImportCounts{Inserted: 1, Skipped: 1},
+		Sessions:      ImportCounts{Inserted: 1, Skipped: 4},
+		Notes:         ImportCounts{Inserted: 1, Skipped: 1},
+		Settings:      ImportCounts{Inserted: 1, Skipped: 2},
+	}
+	got := *report
+	got.Conflicts = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("conteggi = %+v, attesi %+v", got, want)
+	}
+
+	// Conflitti: nome del progetto per UUID, stesso nome con UUID diverso, tipo con colore
+	// diverso, sessione con stesso inizio, nota senza progetto, impostazione diversa
+	entities := map[string]int{}
+	for _, c := range report.Conflicts {
+		entities[c.Entity]++
+	}
+	wantConflicts := map[string]int{"project": 2, "activity_type": 1, "session": 1, "note": 1, "setting": 1}
+	if !reflect.DeepEqual(entities, wantConflicts) {
+		t.Errorf("conflitti = %+v, attesi per entità %v", report.Conflicts, wantConflicts)
+	}
+
+	// Il dato locale vince: nome e impostazione invariati, descrizione vuota completata
+	project, err := TrovaProgetto(db, "Cliente")
+	if err != nil {
+		t.Fatalf("progetto locale rinominato dall'importazione: %v", err)
+	}
+	if _, err := TrovaProgetto(db, "Cliente SRL"); err == nil {
+		t.Error("progetto con lo stesso UUID importato come nuovo")
+	}
+	interno, err := TrovaProgetto(db, "Interno")
+	if err != nil || interno.Description != "Ore" {
+		t.Errorf("descrizione progetto Interno = %+v (%v), attesa 'Ore'", interno, err)
+	}
+	if value, _ := GetSetting(db, "idle_threshold"); value != "5" {
+		t.Errorf("impostazione locale sovrascritta: %s", value)
+	}
+	if value, _ := GetSetting(db, "auto_start"); value == "true" {
+		t.Errorf("impostazione del computer importata: %s", value)
+	}
+
+	// La sessione nuova mantiene l'UUID del backup ed è collegata al progetto nuovo
+	var sessionProject string
+	var archived bool
+	err = db.QueryRow(`SELECT p.name, at.archived FROM sessions s JOIN projects p ON p.id = s.project_id
+		JOIN activity_types at ON at.id = s.activity_type_id WHERE s.uuid = 'nuova-sessione'`).Scan(&sessionProject, &archived)
+	if err != nil || sessionProject != "Nuovo" || !archived {
+		t.Errorf("sessione importata: progetto %q, tipo archiviato %v (%v)", sessionProject, archived, err)
+	}
+	if sessions, _ := CaricaSessioniProgetto(db, project.ID); sessions["Code.exe"] != 600 {
+		t.Errorf("sessioni del progetto Cliente = %v, attesa solo quella locale", sessions)
+	}
+
+	// Importare di nuovo lo stesso backup non aggiunge nulla
+	before := contaRighe(t, db)
+	again, err := ImportaBackup(db, b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Projects.Inserted+again.ActivityTypes.Inserted+again.Sessions.Inserted+again.Notes.Inserted+again.Settings.Inserted != 0 {
+		t.Errorf("seconda importazione ha inserito dati: %+v", again)
+	}
+	if after := contaRighe(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("righe dopo la seconda importazione = %v, prima %v", after, before)
+	}
+}
+
+func TestImportaBackupAnteprima(t *testing.T) {
+	db, b := backupUnione(t)
+	before := contaRighe(t, db)
+
+	preview, err := ImportaBackup(db, b, true)
+	if err != nil {
+		t.Fatalf("errore anteprima: %v", err)
+	}
+	if !preview.DryRun {
+		t.Error("anteprima non segnata come dry-run")
+	}
+	if after := contaRighe(t, db); !reflect.DeepEqual(after, before) {
+		t.Fatalf("l'anteprima ha modificato il database: %v, prima %v", after, before)
+	}
+
+	// L'anteprima riporta gli stessi conteggi dell'importazione reale
+	report, err := ImportaBackup(db, b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview.DryRun = false
+	if !reflect.DeepEqual(preview, report) {
+		t.Errorf("anteprima = %+v, importazione = %+v", preview, report)
+	}
+}
+
+func TestLeggiBackupNonValido(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"JSON troncato", `{"version": "2.1", "export_type": "full"`},
+		{"non un oggetto", `[1, 2, 3]`},
+		{"null", `null`},
+		{"versione numerica", `{"version": 2.1, "export_type": "full"}`},
+		{"versione sconosciuta", `{"version": "9.0", "export_type": "full"}`},
+		{"progetti non array", `{"version": "2.1", "export_type": "full", "export_date": "2026-03-02T08:00:00Z", "projects": {"id": 1}}`},
+		{"secondi testuali", `{"version": "2.1", "export_type": "full", "export_date": "2026-03-02T08:00:00Z", "sessions": [{"id": 1, "app_name": "a", "seconds": "60", "session_type": "manual", "timestamp": "2026-03-02T08:00:00Z"}]}`},
+		{"secondi testuali legacy", `{"version": "1.1", "sessions": [{"id": 1, "app_name": "a", "seconds": "60", "timestamp": "2026-03-02T08:00:00Z"}]}`},
+		{"progetto sessione testuale", `{"version": "2.0", "export_type": "full", "sessions": [{"id": 1, "app_name": "a", "seconds": 60, "project_id": "1", "timestamp": "2026-03-02T08:00:00Z"}]}`},
+		{"impostazione numerica", `{"version": "2.0", "export_type": "full", "settings": {"idle_threshold": 5}}`},
+		{"sessioni testuali nel report legacy", `{"version": "1.1", "export_type": "project_report", "project_name": "P", "sessions": "nessuna"}`},
+		{"tipo export sconosciuto", `{"version": "2.0", "export_type": "parziale"}`},
+		{"durata negativa", `{"version": "2.0", "export_type": "full", "sessions": [{"id": 1, "app_name": "a", "seconds": -5, "timestamp": "2026-03-02T08:00:00Z"}]}`},
+		{"timestamp non valido", `{"version": "2.0", "export_type": "full", "sessions": [{"id": 1, "app_name": "a", "seconds": 5, "timestamp": "ieri"}]}`},
+		{"progetto senza nome", `{"version": "2.0", "export_type": "full", "projects": [{"id": 1, "name": " "}]}`},
+		{"ID progetto duplicato", `{"version": "2.0", "export_type": "full", "projects": [{"id": 1, "name": "A"}, {"id": 1, "name": "B"}]}`},
+		{"periodo di tipo sconosciuto", `{"version": "2.0", "export_type": "full", "pending_idle_periods": [{"period_type": "pausa", "start_time": "2026-03-02T08:00:00Z", "end_time": "2026-03-02T09:00:00Z", "seconds": 3600}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := LeggiBackup([]byte(tt.json))
+			if err == nil {
+				t.Fatalf("backup accettato: %+v", b)
+			}
+		})
+	}
+}
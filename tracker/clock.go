@@ -0,0 +1,201 @@
+package tracker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock astrae l'orologio di sistema per poter simulare il passare del tempo
+type Clock interface {
+	Now() time.Time
+	// Elapsed restituisce il tempo monotono trascorso da un istante fisso: non risente
+	// delle correzioni dell'orologio di sistema e non avanza durante sospensione e ibernazione
+	Elapsed() time.Duration
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker astrae time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock è l'orologio reale basato sul pacchetto time
+var SystemClock Clock = systemClock{}
+
+// clock è l'orologio usato dalle funzioni del pacchetto (timestamp delle sessioni, backup)
+var (
+	clock   Clock = SystemClock
+	clockMu sync.RWMutex
+)
+
+// SetClock imposta l'orologio usato dal pacchetto tracker (nil ripristina quello di sistema)
+func SetClock(c Clock) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	if c == nil {
+		c = SystemClock
+	}
+	clock = c
+}
+
+// currentClock restituisce l'orologio del pacchetto
+func currentClock() Clock {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return clock
+}
+
+// now restituisce l'ora corrente secondo l'orologio del pacchetto
+func now() time.Time {
+	return currentClock().Now()
+}
+
+// monotonicStart è il riferimento per il tempo monotono di sistema
+var monotonicStart = time.Now()
+
+// systemClock delega al pacchetto time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Elapsed() time.Duration { return monotonicElapsed() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// systemTicker adatta *time.Ticker all'interfaccia Ticker
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+
+func (t systemTicker) Stop() { t.t.Stop() }
+
+// ManualClock è un orologio che avanza solo quando richiesto con Advance.
+// Ticker e timer scattano durante Advance; come time.Ticker, un tick viene
+// scartato se il precedente non è ancora stato letto.
+// Ticker e timer seguono il tempo monotono: Set sposta solo l'orologio di sistema.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	mono    time.Duration
+	waiters []*manualWaiter
+}
+
+// manualWaiter è un ticker o timer in attesa su un ManualClock
+type manualWaiter struct {
+	clock    *ManualClock
+	deadline time.Duration // in tempo monotono
+	period   time.Duration // 0 per i timer one-shot di After
+	ch       chan time.Time
+}
+
+// NewManualClock crea un orologio manuale fermo all'istante indicato
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+// Now restituisce l'istante corrente dell'orologio manuale
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Elapsed restituisce il tempo monotono simulato (avanza solo con Advance)
+func (c *ManualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mono
+}
+
+// NewTicker crea un ticker che scatta ogni d di tempo simulato
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("tracker: intervallo non positivo per ManualClock.NewTicker")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &manualWaiter{clock: c, deadline: c.mono + d, period: d, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+// After restituisce un canale che riceve l'ora dopo d di tempo simulato
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &manualWaiter{clock: c, deadline: c.mono + d, ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		return w.ch
+	}
+	c.waiters = append(c.waiters, w)
+	return w.ch
+}
+
+// Set sposta l'orologio di sistema a un istante arbitrario (anche indietro) senza far passare
+// tempo monotono né scattare i ticker: simula una correzione dell'orologio o, in avanti,
+// una sospensione del computer
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Advance fa avanzare l'orologio di d, facendo scattare in ordine ticker e timer scaduti
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.mono + d
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].deadline < c.waiters[j].deadline
+		})
+		if len(c.waiters) == 0 || c.waiters[0].deadline > target {
+			break
+		}
+
+		w := c.waiters[0]
+		c.now = c.now.Add(w.deadline - c.mono)
+		c.mono = w.deadline
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+
+		if w.period > 0 {
+			w.deadline += w.period
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+
+	c.now = c.now.Add(target - c.mono)
+	c.mono = target
+}
+
+// C restituisce il canale dei tick
+func (w *manualWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop rimuove il ticker dall'orologio
+func (w *manualWaiter) Stop() {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
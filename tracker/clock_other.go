@@ -0,0 +1,11 @@
+//go:build !windows
+
+package tracker
+
+import "time"
+
+// monotonicElapsed usa il monotono di Go, che su Linux (CLOCK_MONOTONIC) e macOS
+// non avanza durante la sospensione
+func monotonicElapsed() time.Duration {
+	return time.Since(monotonicStart)
+}
@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockTicker(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	ticker := clock.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	// Il tick riporta l'istante della scadenza, non quello di fine Advance
+	clock.Advance(7 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(5 * time.Second)) {
+			t.Errorf("tick alle %s, atteso alle 09:00:05", tick.Format("15:04:05"))
+		}
+	default:
+		t.Fatal("nessun tick dopo 7 secondi")
+	}
+	if got := clock.Elapsed(); got != 7*time.Second {
+		t.Errorf("Elapsed = %v, atteso 7s", got)
+	}
+
+	// Come time.Ticker, i tick non letti vengono scartati
+	clock.Advance(20 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("tick alle %s, atteso alle 09:00:10", tick.Format("15:04:05"))
+		}
+	default:
+		t.Fatal("nessun tick dopo 27 secondi")
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("i tick non letti non sono stati scartati")
+	default:
+	}
+}
+
+func TestManualClockSet(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	ticker := clock.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	// Set sposta solo l'orologio di sistema: il tempo monotono resta fermo e i ticker non scattano
+	clock.Set(start.Add(time.Hour))
+	select {
+	case <-ticker.C():
+		t.Fatal("tick dopo Set")
+	default:
+	}
+	if got := clock.Elapsed(); got != 0 {
+		t.Errorf("Elapsed dopo Set = %v, atteso 0", got)
+	}
+
+	clock.Advance(5 * time.Second)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(time.Hour + 5*time.Second)) {
+			t.Errorf("tick alle %s, atteso alle 10:00:05", tick.Format("15:04:05"))
+		}
+	default:
+		t.Fatal("nessun tick dopo 5 secondi")
+	}
+}
+
+func TestManualClockAfter(t *testing.T) {
+	clock := NewManualClock(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	timer := clock.After(time.Minute)
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-timer:
+		t.Fatal("timer scattato in anticipo")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-timer:
+	default:
+		t.Fatal("timer non scattato dopo un minuto")
+	}
+}
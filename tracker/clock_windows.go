@@ -0,0 +1,47 @@
+//go:build windows
+
+package tracker
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+var procQueryUnbiasedInterruptTime = kernel32.NewProc("QueryUnbiasedInterruptTime")
+
+// monotonicSource è la sorgente del tempo monotono, scelta una sola volta all'avvio: le due
+// sorgenti non hanno la stessa origine, quindi passare dall'una all'altra produrrebbe
+// falsi salti (sospensioni o derive) nel confronto con l'orologio di sistema
+var monotonicSource = sceltaMonotono()
+
+// sceltaMonotono usa il tempo di interrupt "unbiased", che a differenza del monotono di Go su
+// Windows non avanza durante sospensione e ibernazione; se non è disponibile usa il monotono di Go
+func sceltaMonotono() func() time.Duration {
+	if _, ok := unbiasedInterruptTime(); ok {
+		return func() time.Duration {
+			elapsed, _ := unbiasedInterruptTime()
+			return elapsed
+		}
+	}
+	fmt.Println("[WATCHER] QueryUnbiasedInterruptTime non disponibile: uso il tempo monotono di Go")
+	return func() time.Duration { return time.Since(monotonicStart) }
+}
+
+// unbiasedInterruptTime legge il tempo di interrupt "unbiased"
+func unbiasedInterruptTime() (time.Duration, bool) {
+	if procQueryUnbiasedInterruptTime.Find() != nil {
+		return 0, false
+	}
+	var ticks uint64 // unità da 100 ns
+	ret, _, _ := procQueryUnbiasedInterruptTime.Call(uintptr(unsafe.Pointer(&ticks)))
+	if ret == 0 {
+		return 0, false
+	}
+	return time.Duration(ticks) * 100, true
+}
+
+// monotonicElapsed restituisce il tempo monotono della sorgente scelta all'avvio
+func monotonicElapsed() time.Duration {
+	return monotonicSource()
+}
@@ -3,212 +3,45 @@ package tracker
 import (
 	"database/sql"
 	"fmt"
-	"strings"
+	"os"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-// isDuplicateColumnError verifica se l'errore è dovuto a una colonna già esistente
-func isDuplicateColumnError(err error) bool {
-	if err == nil {
-		return false
+// InitDB inizializza il database e applica le migrazioni di schema
+func InitDB(filepath string) (*sql.DB, error) {
+	// Un file già presente e non vuoto va salvato prima di migrarlo
+	existing := false
+	if info, err := os.Stat(filepath); err == nil && info.Size() > 0 {
+		existing = true
 	}
-	errStr := strings.ToLower(err.Error())
-	return strings.Contains(errStr, "duplicate column") ||
-		strings.Contains(errStr, "already exists")
-}
 
-// InitDB inizializza il database e crea le tabelle
-func InitDB(filepath string) (*sql.DB, error) {
-	// Apri connessione al database
-	db, err := sql.Open("sqlite", filepath)
+	// Apri connessione al database: i vincoli di chiave esterna vanno attivati su ogni connessione
+	db, err := sql.Open("sqlite", filepath+"?_pragma=foreign_keys(1)")
 	if err != nil {
 		return nil, fmt.Errorf("errore apertura database: %v", err)
 	}
 
 	// Verifica che la connessione funzioni
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("errore connessione database: %v", err)
 	}
 
-	// Crea la tabella se non esiste
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS applicazioni (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		nome TEXT NOT NULL,
-		tempo INTEGER NOT NULL,
-		categoria TEXT NOT NULL,
-		data_creazione DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(createTableSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella: %v", err)
-	}
-
-	// Crea tabella projects
-	createProjectsSQL := `
-	CREATE TABLE IF NOT EXISTS projects (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		description TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		archived INTEGER DEFAULT 0,
-		closed_at DATETIME
-	);`
-
-	if _, err := db.Exec(createProjectsSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella projects: %v", err)
-	}
-
-	// Migrazione: aggiungi colonne archived e closed_at se non esistono
-	// Ignoriamo errori "duplicate column" che indicano che la colonna esiste già
-	if _, err := db.Exec(`ALTER TABLE projects ADD COLUMN archived INTEGER DEFAULT 0;`); err != nil {
-		// Log solo se non è un errore "duplicate column"
-		if !isDuplicateColumnError(err) {
-			fmt.Printf("[DB] Avviso migrazione projects.archived: %v\n", err)
-		}
-	}
-	if _, err := db.Exec(`ALTER TABLE projects ADD COLUMN closed_at DATETIME;`); err != nil {
-		if !isDuplicateColumnError(err) {
-			fmt.Printf("[DB] Avviso migrazione projects.closed_at: %v\n", err)
-		}
-	}
-	// Migrazione: aggiungi colonna note_text per nota markdown del progetto
-	if _, err := db.Exec(`ALTER TABLE projects ADD COLUMN note_text TEXT DEFAULT '';`); err != nil {
-		if !isDuplicateColumnError(err) {
-			fmt.Printf("[DB] Avviso migrazione projects.note_text: %v\n", err)
-		}
-	}
-
-	// Crea tabella sessions per tracciare sessioni
-	createSessionsSQL := `
-	CREATE TABLE IF NOT EXISTS sessions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		app_name TEXT NOT NULL,
-		seconds INTEGER NOT NULL,
-		project_id INTEGER,
-		session_type TEXT DEFAULT 'computer',
-		activity_type TEXT DEFAULT NULL,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id)
-	);`
-
-	if _, err := db.Exec(createSessionsSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella sessions: %v", err)
-	}
-
-	// Migrazione: aggiungi colonna activity_type se non esiste
-	if _, err := db.Exec(`ALTER TABLE sessions ADD COLUMN activity_type TEXT DEFAULT NULL;`); err != nil {
-		if !isDuplicateColumnError(err) {
-			fmt.Printf("[DB] Avviso migrazione sessions.activity_type: %v\n", err)
-		}
-	}
-
-	// Crea tabella notes per le note dei progetti
-	createNotesSQL := `
-	CREATE TABLE IF NOT EXISTS notes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		project_id INTEGER NOT NULL,
-		note_text TEXT NOT NULL,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (project_id) REFERENCES projects(id)
-	);`
-
-	if _, err := db.Exec(createNotesSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella notes: %v", err)
-	}
-
-	// Crea tabella activity_types per i tipi di attività configurabili
-	createActivityTypesSQL := `
-	CREATE TABLE IF NOT EXISTS activity_types (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE,
-		color_variant REAL DEFAULT 0.0,
-		display_order INTEGER DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(createActivityTypesSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella activity_types: %v", err)
-	}
-
-	// Migrazione: aggiungi colonna pattern se non esiste
-	if _, err := db.Exec(`ALTER TABLE activity_types ADD COLUMN pattern TEXT DEFAULT 'solid';`); err != nil {
-		if !isDuplicateColumnError(err) {
-			fmt.Printf("[DB] Avviso migrazione activity_types.pattern: %v\n", err)
-		}
-	}
-
-	// Inserisci tipi di attività di default se la tabella è vuota
-	var count int
-	db.QueryRow("SELECT COUNT(*) FROM activity_types").Scan(&count)
-	if count == 0 {
-		defaultTypes := []struct {
-			name         string
-			colorVariant float64
-			pattern      string
-			order        int
-		}{
-			{"RICERCA", 0.3, "dots", 1},
-			{"PROGETTAZIONE", 0.0, "solid", 2},
-			{"REALIZZAZIONE", -0.3, "stripes", 3},
-		}
-
-		for _, t := range defaultTypes {
-			db.Exec("INSERT INTO activity_types (name, color_variant, pattern, display_order) VALUES (?, ?, ?, ?)",
-				t.name, t.colorVariant, t.pattern, t.order)
-		}
-		fmt.Println("[DB] Tipi di attività predefiniti inseriti")
-	}
-
-	// Crea tabella settings per le impostazioni dell'applicazione
-	createSettingsSQL := `
-	CREATE TABLE IF NOT EXISTS settings (
-		key TEXT PRIMARY KEY,
-		value TEXT NOT NULL
-	);`
-
-	if _, err := db.Exec(createSettingsSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella settings: %v", err)
-	}
-
-	// Inserisci impostazioni di default se non esistono
-	db.Exec("INSERT OR IGNORE INTO settings (key, value) VALUES ('auto_start', 'false')")
-
-	// Crea indici per migliorare le performance delle query
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_timestamp ON sessions(timestamp)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_app_name ON sessions(app_name)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_project_id ON notes(project_id)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_timestamp ON notes(timestamp)`)
-
-	// Crea tabella pending_tracking per tracciare sessioni in corso (auto-save)
-	createPendingTrackingSQL := `
-	CREATE TABLE IF NOT EXISTS pending_tracking (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		session_id INTEGER NOT NULL,
-		project_id INTEGER,
-		activity_type TEXT,
-		start_time DATETIME NOT NULL,
-		last_saved_seconds INTEGER DEFAULT 0,
-		last_update DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (session_id) REFERENCES sessions(id),
-		FOREIGN KEY (project_id) REFERENCES projects(id)
-	);`
-
-	if _, err := db.Exec(createPendingTrackingSQL); err != nil {
-		return nil, fmt.Errorf("errore creazione tabella pending_tracking: %v", err)
+	// Porta lo schema all'ultima versione
+	if err := migrateDB(db, filepath, existing); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	fmt.Println("[DB] Database inizializzato con successo")
 	return db, nil
-
 }
 
 // GetDefaultActivityType restituisce il primo tipo di attività secondo l'ordine gerarchico
 func GetDefaultActivityType(db *sql.DB) *string {
-	query := `SELECT name FROM activity_types ORDER BY display_order ASC LIMIT 1`
+	query := `SELECT name FROM activity_types WHERE archived = 0 ORDER BY display_order ASC LIMIT 1`
 
 	var name string
 	err := db.QueryRow(query).Scan(&name)
@@ -230,20 +63,24 @@ func SalvaSessione(db *sql.DB, appName string, seconds int, projectID *int) erro
 
 // SalvaSessioneConTipo salva una sessione specificando il tipo, activity_type e timestamp opzionale
 func SalvaSessioneConTipo(db *sql.DB, appName string, seconds int, projectID *int, sessionType string, activityType *string, timestamp string) error {
-	var insertSQL string
-	var err error
-
-	if timestamp != "" {
-		// Salva con timestamp specifico
-		insertSQL = `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)`
-		_, err = db.Exec(insertSQL, appName, seconds, projectID, sessionType, activityType, timestamp)
+	if timestamp == "" {
+		// Usa l'istante corrente dell'orologio del pacchetto
+		timestamp = FormatTimestamp(now())
 	} else {
-		// Usa timestamp corrente del sistema Go (già in ora locale)
-		now := time.Now().Format("2006-01-02 15:04:05")
-		insertSQL = `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)`
-		_, err = db.Exec(insertSQL, appName, seconds, projectID, sessionType, activityType, now)
+		normalized, err := NormalizzaTimestamp(timestamp)
+		if err != nil {
+			return fmt.Errorf("errore salvataggio sessione: %v", err)
+		}
+		timestamp = normalized
+	}
+
+	activityTypeID, err := idTipoAttivita(db, activityType)
+	if err != nil {
+		return fmt.Errorf("errore salvataggio sessione: %v", err)
 	}
 
+	insertSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at, time_zone) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(insertSQL, appName, seconds, projectID, sessionType, activityTypeID, timestamp, fineSessione(timestamp, seconds), nullIfEmpty(TimeZoneName()))
 	if err != nil {
 		return fmt.Errorf("errore salvataggio sessione: %v", err)
 	}
@@ -265,16 +102,30 @@ func SalvaStatistiche(db *sql.DB, stats map[string]int, projectID *int) error {
 	return nil
 }
 
+// appUsageCTE espone il tempo per applicazione: le sessioni con dettaglio in session_app_usage
+// vengono espanse per applicazione, le altre (manuali, idle, precedenti) restano con il loro app_name
+const appUsageCTE = `
+	WITH app_usage AS (
+		SELECT u.app_name, u.seconds, s.project_id, s.timestamp
+		FROM session_app_usage u
+		JOIN sessions s ON s.id = u.session_id
+		UNION ALL
+		SELECT s.app_name, s.seconds, s.project_id, s.timestamp
+		FROM sessions s
+		WHERE NOT EXISTS (SELECT 1 FROM session_app_usage u WHERE u.session_id = s.id)
+	)`
+
 // CaricaSessioniOggi carica le sessioni di oggi
 func CaricaSessioniOggi(db *sql.DB) (map[string]int, error) {
-	query := `
+	query := appUsageCTE + `
 	SELECT app_name, SUM(seconds) as total
-	FROM sessions
-	WHERE DATE(timestamp) = DATE('now')
+	FROM app_usage
+	WHERE timestamp >= ? AND timestamp < ?
 	GROUP BY app_name
 	`
 
-	rows, err := db.Query(query)
+	start, end := intervalloOggi()
+	rows, err := db.Query(query, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("errore query sessioni: %v", err)
 	}
@@ -295,14 +146,15 @@ func CaricaSessioniOggi(db *sql.DB) (map[string]int, error) {
 
 // CaricaSessioniSettimana carica le sessioni della settimana corrente
 func CaricaSessioniSettimana(db *sql.DB) (map[string]int, error) {
-	query := `
+	query := appUsageCTE + `
 	SELECT app_name, SUM(seconds) as total
-	FROM sessions
-	WHERE DATE(timestamp) >= DATE('now', 'weekday 0', '-7 days')
+	FROM app_usage
+	WHERE timestamp >= ? AND timestamp < ?
 	GROUP BY app_name
 	`
 
-	rows, err := db.Query(query)
+	start, end := intervalloSettimana()
+	rows, err := db.Query(query, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("errore query sessioni settimana: %v", err)
 	}
@@ -323,14 +175,15 @@ func CaricaSessioniSettimana(db *sql.DB) (map[string]int, error) {
 
 // CaricaSessioniMese carica le sessioni del mese corrente
 func CaricaSessioniMese(db *sql.DB) (map[string]int, error) {
-	query := `
+	query := appUsageCTE + `
 	SELECT app_name, SUM(seconds) as total
-	FROM sessions
-	WHERE strftime('%Y-%m', timestamp) = strftime('%Y-%m', 'now')
+	FROM app_usage
+	WHERE timestamp >= ? AND timestamp < ?
 	GROUP BY app_name
 	`
 
-	rows, err := db.Query(query)
+	start, end := intervalloMese()
+	rows, err := db.Query(query, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("errore query sessioni mese: %v", err)
 	}
@@ -354,16 +207,17 @@ func CaricaTopApp(db *sql.DB, limit int) ([]struct {
 	Nome    string
 	Secondi int
 }, error) {
-	query := `
+	query := appUsageCTE + `
 	SELECT app_name, SUM(seconds) as total
-	FROM sessions
-	WHERE DATE(timestamp) = DATE('now')
+	FROM app_usage
+	WHERE timestamp >= ? AND timestamp < ?
 	GROUP BY app_name
 	ORDER BY total DESC
 	LIMIT ?
 	`
 
-	rows, err := db.Query(query, limit)
+	start, end := intervalloOggi()
+	rows, err := db.Query(query, start, end, limit)
 	if err != nil {
 		return nil, fmt.Errorf("errore query top app: %v", err)
 	}
@@ -397,9 +251,9 @@ func CaricaTopApp(db *sql.DB, limit int) ([]struct {
 
 // CreaProgetto crea un nuovo progetto
 func CreaProgetto(db *sql.DB, name, description string) (int64, error) {
-	insertSQL := `INSERT INTO projects (name, description) VALUES (?, ?)`
+	insertSQL := `INSERT INTO projects (name, description, created_at) VALUES (?, ?, ?)`
 
-	result, err := db.Exec(insertSQL, name, description)
+	result, err := db.Exec(insertSQL, name, description, FormatTimestamp(now()))
 	if err != nil {
 		return 0, fmt.Errorf("errore creazione progetto: %v", err)
 	}
@@ -652,80 +506,63 @@ func TrovaProgettoById(db *sql.DB, id int) (*Project, error) {
 
 // EliminaProgetto elimina un progetto e tutti i suoi dati associati (sessioni e note)
 func EliminaProgetto(db *sql.DB, name string) error {
-	// Prima trova l'ID del progetto
 	project, err := TrovaProgetto(db, name)
 	if err != nil {
 		return err
 	}
+	return EliminaProgettoById(db, project.ID)
+}
 
-	// Elimina tutte le note associate al progetto
-	deleteNotesSQL := `DELETE FROM notes WHERE project_id = ?`
-	result, err := db.Exec(deleteNotesSQL, project.ID)
-	if err != nil {
-		return fmt.Errorf("errore eliminazione note del progetto: %v", err)
-	}
-	notesDeleted, _ := result.RowsAffected()
-
-	// Elimina tutte le sessioni associate al progetto
-	deleteSessionsSQL := `DELETE FROM sessions WHERE project_id = ?`
-	result, err = db.Exec(deleteSessionsSQL, project.ID)
-	if err != nil {
-		return fmt.Errorf("errore eliminazione sessioni del progetto: %v", err)
-	}
-	sessionsDeleted, _ := result.RowsAffected()
-
-	// Infine, elimina il progetto stesso
-	deleteProjectSQL := `DELETE FROM projects WHERE id = ?`
-	result, err = db.Exec(deleteProjectSQL, project.ID)
+// EliminaProgettoById elimina un progetto e tutti i dati associati dato l'ID.
+// Note, sessioni (con i loro dati di dettaglio) e tracking pendente del progetto vengono
+// eliminati a cascata dalle chiavi esterne, nella stessa transazione; le regole restano senza
+// progetto.
+func EliminaProgettoById(db *sql.DB, projectID int) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("errore eliminazione progetto: %v", err)
+		return fmt.Errorf("errore avvio eliminazione progetto: %v", err)
 	}
 
-	fmt.Printf("[DB] Progetto eliminato: %s (sessioni: %d, note: %d)\n", name, sessionsDeleted, notesDeleted)
-	return nil
-}
-
-// EliminaProgettoById elimina un progetto e tutti i dati associati dato l'ID
-func EliminaProgettoById(db *sql.DB, projectID int) error {
-	// Recupera il nome del progetto per il log
+	// Recupera nome e dati associati del progetto per il log
 	var projectName string
-	err := db.QueryRow("SELECT name FROM projects WHERE id = ?", projectID).Scan(&projectName)
-	if err != nil {
+	var sessionsDeleted, notesDeleted, rulesDetached int
+	countSQL := `
+	SELECT name,
+		(SELECT COUNT(*) FROM sessions WHERE project_id = projects.id),
+		(SELECT COUNT(*) FROM notes WHERE project_id = projects.id),
+		(SELECT COUNT(*) FROM assignment_rules WHERE project_id = projects.id)
+	FROM projects WHERE id = ?`
+	err = tx.QueryRow(countSQL, projectID).Scan(&projectName, &sessionsDeleted, &notesDeleted, &rulesDetached)
+	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("progetto non trovato: %v", err)
 	}
 
-	// Elimina tutte le note associate al progetto
-	deleteNotesSQL := `DELETE FROM notes WHERE project_id = ?`
-	result, err := db.Exec(deleteNotesSQL, projectID)
-	if err != nil {
-		return fmt.Errorf("errore eliminazione note del progetto: %v", err)
+	// Le regole restano, senza progetto: quelle che assegnavano solo il progetto non hanno
+	// più nulla da applicare e vengono disattivate
+	if _, err := tx.Exec(`UPDATE assignment_rules SET enabled = 0 WHERE project_id = ? AND activity_type_id IS NULL`, projectID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore disattivazione regole del progetto: %v", err)
 	}
-	notesDeleted, _ := result.RowsAffected()
 
-	// Elimina tutte le sessioni associate al progetto
-	deleteSessionsSQL := `DELETE FROM sessions WHERE project_id = ?`
-	result, err = db.Exec(deleteSessionsSQL, projectID)
-	if err != nil {
-		return fmt.Errorf("errore eliminazione sessioni del progetto: %v", err)
+	if _, err := tx.Exec(`DELETE FROM projects WHERE id = ?`, projectID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore eliminazione progetto: %v", err)
 	}
-	sessionsDeleted, _ := result.RowsAffected()
 
-	// Infine, elimina il progetto stesso
-	deleteProjectSQL := `DELETE FROM projects WHERE id = ?`
-	result, err = db.Exec(deleteProjectSQL, projectID)
-	if err != nil {
-		return fmt.Errorf("errore eliminazione progetto: %v", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit eliminazione progetto: %v", err)
 	}
 
-	fmt.Printf("[DB] Progetto eliminato: %s (ID: %d, sessioni: %d, note: %d)\n", projectName, projectID, sessionsDeleted, notesDeleted)
+	fmt.Printf("[DB] Progetto eliminato: %s (ID: %d, sessioni: %d, note: %d, regole scollegate: %d)\n", projectName, projectID, sessionsDeleted, notesDeleted, rulesDetached)
 	return nil
 }
 
 // CaricaSessioniProgetto carica tutte le sessioni per un progetto specifico
 func CaricaSessioniProgetto(db *sql.DB, projectID int) (map[string]int, error) {
-	query := `
+	query := appUsageCTE + `
 	SELECT app_name, SUM(seconds) as total
-	FROM sessions
+	FROM app_usage
 	WHERE project_id = ?
 	GROUP BY app_name
 	`
@@ -758,15 +595,28 @@ type SessionDetail struct {
 	ProjectName  string
 	SessionType  string
 	ActivityType *string
-	Timestamp    string
+	Timestamp    string // inizio, UTC RFC3339
+	EndedAt      string // fine reale della sessione (UTC RFC3339), vuota se è ancora in corso
+	TimeZone     string // fuso orario IANA in cui è stata registrata la sessione
 }
 
-// CaricaSessioniDettagliate carica le sessioni con timestamp per la timeline
-// Ottimizzato: usa confronto diretto invece di DATE() per sfruttare gli indici
+// sessionEndSQL è la fine reale di una sessione; per quelle in corso, che non hanno ancora
+// ended_at, si usa l'inizio più i secondi salvati finora
+const sessionEndSQL = `COALESCE(s.ended_at, strftime(` + sqlTimestamp + `, s.timestamp, '+' || s.seconds || ' seconds'))`
+
+// sessionOverlapSQL seleziona le sessioni il cui intervallo reale si sovrappone a [inizio, fine);
+// parametri: fine, inizio, inizio (le sessioni appena iniziate, senza durata, sono incluse)
+const sessionOverlapSQL = `s.timestamp < ? AND (` + sessionEndSQL + ` > ? OR s.timestamp >= ?)`
+
+// CaricaSessioniDettagliate carica le sessioni con timestamp per la timeline.
+// Le date sono giorni locali del fuso configurato. Una sessione è inclusa se il suo intervallo
+// reale si sovrappone al periodo, quindi anche quelle iniziate prima della mezzanotte e finite nel periodo.
 func CaricaSessioniDettagliate(db *sql.DB, startDate, endDate string) ([]SessionDetail, error) {
-	// Costruisci range di date per query ottimizzata (usa indice su timestamp)
-	startDateTime := startDate + " 00:00:00"
-	endDateTime := endDate + " 23:59:59"
+	// Estremi UTC dei giorni locali richiesti (usa indice su timestamp)
+	startDateTime, endDateTime, err := intervalloGiorni(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
 
 	query := `
 	SELECT
@@ -776,15 +626,17 @@ func CaricaSessioniDettagliate(db *sql.DB, startDate, endDate string) ([]Session
 		s.project_id,
 		COALESCE(p.name, 'Nessun progetto') as project_name,
 		COALESCE(s.session_type, 'computer') as session_type,
-		s.activity_type,
-		s.timestamp
+		` + sessionActivitySQL + `,
+		s.timestamp,
+		s.ended_at,
+		COALESCE(s.time_zone, '')
 	FROM sessions s
 	LEFT JOIN projects p ON s.project_id = p.id
-	WHERE s.timestamp >= ? AND s.timestamp <= ?
+	WHERE ` + sessionOverlapSQL + `
 	ORDER BY s.timestamp ASC
 	`
 
-	rows, err := db.Query(query, startDateTime, endDateTime)
+	rows, err := db.Query(query, endDateTime, startDateTime, startDateTime)
 	if err != nil {
 		return nil, fmt.Errorf("errore query sessioni dettagliate: %v", err)
 	}
@@ -793,9 +645,11 @@ func CaricaSessioniDettagliate(db *sql.DB, startDate, endDate string) ([]Session
 	var sessions []SessionDetail
 	for rows.Next() {
 		var s SessionDetail
-		if err := rows.Scan(&s.ID, &s.AppName, &s.Seconds, &s.ProjectID, &s.ProjectName, &s.SessionType, &s.ActivityType, &s.Timestamp); err != nil {
+		var endedAt sql.NullString
+		if err := rows.Scan(&s.ID, &s.AppName, &s.Seconds, &s.ProjectID, &s.ProjectName, &s.SessionType, &s.ActivityType, &s.Timestamp, &endedAt, &s.TimeZone); err != nil {
 			return nil, err
 		}
+		s.EndedAt = endedAt.String
 		sessions = append(sessions, s)
 	}
 
@@ -804,9 +658,14 @@ func CaricaSessioniDettagliate(db *sql.DB, startDate, endDate string) ([]Session
 
 // AggiornaActivityType aggiorna il tipo di attività di una sessione
 func AggiornaActivityType(db *sql.DB, sessionID int, activityType *string) error {
-	updateSQL := `UPDATE sessions SET activity_type = ? WHERE id = ?`
+	activityTypeID, err := idTipoAttivita(db, activityType)
+	if err != nil {
+		return fmt.Errorf("errore aggiornamento activity_type: %v", err)
+	}
+
+	updateSQL := `UPDATE sessions SET activity_type_id = ? WHERE id = ?`
 
-	_, err := db.Exec(updateSQL, activityType, sessionID)
+	_, err = db.Exec(updateSQL, activityTypeID, sessionID)
 	if err != nil {
 		return fmt.Errorf("errore aggiornamento activity_type: %v", err)
 	}
@@ -819,8 +678,8 @@ func AggiornaActivityType(db *sql.DB, sessionID int, activityType *string) error
 
 // ArchivaProgetto chiude e archivia un progetto
 func ArchivaProgetto(db *sql.DB, projectID int) error {
-	updateSQL := `UPDATE projects SET archived = 1, closed_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := db.Exec(updateSQL, projectID)
+	updateSQL := `UPDATE projects SET archived = 1, closed_at = ? WHERE id = ?`
+	_, err := db.Exec(updateSQL, FormatTimestamp(now()), projectID)
 	if err != nil {
 		return fmt.Errorf("errore archiviazione progetto: %v", err)
 	}
@@ -861,10 +720,11 @@ func GeneraReportChiusura(db *sql.DB, projectID int) (map[string]interface{}, er
 
 	// Calcola suddivisione per tipo di attività
 	activityBreakdownSQL := `
-		SELECT COALESCE(activity_type, 'Nessuna attività'), SUM(seconds)
-		FROM sessions
-		WHERE project_id = ?
-		GROUP BY activity_type
+		SELECT COALESCE(at.name, 'Nessuna attività'), SUM(s.seconds)
+		FROM sessions s
+		LEFT JOIN activity_types at ON at.id = s.activity_type_id
+		WHERE s.project_id = ?
+		GROUP BY at.name
 	`
 	rows, err := db.Query(activityBreakdownSQL, projectID)
 	if err != nil {
@@ -884,7 +744,8 @@ func GeneraReportChiusura(db *sql.DB, projectID int) (map[string]interface{}, er
 
 	// Calcola date di inizio e fine
 	var startDate, endDate string
-	datesSQL := `SELECT COALESCE(MIN(timestamp), ''), COALESCE(MAX(timestamp), '') FROM sessions WHERE project_id = ?`
+	// La fine del progetto è la fine reale dell'ultima sessione, non il suo inizio
+	datesSQL := `SELECT COALESCE(MIN(s.timestamp), ''), COALESCE(MAX(` + sessionEndSQL + `), '') FROM sessions s WHERE s.project_id = ?`
 	err = db.QueryRow(datesSQL, projectID).Scan(&startDate, &endDate)
 	if err != nil {
 		return nil, fmt.Errorf("errore calcolo date: %v", err)
@@ -908,7 +769,8 @@ func GeneraReportChiusura(db *sql.DB, projectID int) (map[string]interface{}, er
 
 // === FUNZIONI PER MODIFICA SESSIONI ===
 
-// EliminaSessione elimina una sessione dal database
+// EliminaSessione elimina una sessione dal database. Il dettaglio per applicazione, la timeline
+// titoli, le pause e i tratti della sessione vengono eliminati a cascata.
 func EliminaSessione(db *sql.DB, sessionID int) error {
 	deleteSQL := `DELETE FROM sessions WHERE id = ?`
 
@@ -932,44 +794,106 @@ func EliminaSessione(db *sql.DB, sessionID int) error {
 
 // AggiornaDurataSessione aggiorna la durata di una sessione
 func AggiornaDurataSessione(db *sql.DB, sessionID int, nuoviSecondi int) error {
-	updateSQL := `UPDATE sessions SET seconds = ? WHERE id = ?`
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio aggiornamento durata: %v", err)
+	}
+
+	// I tratti registrati non corrispondono più alla durata modificata a mano
+	deleteSegmentsSQL := `DELETE FROM session_segments WHERE session_id = ? AND EXISTS (SELECT 1 FROM sessions WHERE id = ? AND seconds != ?)`
+	if _, err := tx.Exec(deleteSegmentsSQL, sessionID, sessionID, nuoviSecondi); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore eliminazione tratti sessione: %v", err)
+	}
 
-	result, err := db.Exec(updateSQL, nuoviSecondi, sessionID)
+	// La fine si sposta della stessa differenza di durata; una sessione in corso non ha ancora fine
+	updateSQL := `
+	UPDATE sessions SET
+		ended_at = CASE WHEN ended_at IS NULL THEN NULL
+			ELSE strftime(` + sqlTimestamp + `, ended_at, (? - seconds) || ' seconds') END,
+		seconds = ?
+	WHERE id = ?`
+
+	result, err := tx.Exec(updateSQL, nuoviSecondi, nuoviSecondi, sessionID)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore aggiornamento durata: %v", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore verifica aggiornamento: %v", err)
 	}
 
 	if rowsAffected == 0 {
+		tx.Rollback()
 		return fmt.Errorf("sessione non trovata")
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit aggiornamento durata: %v", err)
+	}
+
 	fmt.Printf("[DB] Durata sessione ID %d aggiornata a %d secondi\n", sessionID, nuoviSecondi)
 	return nil
 }
 
 // AggiornaSessioneCompleta aggiorna timestamp, durata e tipo attività di una sessione
 func AggiornaSessioneCompleta(db *sql.DB, sessionID int, newTimestamp string, newSeconds int, activityType *string) error {
-	updateSQL := `UPDATE sessions SET timestamp = ?, seconds = ?, activity_type = ? WHERE id = ?`
+	// Il nuovo inizio arriva in ora locale dall'interfaccia
+	newTimestamp, err := NormalizzaTimestamp(newTimestamp)
+	if err != nil {
+		return fmt.Errorf("errore aggiornamento sessione: %v", err)
+	}
+	activityTypeID, err := idTipoAttivita(db, activityType)
+	if err != nil {
+		return fmt.Errorf("errore aggiornamento sessione: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio aggiornamento sessione: %v", err)
+	}
+
+	// I tratti registrati non corrispondono più a inizio o durata modificati a mano
+	deleteSegmentsSQL := `DELETE FROM session_segments WHERE session_id = ? AND EXISTS (SELECT 1 FROM sessions WHERE id = ? AND (timestamp != ? OR seconds != ?))`
+	if _, err := tx.Exec(deleteSegmentsSQL, sessionID, sessionID, newTimestamp, newSeconds); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore eliminazione tratti sessione: %v", err)
+	}
 
-	result, err := db.Exec(updateSQL, newTimestamp, newSeconds, activityType, sessionID)
+	// Se inizio o durata cambiano la fine reale registrata non vale più: diventa inizio più durata
+	updateSQL := `
+	UPDATE sessions SET
+		ended_at = CASE
+			WHEN ended_at IS NULL THEN NULL
+			WHEN timestamp = ? AND seconds = ? THEN ended_at
+			ELSE ? END,
+		timestamp = ?, seconds = ?, activity_type_id = ?
+	WHERE id = ?`
+
+	result, err := tx.Exec(updateSQL, newTimestamp, newSeconds, fineSessione(newTimestamp, newSeconds), newTimestamp, newSeconds, activityTypeID, sessionID)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore aggiornamento sessione: %v", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore verifica aggiornamento: %v", err)
 	}
 
 	if rowsAffected == 0 {
+		tx.Rollback()
 		return fmt.Errorf("sessione non trovata")
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit aggiornamento sessione: %v", err)
+	}
+
 	fmt.Printf("[DB] Sessione ID %d aggiornata: timestamp=%s, secondi=%d\n", sessionID, newTimestamp, newSeconds)
 	return nil
 }
@@ -984,83 +908,151 @@ func CaricaSessioneById(db *sql.DB, sessionID int) (*SessionDetail, error) {
 		s.project_id,
 		COALESCE(p.name, 'Nessun progetto') as project_name,
 		COALESCE(s.session_type, 'computer') as session_type,
-		s.activity_type,
-		s.timestamp
+		` + sessionActivitySQL + `,
+		s.timestamp,
+		s.ended_at,
+		COALESCE(s.time_zone, '')
 	FROM sessions s
 	LEFT JOIN projects p ON s.project_id = p.id
 	WHERE s.id = ?
 	`
 
 	var s SessionDetail
-	err := db.QueryRow(query, sessionID).Scan(&s.ID, &s.AppName, &s.Seconds, &s.ProjectID, &s.ProjectName, &s.SessionType, &s.ActivityType, &s.Timestamp)
+	var endedAt sql.NullString
+	err := db.QueryRow(query, sessionID).Scan(&s.ID, &s.AppName, &s.Seconds, &s.ProjectID, &s.ProjectName, &s.SessionType, &s.ActivityType, &s.Timestamp, &endedAt, &s.TimeZone)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("sessione con ID %d non trovata", sessionID)
 		}
 		return nil, fmt.Errorf("errore caricamento sessione: %v", err)
 	}
+	s.EndedAt = endedAt.String
 
 	return &s, nil
 }
 
-// DividiSessione divide una sessione in due parti
+// DividiSessione divide una sessione in due parti, in un'unica transazione
 func DividiSessione(db *sql.DB, sessionID int, secondiPrimaParte int, activityTypePrimaParte *string, activityTypeSecondaParte *string) error {
+	activityTypeIDPrimaParte, err := idTipoAttivita(db, activityTypePrimaParte)
+	if err != nil {
+		return fmt.Errorf("errore divisione sessione: %v", err)
+	}
+	activityTypeIDSecondaParte, err := idTipoAttivita(db, activityTypeSecondaParte)
+	if err != nil {
+		return fmt.Errorf("errore divisione sessione: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio divisione sessione: %v", err)
+	}
+
 	// Prima carica la sessione originale
-	var appName, sessionType, timestamp string
+	var appName, sessionType, timestamp, endedAt, timeZone string
 	var seconds int
 	var projectID *int
-	var activityType *string
 
-	query := `SELECT app_name, seconds, project_id, session_type, activity_type, timestamp FROM sessions WHERE id = ?`
-	err := db.QueryRow(query, sessionID).Scan(&appName, &seconds, &projectID, &sessionType, &activityType, &timestamp)
+	query := `SELECT app_name, seconds, project_id, session_type, timestamp, COALESCE(ended_at, ''), COALESCE(time_zone, '') FROM sessions WHERE id = ?`
+	err = tx.QueryRow(query, sessionID).Scan(&appName, &seconds, &projectID, &sessionType, &timestamp, &endedAt, &timeZone)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore caricamento sessione: %v", err)
 	}
 
 	if secondiPrimaParte >= seconds {
+		tx.Rollback()
 		return fmt.Errorf("la prima parte deve essere minore della durata totale")
 	}
 
 	secondiSecondaParte := seconds - secondiPrimaParte
 
-	// Aggiorna la sessione originale con la prima parte
-	updateSQL := `UPDATE sessions SET seconds = ?, activity_type = ? WHERE id = ?`
-	_, err = db.Exec(updateSQL, secondiPrimaParte, activityTypePrimaParte, sessionID)
-	if err != nil {
-		return fmt.Errorf("errore aggiornamento prima parte: %v", err)
-	}
-
 	// Calcola il timestamp per la seconda parte (timestamp originale + secondi prima parte)
 	timestampOriginale, err := parseTimestamp(timestamp)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore parsing timestamp: %v", err)
 	}
 
 	timestampSecondaParte := timestampOriginale.Add(time.Duration(secondiPrimaParte) * time.Second)
-	timestampSecondaParteStr := timestampSecondaParte.Format("2006-01-02 15:04:05")
+	timestampSecondaParteStr := FormatTimestamp(timestampSecondaParte)
+
+	// La seconda parte finisce dove finiva la sessione originale
+	var fineSecondaParte interface{} = endedAt
+	if endedAt == "" {
+		fineSecondaParte = fineSessione(timestampSecondaParteStr, secondiSecondaParte)
+	}
+
+	// Aggiorna la sessione originale con la prima parte
+	updateSQL := `UPDATE sessions SET seconds = ?, activity_type_id = ?, ended_at = ? WHERE id = ?`
+	_, err = tx.Exec(updateSQL, secondiPrimaParte, activityTypeIDPrimaParte, timestampSecondaParteStr, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore aggiornamento prima parte: %v", err)
+	}
 
 	// Crea una nuova sessione per la seconda parte
-	insertSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err = db.Exec(insertSQL, appName, secondiSecondaParte, projectID, sessionType, activityTypeSecondaParte, timestampSecondaParteStr)
+	// La seconda parte è registrata nello stesso fuso della sessione originale
+	if timeZone == "" {
+		timeZone = TimeZoneName()
+	}
+
+	insertSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at, time_zone) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(insertSQL, appName, secondiSecondaParte, projectID, sessionType, activityTypeIDSecondaParte, timestampSecondaParteStr, fineSecondaParte, nullIfEmpty(timeZone))
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore creazione seconda parte: %v", err)
 	}
+	newSessionID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore recupero ID seconda parte: %v", err)
+	}
+
+	// Con i tratti registrati la seconda parte inizia all'istante reale della divisione
+	splitAt, err := dividiSegmenti(tx, int64(sessionID), newSessionID, secondiPrimaParte)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !splitAt.IsZero() {
+		splitAtStr := FormatTimestamp(splitAt)
+		if _, err := tx.Exec(`UPDATE sessions SET timestamp = ? WHERE id = ?`, splitAtStr, newSessionID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore aggiornamento inizio seconda parte: %v", err)
+		}
+		if _, err := tx.Exec(`UPDATE sessions SET ended_at = ? WHERE id = ?`, splitAtStr, sessionID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore aggiornamento fine prima parte: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit divisione sessione: %v", err)
+	}
 
 	fmt.Printf("[DB] Sessione ID %d divisa in due parti: %d sec e %d sec\n", sessionID, secondiPrimaParte, secondiSecondaParte)
 	return nil
 }
 
-// parseTimestamp converte un timestamp string in time.Time
+// parseTimestamp converte un timestamp string in time.Time nel fuso configurato.
+// I timestamp RFC3339 (quelli del database) indicano l'istante esatto; quelli senza
+// fuso (inseriti dall'interfaccia) sono in ora locale del fuso configurato.
 func parseTimestamp(timestamp string) (time.Time, error) {
-	// Prova diversi formati
+	loc := TimeZone()
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t.In(loc), nil
+	}
+
+	// Prova i formati senza fuso
 	formats := []string{
 		"2006-01-02 15:04:05",
-		"2006-01-02T15:04:05Z",
 		"2006-01-02T15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02T15:04",
 	}
 
 	for _, format := range formats {
-		t, err := time.Parse(format, timestamp)
+		t, err := time.ParseInLocation(format, timestamp, loc)
 		if err == nil {
 			return t, nil
 		}
@@ -1069,11 +1061,31 @@ func parseTimestamp(timestamp string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("formato timestamp non riconosciuto: %s", timestamp)
 }
 
+// fineSessione restituisce la fine di una sessione che inizia a timestamp e dura seconds secondi.
+// Con un timestamp non riconosciuto la fine resta NULL e le query usano inizio più durata.
+func fineSessione(timestamp string, seconds int) interface{} {
+	start, err := parseTimestamp(timestamp)
+	if err != nil {
+		return nil
+	}
+	return FormatTimestamp(start.Add(time.Duration(seconds) * time.Second))
+}
+
 // CreaSessione crea una nuova sessione manuale
 func CreaSessione(db *sql.DB, appName string, seconds int, projectID *int, sessionType string, activityType *string, timestamp string) error {
-	insertSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)`
+	// L'inizio arriva in ora locale dall'interfaccia
+	timestamp, err := NormalizzaTimestamp(timestamp)
+	if err != nil {
+		return fmt.Errorf("errore creazione sessione: %v", err)
+	}
+	activityTypeID, err := idTipoAttivita(db, activityType)
+	if err != nil {
+		return fmt.Errorf("errore creazione sessione: %v", err)
+	}
+
+	insertSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at, time_zone) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := db.Exec(insertSQL, appName, seconds, projectID, sessionType, activityType, timestamp)
+	result, err := db.Exec(insertSQL, appName, seconds, projectID, sessionType, activityTypeID, timestamp, fineSessione(timestamp, seconds), nullIfEmpty(TimeZoneName()))
 	if err != nil {
 		return fmt.Errorf("errore creazione sessione: %v", err)
 	}
@@ -1087,8 +1099,78 @@ func CreaSessione(db *sql.DB, appName string, seconds int, projectID *int, sessi
 	return nil
 }
 
+// SessionePeriodo è una parte di un periodo fuori dal computer da salvare come sessione
+type SessionePeriodo struct {
+	ProjectID    int
+	ActivityType *string
+	Seconds      int
+	Timestamp    string // inizio, UTC RFC3339
+}
+
+// CreaSessioniPeriodo crea in un'unica transazione le sessioni in cui è diviso un periodo
+// e rimuove il periodo dalla coda dei pendenti (pendingID 0 se non è in coda)
+func CreaSessioniPeriodo(db *sql.DB, appName string, sessionType string, parts []SessionePeriodo, pendingID int64) error {
+	activityTypeIDs := make([]sql.NullInt64, len(parts))
+	for i, part := range parts {
+		id, err := idTipoAttivita(db, part.ActivityType)
+		if err != nil {
+			return fmt.Errorf("errore creazione sessione: %v", err)
+		}
+		activityTypeIDs[i] = id
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio transazione: %v", err)
+	}
+
+	insertSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at, time_zone) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	for i, part := range parts {
+		if _, err := tx.Exec(insertSQL, appName, part.Seconds, part.ProjectID, sessionType, activityTypeIDs[i], part.Timestamp, fineSessione(part.Timestamp, part.Seconds), nullIfEmpty(TimeZoneName())); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore creazione sessione: %v", err)
+		}
+	}
+
+	if pendingID > 0 {
+		if _, err := tx.Exec(`DELETE FROM pending_idle_periods WHERE id = ?`, pendingID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore eliminazione periodo pendente: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit sessioni: %v", err)
+	}
+
+	fmt.Printf("[DB] Periodo diviso in %d sessioni: %s\n", len(parts), appName)
+	return nil
+}
+
 // === FUNZIONI PER TIPI DI ATTIVITÀ ===
 
+// sessionActivitySQL è il nome del tipo attività di una sessione (alias s): le sessioni fanno
+// riferimento al tipo per ID, quindi un tipo rinominato resta collegato
+const sessionActivitySQL = `(SELECT name FROM activity_types WHERE id = s.activity_type_id)`
+
+// idTipoAttivita restituisce l'ID da salvare in activity_type_id per il tipo attività con il
+// nome indicato: NULL se il tipo non è indicato (nil o vuoto), un errore se non esiste
+func idTipoAttivita(db *sql.DB, name *string) (sql.NullInt64, error) {
+	if name == nil || *name == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	var id int64
+	err := db.QueryRow(`SELECT id FROM activity_types WHERE name = ?`, *name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return sql.NullInt64{}, fmt.Errorf("tipo attività '%s' non trovato", *name)
+	}
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("errore ricerca tipo attività: %v", err)
+	}
+	return sql.NullInt64{Int64: id, Valid: true}, nil
+}
+
 // ActivityType rappresenta un tipo di attività configurabile
 type ActivityType struct {
 	ID           int
@@ -1097,13 +1179,24 @@ type ActivityType struct {
 	Pattern      string
 	DisplayOrder int
 	CreatedAt    string
+	Archived     bool // nascosto dalla scelta del tipo, ma ancora presente nelle sessioni e nei report
 }
 
-// CaricaTipiAttivita carica tutti i tipi di attività
+// CaricaTipiAttivita carica i tipi di attività attivi
 func CaricaTipiAttivita(db *sql.DB) ([]ActivityType, error) {
-	query := `SELECT id, name, color_variant, COALESCE(pattern, 'solid'), display_order, COALESCE(created_at, '') FROM activity_types ORDER BY display_order ASC`
+	return caricaTipiAttivita(db, false)
+}
 
-	rows, err := db.Query(query)
+// CaricaTipiAttivitaArchiviati carica i tipi di attività archiviati
+func CaricaTipiAttivitaArchiviati(db *sql.DB) ([]ActivityType, error) {
+	return caricaTipiAttivita(db, true)
+}
+
+// caricaTipiAttivita carica i tipi di attività attivi o archiviati
+func caricaTipiAttivita(db *sql.DB, archived bool) ([]ActivityType, error) {
+	query := `SELECT id, name, color_variant, COALESCE(pattern, 'solid'), display_order, COALESCE(created_at, ''), archived FROM activity_types WHERE archived = ? ORDER BY display_order ASC`
+
+	rows, err := db.Query(query, archived)
 	if err != nil {
 		fmt.Printf("[DB] Errore query tipi attività: %v\n", err)
 		return nil, fmt.Errorf("errore query tipi attività: %v", err)
@@ -1113,7 +1206,7 @@ func CaricaTipiAttivita(db *sql.DB) ([]ActivityType, error) {
 	var types []ActivityType
 	for rows.Next() {
 		var t ActivityType
-		if err := rows.Scan(&t.ID, &t.Name, &t.ColorVariant, &t.Pattern, &t.DisplayOrder, &t.CreatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.Name, &t.ColorVariant, &t.Pattern, &t.DisplayOrder, &t.CreatedAt, &t.Archived); err != nil {
 			fmt.Printf("[DB] Errore scan tipo attività: %v\n", err)
 			return nil, err
 		}
@@ -1128,9 +1221,16 @@ func CaricaTipiAttivita(db *sql.DB) ([]ActivityType, error) {
 func CreaTipoAttivita(db *sql.DB, name string, colorVariant float64, pattern string, displayOrder int) (int64, error) {
 	fmt.Printf("[DB] Tentativo creazione tipo attività: name=%s, color=%.2f, pattern=%s, order=%d\n", name, colorVariant, pattern, displayOrder)
 
-	insertSQL := `INSERT INTO activity_types (name, color_variant, pattern, display_order) VALUES (?, ?, ?, ?)`
+	// Il nome di un tipo archiviato resta occupato: va riattivato invece di crearne uno nuovo
+	var archived bool
+	err := db.QueryRow(`SELECT archived FROM activity_types WHERE name = ?`, name).Scan(&archived)
+	if err == nil && archived {
+		return 0, fmt.Errorf("esiste già un tipo attività archiviato '%s': riattivalo dalle impostazioni", name)
+	}
+
+	insertSQL := `INSERT INTO activity_types (name, color_variant, pattern, display_order, created_at) VALUES (?, ?, ?, ?, ?)`
 
-	result, err := db.Exec(insertSQL, name, colorVariant, pattern, displayOrder)
+	result, err := db.Exec(insertSQL, name, colorVariant, pattern, displayOrder, FormatTimestamp(now()))
 	if err != nil {
 		fmt.Printf("[DB] ERRORE creazione tipo attività: %v\n", err)
 		return 0, fmt.Errorf("errore creazione tipo attività: %v", err)
@@ -1167,34 +1267,64 @@ func AggiornaTipoAttivita(db *sql.DB, id int, name string, colorVariant float64,
 	return nil
 }
 
-// EliminaTipoAttivita elimina un tipo di attività
-func EliminaTipoAttivita(db *sql.DB, id int) error {
-	// Prima aggiorna tutte le sessioni che usano questo tipo a NULL
-	updateSessionsSQL := `UPDATE sessions SET activity_type = NULL WHERE activity_type = (SELECT name FROM activity_types WHERE id = ?)`
-	_, err := db.Exec(updateSessionsSQL, id)
-	if err != nil {
-		return fmt.Errorf("errore aggiornamento sessioni: %v", err)
-	}
+// ArchivaTipoAttivita archivia un tipo di attività: non è più proponibile per nuove sessioni,
+// ma le sessioni esistenti lo mantengono e i report continuano a mostrarlo
+func ArchivaTipoAttivita(db *sql.DB, id int) error {
+	return impostaArchiviazioneTipoAttivita(db, id, true)
+}
 
-	// Poi elimina il tipo
-	deleteSQL := `DELETE FROM activity_types WHERE id = ?`
-	result, err := db.Exec(deleteSQL, id)
+// RiattivaTipoAttivita riattiva un tipo di attività archiviato
+func RiattivaTipoAttivita(db *sql.DB, id int) error {
+	return impostaArchiviazioneTipoAttivita(db, id, false)
+}
+
+// impostaArchiviazioneTipoAttivita archivia o riattiva un tipo di attività
+func impostaArchiviazioneTipoAttivita(db *sql.DB, id int, archived bool) error {
+	result, err := db.Exec(`UPDATE activity_types SET archived = ? WHERE id = ?`, archived, id)
 	if err != nil {
-		return fmt.Errorf("errore eliminazione tipo attività: %v", err)
+		return fmt.Errorf("errore archiviazione tipo attività: %v", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("errore verifica eliminazione: %v", err)
+		return fmt.Errorf("errore verifica archiviazione: %v", err)
 	}
 	if rowsAffected == 0 {
 		return fmt.Errorf("tipo attività non trovato")
 	}
 
-	fmt.Printf("[DB] Tipo attività ID %d eliminato\n", id)
+	if archived {
+		fmt.Printf("[DB] Tipo attività ID %d archiviato\n", id)
+	} else {
+		fmt.Printf("[DB] Tipo attività ID %d riattivato\n", id)
+	}
 	return nil
 }
 
+// RisolviTipoAttivita restituisce l'ID del tipo attività con il nome indicato, creandolo
+// archiviato se non esiste (per le importazioni di sessioni con tipi non più presenti)
+func RisolviTipoAttivita(tx *sql.Tx, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM activity_types WHERE name = ?`, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("errore ricerca tipo attività: %v", err)
+	}
+
+	insertSQL := `
+	INSERT INTO activity_types (name, color_variant, pattern, display_order, created_at, archived)
+	VALUES (?, 0.0, 'solid', (SELECT COALESCE(MAX(display_order), 0) + 1 FROM activity_types), ?, 1)`
+	result, err := tx.Exec(insertSQL, name, FormatTimestamp(now()))
+	if err != nil {
+		return 0, fmt.Errorf("errore creazione tipo attività '%s': %v", name, err)
+	}
+
+	fmt.Printf("[DB] Tipo attività '%s' creato come archiviato\n", name)
+	return result.LastInsertId()
+}
+
 // AggiornaOrdineTipoAttivita aggiorna l'ordine di visualizzazione di un tipo attività
 func AggiornaOrdineTipoAttivita(db *sql.DB, id int, displayOrder int) error {
 	updateSQL := `UPDATE activity_types SET display_order = ? WHERE id = ?`
@@ -1244,78 +1374,177 @@ type PendingTracking struct {
 	StartTime        string
 	LastSavedSeconds int
 	LastUpdate       string
+	PausedAt         *string // inizio della pausa in corso, nil se non in pausa
 }
 
-// StartPendingTracking crea una nuova sessione e registra il tracking pendente
+// StartPendingTracking crea una nuova sessione e registra il tracking pendente (startTime UTC RFC3339),
+// in un'unica transazione
 func StartPendingTracking(db *sql.DB, projectID *int, activityType *string, startTime string) (int64, error) {
+	activityTypeID, err := idTipoAttivita(db, activityType)
+	if err != nil {
+		return 0, fmt.Errorf("errore avvio pending tracking: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("errore avvio pending tracking: %v", err)
+	}
+
 	// Crea la sessione con 0 secondi (verrà aggiornata periodicamente)
-	insertSessionSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := db.Exec(insertSessionSQL, "Sessione di lavoro", 0, projectID, "computer", activityType, startTime)
+	insertSessionSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, time_zone) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(insertSessionSQL, "Sessione di lavoro", 0, projectID, "computer", activityTypeID, startTime, nullIfEmpty(TimeZoneName()))
 	if err != nil {
+		tx.Rollback()
 		return 0, fmt.Errorf("errore creazione sessione pendente: %v", err)
 	}
 
 	sessionID, err := result.LastInsertId()
 	if err != nil {
+		tx.Rollback()
 		return 0, fmt.Errorf("errore recupero ID sessione: %v", err)
 	}
 
 	// Registra il pending tracking
-	insertPendingSQL := `INSERT INTO pending_tracking (session_id, project_id, activity_type, start_time, last_saved_seconds) VALUES (?, ?, ?, ?, ?)`
-	_, err = db.Exec(insertPendingSQL, sessionID, projectID, activityType, startTime, 0)
+	insertPendingSQL := `INSERT INTO pending_tracking (session_id, project_id, activity_type_id, start_time, last_saved_seconds, last_update) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(insertPendingSQL, sessionID, projectID, activityTypeID, startTime, 0, FormatTimestamp(now()))
 	if err != nil {
-		// Rollback: elimina la sessione creata
-		db.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
+		tx.Rollback()
 		return 0, fmt.Errorf("errore registrazione pending tracking: %v", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("errore commit pending tracking: %v", err)
+	}
+
 	fmt.Printf("[DB] Pending tracking avviato - Session ID: %d\n", sessionID)
 	return sessionID, nil
 }
 
 // UpdatePendingTracking aggiorna i secondi della sessione pendente
 func UpdatePendingTracking(db *sql.DB, sessionID int64, totalSeconds int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio aggiornamento pending tracking: %v", err)
+	}
+
 	// Aggiorna i secondi nella sessione
 	updateSessionSQL := `UPDATE sessions SET seconds = ? WHERE id = ?`
-	_, err := db.Exec(updateSessionSQL, totalSeconds, sessionID)
+	_, err = tx.Exec(updateSessionSQL, totalSeconds, sessionID)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore aggiornamento sessione: %v", err)
 	}
 
 	// Aggiorna last_saved_seconds e last_update nel pending tracking
-	updatePendingSQL := `UPDATE pending_tracking SET last_saved_seconds = ?, last_update = CURRENT_TIMESTAMP WHERE session_id = ?`
-	_, err = db.Exec(updatePendingSQL, totalSeconds, sessionID)
+	updatePendingSQL := `UPDATE pending_tracking SET last_saved_seconds = ?, last_update = ? WHERE session_id = ?`
+	_, err = tx.Exec(updatePendingSQL, totalSeconds, FormatTimestamp(now()), sessionID)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore aggiornamento pending tracking: %v", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit pending tracking: %v", err)
+	}
+
 	fmt.Printf("[DB] Pending tracking aggiornato - Session ID: %d, Secondi: %d\n", sessionID, totalSeconds)
 	return nil
 }
 
-// FinalizePendingTracking finalizza la sessione e rimuove il pending tracking
-func FinalizePendingTracking(db *sql.DB, sessionID int64, finalSeconds int) error {
-	// Aggiorna i secondi finali nella sessione
-	updateSessionSQL := `UPDATE sessions SET seconds = ? WHERE id = ?`
-	_, err := db.Exec(updateSessionSQL, finalSeconds, sessionID)
+// FinalizePendingTracking finalizza la sessione con i secondi attivi e l'istante reale di fine
+// e rimuove il pending tracking
+func FinalizePendingTracking(db *sql.DB, sessionID int64, finalSeconds int, endedAt time.Time) error {
+	tx, err := db.Begin()
 	if err != nil {
+		return fmt.Errorf("errore avvio finalizzazione sessione: %v", err)
+	}
+
+	// Aggiorna i secondi finali e la fine nella sessione
+	updateSessionSQL := `UPDATE sessions SET seconds = ?, ended_at = ? WHERE id = ?`
+	_, err = tx.Exec(updateSessionSQL, finalSeconds, FormatTimestamp(endedAt), sessionID)
+	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore finalizzazione sessione: %v", err)
 	}
 
 	// Rimuovi il pending tracking
 	deletePendingSQL := `DELETE FROM pending_tracking WHERE session_id = ?`
-	_, err = db.Exec(deletePendingSQL, sessionID)
+	_, err = tx.Exec(deletePendingSQL, sessionID)
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("errore rimozione pending tracking: %v", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit finalizzazione sessione: %v", err)
+	}
+
 	fmt.Printf("[DB] Pending tracking finalizzato - Session ID: %d, Secondi finali: %d\n", sessionID, finalSeconds)
 	return nil
 }
 
+// DividiSessionePendente chiude la sessione pendente con i secondi indicati e apre una nuova
+// sessione pendente (stesso tipo di sessione) per progetto e tipo attività indicati, a partire da splitTime.
+// Tutto avviene in una transazione: la sessione in corso non resta mai senza pending tracking.
+func DividiSessionePendente(db *sql.DB, sessionID int64, seconds int, projectID *int, activityType *string, splitTime string) (int64, error) {
+	activityTypeID, err := idTipoAttivita(db, activityType)
+	if err != nil {
+		return 0, fmt.Errorf("errore divisione sessione pendente: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("errore avvio divisione sessione pendente: %v", err)
+	}
+
+	var appName, sessionType string
+	err = tx.QueryRow(`SELECT app_name, COALESCE(session_type, 'computer') FROM sessions WHERE id = ?`, sessionID).Scan(&appName, &sessionType)
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("errore caricamento sessione pendente: %v", err)
+	}
+
+	// Chiudi la parte già trascorsa: finisce all'istante della divisione
+	if _, err := tx.Exec(`UPDATE sessions SET seconds = ?, ended_at = ? WHERE id = ?`, seconds, splitTime, sessionID); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("errore aggiornamento prima parte: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM pending_tracking WHERE session_id = ?`, sessionID); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("errore rimozione pending tracking: %v", err)
+	}
+
+	// Apri la nuova sessione pendente
+	insertSessionSQL := `INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, time_zone) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(insertSessionSQL, appName, 0, projectID, sessionType, activityTypeID, splitTime, nullIfEmpty(TimeZoneName()))
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("errore creazione seconda parte: %v", err)
+	}
+
+	newSessionID, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("errore recupero ID sessione: %v", err)
+	}
+
+	insertPendingSQL := `INSERT INTO pending_tracking (session_id, project_id, activity_type_id, start_time, last_saved_seconds, last_update) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(insertPendingSQL, newSessionID, projectID, activityTypeID, splitTime, 0, FormatTimestamp(now())); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("errore registrazione pending tracking: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("errore commit divisione sessione pendente: %v", err)
+	}
+
+	fmt.Printf("[DB] Sessione pendente ID %d divisa dopo %d sec - nuova sessione ID %d\n", sessionID, seconds, newSessionID)
+	return newSessionID, nil
+}
+
 // GetAllPendingTracking restituisce tutte le sessioni pendenti (per recovery all'avvio)
 func GetAllPendingTracking(db *sql.DB) ([]PendingTracking, error) {
-	query := `SELECT id, session_id, project_id, activity_type, start_time, last_saved_seconds, last_update FROM pending_tracking`
+	query := `SELECT id, session_id, project_id, (SELECT name FROM activity_types WHERE id = activity_type_id), start_time, last_saved_seconds, last_update, paused_at FROM pending_tracking`
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -1326,7 +1555,7 @@ func GetAllPendingTracking(db *sql.DB) ([]PendingTracking, error) {
 	var pendingList []PendingTracking
 	for rows.Next() {
 		var p PendingTracking
-		if err := rows.Scan(&p.ID, &p.SessionID, &p.ProjectID, &p.ActivityType, &p.StartTime, &p.LastSavedSeconds, &p.LastUpdate); err != nil {
+		if err := rows.Scan(&p.ID, &p.SessionID, &p.ProjectID, &p.ActivityType, &p.StartTime, &p.LastSavedSeconds, &p.LastUpdate, &p.PausedAt); err != nil {
 			return nil, err
 		}
 		pendingList = append(pendingList, p)
@@ -1335,7 +1564,8 @@ func GetAllPendingTracking(db *sql.DB) ([]PendingTracking, error) {
 	return pendingList, nil
 }
 
-// RecoverPendingTracking recupera e finalizza sessioni pendenti da crash precedenti
+// RecoverPendingTracking recupera e finalizza sessioni pendenti da crash precedenti.
+// Ogni sessione è recuperata nella propria transazione: un errore non blocca le altre.
 func RecoverPendingTracking(db *sql.DB) (int, error) {
 	pendingList, err := GetAllPendingTracking(db)
 	if err != nil {
@@ -1344,35 +1574,10 @@ func RecoverPendingTracking(db *sql.DB) (int, error) {
 
 	recovered := 0
 	for _, p := range pendingList {
-		// Finalizza la sessione con i secondi salvati
-		if p.LastSavedSeconds > 0 {
-			// Aggiorna la sessione con i secondi salvati
-			updateSQL := `UPDATE sessions SET seconds = ? WHERE id = ?`
-			_, err := db.Exec(updateSQL, p.LastSavedSeconds, p.SessionID)
-			if err != nil {
-				fmt.Printf("[DB] Errore recupero sessione ID %d: %v\n", p.SessionID, err)
-				continue
-			}
-			fmt.Printf("[DB] Sessione ID %d recuperata con %d secondi\n", p.SessionID, p.LastSavedSeconds)
-		} else {
-			// Se 0 secondi, elimina la sessione vuota
-			deleteSQL := `DELETE FROM sessions WHERE id = ?`
-			_, err := db.Exec(deleteSQL, p.SessionID)
-			if err != nil {
-				fmt.Printf("[DB] Errore eliminazione sessione vuota ID %d: %v\n", p.SessionID, err)
-			} else {
-				fmt.Printf("[DB] Sessione vuota ID %d eliminata\n", p.SessionID)
-			}
-		}
-
-		// Rimuovi il pending tracking
-		deletePendingSQL := `DELETE FROM pending_tracking WHERE id = ?`
-		_, err := db.Exec(deletePendingSQL, p.ID)
-		if err != nil {
-			fmt.Printf("[DB] Errore rimozione pending tracking ID %d: %v\n", p.ID, err)
+		if err := recuperaPendente(db, p); err != nil {
+			fmt.Printf("[DB] Errore recupero sessione ID %d: %v\n", p.SessionID, err)
 			continue
 		}
-
 		recovered++
 	}
 
@@ -1382,3 +1587,197 @@ func RecoverPendingTracking(db *sql.DB) (int, error) {
 
 	return recovered, nil
 }
+
+// recuperaPendente finalizza (o elimina, se vuota) una sessione pendente e ne rimuove il
+// pending tracking
+func recuperaPendente(db *sql.DB, p PendingTracking) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio recupero: %v", err)
+	}
+
+	// Se era in pausa i secondi salvati all'inizio della pausa sono esatti e la sessione
+	// è finita lì: la pausa mai ripresa non fa parte della sessione
+	if p.PausedAt != nil {
+		if _, err := tx.Exec(`DELETE FROM pause_intervals WHERE session_id = ? AND end_time IS NULL`, p.SessionID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore chiusura pausa: %v", err)
+		}
+		fmt.Printf("[DB] Sessione ID %d era in pausa dal %s: chiusa all'inizio della pausa\n", p.SessionID, *p.PausedAt)
+	}
+
+	// I tratti salvati danno la composizione esatta della sessione fino all'ultimo salvataggio
+	seconds := p.LastSavedSeconds
+	var endedAt interface{}
+	if segmentSeconds, segmentEnd, ok := recuperaSegmenti(tx, p.SessionID); ok {
+		seconds = segmentSeconds
+		endedAt = FormatTimestamp(segmentEnd)
+	} else if p.PausedAt != nil {
+		endedAt = *p.PausedAt
+	}
+
+	if seconds > 0 {
+		// Finalizza la sessione con i secondi salvati
+		// Senza tratti né pausa la fine è stimata da inizio più secondi salvati
+		updateSQL := `UPDATE sessions SET seconds = ?, ended_at = COALESCE(strftime(` + sqlTimestamp + `, ?), strftime(` + sqlTimestamp + `, timestamp, '+' || ? || ' seconds')) WHERE id = ?`
+		if _, err := tx.Exec(updateSQL, seconds, endedAt, seconds, p.SessionID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore finalizzazione sessione: %v", err)
+		}
+	} else {
+		// Se 0 secondi, elimina la sessione vuota: i dati collegati e il pending tracking
+		// vengono eliminati a cascata
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, p.SessionID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore eliminazione sessione vuota: %v", err)
+		}
+	}
+
+	// Rimuovi il pending tracking
+	if _, err := tx.Exec(`DELETE FROM pending_tracking WHERE id = ?`, p.ID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore rimozione pending tracking: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit recupero: %v", err)
+	}
+
+	if seconds > 0 {
+		fmt.Printf("[DB] Sessione ID %d recuperata con %d secondi\n", p.SessionID, seconds)
+	} else {
+		fmt.Printf("[DB] Sessione vuota ID %d eliminata\n", p.SessionID)
+	}
+	return nil
+}
+
+// recuperaSegmenti sistema i tratti di una sessione interrotta da un crash: la sessione finisce
+// con l'ultimo tratto attivo, quindi i tratti aperti o successivi vengono rimossi.
+// Restituisce i secondi attivi dei tratti e la fine dell'ultimo tratto attivo, e false se la
+// sessione non ha tratti.
+func recuperaSegmenti(exec dbExecutor, sessionID int) (int, time.Time, bool) {
+	segments, err := caricaSegmenti(exec, segmentiSessioneSQL, sessionID)
+	if err != nil {
+		fmt.Printf("[DB] Errore caricamento tratti sessione ID %d: %v\n", sessionID, err)
+		return 0, time.Time{}, false
+	}
+
+	lastActive := -1
+	seconds := 0
+	for i, segment := range segments {
+		if segment.Type == SegmentActive {
+			lastActive = i
+			seconds += segment.Seconds()
+		}
+	}
+	if lastActive < 0 {
+		return 0, time.Time{}, false
+	}
+
+	if err := salvaSegmenti(exec, int64(sessionID), segments[:lastActive+1]); err != nil {
+		fmt.Printf("[DB] Errore recupero tratti sessione ID %d: %v\n", sessionID, err)
+	}
+	return seconds, segments[lastActive].EndTime, true
+}
+
+// === UTILIZZO APPLICAZIONI ===
+
+// SalvaUtilizzoApp salva il tempo per applicazione accumulato dal watcher per una sessione.
+// I valori sostituiscono quelli già salvati, perché il watcher fornisce sempre i totali.
+func SalvaUtilizzoApp(db *sql.DB, sessionID int64, appTimes map[string]int) error {
+	if len(appTimes) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio salvataggio utilizzo app: %v", err)
+	}
+
+	upsertSQL := `
+	INSERT INTO session_app_usage (session_id, app_name, seconds) VALUES (?, ?, ?)
+	ON CONFLICT(session_id, app_name) DO UPDATE SET seconds = excluded.seconds
+	`
+	for appName, seconds := range appTimes {
+		if seconds < 0 {
+			seconds = 0
+		}
+		if _, err := tx.Exec(upsertSQL, sessionID, appName, seconds); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore salvataggio utilizzo app %s: %v", appName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit utilizzo app: %v", err)
+	}
+
+	fmt.Printf("[DB] Utilizzo app salvato - Session ID: %d, App: %d\n", sessionID, len(appTimes))
+	return nil
+}
+
+// CaricaUtilizzoAppSessione carica il tempo per applicazione di una sessione
+func CaricaUtilizzoAppSessione(db *sql.DB, sessionID int) (map[string]int, error) {
+	query := `
+	SELECT app_name, seconds
+	FROM session_app_usage
+	WHERE session_id = ?
+	`
+
+	return caricaTotaliApp(db, query, sessionID)
+}
+
+// CaricaUtilizzoAppProgetto carica il tempo per applicazione di tutte le sessioni di un progetto
+func CaricaUtilizzoAppProgetto(db *sql.DB, projectID int) (map[string]int, error) {
+	query := `
+	SELECT u.app_name, SUM(u.seconds) as total
+	FROM session_app_usage u
+	JOIN sessions s ON s.id = u.session_id
+	WHERE s.project_id = ?
+	GROUP BY u.app_name
+	`
+
+	return caricaTotaliApp(db, query, projectID)
+}
+
+// CaricaUtilizzoAppPeriodo carica il tempo per applicazione delle sessioni iniziate nei giorni locali
+// da startDate a endDate inclusi
+func CaricaUtilizzoAppPeriodo(db *sql.DB, startDate, endDate string) (map[string]int, error) {
+	query := `
+	SELECT u.app_name, SUM(u.seconds) as total
+	FROM session_app_usage u
+	JOIN sessions s ON s.id = u.session_id
+	WHERE s.timestamp >= ? AND s.timestamp < ?
+	GROUP BY u.app_name
+	`
+
+	start, end, err := intervalloGiorni(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return caricaTotaliApp(db, query, start, end)
+}
+
+// caricaTotaliApp esegue una query (app_name, secondi) e restituisce la mappa dei totali
+func caricaTotaliApp(db *sql.DB, query string, args ...interface{}) (map[string]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore query utilizzo app: %v", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]int)
+	for rows.Next() {
+		var appName string
+		var total int
+		if err := rows.Scan(&appName, &total); err != nil {
+			return nil, err
+		}
+		stats[appName] = total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("errore lettura utilizzo app: %v", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,237 @@
+package tracker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreaSessioneTipoAttivita(t *testing.T) {
+	db := apriDBTest(t)
+	ricerca, vuoto, sconosciuto := "RICERCA", "", "INESISTENTE"
+
+	tests := []struct {
+		name         string
+		activityType *string
+		want         *string
+		wantErr      bool
+	}{
+		{"tipo esistente", &ricerca, &ricerca, false},
+		{"nessun tipo", nil, nil, false},
+		{"tipo vuoto", &vuoto, nil, false},
+		{"tipo sconosciuto", &sconosciuto, nil, true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamp := FormatTimestamp(testStart.Add(time.Duration(i) * time.Hour))
+			err := CreaSessione(db, "Riunione", 600, nil, "manual", tt.activityType, timestamp)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("atteso un errore per il tipo attività sconosciuto")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("errore creazione sessione: %v", err)
+			}
+		})
+	}
+
+	day := testStart.Format("2006-01-02")
+	sessions, err := CaricaSessioniDettagliate(db, day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("sessioni salvate = %d, attese 3: il tipo sconosciuto non deve creare la sessione", len(sessions))
+	}
+	for i, s := range sessions {
+		want := tests[i].want
+		if (s.ActivityType == nil) != (want == nil) || (want != nil && *s.ActivityType != *want) {
+			t.Errorf("%s: tipo salvato = %v, atteso %v", tests[i].name, s.ActivityType, want)
+		}
+	}
+}
+
+func TestCreaSessioniPeriodoTipoSconosciuto(t *testing.T) {
+	db := apriDBTest(t)
+	projectID, err := CreaProgetto(db, "Cliente", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := testStart.UTC()
+	pendingID, err := SalvaPeriodoPendente(db, IdlePeriod{Type: PeriodIdle, StartTime: start, EndTime: start.Add(time.Hour), Duration: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sconosciuto := "INESISTENTE"
+	parts := []SessionePeriodo{
+		{ProjectID: int(projectID), Seconds: 1800, Timestamp: FormatTimestamp(start)},
+		{ProjectID: int(projectID), ActivityType: &sconosciuto, Seconds: 1800, Timestamp: FormatTimestamp(start.Add(30 * time.Minute))},
+	}
+	if err := CreaSessioniPeriodo(db, "Tempo Idle", "off-computer", parts, pendingID); err == nil {
+		t.Fatal("atteso un errore per il tipo attività sconosciuto")
+	}
+
+	// Nessuna sessione creata e il periodo resta da attribuire
+	day := testStart.Format("2006-01-02")
+	sessions, err := CaricaSessioniDettagliate(db, day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("sessioni create = %d, attese 0", len(sessions))
+	}
+	periods, err := CaricaPeriodiPendenti(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(periods) != 1 {
+		t.Errorf("periodi pendenti = %d, atteso 1", len(periods))
+	}
+}
+
+func TestCaricaUtilizzoAppPeriodoGiorniLocali(t *testing.T) {
+	db := apriDBTest(t)
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTimeZone("") })
+
+	// Inizi in UTC: a Roma (UTC+1) le sessioni vicine alla mezzanotte cambiano giorno
+	sessions := []struct {
+		timestamp string
+		app       string
+		seconds   int
+	}{
+		{"2026-02-28T23:30:00Z", "Inizio.exe", 50}, // 01/03 00:30
+		{"2026-03-01T10:00:00Z", "Code.exe", 100},
+		{"2026-03-03T10:00:00Z", "Excel.exe", 200},
+		{"2026-03-03T22:30:00Z", "Mezzanotte.exe", 300}, // 03/03 23:30
+		{"2026-03-03T23:30:00Z", "Dopo.exe", 400},       // 04/03 00:30
+	}
+	for _, s := range sessions {
+		result, err := db.Exec(`INSERT INTO sessions (app_name, seconds, session_type, timestamp) VALUES (?, ?, 'computer', ?)`, s.app, s.seconds, s.timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		if err := SalvaUtilizzoApp(db, id, map[string]int{s.app: s.seconds}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		want       map[string]int
+	}{
+		{"ultimo giorno", "2026-03-03", "2026-03-03", map[string]int{"Excel.exe": 200, "Mezzanotte.exe": 300}},
+		{"intervallo", "2026-03-01", "2026-03-03", map[string]int{"Inizio.exe": 50, "Code.exe": 100, "Excel.exe": 200, "Mezzanotte.exe": 300}},
+		{"giorno successivo", "2026-03-04", "2026-03-04", map[string]int{"Dopo.exe": 400}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CaricaUtilizzoAppPeriodo(db, tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("utilizzo app = %v, atteso %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := CaricaUtilizzoAppPeriodo(db, "03/03/2026", "2026-03-03"); err == nil {
+		t.Error("atteso un errore per una data non valida")
+	}
+}
+
+func TestEliminaProgettoCascataERegole(t *testing.T) {
+	db := apriDBTest(t)
+	projectID, err := CreaProgetto(db, "Cliente", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	altroID, err := CreaProgetto(db, "Altro", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, altro := int(projectID), int(altroID)
+
+	if err := CreaSessione(db, "Code.exe", 600, &id, "computer", nil, FormatTimestamp(testStart)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreaSessione(db, "Code.exe", 300, &altro, "computer", nil, FormatTimestamp(testStart)); err != nil {
+		t.Fatal(err)
+	}
+	var sessionID int64
+	if err := db.QueryRow(`SELECT id FROM sessions WHERE project_id = ?`, id).Scan(&sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if err := SalvaUtilizzoApp(db, sessionID, map[string]int{"Code.exe": 600}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO notes (project_id, note_text, timestamp) VALUES (?, 'nota', ?)`, id, FormatTimestamp(testStart)); err != nil {
+		t.Fatal(err)
+	}
+
+	ricerca := "RICERCA"
+	soloProgetto, err := CreaRegola(db, AssignmentRule{Name: "solo progetto", Enabled: true, ProcessName: "Code.exe", ProjectID: &id, Mode: RuleModeAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conTipo, err := CreaRegola(db, AssignmentRule{Name: "con tipo", Enabled: true, ProcessName: "Excel.exe", ProjectID: &id, ActivityType: &ricerca, Mode: RuleModeAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EliminaProgettoById(db, id); err != nil {
+		t.Fatalf("errore eliminazione progetto: %v", err)
+	}
+
+	// Dati del progetto eliminati a cascata, quelli degli altri progetti intatti
+	counts := []struct {
+		query string
+		arg   int64
+		want  int
+	}{
+		{`SELECT COUNT(*) FROM sessions WHERE project_id = ?`, projectID, 0},
+		{`SELECT COUNT(*) FROM notes WHERE project_id = ?`, projectID, 0},
+		{`SELECT COUNT(*) FROM session_app_usage WHERE session_id = ?`, sessionID, 0},
+		{`SELECT COUNT(*) FROM sessions WHERE project_id = ?`, altroID, 1},
+		{`SELECT COUNT(*) FROM assignment_rules WHERE id >= ?`, 0, 2},
+	}
+	for _, c := range counts {
+		var got int
+		if err := db.QueryRow(c.query, c.arg).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("%s (%d) = %d, atteso %d", c.query, c.arg, got, c.want)
+		}
+	}
+
+	// Le regole restano senza progetto; quella senza altro da assegnare è disattivata
+	rules, err := CaricaRegole(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rules {
+		if r.ProjectID != nil {
+			t.Errorf("regola '%s': progetto = %d, atteso nessuno", r.Name, *r.ProjectID)
+		}
+		switch int64(r.ID) {
+		case soloProgetto:
+			if r.Enabled {
+				t.Errorf("regola '%s' ancora attiva senza progetto né tipo", r.Name)
+			}
+		case conTipo:
+			if !r.Enabled || r.ActivityType == nil || *r.ActivityType != ricerca {
+				t.Errorf("regola '%s' = %+v, attesa attiva con tipo %s", r.Name, r, ricerca)
+			}
+		}
+	}
+}
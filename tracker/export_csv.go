@@ -0,0 +1,247 @@
+package tracker
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// === ESPORTAZIONE CSV ===
+
+// Colonne disponibili nell'esportazione CSV delle sessioni
+const (
+	CSVColumnDate         = "date"          // giorno di inizio
+	CSVColumnStart        = "start"         // ora di inizio
+	CSVColumnEnd          = "end"           // ora di fine (vuota se la sessione è in corso)
+	CSVColumnDuration     = "duration"      // durata in ore, nel formato scelto
+	CSVColumnProject      = "project"       // nome del progetto
+	CSVColumnActivityType = "activity_type" // tipo di attività
+	CSVColumnSessionType  = "session_type"  // computer, manuale, idle...
+	CSVColumnApp          = "app"           // applicazione o descrizione della sessione
+	CSVColumnNotes        = "notes"         // note del progetto
+)
+
+// Formati della durata
+const (
+	CSVDurationDecimal = "decimal" // ore decimali (1,50)
+	CSVDurationHHMM    = "hh:mm"   // ore e minuti (1:30)
+)
+
+// Lingue dell'esportazione: determinano intestazioni, separatori e formato delle date
+const (
+	CSVLocaleIT = "it"
+	CSVLocaleEN = "en"
+)
+
+// csvColumns sono le colonne ammesse con l'intestazione in italiano e in inglese
+var csvColumns = map[string][2]string{
+	CSVColumnDate:         {"Data", "Date"},
+	CSVColumnStart:        {"Inizio", "Start"},
+	CSVColumnEnd:          {"Fine", "End"},
+	CSVColumnDuration:     {"Durata (ore)", "Duration (hours)"},
+	CSVColumnProject:      {"Progetto", "Project"},
+	CSVColumnActivityType: {"Tipo attività", "Activity type"},
+	CSVColumnSessionType:  {"Tipo sessione", "Session type"},
+	CSVColumnApp:          {"Applicazione", "Application"},
+	CSVColumnNotes:        {"Note progetto", "Project notes"},
+}
+
+// CSVColumnsDefault sono le colonne esportate se non ne viene scelta nessuna
+var CSVColumnsDefault = []string{CSVColumnDate, CSVColumnStart, CSVColumnEnd, CSVColumnDuration, CSVColumnProject, CSVColumnActivityType}
+
+// CSVOptions configura l'esportazione CSV delle sessioni
+type CSVOptions struct {
+	StartDate      string   // primo giorno locale incluso ("2006-01-02")
+	EndDate        string   // ultimo giorno locale incluso ("2006-01-02")
+	ProjectID      *int     // nil = tutti i progetti
+	Columns        []string // colonne nell'ordine di esportazione (vuoto = CSVColumnsDefault)
+	DurationFormat string   // CSVDurationDecimal (predefinito) o CSVDurationHHMM
+	Locale         string   // CSVLocaleIT (predefinito) o CSVLocaleEN
+}
+
+// csvLocale sono le convenzioni di una lingua per il CSV
+type csvLocale struct {
+	header     int    // indice dell'intestazione in csvColumns
+	comma      rune   // separatore dei campi
+	decimal    string // separatore decimale
+	dateLayout string
+}
+
+var csvLocales = map[string]csvLocale{
+	// Excel in italiano usa il punto e virgola come separatore quando la virgola è decimale
+	CSVLocaleIT: {header: 0, comma: ';', decimal: ",", dateLayout: "02/01/2006"},
+	CSVLocaleEN: {header: 1, comma: ',', decimal: ".", dateLayout: "2006-01-02"},
+}
+
+// valida completa i valori predefiniti e controlla le opzioni
+func (o *CSVOptions) valida() error {
+	if len(o.Columns) == 0 {
+		o.Columns = CSVColumnsDefault
+	}
+	for _, c := range o.Columns {
+		if _, ok := csvColumns[c]; !ok {
+			return fmt.Errorf("colonna CSV non valida: %s", c)
+		}
+	}
+	if o.DurationFormat == "" {
+		o.DurationFormat = CSVDurationDecimal
+	}
+	if o.DurationFormat != CSVDurationDecimal && o.DurationFormat != CSVDurationHHMM {
+		return fmt.Errorf("formato durata non valido: %s", o.DurationFormat)
+	}
+	if o.Locale == "" {
+		o.Locale = CSVLocaleIT
+	}
+	if _, ok := csvLocales[o.Locale]; !ok {
+		return fmt.Errorf("lingua CSV non valida: %s", o.Locale)
+	}
+	return nil
+}
+
+// EsportaSessioniCSV scrive in w le sessioni del periodo in formato CSV e restituisce il numero
+// di sessioni esportate. Come per la timeline, una sessione è inclusa se si sovrappone al
+// periodo ed è esportata per intero. Le righe vengono lette e scritte una alla volta, senza
+// caricare tutte le sessioni in memoria.
+func EsportaSessioniCSV(db *sql.DB, w io.Writer, opts CSVOptions) (int, error) {
+	if err := opts.valida(); err != nil {
+		return 0, err
+	}
+	locale := csvLocales[opts.Locale]
+
+	startDateTime, endDateTime, err := intervalloGiorni(opts.StartDate, opts.EndDate)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	SELECT
+		s.timestamp,
+		COALESCE(s.ended_at, ''),
+		s.seconds,
+		COALESCE(p.name, 'Nessun progetto'),
+		COALESCE(` + sessionActivitySQL + `, ''),
+		COALESCE(s.session_type, 'computer'),
+		s.app_name,
+		COALESCE(p.note_text, '')
+	FROM sessions s
+	LEFT JOIN projects p ON s.project_id = p.id
+	WHERE ` + sessionOverlapSQL
+	args := []interface{}{endDateTime, startDateTime, startDateTime}
+	if opts.ProjectID != nil {
+		query += ` AND s.project_id = ?`
+		args = append(args, *opts.ProjectID)
+	}
+	query += ` ORDER BY s.timestamp ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("errore query esportazione CSV: %v", err)
+	}
+	defer rows.Close()
+
+	// BOM UTF-8: senza, Excel non riconosce le lettere accentate
+	buffered := bufio.NewWriter(w)
+	if _, err := buffered.WriteString("\ufeff"); err != nil {
+		return 0, fmt.Errorf("errore scrittura CSV: %v", err)
+	}
+	writer := csv.NewWriter(buffered)
+	writer.Comma = locale.comma
+	writer.UseCRLF = true
+
+	record := make([]string, len(opts.Columns))
+	for i, c := range opts.Columns {
+		record[i] = csvColumns[c][locale.header]
+	}
+	if err := writer.Write(record); err != nil {
+		return 0, fmt.Errorf("errore scrittura CSV: %v", err)
+	}
+
+	count := 0
+	for rows.Next() {
+		var timestamp, endedAt, projectName, activityType, sessionType, appName, noteText string
+		var seconds int
+		if err := rows.Scan(&timestamp, &endedAt, &seconds, &projectName, &activityType, &sessionType, &appName, &noteText); err != nil {
+			return count, fmt.Errorf("errore lettura sessione: %v", err)
+		}
+
+		start, err := parseTimestamp(timestamp)
+		if err != nil {
+			return count, fmt.Errorf("errore lettura inizio sessione '%s': %v", timestamp, err)
+		}
+		start = start.In(TimeZone())
+		var end time.Time
+		if endedAt != "" {
+			if end, err = parseTimestamp(endedAt); err != nil {
+				return count, fmt.Errorf("errore lettura fine sessione '%s': %v", endedAt, err)
+			}
+			end = end.In(TimeZone())
+		}
+
+		for i, c := range opts.Columns {
+			switch c {
+			case CSVColumnDate:
+				record[i] = start.Format(locale.dateLayout)
+			case CSVColumnStart:
+				record[i] = start.Format("15:04")
+			case CSVColumnEnd:
+				record[i] = ""
+				if !end.IsZero() {
+					record[i] = end.Format("15:04")
+				}
+			case CSVColumnDuration:
+				record[i] = formattaDurataCSV(seconds, opts.DurationFormat, locale.decimal)
+			case CSVColumnProject:
+				record[i] = testoCSV(projectName)
+			case CSVColumnActivityType:
+				record[i] = testoCSV(activityType)
+			case CSVColumnSessionType:
+				record[i] = testoCSV(sessionType)
+			case CSVColumnApp:
+				record[i] = testoCSV(appName)
+			case CSVColumnNotes:
+				record[i] = testoCSV(noteText)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return count, fmt.Errorf("errore scrittura CSV: %v", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("errore lettura sessioni: %v", err)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return count, fmt.Errorf("errore scrittura CSV: %v", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return count, fmt.Errorf("errore scrittura CSV: %v", err)
+	}
+
+	fmt.Printf("[DB] Esportate %d sessioni in CSV (%s - %s)\n", count, opts.StartDate, opts.EndDate)
+	return count, nil
+}
+
+// formattaDurataCSV formatta una durata in ore decimali (due cifre) o in ore e minuti
+func formattaDurataCSV(seconds int, format, decimal string) string {
+	if format == CSVDurationHHMM {
+		minutes := (seconds + 30) / 60
+		return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+	}
+	hours := strconv.FormatFloat(float64(seconds)/3600, 'f', 2, 64)
+	return strings.Replace(hours, ".", decimal, 1)
+}
+
+// testoCSV neutralizza i testi che un foglio di calcolo interpreterebbe come formule
+func testoCSV(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,219 @@
+package tracker
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apriDBEsportazione crea un database con due progetti e sessioni tra l'1 e il 4 marzo 2026
+// (fuso Europe/Rome) e restituisce gli ID dei progetti
+func apriDBEsportazione(t *testing.T) (*sql.DB, int, int) {
+	t.Helper()
+	t.Cleanup(func() { SetTimeZone("") })
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	db := apriDBTest(t)
+
+	rossi, err := CreaProgetto(db, "Rossi; Bianchi", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formula, err := CreaProgetto(db, "=SOMMA(A1)", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE projects SET note_text = ? WHERE id = ?`, "Contratto\n2026", rossi); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(d, h, m int) time.Time { return time.Date(2026, 3, d, h, m, 0, 0, TimeZone()) }
+	sessions := []struct {
+		start    time.Time
+		seconds  int
+		ended    bool
+		project  interface{}
+		activity interface{}
+		app      string
+		typ      interface{}
+	}{
+		{at(1, 23, 30), 3600, true, rossi, "RICERCA", "Code.exe", "computer"}, // a cavallo della mezzanotte
+		{at(2, 9, 0), 5400, true, rossi, "PROGETTAZIONE", "Riunione, cliente", "manual"},
+		{at(2, 14, 0), 1799, true, formula, nil, "@cmd", nil},
+		{at(3, 8, 0), 89, false, nil, nil, "Code.exe", "computer"},    // in corso
+		{at(4, 9, 0), 3600, true, rossi, nil, "Code.exe", "computer"}, // fuori dal periodo
+	}
+	for _, s := range sessions {
+		var endedAt interface{}
+		if s.ended {
+			endedAt = FormatTimestamp(s.start.Add(time.Duration(s.seconds) * time.Second))
+		}
+		_, err := db.Exec(`INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at)
+			VALUES (?, ?, ?, COALESCE(?, 'computer'), (SELECT id FROM activity_types WHERE name = ?), ?, ?)`,
+			s.app, s.seconds, s.project, s.typ, s.activity, FormatTimestamp(s.start), endedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, int(rossi), int(formula)
+}
+
+func TestEsportaSessioniCSV(t *testing.T) {
+	db, rossi, formula := apriDBEsportazione(t)
+
+	tests := []struct {
+		name  string
+		opts  CSVOptions
+		count int
+		want  []string // righe senza BOM e terminatori
+	}{
+		{
+			name:  "italiano predefinito",
+			opts:  CSVOptions{},
+			count: 4,
+			want: []string{
+				"Data;Inizio;Fine;Durata (ore);Progetto;Tipo attività",
+				`01/03/2026;23:30;00:30;1,00;"Rossi; Bianchi";RICERCA`,
+				`02/03/2026;09:00;10:30;1,50;"Rossi; Bianchi";PROGETTAZIONE`,
+				"02/03/2026;14:00;14:29;0,50;'=SOMMA(A1);",
+				"03/03/2026;08:00;;0,02;Nessun progetto;",
+			},
+		},
+		{
+			name:  "inglese in ore e minuti",
+			opts:  CSVOptions{Locale: CSVLocaleEN, DurationFormat: CSVDurationHHMM},
+			count: 4,
+			want: []string{
+				"Date,Start,End,Duration (hours),Project,Activity type",
+				"2026-03-01,23:30,00:30,1:00,Rossi; Bianchi,RICERCA",
+				"2026-03-02,09:00,10:30,1:30,Rossi; Bianchi,PROGETTAZIONE",
+				"2026-03-02,14:00,14:29,0:30,'=SOMMA(A1),",
+				"2026-03-03,08:00,,0:01,Nessun progetto,",
+			},
+		},
+		{
+			name:  "filtro progetto",
+			opts:  CSVOptions{ProjectID: &formula},
+			count: 1,
+			want: []string{
+				"Data;Inizio;Fine;Durata (ore);Progetto;Tipo attività",
+				"02/03/2026;14:00;14:29;0,50;'=SOMMA(A1);",
+			},
+		},
+		{
+			name: "colonne personalizzate",
+			opts: CSVOptions{
+				ProjectID: &rossi,
+				Locale:    CSVLocaleEN,
+				Columns:   []string{CSVColumnApp, CSVColumnNotes, CSVColumnSessionType, CSVColumnDate, CSVColumnDuration},
+			},
+			count: 2,
+			want: []string{
+				"Application,Project notes,Session type,Date,Duration (hours)",
+				"Code.exe,\"Contratto\r\n2026\",computer,2026-03-01,1.00",
+				"\"Riunione, cliente\",\"Contratto\r\n2026\",manual,2026-03-02,1.50",
+			},
+		},
+		{
+			name:  "periodo senza sessioni",
+			opts:  CSVOptions{StartDate: "2026-02-01", EndDate: "2026-02-28"},
+			count: 0,
+			want:  []string{"Data;Inizio;Fine;Durata (ore);Progetto;Tipo attività"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.StartDate == "" {
+				opts.StartDate, opts.EndDate = "2026-03-02", "2026-03-03"
+			}
+			var buf bytes.Buffer
+			count, err := EsportaSessioniCSV(db, &buf, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("sessioni esportate = %d, attese %d", count, tt.count)
+			}
+			want := "\ufeff" + strings.Join(tt.want, "\r\n") + "\r\n"
+			if got := buf.String(); got != want {
+				t.Errorf("CSV =\n%q\natteso\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestEsportaSessioniCSVOpzioniNonValide(t *testing.T) {
+	db := apriDBTest(t)
+	tests := []struct {
+		name string
+		opts CSVOptions
+	}{
+		{"colonna", CSVOptions{Columns: []string{CSVColumnDate, "costo"}}},
+		{"formato durata", CSVOptions{DurationFormat: "minuti"}},
+		{"lingua", CSVOptions{Locale: "de"}},
+		{"data", CSVOptions{StartDate: "02/03/2026", EndDate: "2026-03-02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.StartDate == "" {
+				opts.StartDate, opts.EndDate = "2026-03-02", "2026-03-02"
+			}
+			var buf bytes.Buffer
+			if _, err := EsportaSessioniCSV(db, &buf, opts); err == nil {
+				t.Error("opzioni non valide accettate")
+			}
+			if buf.Len() != 0 {
+				t.Errorf("scritto %q con opzioni non valide", buf.String())
+			}
+		})
+	}
+}
+
+func TestFormattaDurataCSV(t *testing.T) {
+	tests := []struct {
+		seconds       int
+		decimal, hhmm string
+	}{
+		{0, "0,00", "0:00"},
+		{29, "0,01", "0:00"},
+		{30, "0,01", "0:01"},
+		{89, "0,02", "0:01"},
+		{90, "0,03", "0:02"},
+		{1799, "0,50", "0:30"},
+		{3570, "0,99", "1:00"},
+		{3600, "1,00", "1:00"},
+		{5400, "1,50", "1:30"},
+		{36000 + 59*60 + 45, "11,00", "11:00"},
+	}
+	for _, tt := range tests {
+		if got := formattaDurataCSV(tt.seconds, CSVDurationDecimal, ","); got != tt.decimal {
+			t.Errorf("formattaDurataCSV(%d, decimal) = %q, atteso %q", tt.seconds, got, tt.decimal)
+		}
+		if got := formattaDurataCSV(tt.seconds, CSVDurationHHMM, ","); got != tt.hhmm {
+			t.Errorf("formattaDurataCSV(%d, hh:mm) = %q, atteso %q", tt.seconds, got, tt.hhmm)
+		}
+	}
+}
+
+func TestTestoCSV(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"Cliente", "Cliente"},
+		{"=1+1", "'=1+1"},
+		{"+39 02 1234", "'+39 02 1234"},
+		{"-2", "'-2"},
+		{"@SOMMA(A1)", "'@SOMMA(A1)"},
+		{"a=b", "a=b"},
+		{"'=già protetto", "'=già protetto"},
+	}
+	for _, tt := range tests {
+		if got := testoCSV(tt.in); got != tt.want {
+			t.Errorf("testoCSV(%q) = %q, atteso %q", tt.in, got, tt.want)
+		}
+	}
+}
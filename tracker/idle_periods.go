@@ -0,0 +1,99 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SalvaPeriodoPendente accoda un periodo idle o sospeso in attesa di attribuzione
+// e ne restituisce l'ID
+func SalvaPeriodoPendente(db *sql.DB, period IdlePeriod) (int64, error) {
+	insertSQL := `INSERT INTO pending_idle_periods (period_type, start_time, end_time, seconds, created_at) VALUES (?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(insertSQL, period.Type,
+		FormatTimestamp(period.StartTime),
+		FormatTimestamp(period.EndTime),
+		period.Duration,
+		FormatTimestamp(now()))
+	if err != nil {
+		return 0, fmt.Errorf("errore salvataggio periodo pendente: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("errore recupero ID periodo pendente: %v", err)
+	}
+
+	fmt.Printf("[DB] Periodo %s pendente salvato con ID %d: %d sec dal %s\n",
+		period.Type, id, period.Duration, FormatLocal(period.StartTime))
+	return id, nil
+}
+
+// CaricaPeriodiPendenti carica i periodi in attesa di attribuzione, dal più vecchio
+func CaricaPeriodiPendenti(db *sql.DB) ([]IdlePeriod, error) {
+	query := `
+	SELECT id, period_type, start_time, end_time, seconds
+	FROM pending_idle_periods
+	ORDER BY start_time ASC, id ASC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("errore query periodi pendenti: %v", err)
+	}
+	defer rows.Close()
+
+	var periods []IdlePeriod
+	for rows.Next() {
+		var p IdlePeriod
+		var startTime, endTime string
+		if err := rows.Scan(&p.ID, &p.Type, &startTime, &endTime, &p.Duration); err != nil {
+			return nil, err
+		}
+		if p.StartTime, err = parseTimestamp(startTime); err != nil {
+			return nil, err
+		}
+		if p.EndTime, err = parseTimestamp(endTime); err != nil {
+			return nil, err
+		}
+		periods = append(periods, p)
+	}
+
+	return periods, nil
+}
+
+// EliminaPeriodoPendente rimuove un periodo dalla coda (attribuito o scartato)
+func EliminaPeriodoPendente(db *sql.DB, id int64) error {
+	if _, err := db.Exec(`DELETE FROM pending_idle_periods WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("errore eliminazione periodo pendente: %v", err)
+	}
+
+	fmt.Printf("[DB] Periodo pendente ID %d rimosso\n", id)
+	return nil
+}
+
+// RecoverPendingIdlePeriods verifica all'avvio i periodi rimasti in attesa da esecuzioni
+// precedenti: scarta quelli non validi e restituisce quanti restano da attribuire
+func RecoverPendingIdlePeriods(db *sql.DB) (int, error) {
+	periods, err := CaricaPeriodiPendenti(db)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, p := range periods {
+		if p.Duration <= 0 || !p.EndTime.After(p.StartTime) {
+			if err := EliminaPeriodoPendente(db, p.ID); err != nil {
+				fmt.Printf("[DB] Errore rimozione periodo pendente non valido ID %d: %v\n", p.ID, err)
+			}
+			continue
+		}
+		pending++
+	}
+
+	if pending > 0 {
+		fmt.Printf("[DB] %d periodi idle in attesa di attribuzione\n", pending)
+	}
+
+	return pending, nil
+}
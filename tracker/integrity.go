@@ -0,0 +1,447 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Tipi di problema rilevati dal controllo di integrità
+const (
+	IssueOverlap       = "overlap"          // due sessioni si sovrappongono
+	IssueOrphanProject = "orphan_project"   // sessione collegata a un progetto eliminato
+	IssueOrphanRows    = "orphan_rows"      // righe collegate a sessioni eliminate
+	IssueZeroLength    = "zero_length"      // sessione di durata nulla
+	IssueNegative      = "negative_seconds" // sessione con durata negativa
+	IssueTooLong       = "too_long"         // sessione di durata implausibile
+	IssuePendingOrphan = "pending_orphan"   // pending_tracking senza sessione
+)
+
+// maxSessionDuration è la durata oltre la quale una sessione è considerata implausibile
+const maxSessionDuration = 16 * time.Hour
+
+// IntegrityIssue è un problema rilevato nel database, con l'eventuale correzione proposta
+type IntegrityIssue struct {
+	Type        string
+	SessionID   int // 0 se il problema non riguarda una singola sessione
+	OtherID     int // sessione sovrapposta o riga di pending_tracking
+	Description string
+	Fix         string // correzione automatica proposta, vuota se va corretto a mano
+
+	apply func(tx *sql.Tx) error
+}
+
+// IntegrityReport è l'esito del controllo di integrità
+type IntegrityReport struct {
+	Issues  []IntegrityIssue
+	Fixable int  // problemi con correzione automatica
+	Applied bool // true se le correzioni sono state applicate
+}
+
+// integritySession è una sessione letta per il controllo, con gli estremi reali
+type integritySession struct {
+	id           int
+	start        time.Time
+	end          time.Time
+	seconds      int
+	projectID    sql.NullInt64
+	activityType sql.NullInt64
+	orphan       bool // il progetto non esiste più
+	running      bool // sessione in corso (presente in pending_tracking)
+	removed      bool // eliminata da una correzione già pianificata
+}
+
+// CheckIntegrity controlla la tabella sessions e le tabelle collegate: sovrapposizioni,
+// sessioni orfane di progetto, di durata nulla, negativa o implausibile, righe collegate a
+// sessioni eliminate e pending_tracking senza sessione.
+// Con fix false restituisce solo l'anteprima delle correzioni; con fix true le applica in
+// un'unica transazione. Le sessioni in corso non vengono mai modificate.
+func CheckIntegrity(db *sql.DB, fix bool) (*IntegrityReport, error) {
+	sessions, err := caricaSessioniIntegrita(db)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{}
+	controllaSessioni(report, sessions)
+	controllaSovrapposizioni(report, sessions)
+
+	if err := controllaPendingOrfani(db, report); err != nil {
+		return nil, err
+	}
+	if err := controllaRigheOrfane(db, report); err != nil {
+		return nil, err
+	}
+
+	for _, issue := range report.Issues {
+		if issue.apply != nil {
+			report.Fixable++
+		}
+	}
+
+	if !fix || report.Fixable == 0 {
+		return report, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("errore avvio correzione integrità: %v", err)
+	}
+	for _, issue := range report.Issues {
+		if issue.apply == nil {
+			continue
+		}
+		if err := issue.apply(tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("errore commit correzione integrità: %v", err)
+	}
+
+	report.Applied = true
+	fmt.Printf("[DB] Integrità: %d problemi, %d correzioni applicate\n", len(report.Issues), report.Fixable)
+	return report, nil
+}
+
+// caricaSessioniIntegrita carica tutte le sessioni in ordine di inizio
+func caricaSessioniIntegrita(db *sql.DB) ([]integritySession, error) {
+	query := `
+	SELECT s.id, s.timestamp, s.seconds, s.ended_at, s.project_id, s.activity_type_id,
+		s.project_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = s.project_id),
+		EXISTS (SELECT 1 FROM pending_tracking pt WHERE pt.session_id = s.id)
+	FROM sessions s
+	ORDER BY s.timestamp ASC, s.id ASC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("errore query sessioni: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []integritySession
+	for rows.Next() {
+		var s integritySession
+		var timestamp string
+		var endedAt sql.NullString
+		if err := rows.Scan(&s.id, &timestamp, &s.seconds, &endedAt, &s.projectID, &s.activityType, &s.orphan, &s.running); err != nil {
+			return nil, fmt.Errorf("errore lettura sessione: %v", err)
+		}
+
+		start, err := parseTimestamp(timestamp)
+		if err != nil {
+			fmt.Printf("[DB] Integrità: sessione %d con timestamp non valido '%s'\n", s.id, timestamp)
+			continue
+		}
+		s.start = start
+		s.end = start.Add(time.Duration(s.seconds) * time.Second)
+		if endedAt.Valid {
+			if end, err := parseTimestamp(endedAt.String); err == nil && !end.Before(start) {
+				s.end = end
+			}
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// controllaSessioni segnala le sessioni orfane di progetto e quelle di durata non plausibile
+func controllaSessioni(report *IntegrityReport, sessions []integritySession) {
+	for i := range sessions {
+		s := &sessions[i]
+
+		if s.orphan {
+			id := s.id
+			report.Issues = append(report.Issues, IntegrityIssue{
+				Type:        IssueOrphanProject,
+				SessionID:   id,
+				Description: fmt.Sprintf("La sessione %d del %s è collegata al progetto %d, che non esiste più", id, FormatLocal(s.start), s.projectID.Int64),
+				Fix:         "Rendi la sessione non assegnata",
+				apply: func(tx *sql.Tx) error {
+					if _, err := tx.Exec(`UPDATE sessions SET project_id = NULL WHERE id = ?`, id); err != nil {
+						return fmt.Errorf("errore correzione progetto sessione %d: %v", id, err)
+					}
+					return nil
+				},
+			})
+		}
+
+		// Una sessione appena avviata ha legittimamente durata nulla
+		if s.running {
+			continue
+		}
+
+		switch {
+		case s.seconds < 0:
+			s.removed = true
+			report.Issues = append(report.Issues, sessionDeleteIssue(IssueNegative, s.id,
+				fmt.Sprintf("La sessione %d del %s ha durata negativa (%d secondi)", s.id, FormatLocal(s.start), s.seconds)))
+		case s.seconds == 0:
+			s.removed = true
+			report.Issues = append(report.Issues, sessionDeleteIssue(IssueZeroLength, s.id,
+				fmt.Sprintf("La sessione %d del %s ha durata nulla", s.id, FormatLocal(s.start))))
+		case time.Duration(s.seconds)*time.Second > maxSessionDuration || s.end.Sub(s.start) > maxSessionDuration:
+			report.Issues = append(report.Issues, IntegrityIssue{
+				Type:        IssueTooLong,
+				SessionID:   s.id,
+				Description: fmt.Sprintf("La sessione %d del %s dura %s (dalle %s alle %s)", s.id, FormatLocal(s.start), formatDurata(s.seconds), FormatLocal(s.start), FormatLocal(s.end)),
+			})
+		}
+	}
+}
+
+// sessionDeleteIssue crea un problema la cui correzione è l'eliminazione della sessione
+func sessionDeleteIssue(issueType string, sessionID int, description string) IntegrityIssue {
+	return IntegrityIssue{
+		Type:        issueType,
+		SessionID:   sessionID,
+		Description: description,
+		Fix:         fmt.Sprintf("Elimina la sessione %d", sessionID),
+		apply: func(tx *sql.Tx) error {
+			return eliminaSessioneTx(tx, sessionID)
+		},
+	}
+}
+
+// controllaSovrapposizioni confronta ogni sessione con quella che finisce più tardi tra le
+// precedenti. Sessioni con stesso progetto e attività vengono unite; altrimenti si accorcia
+// la prima. Una sessione contenuta in un'altra di progetto diverso va corretta a mano.
+func controllaSovrapposizioni(report *IntegrityReport, sessions []integritySession) {
+	var prev *integritySession
+	for i := range sessions {
+		cur := &sessions[i]
+		if cur.removed {
+			continue
+		}
+
+		if prev == nil || !cur.start.Before(prev.end) {
+			prev = cur
+			continue
+		}
+
+		overlapEnd := prev.end
+		if cur.end.Before(overlapEnd) {
+			overlapEnd = cur.end
+		}
+		overlap := durataSecondi(cur.start, overlapEnd)
+		issue := IntegrityIssue{
+			Type:      IssueOverlap,
+			SessionID: prev.id,
+			OtherID:   cur.id,
+			Description: fmt.Sprintf("Le sessioni %d (%s - %s) e %d (%s - %s) si sovrappongono per %s",
+				prev.id, FormatLocal(prev.start), FormatLocal(prev.end),
+				cur.id, FormatLocal(cur.start), FormatLocal(cur.end), formatDurata(overlap)),
+		}
+
+		switch {
+		case prev.running || cur.running:
+			// Le sessioni in corso non si modificano: il problema resta solo segnalato
+
+		case prev.projectID == cur.projectID && prev.activityType == cur.activityType:
+			newEnd := prev.end
+			if cur.end.After(newEnd) {
+				newEnd = cur.end
+			}
+			newSeconds := clampSecondi(prev.seconds+cur.seconds-overlap, prev.start, newEnd)
+			keepID, mergeID := prev.id, cur.id
+			issue.Fix = fmt.Sprintf("Unisci la sessione %d nella %d (%s - %s, %s)",
+				mergeID, keepID, FormatLocal(prev.start), FormatLocal(newEnd), formatDurata(newSeconds))
+			issue.apply = func(tx *sql.Tx) error {
+				return unisciSessioni(tx, keepID, mergeID, newSeconds, newEnd)
+			}
+			prev.end = newEnd
+			prev.seconds = newSeconds
+			cur.removed = true
+
+		case cur.end.After(prev.end):
+			newEnd := cur.start
+			trimmedID := prev.id
+			if !newEnd.After(prev.start) {
+				// Le due sessioni iniziano insieme: la prima è interamente coperta dalla seconda
+				issue.Fix = fmt.Sprintf("Elimina la sessione %d, coperta dalla %d", trimmedID, cur.id)
+				issue.apply = func(tx *sql.Tx) error {
+					return eliminaSessioneTx(tx, trimmedID)
+				}
+				prev.removed = true
+			} else {
+				newSeconds := clampSecondi(prev.seconds-overlap, prev.start, newEnd)
+				issue.Fix = fmt.Sprintf("Accorcia la sessione %d fino alle %s (%s)",
+					trimmedID, FormatLocal(newEnd), formatDurata(newSeconds))
+				issue.apply = func(tx *sql.Tx) error {
+					return accorciaSessione(tx, trimmedID, newSeconds, newEnd)
+				}
+				prev.end = newEnd
+				prev.seconds = newSeconds
+			}
+		}
+
+		report.Issues = append(report.Issues, issue)
+		if !cur.removed && (prev.removed || cur.end.After(prev.end)) {
+			prev = cur
+		}
+	}
+}
+
+// controllaPendingOrfani segnala le righe di pending_tracking senza sessione
+func controllaPendingOrfani(db *sql.DB, report *IntegrityReport) error {
+	query := `
+	SELECT pt.id, pt.session_id
+	FROM pending_tracking pt
+	WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = pt.session_id)
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("errore query pending tracking: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pendingID, sessionID int
+		if err := rows.Scan(&pendingID, &sessionID); err != nil {
+			return fmt.Errorf("errore lettura pending tracking: %v", err)
+		}
+		report.Issues = append(report.Issues, IntegrityIssue{
+			Type:        IssuePendingOrphan,
+			SessionID:   sessionID,
+			OtherID:     pendingID,
+			Description: fmt.Sprintf("Il tracking pendente %d fa riferimento alla sessione %d, che non esiste più", pendingID, sessionID),
+			Fix:         "Elimina il tracking pendente",
+			apply: func(tx *sql.Tx) error {
+				if _, err := tx.Exec(`DELETE FROM pending_tracking WHERE id = ?`, pendingID); err != nil {
+					return fmt.Errorf("errore eliminazione pending tracking %d: %v", pendingID, err)
+				}
+				return nil
+			},
+		})
+	}
+	return rows.Err()
+}
+
+// controllaRigheOrfane segnala le righe delle tabelle di dettaglio collegate a sessioni eliminate
+func controllaRigheOrfane(db *sql.DB, report *IntegrityReport) error {
+	tables := []struct {
+		name  string
+		label string
+	}{
+		{"session_app_usage", "utilizzo app"},
+		{"window_title_spans", "timeline titoli"},
+		{"pause_intervals", "pause"},
+		{"session_segments", "tratti sessione"},
+	}
+
+	for _, t := range tables {
+		orphanSQL := `FROM ` + t.name + ` WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.id = ` + t.name + `.session_id)`
+
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) ` + orphanSQL).Scan(&count); err != nil {
+			return fmt.Errorf("errore controllo %s: %v", t.name, err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		table := t.name
+		report.Issues = append(report.Issues, IntegrityIssue{
+			Type:        IssueOrphanRows,
+			Description: fmt.Sprintf("%d righe di %s collegate a sessioni che non esistono più", count, t.label),
+			Fix:         fmt.Sprintf("Elimina le %d righe", count),
+			apply: func(tx *sql.Tx) error {
+				if _, err := tx.Exec(`DELETE ` + orphanSQL); err != nil {
+					return fmt.Errorf("errore eliminazione righe orfane di %s: %v", table, err)
+				}
+				return nil
+			},
+		})
+	}
+	return nil
+}
+
+// eliminaSessioneTx elimina una sessione; i dati collegati vengono eliminati a cascata
+func eliminaSessioneTx(tx *sql.Tx, sessionID int) error {
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID); err != nil {
+		return fmt.Errorf("errore eliminazione sessione %d: %v", sessionID, err)
+	}
+	return nil
+}
+
+// unisciSessioni unisce la sessione mergeID in keepID: il dettaglio per applicazione, la
+// timeline titoli e le pause passano a keepID, mentre i tratti non corrispondono più
+// alla sessione unita e vengono eliminati
+func unisciSessioni(tx *sql.Tx, keepID, mergeID, seconds int, endedAt time.Time) error {
+	usageSQL := `
+	INSERT INTO session_app_usage (session_id, app_name, seconds)
+	SELECT ?, app_name, seconds FROM session_app_usage WHERE session_id = ?
+	ON CONFLICT(session_id, app_name) DO UPDATE SET seconds = seconds + excluded.seconds
+	`
+	if _, err := tx.Exec(usageSQL, keepID, mergeID); err != nil {
+		return fmt.Errorf("errore unione utilizzo app: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE window_title_spans SET session_id = ? WHERE session_id = ?`, keepID, mergeID); err != nil {
+		return fmt.Errorf("errore unione timeline titoli: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE pause_intervals SET session_id = ? WHERE session_id = ?`, keepID, mergeID); err != nil {
+		return fmt.Errorf("errore unione pause: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM session_segments WHERE session_id = ?`, keepID); err != nil {
+		return fmt.Errorf("errore eliminazione tratti sessione: %v", err)
+	}
+	if err := eliminaSessioneTx(tx, mergeID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET seconds = ?, ended_at = ? WHERE id = ?`, seconds, FormatTimestamp(endedAt), keepID); err != nil {
+		return fmt.Errorf("errore aggiornamento sessione %d: %v", keepID, err)
+	}
+	fmt.Printf("[DB] Integrità: sessione %d unita nella %d\n", mergeID, keepID)
+	return nil
+}
+
+// accorciaSessione fa terminare una sessione a endedAt, tagliando pause e timeline titoli
+// successive. I tratti registrati non corrispondono più e vengono eliminati.
+func accorciaSessione(tx *sql.Tx, sessionID, seconds int, endedAt time.Time) error {
+	end := FormatTimestamp(endedAt)
+	for _, table := range []string{"pause_intervals", "window_title_spans"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE session_id = ? AND start_time >= ?`, sessionID, end); err != nil {
+			return fmt.Errorf("errore taglio %s: %v", table, err)
+		}
+		if _, err := tx.Exec(`UPDATE `+table+` SET end_time = ? WHERE session_id = ? AND end_time > ?`, end, sessionID, end); err != nil {
+			return fmt.Errorf("errore taglio %s: %v", table, err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM session_segments WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("errore eliminazione tratti sessione: %v", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET seconds = ?, ended_at = ? WHERE id = ?`, seconds, end, sessionID); err != nil {
+		return fmt.Errorf("errore aggiornamento sessione %d: %v", sessionID, err)
+	}
+	fmt.Printf("[DB] Integrità: sessione %d accorciata alle %s\n", sessionID, end)
+	return nil
+}
+
+// durataSecondi restituisce i secondi tra due istanti
+func durataSecondi(start, end time.Time) int {
+	return int(end.Sub(start).Round(time.Second) / time.Second)
+}
+
+// clampSecondi limita una durata tra zero e la durata reale dell'intervallo [start, end]
+func clampSecondi(seconds int, start, end time.Time) int {
+	if span := durataSecondi(start, end); seconds > span {
+		seconds = span
+	}
+	if seconds < 0 {
+		seconds = 0
+	}
+	return seconds
+}
+
+// formatDurata formatta una durata in secondi per i messaggi (es. "1h 05m", "12m 30s")
+func formatDurata(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%dh %02dm", seconds/3600, seconds%3600/60)
+	}
+	return fmt.Sprintf("%dm %02ds", seconds/60, seconds%60)
+}
@@ -0,0 +1,178 @@
+package tracker
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessioneIntegrita è una sessione di prova: inizio e durata in minuti da testStart
+type sessioneIntegrita struct {
+	start, minutes int
+	project        int // 1 o 2
+	running        bool
+}
+
+// statoSessione è lo stato salvato di una sessione dopo il controllo
+type statoSessione struct {
+	ID      int
+	Seconds int
+	EndedAt string
+}
+
+// fineMinuti restituisce il timestamp a minutes minuti da testStart
+func fineMinuti(minutes int) string {
+	return FormatTimestamp(testStart.Add(time.Duration(minutes) * time.Minute))
+}
+
+// leggiStatoSessioni restituisce lo stato di tutte le sessioni in ordine di ID
+func leggiStatoSessioni(t *testing.T, db *sql.DB) []statoSessione {
+	t.Helper()
+	rows, err := db.Query(`SELECT id, seconds, CAST(ended_at AS TEXT) FROM sessions ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var states []statoSessione
+	for rows.Next() {
+		var s statoSessione
+		if err := rows.Scan(&s.ID, &s.Seconds, &s.EndedAt); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return states
+}
+
+func TestCheckIntegritySovrapposizioni(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []sessioneIntegrita
+		fixes    []string // inizio della correzione proposta per ogni sovrapposizione ("" = solo segnalata)
+		want     []statoSessione
+	}{
+		{
+			name:     "stesso progetto unite",
+			sessions: []sessioneIntegrita{{0, 60, 1, false}, {30, 60, 1, false}},
+			fixes:    []string{"Unisci la sessione 2 nella 1"},
+			want:     []statoSessione{{1, 5400, fineMinuti(90)}},
+		},
+		{
+			name:     "progetto diverso accorciata",
+			sessions: []sessioneIntegrita{{0, 60, 1, false}, {30, 60, 2, false}},
+			fixes:    []string{"Accorcia la sessione 1"},
+			want:     []statoSessione{{1, 1800, fineMinuti(30)}, {2, 3600, fineMinuti(90)}},
+		},
+		{
+			name:     "stesso inizio eliminata",
+			sessions: []sessioneIntegrita{{0, 60, 1, false}, {0, 120, 2, false}},
+			fixes:    []string{"Elimina la sessione 1"},
+			want:     []statoSessione{{2, 7200, fineMinuti(120)}},
+		},
+		{
+			name:     "contenuta di progetto diverso solo segnalata",
+			sessions: []sessioneIntegrita{{0, 120, 1, false}, {30, 30, 2, false}},
+			fixes:    []string{""},
+			want:     []statoSessione{{1, 7200, fineMinuti(120)}, {2, 1800, fineMinuti(60)}},
+		},
+		{
+			name:     "sessione in corso non modificata",
+			sessions: []sessioneIntegrita{{0, 60, 1, true}, {30, 60, 2, false}},
+			fixes:    []string{""},
+			want:     []statoSessione{{1, 3600, fineMinuti(60)}, {2, 3600, fineMinuti(90)}},
+		},
+		{
+			name:     "unione poi accorciamento",
+			sessions: []sessioneIntegrita{{0, 60, 1, false}, {30, 60, 1, false}, {75, 45, 2, false}},
+			fixes:    []string{"Unisci la sessione 2 nella 1", "Accorcia la sessione 1 fino alle"},
+			want:     []statoSessione{{1, 4500, fineMinuti(75)}, {3, 2700, fineMinuti(120)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := apriDBTest(t)
+			var projects [3]int64
+			for p, name := range []string{"", "Uno", "Due"} {
+				if name == "" {
+					continue
+				}
+				id, err := CreaProgetto(db, name, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				projects[p] = id
+			}
+			for _, s := range tt.sessions {
+				result, err := db.Exec(`INSERT INTO sessions (app_name, seconds, project_id, timestamp, ended_at) VALUES ('Code.exe', ?, ?, ?, ?)`,
+					s.minutes*60, projects[s.project], fineMinuti(s.start), fineMinuti(s.start+s.minutes))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.running {
+					id, _ := result.LastInsertId()
+					if _, err := db.Exec(`INSERT INTO pending_tracking (session_id, project_id, start_time, last_saved_seconds, last_update) VALUES (?, ?, ?, ?, ?)`,
+						id, projects[s.project], fineMinuti(s.start), s.minutes*60, fineMinuti(s.start+s.minutes)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			// L'anteprima propone le correzioni senza toccare il database
+			before := leggiStatoSessioni(t, db)
+			preview, err := CheckIntegrity(db, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preview.Applied {
+				t.Error("anteprima segnata come applicata")
+			}
+			var fixes []string
+			for _, issue := range preview.Issues {
+				if issue.Type != IssueOverlap {
+					t.Errorf("problema inatteso: %s %s", issue.Type, issue.Description)
+					continue
+				}
+				fixes = append(fixes, issue.Fix)
+			}
+			if len(fixes) != len(tt.fixes) {
+				t.Fatalf("correzioni = %q, attese %q", fixes, tt.fixes)
+			}
+			for i, fix := range fixes {
+				if (tt.fixes[i] == "") != (fix == "") || !strings.HasPrefix(fix, tt.fixes[i]) {
+					t.Errorf("correzione %d = %q, attesa %q", i, fix, tt.fixes[i])
+				}
+			}
+			if got := leggiStatoSessioni(t, db); !reflect.DeepEqual(got, before) {
+				t.Fatalf("l'anteprima ha modificato le sessioni: %+v, prima %+v", got, before)
+			}
+
+			// Le correzioni vengono applicate insieme
+			report, err := CheckIntegrity(db, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Fixable > 0 && !report.Applied {
+				t.Error("correzioni non applicate")
+			}
+			if got := leggiStatoSessioni(t, db); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sessioni dopo la correzione = %+v, attese %+v", got, tt.want)
+			}
+
+			// Dopo la correzione restano solo i problemi da risolvere a mano
+			after, err := CheckIntegrity(db, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Fixable != 0 {
+				t.Errorf("correzioni ancora proposte dopo l'applicazione: %+v", after.Issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,1059 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// migration rappresenta una modifica di schema versionata
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations elenca le migrazioni in ordine di versione crescente.
+// Le migrazioni già rilasciate non vanno mai modificate: ogni cambio di schema
+// va aggiunto in coda con una nuova versione.
+var migrations = []migration{
+	{1, "schema iniziale", migrateSchemaIniziale},
+	{2, "utilizzo applicazioni per sessione", migrateSessionAppUsage},
+	{3, "timeline titoli finestre", migrateWindowTitleSpans},
+	{4, "regole di assegnazione", migrateAssignmentRules},
+	{5, "intervalli di pausa", migratePauseIntervals},
+	{6, "periodi idle pendenti", migratePendingIdlePeriods},
+	{7, "tratti delle sessioni", migrateSessionSegments},
+	{8, "fine reale delle sessioni", migrateSessionEndedAt},
+	{9, "timestamp in UTC", migrateTimestampsUTC},
+	{10, "chiavi esterne con eliminazione a cascata", migrateForeignKeys},
+	{11, "tipi attività per ID", migrateActivityTypeIDs},
+	{12, "identificativi globali (UUID)", migrateUUIDs},
+	{13, "regole conservate all'eliminazione del progetto", migrateRulesProjectSetNull},
+}
+
+// LatestSchemaVersion restituisce la versione di schema supportata da questo binario
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion restituisce la versione di schema attuale del database (0 se mai migrato)
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("errore lettura versione schema: %v", err)
+	}
+	return version, nil
+}
+
+// migrateDB porta il database all'ultima versione di schema.
+// Se ci sono migrazioni da applicare su un database esistente, prima ne crea una copia di backup.
+// Ogni migrazione viene eseguita nella propria transazione insieme alla registrazione in schema_migrations,
+// quindi un crash lascia il database all'ultima versione completata.
+func migrateDB(db *sql.DB, dbPath string, existing bool) error {
+	createMigrationsSQL := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := db.Exec(createMigrationsSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella schema_migrations: %v", err)
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("il database è alla versione di schema %d, più recente di quella supportata (%d): aggiorna l'applicazione", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	// Backup automatico prima di modificare un database esistente
+	if existing {
+		backupPath, err := backupDB(db, dbPath, current)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[DB] Backup pre-migrazione creato: %s\n", backupPath)
+	}
+
+	// Le migrazioni ricreano tabelle collegate: vanno eseguite con i vincoli di chiave esterna
+	// disattivati, su una connessione dedicata perché il PRAGMA non ha effetto in transazione
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("errore connessione per migrazioni: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(context.Background(), `PRAGMA foreign_keys = OFF`); err != nil {
+		return fmt.Errorf("errore disattivazione chiavi esterne: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`)
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		if err := applyMigration(conn, m); err != nil {
+			return err
+		}
+		fmt.Printf("[DB] Migrazione %d applicata: %s\n", m.version, m.name)
+	}
+
+	return nil
+}
+
+// applyMigration esegue una singola migrazione in transazione
+func applyMigration(conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("errore avvio migrazione %d: %v", m.version, err)
+	}
+
+	if err := m.up(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore migrazione %d (%s): %v", m.version, m.name, err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore registrazione migrazione %d: %v", m.version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit migrazione %d: %v", m.version, err)
+	}
+
+	return nil
+}
+
+// backupDB crea una copia consistente del database accanto al file originale
+func backupDB(db *sql.DB, dbPath string, version int) (string, error) {
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", dbPath, version, now().Format("20060102-150405"))
+
+	// VACUUM INTO fallisce se il file esiste già
+	if _, err := os.Stat(backupPath); err == nil {
+		return "", fmt.Errorf("file di backup già esistente: %s", backupPath)
+	}
+
+	if _, err := db.Exec(`VACUUM INTO ?`, backupPath); err != nil {
+		return "", fmt.Errorf("errore backup pre-migrazione: %v", err)
+	}
+
+	return backupPath, nil
+}
+
+// columnExists verifica se una colonna è presente in una tabella
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, fmt.Errorf("errore lettura colonne %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// addColumnIfMissing aggiunge una colonna solo se non esiste già
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition)); err != nil {
+		return fmt.Errorf("errore aggiunta colonna %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// migrateSchemaIniziale crea lo schema di base.
+// Su database creati prima del sistema di migrazioni le tabelle esistono già
+// e vengono solo aggiunte le colonne mancanti.
+func migrateSchemaIniziale(tx *sql.Tx) error {
+	tables := []struct {
+		name string
+		sql  string
+	}{
+		{"applicazioni", `
+		CREATE TABLE IF NOT EXISTS applicazioni (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			nome TEXT NOT NULL,
+			tempo INTEGER NOT NULL,
+			categoria TEXT NOT NULL,
+			data_creazione DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`},
+		{"projects", `
+		CREATE TABLE IF NOT EXISTS projects (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			archived INTEGER DEFAULT 0,
+			closed_at DATETIME,
+			note_text TEXT DEFAULT ''
+		);`},
+		{"sessions", `
+		CREATE TABLE IF NOT EXISTS sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			app_name TEXT NOT NULL,
+			seconds INTEGER NOT NULL,
+			project_id INTEGER,
+			session_type TEXT DEFAULT 'computer',
+			activity_type TEXT DEFAULT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (project_id) REFERENCES projects(id)
+		);`},
+		{"notes", `
+		CREATE TABLE IF NOT EXISTS notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			project_id INTEGER NOT NULL,
+			note_text TEXT NOT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (project_id) REFERENCES projects(id)
+		);`},
+		{"activity_types", `
+		CREATE TABLE IF NOT EXISTS activity_types (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			color_variant REAL DEFAULT 0.0,
+			display_order INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			pattern TEXT DEFAULT 'solid'
+		);`},
+		{"settings", `
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`},
+		{"pending_tracking", `
+		CREATE TABLE IF NOT EXISTS pending_tracking (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			project_id INTEGER,
+			activity_type TEXT,
+			start_time DATETIME NOT NULL,
+			last_saved_seconds INTEGER DEFAULT 0,
+			last_update DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (session_id) REFERENCES sessions(id),
+			FOREIGN KEY (project_id) REFERENCES projects(id)
+		);`},
+	}
+
+	for _, t := range tables {
+		if _, err := tx.Exec(t.sql); err != nil {
+			return fmt.Errorf("errore creazione tabella %s: %v", t.name, err)
+		}
+	}
+
+	// Colonne aggiunte nelle versioni precedenti al sistema di migrazioni
+	legacyColumns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"projects", "archived", "INTEGER DEFAULT 0"},
+		{"projects", "closed_at", "DATETIME"},
+		{"projects", "note_text", "TEXT DEFAULT ''"},
+		{"sessions", "activity_type", "TEXT DEFAULT NULL"},
+		{"activity_types", "pattern", "TEXT DEFAULT 'solid'"},
+	}
+
+	for _, c := range legacyColumns {
+		if err := addColumnIfMissing(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Indici per migliorare le performance delle query
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_sessions_timestamp ON sessions(timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_app_name ON sessions(app_name)`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_project_id ON notes(project_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_timestamp ON notes(timestamp)`,
+	}
+
+	for _, idx := range indexes {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("errore creazione indice: %v", err)
+		}
+	}
+
+	// Tipi di attività di default se la tabella è vuota
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM activity_types").Scan(&count); err != nil {
+		return fmt.Errorf("errore conteggio tipi attività: %v", err)
+	}
+	if count == 0 {
+		defaultTypes := []struct {
+			name         string
+			colorVariant float64
+			pattern      string
+			order        int
+		}{
+			{"RICERCA", 0.3, "dots", 1},
+			{"PROGETTAZIONE", 0.0, "solid", 2},
+			{"REALIZZAZIONE", -0.3, "stripes", 3},
+		}
+
+		for _, t := range defaultTypes {
+			if _, err := tx.Exec("INSERT INTO activity_types (name, color_variant, pattern, display_order) VALUES (?, ?, ?, ?)",
+				t.name, t.colorVariant, t.pattern, t.order); err != nil {
+				return fmt.Errorf("errore inserimento tipo attività %s: %v", t.name, err)
+			}
+		}
+		fmt.Println("[DB] Tipi di attività predefiniti inseriti")
+	}
+
+	// Impostazioni di default
+	if _, err := tx.Exec("INSERT OR IGNORE INTO settings (key, value) VALUES ('auto_start', 'false')"); err != nil {
+		return fmt.Errorf("errore inserimento impostazioni di default: %v", err)
+	}
+
+	return nil
+}
+
+// migrateSessionAppUsage crea la tabella con il tempo per applicazione di ogni sessione
+func migrateSessionAppUsage(tx *sql.Tx) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS session_app_usage (
+		session_id INTEGER NOT NULL,
+		app_name TEXT NOT NULL,
+		seconds INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (session_id, app_name),
+		FOREIGN KEY (session_id) REFERENCES sessions(id)
+	);`
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella session_app_usage: %v", err)
+	}
+
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_session_app_usage_app_name ON session_app_usage(app_name)`); err != nil {
+		return fmt.Errorf("errore creazione indice session_app_usage: %v", err)
+	}
+
+	return nil
+}
+
+// migrateWindowTitleSpans crea la tabella della timeline dei titoli delle finestre
+func migrateWindowTitleSpans(tx *sql.Tx) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS window_title_spans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		process_name TEXT NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		FOREIGN KEY (session_id) REFERENCES sessions(id)
+	);`
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella window_title_spans: %v", err)
+	}
+
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_window_title_spans_session_id ON window_title_spans(session_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_window_title_spans_start_time ON window_title_spans(start_time)`,
+	}
+	for _, idx := range indexes {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("errore creazione indice window_title_spans: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// migrateAssignmentRules crea la tabella delle regole di assegnazione automatica
+func migrateAssignmentRules(tx *sql.Tx) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS assignment_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		process_name TEXT NOT NULL DEFAULT '',
+		title_pattern TEXT NOT NULL DEFAULT '',
+		time_from TEXT NOT NULL DEFAULT '',
+		time_to TEXT NOT NULL DEFAULT '',
+		project_id INTEGER,
+		activity_type TEXT,
+		mode TEXT NOT NULL DEFAULT 'suggest',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (project_id) REFERENCES projects(id)
+	);`
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella assignment_rules: %v", err)
+	}
+
+	return nil
+}
+
+// migratePauseIntervals crea la tabella delle pause e aggiunge lo stato di pausa al pending tracking
+func migratePauseIntervals(tx *sql.Tx) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS pause_intervals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		FOREIGN KEY (session_id) REFERENCES sessions(id)
+	);`
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella pause_intervals: %v", err)
+	}
+
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_pause_intervals_session_id ON pause_intervals(session_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_pause_intervals_start_time ON pause_intervals(start_time)`,
+	}
+	for _, idx := range indexes {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("errore creazione indice pause_intervals: %v", err)
+		}
+	}
+
+	// Istante di inizio della pausa in corso (NULL se il tracking non è in pausa)
+	return addColumnIfMissing(tx, "pending_tracking", "paused_at", "DATETIME")
+}
+
+// migratePendingIdlePeriods crea la coda dei periodi idle e sospesi in attesa di attribuzione
+func migratePendingIdlePeriods(tx *sql.Tx) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS pending_idle_periods (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		period_type TEXT NOT NULL DEFAULT 'idle',
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		seconds INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella pending_idle_periods: %v", err)
+	}
+
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pending_idle_periods_start_time ON pending_idle_periods(start_time)`); err != nil {
+		return fmt.Errorf("errore creazione indice pending_idle_periods: %v", err)
+	}
+	return nil
+}
+
+// migrateSessionSegments crea la tabella dei tratti (attivi, idle, pause, sospensioni) delle sessioni
+func migrateSessionSegments(tx *sql.Tx) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS session_segments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		segment_type TEXT NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		FOREIGN KEY (session_id) REFERENCES sessions(id)
+	);`
+
+	if _, err := tx.Exec(createSQL); err != nil {
+		return fmt.Errorf("errore creazione tabella session_segments: %v", err)
+	}
+
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_session_segments_session_id ON session_segments(session_id)`); err != nil {
+		return fmt.Errorf("errore creazione indice session_segments: %v", err)
+	}
+	return nil
+}
+
+// migrateSessionEndedAt aggiunge la fine reale delle sessioni e la ricava per quelle esistenti:
+// dall'ultimo tratto attivo se la sessione ha tratti registrati, altrimenti da inizio più durata.
+// Le sessioni ancora in corso restano senza fine fino alla finalizzazione.
+func migrateSessionEndedAt(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "sessions", "ended_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	backfillSQL := `
+	UPDATE sessions SET ended_at = COALESCE(
+		(SELECT datetime(MAX(end_time)) FROM session_segments
+		 WHERE session_id = sessions.id AND segment_type = 'active' AND end_time IS NOT NULL),
+		datetime(timestamp, '+' || seconds || ' seconds')
+	)
+	WHERE ended_at IS NULL
+	  AND id NOT IN (SELECT session_id FROM pending_tracking)`
+
+	if _, err := tx.Exec(backfillSQL); err != nil {
+		return fmt.Errorf("errore calcolo fine sessioni esistenti: %v", err)
+	}
+
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_sessions_ended_at ON sessions(ended_at)`); err != nil {
+		return fmt.Errorf("errore creazione indice ended_at: %v", err)
+	}
+	return nil
+}
+
+// timestampColumn è una colonna di timestamp da convertire in UTC RFC3339
+type timestampColumn struct {
+	table, column string
+}
+
+// localTimestampColumns sono le colonne scritte finora in ora locale di sistema
+var localTimestampColumns = []timestampColumn{
+	{"sessions", "timestamp"},
+	{"sessions", "ended_at"},
+	{"pause_intervals", "start_time"},
+	{"pause_intervals", "end_time"},
+	{"session_segments", "start_time"},
+	{"session_segments", "end_time"},
+	{"window_title_spans", "start_time"},
+	{"window_title_spans", "end_time"},
+	{"pending_tracking", "start_time"},
+	{"pending_tracking", "paused_at"},
+	{"pending_idle_periods", "start_time"},
+	{"pending_idle_periods", "end_time"},
+}
+
+// utcTimestampColumns sono le colonne scritte finora da CURRENT_TIMESTAMP, già in UTC
+var utcTimestampColumns = []timestampColumn{
+	{"projects", "created_at"},
+	{"projects", "closed_at"},
+	{"notes", "timestamp"},
+	{"activity_types", "created_at"},
+	{"assignment_rules", "created_at"},
+	{"pending_tracking", "last_update"},
+	{"pending_idle_periods", "created_at"},
+}
+
+// migrateTimestampsUTC porta tutti i timestamp in UTC RFC3339 e registra il fuso orario di ogni
+// sessione. I valori in ora locale sono stati scritti con il fuso di sistema, quindi si convertono
+// con quello (incluse le regole dell'ora legale in vigore a ogni data). Le sessioni sono
+// etichettate con il nome dello stesso fuso di sistema, o restano senza fuso se non è noto.
+func migrateTimestampsUTC(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "sessions", "time_zone", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET time_zone = ? WHERE time_zone IS NULL`, nullIfEmpty(systemTimeZoneName())); err != nil {
+		return fmt.Errorf("errore impostazione fuso orario sessioni: %v", err)
+	}
+
+	for _, c := range localTimestampColumns {
+		if err := convertTimestampColumn(tx, c, time.Local); err != nil {
+			return err
+		}
+	}
+	for _, c := range utcTimestampColumns {
+		if err := convertTimestampColumn(tx, c, time.UTC); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertTimestampColumn riscrive una colonna interpretando le cifre di ogni valore nel fuso loc.
+// L'eventuale "Z" finale viene ignorata: gli export precedenti la aggiungevano anche all'ora locale.
+func convertTimestampColumn(tx *sql.Tx, c timestampColumn, loc *time.Location) error {
+	// CAST per leggere il testo salvato, non il valore già interpretato dal driver
+	rows, err := tx.Query(fmt.Sprintf(`SELECT id, CAST(%s AS TEXT) FROM %s WHERE %s IS NOT NULL AND %s != ''`, c.column, c.table, c.column, c.column))
+	if err != nil {
+		return fmt.Errorf("errore lettura %s.%s: %v", c.table, c.column, err)
+	}
+
+	converted := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("errore lettura %s.%s: %v", c.table, c.column, err)
+		}
+		t, ok := parseLegacyTimestamp(value, loc)
+		if !ok {
+			fmt.Printf("[DB] Timestamp non riconosciuto in %s.%s (ID %d): '%s', lasciato invariato\n", c.table, c.column, id, value)
+			continue
+		}
+		converted[id] = FormatTimestamp(t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("errore lettura %s.%s: %v", c.table, c.column, err)
+	}
+
+	updateSQL := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, c.table, c.column)
+	for id, value := range converted {
+		if _, err := tx.Exec(updateSQL, value, id); err != nil {
+			return fmt.Errorf("errore conversione %s.%s: %v", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
+// parseLegacyTimestamp interpreta un timestamp senza fuso nelle forme usate prima della
+// conversione in UTC
+func parseLegacyTimestamp(value string, loc *time.Location) (time.Time, bool) {
+	value = strings.TrimSuffix(strings.Replace(value, "T", " ", 1), "Z")
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// foreignKeyTable è una tabella da ricreare con le azioni ON DELETE delle chiavi esterne
+type foreignKeyTable struct {
+	name    string
+	create  string // CREATE TABLE della nuova tabella (con nome segnaposto %s)
+	columns string // colonne da copiare
+	copy    string // espressioni SELECT corrispondenti alle colonne
+	where   string // righe da copiare: quelle collegate a righe eliminate vengono scartate
+	indexes []string
+}
+
+// foreignKeyTables definisce l'azione ON DELETE di ogni relazione:
+//   - sessioni, note, regole e tracking pendente seguono il progetto eliminato
+//   - i dati di dettaglio e il tracking pendente seguono la sessione eliminata
+var foreignKeyTables = []foreignKeyTable{
+	{
+		name: "sessions",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			app_name TEXT NOT NULL,
+			seconds INTEGER NOT NULL,
+			project_id INTEGER,
+			session_type TEXT DEFAULT 'computer',
+			activity_type TEXT DEFAULT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			ended_at DATETIME,
+			time_zone TEXT,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+		)`,
+		columns: "id, app_name, seconds, project_id, session_type, activity_type, timestamp, ended_at, time_zone",
+		// Le sessioni di progetti già eliminati restano, non assegnate
+		copy: "id, app_name, seconds, CASE WHEN project_id IN (SELECT id FROM projects) THEN project_id END, session_type, activity_type, timestamp, ended_at, time_zone",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_sessions_timestamp ON sessions(timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_app_name ON sessions(app_name)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_ended_at ON sessions(ended_at)`,
+		},
+	},
+	{
+		name: "notes",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			project_id INTEGER NOT NULL,
+			note_text TEXT NOT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+		)`,
+		columns: "id, project_id, note_text, timestamp",
+		where:   "project_id IN (SELECT id FROM projects)",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_notes_project_id ON notes(project_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_notes_timestamp ON notes(timestamp)`,
+		},
+	},
+	{
+		name: "pending_tracking",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			project_id INTEGER,
+			activity_type TEXT,
+			start_time DATETIME NOT NULL,
+			last_saved_seconds INTEGER DEFAULT 0,
+			last_update DATETIME DEFAULT CURRENT_TIMESTAMP,
+			paused_at DATETIME,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+		)`,
+		columns: "id, session_id, project_id, activity_type, start_time, last_saved_seconds, last_update, paused_at",
+		copy:    "id, session_id, CASE WHEN project_id IN (SELECT id FROM projects) THEN project_id END, activity_type, start_time, last_saved_seconds, last_update, paused_at",
+		where:   "session_id IN (SELECT id FROM sessions)",
+	},
+	{
+		name: "session_app_usage",
+		create: `CREATE TABLE %s (
+			session_id INTEGER NOT NULL,
+			app_name TEXT NOT NULL,
+			seconds INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (session_id, app_name),
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		)`,
+		columns: "session_id, app_name, seconds",
+		where:   "session_id IN (SELECT id FROM sessions)",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_session_app_usage_app_name ON session_app_usage(app_name)`,
+		},
+	},
+	{
+		name: "window_title_spans",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			process_name TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			start_time DATETIME NOT NULL,
+			end_time DATETIME NOT NULL,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		)`,
+		columns: "id, session_id, process_name, title, start_time, end_time",
+		where:   "session_id IN (SELECT id FROM sessions)",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_window_title_spans_session_id ON window_title_spans(session_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_window_title_spans_start_time ON window_title_spans(start_time)`,
+		},
+	},
+	{
+		name: "assignment_rules",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			process_name TEXT NOT NULL DEFAULT '',
+			title_pattern TEXT NOT NULL DEFAULT '',
+			time_from TEXT NOT NULL DEFAULT '',
+			time_to TEXT NOT NULL DEFAULT '',
+			project_id INTEGER,
+			activity_type TEXT,
+			mode TEXT NOT NULL DEFAULT 'suggest',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+		)`,
+		columns: "id, name, priority, enabled, process_name, title_pattern, time_from, time_to, project_id, activity_type, mode, created_at",
+		where:   "project_id IS NULL OR project_id IN (SELECT id FROM projects)",
+	},
+	{
+		name: "pause_intervals",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			start_time DATETIME NOT NULL,
+			end_time DATETIME,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		)`,
+		columns: "id, session_id, start_time, end_time",
+		where:   "session_id IN (SELECT id FROM sessions)",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_pause_intervals_session_id ON pause_intervals(session_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_pause_intervals_start_time ON pause_intervals(start_time)`,
+		},
+	},
+	{
+		name: "session_segments",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			segment_type TEXT NOT NULL,
+			start_time DATETIME NOT NULL,
+			end_time DATETIME,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		)`,
+		columns: "id, session_id, segment_type, start_time, end_time",
+		where:   "session_id IN (SELECT id FROM sessions)",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_session_segments_session_id ON session_segments(session_id)`,
+		},
+	},
+}
+
+// migrateForeignKeys ricrea le tabelle collegate con le azioni ON DELETE delle chiavi esterne.
+// SQLite non permette di modificare i vincoli di una tabella esistente: ogni tabella viene
+// copiata in una nuova, scartando le righe già orfane, e sostituita. Le migrazioni girano con
+// i vincoli disattivati, quindi alla fine si verifica che non resti nessuna violazione.
+func migrateForeignKeys(tx *sql.Tx) error {
+	for _, t := range foreignKeyTables {
+		if err := rebuildTable(tx, t); err != nil {
+			return err
+		}
+	}
+	return verificaChiaviEsterne(tx)
+}
+
+// verificaChiaviEsterne controlla che nessuna riga violi i vincoli di chiave esterna
+func verificaChiaviEsterne(tx *sql.Tx) error {
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return fmt.Errorf("errore verifica chiavi esterne: %v", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return fmt.Errorf("errore verifica chiavi esterne: %v", err)
+		}
+		return fmt.Errorf("chiave esterna non valida in %s (riga %d) verso %s", table, rowID.Int64, parent)
+	}
+	return rows.Err()
+}
+
+// rebuildTable sostituisce una tabella con una nuova definizione mantenendone i dati
+func rebuildTable(tx *sql.Tx, t foreignKeyTable) error {
+	newName := t.name + "_new"
+	if _, err := tx.Exec(fmt.Sprintf(t.create, newName)); err != nil {
+		return fmt.Errorf("errore creazione tabella %s: %v", newName, err)
+	}
+
+	copyColumns := t.copy
+	if copyColumns == "" {
+		copyColumns = t.columns
+	}
+	copySQL := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`, newName, t.columns, copyColumns, t.name)
+	if t.where != "" {
+		copySQL += " WHERE " + t.where
+	}
+	result, err := tx.Exec(copySQL)
+	if err != nil {
+		return fmt.Errorf("errore copia tabella %s: %v", t.name, err)
+	}
+
+	var total int64
+	if err := tx.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s`, t.name)).Scan(&total); err != nil {
+		return fmt.Errorf("errore conteggio tabella %s: %v", t.name, err)
+	}
+	if copied, _ := result.RowsAffected(); copied < total {
+		fmt.Printf("[DB] %s: %d righe orfane scartate\n", t.name, total-copied)
+	}
+
+	// Il contatore AUTOINCREMENT deve proseguire da quello della tabella originale,
+	// così gli ID di righe eliminate non vengono riusati
+	var sequence sql.NullInt64
+	err = tx.QueryRow(`SELECT seq FROM sqlite_sequence WHERE name = ?`, t.name).Scan(&sequence)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("errore lettura sequenza %s: %v", t.name, err)
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE %s`, t.name)); err != nil {
+		return fmt.Errorf("errore eliminazione tabella %s: %v", t.name, err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, newName, t.name)); err != nil {
+		return fmt.Errorf("errore rinomina tabella %s: %v", newName, err)
+	}
+
+	if sequence.Valid {
+		result, err := tx.Exec(`UPDATE sqlite_sequence SET seq = MAX(seq, ?) WHERE name = ?`, sequence.Int64, t.name)
+		if err != nil {
+			return fmt.Errorf("errore aggiornamento sequenza %s: %v", t.name, err)
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			if _, err := tx.Exec(`INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)`, t.name, sequence.Int64); err != nil {
+				return fmt.Errorf("errore aggiornamento sequenza %s: %v", t.name, err)
+			}
+		}
+	}
+
+	for _, idx := range t.indexes {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("errore creazione indice %s: %v", t.name, err)
+		}
+	}
+	return nil
+}
+
+// activityTypeTables sono le tabelle che fanno riferimento al tipo attività per ID invece che
+// per nome: un tipo rinominato resta collegato alle sessioni, e un tipo archiviato non le perde
+var activityTypeTables = []foreignKeyTable{
+	{
+		name: "sessions",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			app_name TEXT NOT NULL,
+			seconds INTEGER NOT NULL,
+			project_id INTEGER,
+			session_type TEXT DEFAULT 'computer',
+			activity_type_id INTEGER,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			ended_at DATETIME,
+			time_zone TEXT,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (activity_type_id) REFERENCES activity_types(id) ON DELETE SET NULL
+		)`,
+		columns: "id, app_name, seconds, project_id, session_type, activity_type_id, timestamp, ended_at, time_zone",
+		copy:    "id, app_name, seconds, project_id, session_type, (SELECT id FROM activity_types WHERE name = activity_type), timestamp, ended_at, time_zone",
+		indexes: []string{
+			`CREATE INDEX IF NOT EXISTS idx_sessions_timestamp ON sessions(timestamp)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_project_id ON sessions(project_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_app_name ON sessions(app_name)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_ended_at ON sessions(ended_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_activity_type_id ON sessions(activity_type_id)`,
+		},
+	},
+	{
+		name: "pending_tracking",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			session_id INTEGER NOT NULL,
+			project_id INTEGER,
+			activity_type_id INTEGER,
+			start_time DATETIME NOT NULL,
+			last_saved_seconds INTEGER DEFAULT 0,
+			last_update DATETIME DEFAULT CURRENT_TIMESTAMP,
+			paused_at DATETIME,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (activity_type_id) REFERENCES activity_types(id) ON DELETE SET NULL
+		)`,
+		columns: "id, session_id, project_id, activity_type_id, start_time, last_saved_seconds, last_update, paused_at",
+		copy:    "id, session_id, project_id, (SELECT id FROM activity_types WHERE name = activity_type), start_time, last_saved_seconds, last_update, paused_at",
+	},
+	{
+		name: "assignment_rules",
+		create: `CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			process_name TEXT NOT NULL DEFAULT '',
+			title_pattern TEXT NOT NULL DEFAULT '',
+			time_from TEXT NOT NULL DEFAULT '',
+			time_to TEXT NOT NULL DEFAULT '',
+			project_id INTEGER,
+			activity_type_id INTEGER,
+			mode TEXT NOT NULL DEFAULT 'suggest',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (activity_type_id) REFERENCES activity_types(id) ON DELETE SET NULL
+		)`,
+		columns: "id, name, priority, enabled, process_name, title_pattern, time_from, time_to, project_id, activity_type_id, mode, created_at",
+		copy:    "id, name, priority, enabled, process_name, title_pattern, time_from, time_to, project_id, (SELECT id FROM activity_types WHERE name = activity_type), mode, created_at",
+	},
+}
+
+// migrateActivityTypeIDs sostituisce il nome del tipo attività con il suo ID in sessioni,
+// tracking pendente e regole, e aggiunge l'archiviazione dei tipi attività.
+// I nomi che non corrispondono a nessun tipo (tipi già eliminati o rinominati) diventano tipi
+// archiviati, così le sessioni storiche mantengono la loro attività nei report.
+func migrateActivityTypeIDs(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "activity_types", "archived", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// I tipi recuperati vanno in fondo all'elenco, ognuno con la sua posizione
+	missingSQL := `
+	INSERT INTO activity_types (name, color_variant, pattern, display_order, created_at, archived)
+	SELECT name, 0.0, 'solid', (SELECT COALESCE(MAX(display_order), 0) FROM activity_types) + ROW_NUMBER() OVER (ORDER BY name), ?, 1
+	FROM (
+		SELECT activity_type AS name FROM sessions
+		UNION SELECT activity_type FROM pending_tracking
+		UNION SELECT activity_type FROM assignment_rules
+	)
+	WHERE name IS NOT NULL AND name != '' AND name NOT IN (SELECT name FROM activity_types)`
+
+	result, err := tx.Exec(missingSQL, FormatTimestamp(now()))
+	if err != nil {
+		return fmt.Errorf("errore creazione tipi attività mancanti: %v", err)
+	}
+	if created, _ := result.RowsAffected(); created > 0 {
+		fmt.Printf("[DB] %d tipi attività non più esistenti recuperati come archiviati\n", created)
+	}
+
+	for _, t := range activityTypeTables {
+		if err := rebuildTable(tx, t); err != nil {
+			return err
+		}
+	}
+	return verificaChiaviEsterne(tx)
+}
+
+// uuidSQL genera in SQL un UUID versione 4 casuale (es. "3f2b8c1e-9a4d-4c7e-b2f1-0d6e5a4c3b2a")
+const uuidSQL = `lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+	substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))`
+
+// uuidTables sono le tabelle delle entità con identificativo globale
+var uuidTables = []string{"projects", "sessions", "activity_types", "notes"}
+
+// migrateUUIDs aggiunge a progetti, sessioni, tipi di attività e note un identificativo globale
+// che resta invariato tra esportazione e importazione, per riconoscere la stessa entità su
+// computer diversi. Un trigger assegna l'UUID a ogni riga inserita senza.
+// Attenzione: ricostruire una di queste tabelle elimina il suo trigger, che va ricreato.
+func migrateUUIDs(tx *sql.Tx) error {
+	for _, table := range uuidTables {
+		if err := addColumnIfMissing(tx, table, "uuid", "TEXT"); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE ` + table + ` SET uuid = ` + uuidSQL + ` WHERE uuid IS NULL`); err != nil {
+			return fmt.Errorf("errore generazione UUID %s: %v", table, err)
+		}
+
+		indexSQL := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_uuid ON %s(uuid)`, table, table)
+		if _, err := tx.Exec(indexSQL); err != nil {
+			return fmt.Errorf("errore creazione indice UUID %s: %v", table, err)
+		}
+
+		triggerSQL := fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS %s_uuid AFTER INSERT ON %s
+		WHEN NEW.uuid IS NULL
+		BEGIN
+			UPDATE %s SET uuid = %s WHERE id = NEW.id;
+		END`, table, table, table, uuidSQL)
+		if _, err := tx.Exec(triggerSQL); err != nil {
+			return fmt.Errorf("errore creazione trigger UUID %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// rulesProjectSetNullTable ricrea assignment_rules in modo che eliminare un progetto non
+// elimini più le regole che lo assegnano: il progetto della regola diventa NULL, come già
+// succede per il tipo attività. Il created_at predefinito è in UTC RFC3339 come gli altri
+// timestamp (i % sono raddoppiati per fmt.Sprintf in rebuildTable).
+var rulesProjectSetNullTable = foreignKeyTable{
+	name: "assignment_rules",
+	create: `CREATE TABLE %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		process_name TEXT NOT NULL DEFAULT '',
+		title_pattern TEXT NOT NULL DEFAULT '',
+		time_from TEXT NOT NULL DEFAULT '',
+		time_to TEXT NOT NULL DEFAULT '',
+		project_id INTEGER,
+		activity_type_id INTEGER,
+		mode TEXT NOT NULL DEFAULT 'suggest',
+		created_at DATETIME DEFAULT (strftime('%%Y-%%m-%%dT%%H:%%M:%%SZ', 'now')),
+		FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+		FOREIGN KEY (activity_type_id) REFERENCES activity_types(id) ON DELETE SET NULL
+	)`,
+	columns: "id, name, priority, enabled, process_name, title_pattern, time_from, time_to, project_id, activity_type_id, mode, created_at",
+}
+
+// migrateRulesProjectSetNull scollega dal progetto eliminato le regole invece di eliminarle
+// (vedi EliminaProgettoById)
+func migrateRulesProjectSetNull(tx *sql.Tx) error {
+	if err := rebuildTable(tx, rulesProjectSetNullTable); err != nil {
+		return err
+	}
+	return verificaChiaviEsterne(tx)
+}
@@ -0,0 +1,375 @@
+package tracker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apriDBVersione crea un database con le migrazioni applicate fino alla versione indicata
+// e restituisce la connessione su cui applicare le successive
+func apriDBVersione(t *testing.T, version int) (*sql.DB, *sql.Conn) {
+	t.Helper()
+	return creaDBVersione(t, filepath.Join(t.TempDir(), "timetracker.db"), version)
+}
+
+// creaDBVersione è apriDBVersione con il file del database indicato
+func creaDBVersione(t *testing.T, path string, version int) (*sql.DB, *sql.Conn) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for _, m := range migrations {
+		if m.version > version {
+			break
+		}
+		if err := applyMigration(conn, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, conn
+}
+
+func TestMigrateActivityTypeIDsOrdineTipiRecuperati(t *testing.T) {
+	db, conn := apriDBVersione(t, 10)
+
+	// Sessioni con tipi attività eliminati o rinominati prima della migrazione
+	for _, name := range []string{"VECCHIO B", "VECCHIO A", "VECCHIO B", "RICERCA"} {
+		if _, err := db.Exec(`INSERT INTO sessions (app_name, seconds, activity_type, timestamp) VALUES ('Code.exe', 60, ?, '2026-03-02T08:00:00Z')`, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := applyMigration(conn, migrations[10]); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT name, display_order, archived FROM activity_types ORDER BY display_order`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type tipo struct {
+		name     string
+		order    int
+		archived bool
+	}
+	var got []tipo
+	for rows.Next() {
+		var r tipo
+		if err := rows.Scan(&r.name, &r.order, &r.archived); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []tipo{
+		{"RICERCA", 1, false},
+		{"PROGETTAZIONE", 2, false},
+		{"REALIZZAZIONE", 3, false},
+		{"VECCHIO A", 4, true},
+		{"VECCHIO B", 5, true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tipi attività = %+v, attesi %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tipo attività %d = %+v, atteso %+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestMigrateRulesProjectSetNull(t *testing.T) {
+	db, conn := apriDBVersione(t, 12)
+
+	if _, err := db.Exec(`INSERT INTO projects (name, created_at) VALUES ('Cliente', '2026-03-02T08:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO assignment_rules (name, process_name, project_id, mode, created_at) VALUES ('Editor', 'Code.exe', 1, 'auto', '2026-03-02T08:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyMigration(conn, migrations[12]); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT "from", on_delete FROM pragma_foreign_key_list('assignment_rules')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	actions := map[string]string{}
+	for rows.Next() {
+		var column, action string
+		if err := rows.Scan(&column, &action); err != nil {
+			t.Fatal(err)
+		}
+		actions[column] = action
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if actions["project_id"] != "SET NULL" || actions["activity_type_id"] != "SET NULL" {
+		t.Errorf("azioni ON DELETE = %v, attese SET NULL", actions)
+	}
+
+	// La regola esistente è conservata, e le nuove ricevono created_at in UTC RFC3339
+	var projectID int
+	if err := db.QueryRow(`SELECT project_id FROM assignment_rules WHERE name = 'Editor'`).Scan(&projectID); err != nil || projectID != 1 {
+		t.Errorf("regola esistente: progetto = %d (%v), atteso 1", projectID, err)
+	}
+	if _, err := db.Exec(`INSERT INTO assignment_rules (name, process_name, project_id) VALUES ('Nuova', '*', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	var createdAt string
+	if err := db.QueryRow(`SELECT CAST(created_at AS TEXT) FROM assignment_rules WHERE name = 'Nuova'`).Scan(&createdAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(timestampLayout, createdAt); err != nil {
+		t.Errorf("created_at predefinito = %s, atteso nel formato %s", createdAt, timestampLayout)
+	}
+}
+
+// versioniApplicate restituisce le versioni registrate in schema_migrations con il loro nome
+func versioniApplicate(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT version, name FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var applied []string
+	for rows.Next() {
+		var version int
+		var name string
+		if err := rows.Scan(&version, &name); err != nil {
+			t.Fatal(err)
+		}
+		applied = append(applied, fmt.Sprintf("%d %s", version, name))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return applied
+}
+
+// backupPresenti restituisce i file di backup pre-migrazione nella cartella del database
+func backupPresenti(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".v*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestMigrateDBNuovoDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timetracker.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for _, m := range migrations {
+		want = append(want, fmt.Sprintf("%d %s", m.version, m.name))
+	}
+	if got := versioniApplicate(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrazioni applicate = %q, attese %q", got, want)
+	}
+	if version, err := SchemaVersion(db); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("versione schema = %d (%v), attesa %d", version, err, LatestSchemaVersion())
+	}
+	// Un database nuovo non ha nulla da salvare
+	if backups := backupPresenti(t, path); len(backups) != 0 {
+		t.Errorf("backup creati per un database nuovo: %q", backups)
+	}
+	if _, err := CreaProgetto(db, "Cliente", ""); err != nil {
+		t.Fatal(err)
+	}
+	var appliedAt string
+	if err := db.QueryRow(`SELECT CAST(applied_at AS TEXT) FROM schema_migrations WHERE version = 1`).Scan(&appliedAt); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Alla seconda apertura non c'è nulla da migrare né da salvare
+	db, err = InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := versioniApplicate(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrazioni dopo la seconda apertura = %q, attese %q", got, want)
+	}
+	var appliedAgain string
+	if err := db.QueryRow(`SELECT CAST(applied_at AS TEXT) FROM schema_migrations WHERE version = 1`).Scan(&appliedAgain); err != nil || appliedAgain != appliedAt {
+		t.Errorf("migrazione 1 registrata alle %s (%v), prima alle %s", appliedAgain, err, appliedAt)
+	}
+	if backups := backupPresenti(t, path); len(backups) != 0 {
+		t.Errorf("backup creati senza migrazioni da applicare: %q", backups)
+	}
+	if project, err := TrovaProgetto(db, "Cliente"); err != nil || project == nil {
+		t.Errorf("progetto perso alla seconda apertura: %v", err)
+	}
+}
+
+func TestMigrateDBVersionePiuRecente(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timetracker.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer := LatestSchemaVersion() + 1
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'da una versione futura')`, newer); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Un binario più vecchio non apre né modifica un database migrato da uno più recente
+	if db, err := InitDB(path); err == nil {
+		db.Close()
+		t.Fatal("database con schema più recente aperto")
+	} else if !strings.Contains(err.Error(), "più recente") {
+		t.Errorf("errore = %v, atteso il rifiuto della versione più recente", err)
+	}
+	if backups := backupPresenti(t, path); len(backups) != 0 {
+		t.Errorf("backup creati per un database rifiutato: %q", backups)
+	}
+
+	db, err = sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if version, err := SchemaVersion(db); err != nil || version != newer {
+		t.Errorf("versione schema = %d (%v), attesa %d", version, err, newer)
+	}
+}
+
+func TestMigrateDBBackupPreMigrazione(t *testing.T) {
+	SetClock(NewManualClock(testStart))
+	t.Cleanup(func() { SetClock(nil) })
+
+	path := filepath.Join(t.TempDir(), "timetracker.db")
+	previous := LatestSchemaVersion() - 1
+	old, _ := creaDBVersione(t, path, previous)
+	if _, err := old.Exec(`INSERT INTO projects (name, created_at) VALUES ('Cliente', '2026-03-02T08:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if version, err := SchemaVersion(db); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("versione schema = %d (%v), attesa %d", version, err, LatestSchemaVersion())
+	}
+
+	// Il backup porta nel nome la versione di partenza e l'istante della migrazione
+	wantBackup := fmt.Sprintf("%s.v%d-%s.bak", path, previous, testStart.Format("20060102-150405"))
+	if backups := backupPresenti(t, path); !reflect.DeepEqual(backups, []string{wantBackup}) {
+		t.Fatalf("backup = %q, atteso %q", backups, wantBackup)
+	}
+	backup, err := sql.Open("sqlite", wantBackup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if version, err := SchemaVersion(backup); err != nil || version != previous {
+		t.Errorf("versione schema del backup = %d (%v), attesa %d", version, err, previous)
+	}
+	var name string
+	if err := backup.QueryRow(`SELECT name FROM projects`).Scan(&name); err != nil || name != "Cliente" {
+		t.Errorf("progetto nel backup = %q (%v), atteso Cliente", name, err)
+	}
+}
+
+func TestMigrateDBMigrazioneFallita(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timetracker.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Due nuove migrazioni: la prima riesce, la seconda fallisce dopo aver modificato lo schema
+	latest := LatestSchemaVersion()
+	original := migrations
+	t.Cleanup(func() { migrations = original })
+	migrations = append(append([]migration(nil), original...),
+		migration{latest + 1, "tabella di prova", func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE TABLE prova_riuscita (id INTEGER PRIMARY KEY)`)
+			return err
+		}},
+		migration{latest + 2, "migrazione rotta", func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`CREATE TABLE prova_fallita (id INTEGER PRIMARY KEY)`); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`ALTER TABLE sessions ADD COLUMN prova TEXT`); err != nil {
+				return err
+			}
+			return fmt.Errorf("errore simulato")
+		}},
+	)
+
+	if db, err := InitDB(path); err == nil {
+		db.Close()
+		t.Fatal("migrazione fallita non segnalata")
+	} else if !strings.Contains(err.Error(), "migrazione rotta") {
+		t.Errorf("errore = %v, atteso il nome della migrazione fallita", err)
+	}
+
+	db, err = sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Resta applicata solo la migrazione riuscita: quella fallita è annullata per intero
+	if version, err := SchemaVersion(db); err != nil || version != latest+1 {
+		t.Errorf("versione schema = %d (%v), attesa %d", version, err, latest+1)
+	}
+	tables := map[string]bool{}
+	for _, table := range []string{"prova_riuscita", "prova_fallita"} {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		tables[table] = count == 1
+	}
+	if !tables["prova_riuscita"] || tables["prova_fallita"] {
+		t.Errorf("tabelle dopo il fallimento = %v, attesa solo prova_riuscita", tables)
+	}
+	var columns int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('sessions') WHERE name = 'prova'`).Scan(&columns); err != nil || columns != 0 {
+		t.Errorf("colonna della migrazione fallita presente (%d, %v)", columns, err)
+	}
+	if backups := backupPresenti(t, path); len(backups) != 1 {
+		t.Errorf("backup pre-migrazione = %q, atteso uno", backups)
+	}
+}
@@ -0,0 +1,135 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PauseInterval rappresenta una pausa all'interno di una sessione di tracking
+type PauseInterval struct {
+	ID        int
+	SessionID int
+	StartTime time.Time
+	EndTime   time.Time // zero se la pausa è ancora in corso
+}
+
+// IniziaPausa registra l'inizio di una pausa sulla sessione pendente.
+// Salva anche i secondi raggiunti, così un recupero dopo un crash durante la pausa è esatto.
+func IniziaPausa(db *sql.DB, sessionID int64, seconds int, at time.Time) error {
+	startTime := FormatTimestamp(at)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio registrazione pausa: %v", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET seconds = ? WHERE id = ?`, seconds, sessionID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore aggiornamento sessione: %v", err)
+	}
+
+	updatePendingSQL := `UPDATE pending_tracking SET last_saved_seconds = ?, paused_at = ?, last_update = ? WHERE session_id = ?`
+	if _, err := tx.Exec(updatePendingSQL, seconds, startTime, FormatTimestamp(now()), sessionID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore aggiornamento pending tracking: %v", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO pause_intervals (session_id, start_time) VALUES (?, ?)`, sessionID, startTime); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore registrazione pausa: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit pausa: %v", err)
+	}
+
+	fmt.Printf("[DB] Pausa iniziata - Session ID: %d, Secondi: %d\n", sessionID, seconds)
+	return nil
+}
+
+// TerminaPausa chiude la pausa in corso sulla sessione pendente
+func TerminaPausa(db *sql.DB, sessionID int64, at time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio chiusura pausa: %v", err)
+	}
+
+	updatePauseSQL := `UPDATE pause_intervals SET end_time = ? WHERE session_id = ? AND end_time IS NULL`
+	if _, err := tx.Exec(updatePauseSQL, FormatTimestamp(at), sessionID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore chiusura pausa: %v", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE pending_tracking SET paused_at = NULL WHERE session_id = ?`, sessionID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore aggiornamento pending tracking: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit chiusura pausa: %v", err)
+	}
+
+	fmt.Printf("[DB] Pausa terminata - Session ID: %d\n", sessionID)
+	return nil
+}
+
+// CaricaPauseSessione carica le pause di una sessione
+func CaricaPauseSessione(db *sql.DB, sessionID int) ([]PauseInterval, error) {
+	query := `
+	SELECT id, session_id, start_time, COALESCE(end_time, '')
+	FROM pause_intervals
+	WHERE session_id = ?
+	ORDER BY start_time ASC
+	`
+
+	return caricaPause(db, query, sessionID)
+}
+
+// CaricaPausePeriodo carica le pause delle sessioni in un intervallo di date (estremi inclusi),
+// con lo stesso criterio di sovrapposizione di CaricaSessioniDettagliate
+func CaricaPausePeriodo(db *sql.DB, startDate, endDate string) ([]PauseInterval, error) {
+	query := `
+	SELECT id, session_id, start_time, COALESCE(end_time, '')
+	FROM pause_intervals
+	WHERE session_id IN (
+		SELECT s.id FROM sessions s WHERE ` + sessionOverlapSQL + `
+	)
+	ORDER BY start_time ASC
+	`
+
+	start, end, err := intervalloGiorni(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return caricaPause(db, query, end, start, start)
+}
+
+// caricaPause esegue una query sulle pause
+func caricaPause(db *sql.DB, query string, args ...interface{}) ([]PauseInterval, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore query pause: %v", err)
+	}
+	defer rows.Close()
+
+	var pauses []PauseInterval
+	for rows.Next() {
+		var p PauseInterval
+		var startTime, endTime string
+		if err := rows.Scan(&p.ID, &p.SessionID, &startTime, &endTime); err != nil {
+			return nil, err
+		}
+		if p.StartTime, err = parseTimestamp(startTime); err != nil {
+			return nil, err
+		}
+		if endTime != "" {
+			if p.EndTime, err = parseTimestamp(endTime); err != nil {
+				return nil, err
+			}
+		}
+		pauses = append(pauses, p)
+	}
+
+	return pauses, nil
+}
@@ -0,0 +1,332 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Modalità di applicazione di una regola
+const (
+	RuleModeAuto    = "auto"    // applica automaticamente progetto/tipo attività
+	RuleModeSuggest = "suggest" // propone all'utente senza cambiare nulla
+)
+
+// ruleSwitchDelay è per quanto una regola deve restare valida prima di cambiare la sessione in corso,
+// per evitare di spezzare la sessione a ogni rapido cambio di finestra
+const ruleSwitchDelay = 60 * time.Second
+
+// AssignmentRule associa un contesto (processo, titolo, orario) a un progetto e/o tipo di attività
+type AssignmentRule struct {
+	ID           int
+	Name         string
+	Priority     int // le regole sono valutate in ordine di priorità crescente
+	Enabled      bool
+	ProcessName  string // nome processo o glob (es. "Code.exe", "*.exe"), vuoto = qualsiasi
+	TitlePattern string // regex sul titolo finestra, vuoto = qualsiasi
+	TimeFrom     string // "HH:MM", vuoto = qualsiasi orario
+	TimeTo       string // "HH:MM" (se minore di TimeFrom la fascia attraversa la mezzanotte)
+	ProjectID    *int
+	ActivityType *string
+	Mode         string
+}
+
+// RuleContext è il contesto su cui vengono valutate le regole
+type RuleContext struct {
+	ProcessName string
+	Title       string
+	Time        time.Time
+}
+
+// compiledRule è una regola pronta per la valutazione
+type compiledRule struct {
+	rule     AssignmentRule
+	title    *regexp.Regexp
+	fromMin  int
+	toMin    int
+	hasRange bool
+}
+
+// RuleEngine valuta le regole di assegnazione
+type RuleEngine struct {
+	rules []compiledRule
+
+	// Stato per l'applicazione durante il tracking (vedi Observe)
+	candidateID    int
+	candidateSince time.Time
+}
+
+// parseClock converte "HH:MM" in minuti dalla mezzanotte
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("orario non valido '%s' (formato HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// compileRule valida e prepara una regola
+func compileRule(r AssignmentRule) (compiledRule, error) {
+	c := compiledRule{rule: r}
+
+	if r.ProcessName == "" && r.TitlePattern == "" && r.TimeFrom == "" && r.TimeTo == "" {
+		return c, fmt.Errorf("regola '%s': serve almeno un criterio (processo, titolo o orario)", r.Name)
+	}
+	if r.ProjectID == nil && r.ActivityType == nil {
+		return c, fmt.Errorf("regola '%s': serve un progetto o un tipo di attività", r.Name)
+	}
+	if r.Mode != RuleModeAuto && r.Mode != RuleModeSuggest {
+		return c, fmt.Errorf("regola '%s': modalità non valida '%s'", r.Name, r.Mode)
+	}
+
+	if r.ProcessName != "" {
+		if _, err := path.Match(strings.ToLower(r.ProcessName), ""); err != nil {
+			return c, fmt.Errorf("regola '%s': pattern processo non valido: %v", r.Name, err)
+		}
+	}
+
+	if r.TitlePattern != "" {
+		re, err := regexp.Compile(r.TitlePattern)
+		if err != nil {
+			return c, fmt.Errorf("regola '%s': regex titolo non valida: %v", r.Name, err)
+		}
+		c.title = re
+	}
+
+	if r.TimeFrom != "" || r.TimeTo != "" {
+		if r.TimeFrom == "" || r.TimeTo == "" {
+			return c, fmt.Errorf("regola '%s': indicare sia l'inizio che la fine della fascia oraria", r.Name)
+		}
+		var err error
+		if c.fromMin, err = parseClock(r.TimeFrom); err != nil {
+			return c, err
+		}
+		if c.toMin, err = parseClock(r.TimeTo); err != nil {
+			return c, err
+		}
+		c.hasRange = true
+	}
+
+	return c, nil
+}
+
+// matches verifica se la regola si applica al contesto
+func (c compiledRule) matches(ctx RuleContext) bool {
+	if c.rule.ProcessName != "" {
+		ok, _ := path.Match(strings.ToLower(c.rule.ProcessName), strings.ToLower(ctx.ProcessName))
+		if !ok {
+			return false
+		}
+	}
+
+	if c.title != nil && !c.title.MatchString(ctx.Title) {
+		return false
+	}
+
+	if c.hasRange {
+		// Le fasce orarie sono in ora locale del fuso configurato
+		local := ctx.Time.In(TimeZone())
+		minute := local.Hour()*60 + local.Minute()
+		if c.fromMin <= c.toMin {
+			if minute < c.fromMin || minute >= c.toMin {
+				return false
+			}
+		} else if minute < c.fromMin && minute >= c.toMin {
+			// Fascia a cavallo della mezzanotte (es. 22:00-06:00)
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewRuleEngine compila le regole abilitate (già ordinate per priorità).
+// Le regole non valide (es. una regex importata da un backup) vengono ignorate, così una
+// singola regola errata non blocca il tracking.
+func NewRuleEngine(rules []AssignmentRule) *RuleEngine {
+	e := &RuleEngine{}
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		c, err := compileRule(r)
+		if err != nil {
+			fmt.Printf("[RULES] Regola ignorata: %v\n", err)
+			continue
+		}
+		e.rules = append(e.rules, c)
+	}
+	return e
+}
+
+// Match restituisce la prima regola che si applica al contesto, o nil
+func (e *RuleEngine) Match(ctx RuleContext) *AssignmentRule {
+	for _, c := range e.rules {
+		if c.matches(ctx) {
+			rule := c.rule
+			return &rule
+		}
+	}
+	return nil
+}
+
+// Observe valuta le regole su un tick del watcher e restituisce la regola da applicare
+// solo quando la stessa regola è rimasta valida per almeno ruleSwitchDelay.
+// Le regole in modalità suggest vengono restituite subito.
+func (e *RuleEngine) Observe(ctx RuleContext) *AssignmentRule {
+	rule := e.Match(ctx)
+	if rule == nil {
+		e.candidateID = 0
+		return nil
+	}
+
+	if rule.Mode == RuleModeSuggest {
+		e.candidateID = 0
+		return rule
+	}
+
+	if rule.ID != e.candidateID {
+		e.candidateID = rule.ID
+		e.candidateSince = ctx.Time
+	}
+	if ctx.Time.Sub(e.candidateSince) < ruleSwitchDelay {
+		return nil
+	}
+
+	return rule
+}
+
+// === PERSISTENZA REGOLE ===
+
+// CaricaRegole carica tutte le regole ordinate per priorità
+func CaricaRegole(db *sql.DB) ([]AssignmentRule, error) {
+	query := `
+	SELECT id, name, priority, enabled, process_name, title_pattern, time_from, time_to, project_id,
+		(SELECT at.name FROM activity_types at WHERE at.id = activity_type_id), mode
+	FROM assignment_rules
+	ORDER BY priority ASC, id ASC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("errore query regole: %v", err)
+	}
+	defer rows.Close()
+
+	var rules []AssignmentRule
+	for rows.Next() {
+		var r AssignmentRule
+		var enabled int
+		if err := rows.Scan(&r.ID, &r.Name, &r.Priority, &enabled, &r.ProcessName, &r.TitlePattern, &r.TimeFrom, &r.TimeTo, &r.ProjectID, &r.ActivityType, &r.Mode); err != nil {
+			return nil, err
+		}
+		r.Enabled = enabled == 1
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("errore lettura regole: %v", err)
+	}
+
+	return rules, nil
+}
+
+// CreaRegola valida una nuova regola (criteri, regex del titolo, fascia oraria e modalità),
+// la salva e ne restituisce l'ID
+func CreaRegola(db *sql.DB, r AssignmentRule) (int64, error) {
+	if _, err := compileRule(r); err != nil {
+		return 0, err
+	}
+	activityTypeID, err := idTipoAttivita(db, r.ActivityType)
+	if err != nil {
+		return 0, fmt.Errorf("errore creazione regola: %v", err)
+	}
+
+	insertSQL := `
+	INSERT INTO assignment_rules (name, priority, enabled, process_name, title_pattern, time_from, time_to, project_id, activity_type_id, mode, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.Exec(insertSQL, r.Name, r.Priority, boolToInt(r.Enabled), r.ProcessName, r.TitlePattern, r.TimeFrom, r.TimeTo, r.ProjectID, activityTypeID, r.Mode, FormatTimestamp(now()))
+	if err != nil {
+		return 0, fmt.Errorf("errore creazione regola: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("errore recupero ID: %v", err)
+	}
+
+	fmt.Printf("[DB] Regola creata: %s (ID %d)\n", r.Name, id)
+	return id, nil
+}
+
+// AggiornaRegola valida e aggiorna una regola esistente
+func AggiornaRegola(db *sql.DB, r AssignmentRule) error {
+	if _, err := compileRule(r); err != nil {
+		return err
+	}
+	activityTypeID, err := idTipoAttivita(db, r.ActivityType)
+	if err != nil {
+		return fmt.Errorf("errore aggiornamento regola: %v", err)
+	}
+
+	updateSQL := `
+	UPDATE assignment_rules
+	SET name = ?, priority = ?, enabled = ?, process_name = ?, title_pattern = ?, time_from = ?, time_to = ?, project_id = ?, activity_type_id = ?, mode = ?
+	WHERE id = ?
+	`
+	result, err := db.Exec(updateSQL, r.Name, r.Priority, boolToInt(r.Enabled), r.ProcessName, r.TitlePattern, r.TimeFrom, r.TimeTo, r.ProjectID, activityTypeID, r.Mode, r.ID)
+	if err != nil {
+		return fmt.Errorf("errore aggiornamento regola: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("errore verifica aggiornamento: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("regola con ID %d non trovata", r.ID)
+	}
+
+	fmt.Printf("[DB] Regola ID %d aggiornata\n", r.ID)
+	return nil
+}
+
+// EliminaRegola elimina una regola
+func EliminaRegola(db *sql.DB, id int) error {
+	result, err := db.Exec(`DELETE FROM assignment_rules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("errore eliminazione regola: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("errore verifica eliminazione: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("regola con ID %d non trovata", id)
+	}
+
+	fmt.Printf("[DB] Regola ID %d eliminata\n", id)
+	return nil
+}
+
+// ValutaRegole esegue le regole salvate su un contesto senza applicarle (dry-run)
+func ValutaRegole(db *sql.DB, ctx RuleContext) (*AssignmentRule, error) {
+	rules, err := CaricaRegole(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRuleEngine(rules).Match(ctx), nil
+}
+
+// boolToInt converte un booleano nel formato 0/1 usato da SQLite
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreaRegolaCreatedAtUTC(t *testing.T) {
+	db := apriDBTest(t)
+	SetClock(NewManualClock(testStart))
+	t.Cleanup(func() { SetClock(nil) })
+
+	ricerca := "RICERCA"
+	id, err := CreaRegola(db, AssignmentRule{Name: "Editor", Enabled: true, ProcessName: "Code.exe", ActivityType: &ricerca, Mode: RuleModeAuto})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stesso formato dei valori convertiti dalla migrazione in UTC, non quello di CURRENT_TIMESTAMP
+	var createdAt string
+	if err := db.QueryRow(`SELECT CAST(created_at AS TEXT) FROM assignment_rules WHERE id = ?`, id).Scan(&createdAt); err != nil {
+		t.Fatal(err)
+	}
+	if want := FormatTimestamp(testStart); createdAt != want {
+		t.Errorf("created_at = %s, atteso %s", createdAt, want)
+	}
+}
+
+// regola costruisce una regola automatica abilitata verso il progetto 1
+func regola(id int, name string) AssignmentRule {
+	projectID := 1
+	return AssignmentRule{ID: id, Name: name, Enabled: true, ProjectID: &projectID, Mode: RuleModeAuto}
+}
+
+func TestCompileRule(t *testing.T) {
+	base := regola(1, "Editor")
+	base.ProcessName = "Code.exe"
+
+	tests := []struct {
+		name    string
+		edit    func(r *AssignmentRule)
+		wantErr bool
+	}{
+		{"valida", func(r *AssignmentRule) {}, false},
+		{"senza criteri", func(r *AssignmentRule) { r.ProcessName = "" }, true},
+		{"senza progetto né tipo", func(r *AssignmentRule) { r.ProjectID = nil }, true},
+		{"modalità non valida", func(r *AssignmentRule) { r.Mode = "sempre" }, true},
+		{"glob non valido", func(r *AssignmentRule) { r.ProcessName = "[code" }, true},
+		{"regex non valida", func(r *AssignmentRule) { r.TitlePattern = "(progetto" }, true},
+		{"fascia senza fine", func(r *AssignmentRule) { r.TimeFrom = "09:00" }, true},
+		{"orario non valido", func(r *AssignmentRule) { r.TimeFrom, r.TimeTo = "9", "18:00" }, true},
+		{"fascia valida", func(r *AssignmentRule) { r.TimeFrom, r.TimeTo = "22:00", "06:00" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := base
+			tt.edit(&r)
+			_, err := compileRule(r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("errore = %v, atteso errore: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleEngineMatch(t *testing.T) {
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTimeZone("") })
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 2, hour, minute, 0, 0, TimeZone())
+	}
+
+	processo := regola(1, "processo")
+	processo.ProcessName = "CODE.EXE"
+	titolo := regola(2, "titolo")
+	titolo.TitlePattern = `(?i)cliente rossi`
+	notte := regola(3, "notte")
+	notte.TimeFrom, notte.TimeTo = "22:00", "06:00"
+	ufficio := regola(4, "ufficio")
+	ufficio.ProcessName, ufficio.TimeFrom, ufficio.TimeTo = "*.exe", "09:00", "18:00"
+	disabilitata := regola(5, "disabilitata")
+	disabilitata.ProcessName, disabilitata.Enabled = "*", false
+	nonValida := regola(6, "non valida")
+	nonValida.TitlePattern = "(rossi"
+
+	engine := NewRuleEngine([]AssignmentRule{disabilitata, nonValida, processo, titolo, notte, ufficio})
+	if len(engine.rules) != 4 {
+		t.Fatalf("regole compilate = %d, attese 4: disabilitate e non valide vanno ignorate", len(engine.rules))
+	}
+
+	tests := []struct {
+		name string
+		ctx  RuleContext
+		want string
+	}{
+		{"processo senza maiuscole", RuleContext{ProcessName: "code.exe", Time: at(12, 0)}, "processo"},
+		{"prima regola per priorità", RuleContext{ProcessName: "Code.exe", Title: "Cliente Rossi", Time: at(23, 0)}, "processo"},
+		{"regex titolo", RuleContext{ProcessName: "chrome", Title: "Offerta CLIENTE ROSSI", Time: at(12, 0)}, "titolo"},
+		{"notte prima di mezzanotte", RuleContext{ProcessName: "chrome", Time: at(23, 30)}, "notte"},
+		{"notte dopo mezzanotte", RuleContext{ProcessName: "chrome", Time: at(5, 59)}, "notte"},
+		{"fine fascia notturna esclusa", RuleContext{ProcessName: "chrome", Time: at(6, 0)}, ""},
+		{"glob e fascia diurna", RuleContext{ProcessName: "Excel.exe", Time: at(9, 0)}, "ufficio"},
+		{"fine fascia diurna esclusa", RuleContext{ProcessName: "Excel.exe", Time: at(18, 0)}, ""},
+		{"orario in UTC convertito", RuleContext{ProcessName: "chrome", Time: time.Date(2026, 3, 2, 21, 30, 0, 0, time.UTC)}, "notte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if rule := engine.Match(tt.ctx); rule != nil {
+				got = rule.Name
+			}
+			if got != tt.want {
+				t.Errorf("regola = %q, attesa %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleEngineObserve(t *testing.T) {
+	auto := regola(1, "auto")
+	auto.ProcessName = "Code.exe"
+	altra := regola(2, "altra")
+	altra.ProcessName = "Excel.exe"
+	suggerita := regola(3, "suggerita")
+	suggerita.ProcessName, suggerita.Mode = "chrome", RuleModeSuggest
+	engine := NewRuleEngine([]AssignmentRule{auto, altra, suggerita})
+
+	steps := []struct {
+		offset  time.Duration
+		process string
+		want    string
+	}{
+		{0, "Code.exe", ""},
+		{59 * time.Second, "Code.exe", ""},
+		{60 * time.Second, "Code.exe", "auto"},
+		{65 * time.Second, "Code.exe", "auto"},
+		// Un cambio di regola riparte da capo
+		{70 * time.Second, "Excel.exe", ""},
+		{100 * time.Second, "Code.exe", ""},
+		{159 * time.Second, "Code.exe", ""},
+		{160 * time.Second, "Code.exe", "auto"},
+		// Le regole suggest sono restituite subito e azzerano l'attesa
+		{165 * time.Second, "chrome", "suggerita"},
+		{170 * time.Second, "Code.exe", ""},
+		// Anche un contesto senza regole azzera l'attesa
+		{200 * time.Second, "notepad.exe", ""},
+		{230 * time.Second, "Code.exe", ""},
+		{289 * time.Second, "Code.exe", ""},
+		{290 * time.Second, "Code.exe", "auto"},
+	}
+	for _, step := range steps {
+		got := ""
+		if rule := engine.Observe(RuleContext{ProcessName: step.process, Time: testStart.Add(step.offset)}); rule != nil {
+			got = rule.Name
+		}
+		if got != step.want {
+			t.Errorf("%v %s: regola = %q, attesa %q", step.offset, step.process, got, step.want)
+		}
+	}
+}
+
+func TestValutaRegolePriorita(t *testing.T) {
+	db := apriDBTest(t)
+	projectID, err := CreaProgetto(db, "Cliente", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int(projectID)
+
+	for _, r := range []AssignmentRule{
+		{Name: "generica", Priority: 20, Enabled: true, ProcessName: "*", ProjectID: &id, Mode: RuleModeAuto},
+		{Name: "specifica", Priority: 10, Enabled: true, ProcessName: "Code.exe", ProjectID: &id, Mode: RuleModeSuggest},
+	} {
+		if _, err := CreaRegola(db, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Regola non valida arrivata senza passare da CreaRegola (es. importazione)
+	if _, err := db.Exec(`INSERT INTO assignment_rules (name, priority, enabled, title_pattern, project_id, mode) VALUES ('rotta', 1, 1, '(x', ?, 'auto')`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		process string
+		want    string
+	}{
+		{"Code.exe", "specifica"},
+		{"Excel.exe", "generica"},
+	}
+	for _, tt := range tests {
+		rule, err := ValutaRegole(db, RuleContext{ProcessName: tt.process, Time: testStart})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.process, err)
+		}
+		if rule == nil || rule.Name != tt.want {
+			t.Errorf("%s: regola = %+v, attesa %q", tt.process, rule, tt.want)
+		}
+	}
+}
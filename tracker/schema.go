@@ -0,0 +1,231 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupSchema genera il JSON Schema del formato di backup corrente dalle struct Backup.
+// I campi senza omitempty sono obbligatori, i puntatori ammettono null; i tag desc, format ed
+// enum aggiungono descrizione, formato e valori ammessi.
+func BackupSchema() map[string]interface{} {
+	schema := schemaTipo(reflect.TypeOf(Backup{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Backup PrendiTempo " + BackupVersion
+	schema["description"] = "Backup completo o report di progetto esportato da PrendiTempo"
+	return schema
+}
+
+// BackupSchemaJSON restituisce BackupSchema come documento JSON indentato
+func BackupSchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(BackupSchema(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("errore generazione schema backup: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaTipo genera lo schema di un tipo Go
+func schemaTipo(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaTipo(t.Elem())
+		schema["type"] = []interface{}{schema["type"], "null"}
+		return schema
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, omitempty := campoJSON(field)
+			if name == "" {
+				continue
+			}
+			schema := schemaTipo(field.Type)
+			if desc := field.Tag.Get("desc"); desc != "" {
+				schema["description"] = desc
+			}
+			if format := field.Tag.Get("format"); format != "" {
+				schema["format"] = format
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				var values []interface{}
+				for _, v := range strings.Split(enum, ",") {
+					values = append(values, v)
+				}
+				schema["enum"] = values
+			}
+			properties[name] = schema
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaTipo(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaTipo(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	panic(fmt.Sprintf("tipo non supportato nello schema backup: %s", t))
+}
+
+// campoJSON restituisce il nome JSON di un campo e se ha omitempty ("" se escluso)
+func campoJSON(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+// validaSchema valida un valore JSON decodificato (map, slice, string, float64, bool, nil)
+// con il sottoinsieme di JSON Schema prodotto da schemaTipo. Restituisce un errore per ogni
+// violazione, con il percorso del valore.
+func validaSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	if !tipoAmmesso(schema["type"], value) {
+		return []string{fmt.Sprintf("%s: atteso %s, trovato %s", path, descriviTipo(schema["type"]), tipoJSON(value))}
+	}
+
+	var errs []string
+	if enum, ok := schema["enum"].([]interface{}); ok && value != nil {
+		found := false
+		for _, v := range enum {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: valore %v non ammesso", path, value))
+		}
+	}
+	if schema["format"] == "date-time" {
+		if s, ok := value.(string); ok {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: data e ora non valida '%s'", path, s))
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: campo obbligatorio '%s' mancante", path, name))
+				}
+			}
+		}
+
+		// Ordine stabile dei messaggi
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := properties[key].(map[string]interface{}); ok {
+				errs = append(errs, validaSchema(prop, v[key], path+"."+key)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: campo sconosciuto '%s'", path, key))
+				}
+			case map[string]interface{}:
+				errs = append(errs, validaSchema(extra, v[key], path+"."+key)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				errs = append(errs, validaSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+// tipoAmmesso indica se il valore rispetta il tipo (o uno dei tipi) dello schema
+func tipoAmmesso(schemaType interface{}, value interface{}) bool {
+	switch t := schemaType.(type) {
+	case string:
+		actual := tipoJSON(value)
+		return actual == t || (t == "number" && actual == "integer")
+	case []interface{}:
+		for _, option := range t {
+			if tipoAmmesso(option, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// tipoJSON restituisce il nome JSON Schema del tipo di un valore decodificato
+func tipoJSON(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// descriviTipo descrive il tipo (o i tipi) ammessi da uno schema
+func descriviTipo(schemaType interface{}) string {
+	if types, ok := schemaType.([]interface{}); ok {
+		var names []string
+		for _, t := range types {
+			names = append(names, descriviTipo(t))
+		}
+		return strings.Join(names, " o ")
+	}
+	return fmt.Sprint(schemaType)
+}
@@ -0,0 +1,218 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Tipi di tratto di una sessione
+const (
+	SegmentActive    = "active"    // tempo attivo conteggiato nella sessione
+	SegmentIdle      = "idle"      // inattività esclusa dal conteggio
+	SegmentPaused    = "paused"    // pausa
+	SegmentSuspended = "suspended" // computer sospeso
+)
+
+// SessionSegment è un tratto di una sessione di tracking con i suoi istanti reali
+type SessionSegment struct {
+	ID        int
+	SessionID int
+	Type      string
+	StartTime time.Time
+	EndTime   time.Time // zero se il tratto è ancora aperto
+}
+
+// Seconds restituisce la durata del tratto (0 se è ancora aperto)
+func (s SessionSegment) Seconds() int {
+	if s.EndTime.IsZero() {
+		return 0
+	}
+	return int(wallSub(s.EndTime, s.StartTime).Round(time.Second) / time.Second)
+}
+
+// dbExecutor è implementato sia da *sql.DB che da *sql.Tx
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// sessionLayout compone i tratti ordinati di una sessione: gli intervalli attivi contigui
+// diventano un unico tratto attivo, a cui si aggiungono i tratti esclusi. Idle e sospensioni
+// dopo l'ultimo tratto attivo non fanno parte della sessione (es. l'idle che l'ha fermata).
+func sessionLayout(intervals []ActiveInterval, excluded []SessionSegment) []SessionSegment {
+	var segments []SessionSegment
+	for _, interval := range intervals {
+		if n := len(segments); n > 0 && segments[n-1].EndTime.Equal(interval.StartTime) {
+			segments[n-1].EndTime = interval.EndTime
+			continue
+		}
+		segments = append(segments, SessionSegment{Type: SegmentActive, StartTime: interval.StartTime, EndTime: interval.EndTime})
+	}
+
+	var lastActiveEnd time.Time
+	if n := len(segments); n > 0 {
+		lastActiveEnd = segments[n-1].EndTime
+	}
+	for _, segment := range excluded {
+		if segment.Type != SegmentPaused && !segment.StartTime.Before(lastActiveEnd) {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].StartTime.Before(segments[j].StartTime)
+	})
+	return segments
+}
+
+// SalvaSegmentiSessione salva i tratti di una sessione. I tratti sostituiscono quelli già
+// salvati, perché il watcher fornisce sempre la composizione completa della sessione.
+func SalvaSegmentiSessione(db *sql.DB, sessionID int64, segments []SessionSegment) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio salvataggio tratti sessione: %v", err)
+	}
+
+	if err := salvaSegmenti(tx, sessionID, segments); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit tratti sessione: %v", err)
+	}
+	return nil
+}
+
+// salvaSegmenti sostituisce i tratti salvati di una sessione
+func salvaSegmenti(exec dbExecutor, sessionID int64, segments []SessionSegment) error {
+	if _, err := exec.Exec(`DELETE FROM session_segments WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("errore pulizia tratti sessione: %v", err)
+	}
+
+	insertSQL := `INSERT INTO session_segments (session_id, segment_type, start_time, end_time) VALUES (?, ?, ?, ?)`
+	for _, segment := range segments {
+		var endTime interface{}
+		if !segment.EndTime.IsZero() {
+			endTime = FormatTimestamp(segment.EndTime)
+		}
+		if _, err := exec.Exec(insertSQL, sessionID, segment.Type, FormatTimestamp(segment.StartTime), endTime); err != nil {
+			return fmt.Errorf("errore salvataggio tratto sessione: %v", err)
+		}
+	}
+	return nil
+}
+
+// segmentiSessioneSQL seleziona i tratti di una sessione in ordine cronologico
+const segmentiSessioneSQL = `
+	SELECT id, session_id, segment_type, start_time, COALESCE(end_time, '')
+	FROM session_segments
+	WHERE session_id = ?
+	ORDER BY start_time ASC, id ASC
+	`
+
+// CaricaSegmentiSessione carica i tratti di una sessione in ordine cronologico
+func CaricaSegmentiSessione(db *sql.DB, sessionID int) ([]SessionSegment, error) {
+	return caricaSegmenti(db, segmentiSessioneSQL, sessionID)
+}
+
+// CaricaSegmentiPeriodo carica i tratti delle sessioni in un intervallo di date (estremi inclusi),
+// con lo stesso criterio di sovrapposizione di CaricaSessioniDettagliate
+func CaricaSegmentiPeriodo(db *sql.DB, startDate, endDate string) ([]SessionSegment, error) {
+	query := `
+	SELECT id, session_id, segment_type, start_time, COALESCE(end_time, '')
+	FROM session_segments
+	WHERE session_id IN (
+		SELECT s.id FROM sessions s WHERE ` + sessionOverlapSQL + `
+	)
+	ORDER BY session_id ASC, start_time ASC, id ASC
+	`
+
+	start, end, err := intervalloGiorni(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return caricaSegmenti(db, query, end, start, start)
+}
+
+// caricaSegmenti esegue una query sui tratti di sessione
+func caricaSegmenti(exec dbExecutor, query string, args ...interface{}) ([]SessionSegment, error) {
+	rows, err := exec.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore query tratti sessione: %v", err)
+	}
+	defer rows.Close()
+
+	var segments []SessionSegment
+	for rows.Next() {
+		var s SessionSegment
+		var startTime, endTime string
+		if err := rows.Scan(&s.ID, &s.SessionID, &s.Type, &startTime, &endTime); err != nil {
+			return nil, err
+		}
+		if s.StartTime, err = parseTimestamp(startTime); err != nil {
+			return nil, err
+		}
+		if endTime != "" {
+			if s.EndTime, err = parseTimestamp(endTime); err != nil {
+				return nil, err
+			}
+		}
+		segments = append(segments, s)
+	}
+
+	return segments, rows.Err()
+}
+
+// dividiSegmenti sposta sulla nuova sessione i tratti successivi ai primi secondiPrimaParte
+// secondi attivi, dividendo il tratto attivo a cavallo. Restituisce l'istante della divisione,
+// o zero se la sessione non ha tratti.
+func dividiSegmenti(exec dbExecutor, sessionID, newSessionID int64, secondiPrimaParte int) (time.Time, error) {
+	segments, err := caricaSegmenti(exec, segmentiSessioneSQL, sessionID)
+	if err != nil || len(segments) == 0 {
+		return time.Time{}, err
+	}
+
+	// Trova l'istante in cui si raggiungono i secondi attivi della prima parte
+	var first, second []SessionSegment
+	var splitAt time.Time
+	remaining := secondiPrimaParte
+	for _, segment := range segments {
+		switch {
+		case !splitAt.IsZero():
+			second = append(second, segment)
+		case segment.Type == SegmentActive && segment.Seconds() >= remaining:
+			splitAt = segment.StartTime.Add(time.Duration(remaining) * time.Second)
+			if remaining > 0 {
+				head := segment
+				head.EndTime = splitAt
+				first = append(first, head)
+			}
+			if splitAt.Before(segment.EndTime) {
+				tail := segment
+				tail.StartTime = splitAt
+				second = append(second, tail)
+			}
+		default:
+			if segment.Type == SegmentActive {
+				remaining -= segment.Seconds()
+			}
+			first = append(first, segment)
+		}
+	}
+	if splitAt.IsZero() {
+		// Tratti non coerenti con la durata: non si possono dividere
+		return time.Time{}, nil
+	}
+
+	if err := salvaSegmenti(exec, sessionID, first); err != nil {
+		return time.Time{}, err
+	}
+	if err := salvaSegmenti(exec, newSessionID, second); err != nil {
+		return time.Time{}, err
+	}
+	return splitAt, nil
+}
@@ -0,0 +1,99 @@
+package tracker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSegmentiSessioneRoundTrip(t *testing.T) {
+	t.Cleanup(func() { SetTimeZone("") })
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	db := apriDBTest(t)
+	rome := TimeZone()
+
+	// Sessioni: una a cavallo della mezzanotte, una nel giorno richiesto, una il giorno dopo
+	day := func(d, h, m int) time.Time { return time.Date(2026, 3, d, h, m, 0, 0, rome) }
+	sessions := []struct {
+		start, end time.Time
+		segments   []SessionSegment
+	}{
+		{day(1, 23, 30), day(2, 0, 30), []SessionSegment{
+			{Type: SegmentActive, StartTime: day(1, 23, 30), EndTime: day(2, 0, 10)},
+			{Type: SegmentIdle, StartTime: day(2, 0, 10), EndTime: day(2, 0, 20)},
+			{Type: SegmentActive, StartTime: day(2, 0, 20), EndTime: day(2, 0, 30)},
+		}},
+		{day(2, 9, 0), day(2, 10, 0), []SessionSegment{
+			{Type: SegmentActive, StartTime: day(2, 9, 0), EndTime: day(2, 9, 20)},
+			{Type: SegmentPaused, StartTime: day(2, 9, 20), EndTime: day(2, 9, 30)},
+			{Type: SegmentSuspended, StartTime: day(2, 9, 30), EndTime: day(2, 9, 40)},
+			{Type: SegmentActive, StartTime: day(2, 9, 40)}, // ancora aperto
+		}},
+		{day(3, 9, 0), day(3, 10, 0), []SessionSegment{
+			{Type: SegmentActive, StartTime: day(3, 9, 0), EndTime: day(3, 10, 0)},
+		}},
+	}
+
+	var want []SessionSegment
+	for i, s := range sessions {
+		result, err := db.Exec(`INSERT INTO sessions (app_name, seconds, timestamp, ended_at) VALUES ('Code.exe', ?, ?, ?)`,
+			int(s.end.Sub(s.start).Seconds()), FormatTimestamp(s.start), FormatTimestamp(s.end))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessionID, _ := result.LastInsertId()
+
+		// Un secondo salvataggio sostituisce i tratti del primo
+		if err := SalvaSegmentiSessione(db, sessionID, s.segments[:1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := SalvaSegmentiSessione(db, sessionID, s.segments); err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 {
+			continue
+		}
+		for _, segment := range s.segments {
+			segment.SessionID = int(sessionID)
+			want = append(want, segment)
+		}
+	}
+
+	got, err := CaricaSegmentiPeriodo(db, "2026-03-02", "2026-03-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tratti caricati = %d, attesi %d: %+v", len(got), len(want), got)
+	}
+	for i := range got {
+		if got[i].ID == 0 {
+			t.Errorf("tratto %d senza ID", i)
+		}
+		got[i].ID = 0
+		if got[i].SessionID != want[i].SessionID || got[i].Type != want[i].Type ||
+			!got[i].StartTime.Equal(want[i].StartTime) || !got[i].EndTime.Equal(want[i].EndTime) || got[i].EndTime.IsZero() != want[i].EndTime.IsZero() {
+			t.Errorf("tratto %d = %+v, atteso %+v", i, got[i], want[i])
+		}
+	}
+
+	// I tratti di una sessione si rileggono uguali anche singolarmente
+	single, err := CaricaSegmentiSessione(db, want[0].SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range single {
+		single[i].ID = 0
+	}
+	if !reflect.DeepEqual(single, got[:3]) {
+		t.Errorf("tratti della sessione = %+v, attesi %+v", single, got[:3])
+	}
+	if seconds := got[0].Seconds() + got[2].Seconds(); seconds != 3000 {
+		t.Errorf("secondi attivi della prima sessione = %d, attesi 3000", seconds)
+	}
+	if open := got[len(got)-1]; !open.EndTime.IsZero() || open.Seconds() != 0 {
+		t.Errorf("tratto aperto = %+v, atteso senza fine", open)
+	}
+}
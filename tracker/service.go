@@ -0,0 +1,1055 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TrackingStatus è lo stato della macchina a stati del tracking
+type TrackingStatus string
+
+const (
+	StatusIdle        TrackingStatus = "idle"         // nessun tracking in corso
+	StatusTracking    TrackingStatus = "tracking"     // tracking in corso
+	StatusPaused      TrackingStatus = "paused"       // tracking in pausa, la sessione resta aperta
+	StatusAutoStopped TrackingStatus = "auto-stopped" // fermato per inattività, periodo idle da attribuire
+)
+
+// Tipi di evento emessi dal TrackingService
+const (
+	EventStateChanged   = "state-changed"         // lo stato è cambiato (vedi TrackingEvent.State)
+	EventAutoStopped    = "tracking-auto-stopped" // sessione chiusa automaticamente per inattività
+	EventSwitched       = "tracking-switched"     // aperta una nuova sessione senza fermare il timer (Switch o regola)
+	EventRuleSuggestion = "rule-suggestion"       // una regola suggest propone progetto/tipo attività
+	EventIdleReturn     = "idle-return"           // l'utente è tornato dopo un periodo idle
+	EventSuspended      = "tracking-suspended"    // rilevata una sospensione del computer da attribuire
+)
+
+// idleThresholdSettingKey è la chiave in settings della soglia di inattività (minuti)
+const idleThresholdSettingKey = "idle_threshold"
+
+// suspendHandlingSettingKey è la chiave in settings della gestione delle sospensioni
+const suspendHandlingSettingKey = "suspend_handling"
+
+// Gestione delle sospensioni del computer rilevate durante il tracking
+const (
+	SuspendAsk     = "ask"     // proponi l'attribuzione come per i periodi idle
+	SuspendDiscard = "discard" // scarta automaticamente
+)
+
+// TrackingSnapshot è una fotografia dello stato del tracking
+type TrackingSnapshot struct {
+	Status           TrackingStatus
+	Project          *Project
+	ActivityType     *string
+	SessionID        int64
+	StartTime        time.Time // inizio della sessione pendente corrente
+	PausedAt         time.Time // inizio della pausa in corso (zero se non in pausa)
+	ElapsedSeconds   int
+	PendingIdle      *IdlePeriod
+	PendingSuspended *IdlePeriod
+}
+
+// TrackingEvent è un evento emesso dal TrackingService
+type TrackingEvent struct {
+	Type        string
+	State       TrackingSnapshot
+	Seconds     int             // secondi della sessione chiusa (EventAutoStopped)
+	Rule        *AssignmentRule // regola applicata o suggerita (EventSwitched da regola, EventRuleSuggestion)
+	IdleMinutes int             // minuti di inattività (EventIdleReturn)
+	Period      *IdlePeriod     // periodo sospeso (EventSuspended)
+}
+
+// TrackingEventHandler riceve gli eventi del TrackingService.
+// Viene chiamato senza lock, può quindi interrogare il servizio.
+type TrackingEventHandler func(event TrackingEvent)
+
+// WatcherFactory crea il watcher per una nuova sessione di tracking
+type WatcherFactory func() *TimeWatcher
+
+// TrackingService possiede lo stato del tracking e la sua macchina a stati
+// (idle → tracking ⇄ paused, tracking → auto-stopped → idle).
+// Non dipende da Wails: database, orologio e sorgenti del watcher sono iniettabili.
+type TrackingService struct {
+	db         *sql.DB
+	clock      Clock
+	newWatcher WatcherFactory
+	onEvent    TrackingEventHandler
+
+	mu              sync.Mutex
+	status          TrackingStatus
+	project         *Project
+	activityType    *string
+	watcher         *TimeWatcher
+	sessionID       int64
+	sessionStart    time.Time
+	pausedAt        time.Time    // inizio della pausa in corso
+	pendingPeriods  []IdlePeriod // copia di pending_idle_periods (più quelli non salvati), dal più vecchio
+	idleThreshold   int          // soglia inattività in minuti
+	suspendHandling string       // SuspendAsk o SuspendDiscard
+}
+
+// NewTrackingService crea il servizio e carica la soglia di inattività dal database
+func NewTrackingService(db *sql.DB, clock Clock) *TrackingService {
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	s := &TrackingService{
+		db:              db,
+		clock:           clock,
+		newWatcher:      NewTimeWatcher,
+		status:          StatusIdle,
+		idleThreshold:   5, // default: 5 minuti
+		suspendHandling: SuspendAsk,
+	}
+
+	if db != nil {
+		if value, err := GetSetting(db, idleThresholdSettingKey); err == nil && value != "" {
+			if threshold, err := strconv.Atoi(value); err == nil && threshold > 0 {
+				s.idleThreshold = threshold
+			}
+		}
+		if value, err := GetSetting(db, suspendHandlingSettingKey); err == nil && (value == SuspendAsk || value == SuspendDiscard) {
+			s.suspendHandling = value
+		}
+		// Periodi rimasti da attribuire in esecuzioni precedenti
+		if err := s.loadPendingPeriods(); err != nil {
+			fmt.Printf("[IDLE] Errore caricamento periodi pendenti: %v\n", err)
+		}
+	}
+
+	return s
+}
+
+// SetWatcherFactory imposta come creare i watcher (es. con sorgenti finte)
+func (s *TrackingService) SetWatcherFactory(factory WatcherFactory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if factory == nil {
+		factory = NewTimeWatcher
+	}
+	s.newWatcher = factory
+}
+
+// SetEventHandler imposta chi riceve gli eventi del servizio
+func (s *TrackingService) SetEventHandler(handler TrackingEventHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEvent = handler
+}
+
+// emit invia gli eventi all'handler (da chiamare senza lock)
+func (s *TrackingService) emit(events ...TrackingEvent) {
+	s.mu.Lock()
+	handler := s.onEvent
+	s.mu.Unlock()
+
+	if handler == nil {
+		return
+	}
+	for _, event := range events {
+		handler(event)
+	}
+}
+
+// stateChanged costruisce l'evento di cambio stato (lock tenuto)
+func (s *TrackingService) stateChanged() TrackingEvent {
+	return TrackingEvent{Type: EventStateChanged, State: s.snapshot()}
+}
+
+// State restituisce lo stato corrente
+func (s *TrackingService) State() TrackingSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// snapshot fotografa lo stato corrente (lock tenuto)
+func (s *TrackingService) snapshot() TrackingSnapshot {
+	state := TrackingSnapshot{
+		Status:           s.status,
+		Project:          s.project,
+		ActivityType:     s.activityType,
+		SessionID:        s.sessionID,
+		StartTime:        s.sessionStart,
+		PausedAt:         s.pausedAt,
+		PendingIdle:      s.firstPending(PeriodIdle),
+		PendingSuspended: s.firstPending(PeriodSuspended),
+	}
+	if s.watcher != nil && s.isActive() {
+		state.ElapsedSeconds = s.watcher.GetTotalActiveSeconds()
+	}
+	return state
+}
+
+// firstPending restituisce una copia del periodo più vecchio del tipo indicato in attesa
+// di attribuzione, o nil (lock tenuto)
+func (s *TrackingService) firstPending(periodType string) *IdlePeriod {
+	for _, period := range s.pendingPeriods {
+		if period.Type == periodType {
+			p := period
+			return &p
+		}
+	}
+	return nil
+}
+
+// loadPendingPeriods rilegge la coda dei periodi da attribuire dalla tabella
+// pending_idle_periods, che è la fonte di verità: ogni modifica alla tabella passa di qui.
+// Restano in coda anche i periodi che non è stato possibile salvare (ID 0). Lock tenuto.
+func (s *TrackingService) loadPendingPeriods() error {
+	if s.db == nil {
+		return nil
+	}
+
+	periods, err := CaricaPeriodiPendenti(s.db)
+	if err != nil {
+		return err
+	}
+	for _, p := range s.pendingPeriods {
+		if p.ID == 0 {
+			periods = append(periods, p)
+		}
+	}
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].StartTime.Before(periods[j].StartTime)
+	})
+	s.pendingPeriods = periods
+	return nil
+}
+
+// ReloadPendingPeriods rilegge dal database i periodi in attesa di attribuzione dopo una
+// modifica esterna al servizio (es. importazione di un backup) e notifica il nuovo stato
+func (s *TrackingService) ReloadPendingPeriods() error {
+	s.mu.Lock()
+	if err := s.loadPendingPeriods(); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("errore caricamento periodi pendenti: %v", err)
+	}
+	event := s.stateChanged()
+	s.mu.Unlock()
+
+	s.emit(event)
+	return nil
+}
+
+// queuePeriod accoda un periodo da attribuire e lo salva nel database, così sopravvive
+// a chiusure e crash dell'app (lock tenuto)
+func (s *TrackingService) queuePeriod(period IdlePeriod) {
+	if s.db != nil {
+		id, err := SalvaPeriodoPendente(s.db, period)
+		if err != nil {
+			fmt.Printf("[IDLE] Errore salvataggio periodo pendente: %v\n", err)
+		}
+		period.ID = id
+	}
+	s.pendingPeriods = append(s.pendingPeriods, period)
+	if err := s.loadPendingPeriods(); err != nil {
+		fmt.Printf("[IDLE] Errore caricamento periodi pendenti: %v\n", err)
+	}
+}
+
+// takeWatcherPeriods sposta nella coda i periodi pendenti rilevati dal watcher (lock tenuto)
+func (s *TrackingService) takeWatcherPeriods(w *TimeWatcher) {
+	if idle := w.GetPendingIdlePeriod(); idle != nil {
+		s.queuePeriod(*idle)
+		w.ClearPendingIdlePeriod()
+	}
+	if suspended := w.GetPendingSuspendedPeriod(); suspended != nil {
+		s.queuePeriod(*suspended)
+		w.ClearPendingSuspendedPeriod()
+	}
+}
+
+// PendingPeriods restituisce tutti i periodi idle e sospesi in attesa di attribuzione
+func (s *TrackingService) PendingPeriods() []IdlePeriod {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]IdlePeriod, len(s.pendingPeriods))
+	copy(result, s.pendingPeriods)
+	return result
+}
+
+// isActive indica se c'è una sessione aperta (lock tenuto)
+func (s *TrackingService) isActive() bool {
+	return s.status == StatusTracking || s.status == StatusPaused
+}
+
+// IdleThreshold restituisce la soglia di inattività in minuti
+func (s *TrackingService) IdleThreshold() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idleThreshold
+}
+
+// SetIdleThreshold imposta la soglia di inattività, la salva nel database
+// e la applica al watcher in esecuzione
+func (s *TrackingService) SetIdleThreshold(minutes int) error {
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idleThreshold = minutes
+	if s.watcher != nil {
+		s.watcher.SetIdleThreshold(minutes * 60)
+	}
+
+	if s.db != nil {
+		return SetSetting(s.db, idleThresholdSettingKey, strconv.Itoa(minutes))
+	}
+	return nil
+}
+
+// detachWatcher scollega il watcher corrente e accoda i suoi periodi pendenti.
+// Il watcher restituito va fermato senza lock (lock tenuto).
+func (s *TrackingService) detachWatcher() *TimeWatcher {
+	w := s.watcher
+	if w != nil {
+		// Un idle ancora in corso finisce qui: l'utente sta usando l'app
+		w.CloseIdle()
+		s.takeWatcherPeriods(w)
+	}
+	s.watcher = nil
+	return w
+}
+
+// reset riporta il servizio allo stato idle (lock tenuto)
+func (s *TrackingService) reset() {
+	s.status = StatusIdle
+	s.project = nil
+	s.activityType = nil
+	s.sessionID = 0
+	s.sessionStart = time.Time{}
+	s.pausedAt = time.Time{}
+}
+
+// Start avvia il tracking per un progetto.
+// Se projectID <= 0 o activityType è nil, i valori mancanti vengono presi dalla prima
+// regola automatica che corrisponde all'applicazione in primo piano.
+func (s *TrackingService) Start(projectID int, activityType *string) error {
+	s.mu.Lock()
+	if s.isActive() {
+		s.mu.Unlock()
+		return fmt.Errorf("tracking già in corso")
+	}
+	// Dopo un auto-stop il vecchio watcher resta attivo solo per rilevare il ritorno dall'idle
+	oldWatcher := s.detachWatcher()
+	newWatcher := s.newWatcher
+	idleMinutes := s.idleThreshold
+	s.mu.Unlock()
+
+	if oldWatcher != nil {
+		oldWatcher.Stop()
+	}
+
+	watcher := newWatcher()
+	watcher.SetClock(s.clock)
+
+	// Regole di assegnazione automatica: senza regole leggibili si traccia comunque
+	rules, err := CaricaRegole(s.db)
+	if err != nil {
+		fmt.Printf("[RULES] Errore caricamento regole, tracking senza regole: %v\n", err)
+	}
+	engine := NewRuleEngine(rules)
+
+	if projectID <= 0 || activityType == nil {
+		processName, title := watcher.SampleActivity()
+		rule := engine.Match(RuleContext{ProcessName: processName, Title: title, Time: s.clock.Now()})
+		if rule != nil && rule.Mode == RuleModeAuto {
+			if projectID <= 0 && rule.ProjectID != nil {
+				projectID = *rule.ProjectID
+			}
+			if activityType == nil {
+				activityType = rule.ActivityType
+			}
+			fmt.Printf("[RULES] Regola '%s' applicata all'avvio\n", rule.Name)
+		}
+	}
+
+	project, err := TrovaProgettoById(s.db, projectID)
+	if err != nil {
+		return err
+	}
+
+	// Timeline titoli finestre (opt-in)
+	titleSettings, err := CaricaImpostazioniTitoli(s.db)
+	if err != nil {
+		fmt.Printf("[TRACK] Errore lettura impostazioni titoli: %v\n", err)
+	} else if titleSettings.Enabled {
+		redactor, err := NewTitleRedactor(titleSettings)
+		if err != nil {
+			fmt.Printf("[TRACK] Regole titoli non valide, timeline disattivata: %v\n", err)
+		} else {
+			watcher.SetTitleRedactor(redactor)
+		}
+	}
+
+	watcher.SetIdleThreshold(idleMinutes * 60) // Converti minuti in secondi
+
+	// Imposta callback per salvataggio periodico
+	watcher.SetSaveCallback(func(totalSeconds int) error {
+		return s.saveProgress(watcher, totalSeconds)
+	}, 300) // Ogni 5 minuti
+
+	// Imposta callback per auto-stop quando viene rilevato idle
+	watcher.SetOnIdleCallback(func() {
+		s.autoStopOnIdle(watcher)
+	})
+
+	// Imposta callback per notifica quando l'utente torna dall'idle
+	watcher.SetOnIdleReturnCallback(func(minutes int) {
+		s.onIdleReturn(watcher, minutes)
+	})
+
+	// Imposta callback per le sospensioni del computer
+	watcher.SetOnSuspendCallback(func(period IdlePeriod) {
+		s.onSuspend(watcher, period)
+	})
+
+	// Valuta le regole a ogni tick
+	if len(engine.rules) > 0 {
+		lastSuggestedID := 0
+		watcher.SetOnActivityCallback(func(processName, title string, at time.Time) {
+			rule := engine.Observe(RuleContext{ProcessName: processName, Title: title, Time: at})
+			if rule == nil {
+				return
+			}
+
+			if rule.Mode == RuleModeSuggest {
+				// Proponi ogni regola una sola volta di seguito
+				if rule.ID != lastSuggestedID {
+					lastSuggestedID = rule.ID
+					s.emit(TrackingEvent{Type: EventRuleSuggestion, State: s.State(), Rule: rule})
+				}
+				return
+			}
+
+			s.applyRule(watcher, rule, at)
+		})
+	}
+
+	s.mu.Lock()
+	if s.isActive() {
+		// Un altro Start è arrivato prima
+		s.mu.Unlock()
+		return fmt.Errorf("tracking già in corso")
+	}
+
+	// Crea sessione pendente
+	startTime := s.clock.Now()
+	sessionID, err := StartPendingTracking(s.db, &projectID, activityType, FormatTimestamp(startTime))
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	s.status = StatusTracking
+	s.project = project
+	s.activityType = activityType
+	s.watcher = watcher
+	s.sessionID = sessionID
+	s.sessionStart = startTime
+	watcher.Start(5)
+	event := s.stateChanged()
+	s.mu.Unlock()
+
+	s.emit(event)
+	return nil
+}
+
+// Stop ferma il tracking corrente e restituisce i secondi attivi della sessione
+func (s *TrackingService) Stop() (int, error) {
+	s.mu.Lock()
+	if !s.isActive() || s.watcher == nil {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("nessun tracking in corso")
+	}
+
+	// Scollega il watcher prima di fermarlo: le sue callback vedono che non è più quello
+	// corrente e non toccano lo stato
+	sessionID := s.sessionID
+	wasPaused := s.status == StatusPaused
+	watcher := s.detachWatcher()
+	s.reset()
+	event := s.stateChanged()
+	s.mu.Unlock()
+
+	if wasPaused && sessionID > 0 {
+		if err := TerminaPausa(s.db, sessionID, s.clock.Now()); err != nil {
+			fmt.Printf("[TRACK] Errore chiusura pausa: %v\n", err)
+		}
+	}
+
+	// Stop attende che la goroutine del watcher abbia finito il tick corrente
+	watcher.Stop()
+	finalSeconds := watcher.GetTotalActiveSeconds()
+
+	if sessionID > 0 {
+		if err := s.saveWatcherDetails(watcher, sessionID); err != nil {
+			return 0, err
+		}
+		// La sessione finisce quando l'utente ferma il tracking
+		if err := FinalizePendingTracking(s.db, sessionID, finalSeconds, s.clock.Now()); err != nil {
+			return 0, err
+		}
+	}
+
+	s.emit(event)
+	return finalSeconds, nil
+}
+
+// Pause sospende il tracking senza chiudere la sessione: finché è in pausa non si
+// accumulano secondi e la pausa viene registrata sulla sessione
+func (s *TrackingService) Pause() error {
+	s.mu.Lock()
+	if s.status != StatusTracking {
+		s.mu.Unlock()
+		return fmt.Errorf("nessun tracking in corso da mettere in pausa")
+	}
+
+	s.watcher.Pause()
+	pausedAt := s.clock.Now()
+	if err := IniziaPausa(s.db, s.sessionID, s.watcher.GetTotalActiveSeconds(), pausedAt); err != nil {
+		s.watcher.Resume()
+		s.mu.Unlock()
+		return err
+	}
+	if err := s.saveWatcherDetails(s.watcher, s.sessionID); err != nil {
+		fmt.Printf("[TRACK] Errore salvataggio dettagli sessione: %v\n", err)
+	}
+
+	s.status = StatusPaused
+	s.pausedAt = pausedAt
+	event := s.stateChanged()
+	s.mu.Unlock()
+
+	s.emit(event)
+	return nil
+}
+
+// Resume riprende un tracking in pausa
+func (s *TrackingService) Resume() error {
+	s.mu.Lock()
+	if s.status != StatusPaused {
+		s.mu.Unlock()
+		return fmt.Errorf("il tracking non è in pausa")
+	}
+
+	if err := TerminaPausa(s.db, s.sessionID, s.clock.Now()); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	s.watcher.Resume()
+	if err := SalvaSegmentiSessione(s.db, s.sessionID, s.watcher.GetSessionSegments()); err != nil {
+		fmt.Printf("[TRACK] Errore salvataggio tratti sessione: %v\n", err)
+	}
+	s.status = StatusTracking
+	s.pausedAt = time.Time{}
+	event := s.stateChanged()
+	s.mu.Unlock()
+
+	s.emit(event)
+	return nil
+}
+
+// PendingIdle restituisce il periodo idle in attesa di attribuzione, o nil
+func (s *TrackingService) PendingIdle() *IdlePeriod {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot().PendingIdle
+}
+
+// AttributeIdle attribuisce il periodo idle pendente a un progetto o lo scarta come pausa
+func (s *TrackingService) AttributeIdle(projectID int, isBreak bool) error {
+	return s.attributePeriod(PeriodIdle, projectID, isBreak)
+}
+
+// IdleSegment è una parte di un periodo idle da attribuire. La durata si indica con Seconds
+// o con EndTime; l'ultimo segmento può non indicarla e prende il tempo rimanente.
+type IdleSegment struct {
+	ProjectID    int
+	ActivityType string // vuoto se non specificato
+	Seconds      int
+	EndTime      time.Time
+}
+
+// AttributeIdleSplit divide il periodo idle pendente tra più progetti e tipi di attività.
+// I segmenti, in ordine cronologico, devono coprire esattamente la durata del periodo:
+// le sessioni vengono create in un'unica transazione.
+func (s *TrackingService) AttributeIdleSplit(segments []IdleSegment) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("nessun segmento da attribuire")
+	}
+	return s.resolvePeriod(PeriodIdle, func(period IdlePeriod, appName string) error {
+		parts, err := splitPeriod(period, segments)
+		if err != nil {
+			return err
+		}
+		return CreaSessioniPeriodo(s.db, appName, "off-computer", parts, period.ID)
+	})
+}
+
+// splitPeriod converte i segmenti nelle sessioni da creare, verificando che coprano il periodo
+func splitPeriod(period IdlePeriod, segments []IdleSegment) ([]SessionePeriodo, error) {
+	parts := make([]SessionePeriodo, 0, len(segments))
+	cursor := period.StartTime
+	remaining := period.Duration
+
+	for i, segment := range segments {
+		if segment.ProjectID <= 0 {
+			return nil, fmt.Errorf("segmento %d: ID progetto non valido", i+1)
+		}
+		if segment.Seconds < 0 {
+			return nil, fmt.Errorf("segmento %d: durata non valida", i+1)
+		}
+
+		seconds := segment.Seconds
+		switch {
+		case !segment.EndTime.IsZero():
+			untilEnd := int(wallSub(segment.EndTime, cursor).Seconds())
+			if seconds > 0 && seconds != untilEnd {
+				return nil, fmt.Errorf("segmento %d: durata (%d sec) e orario di fine (%d sec) non coincidono", i+1, seconds, untilEnd)
+			}
+			seconds = untilEnd
+		case seconds == 0:
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("segmento %d: durata mancante (solo l'ultimo segmento può prendere il tempo rimanente)", i+1)
+			}
+			seconds = remaining
+		}
+
+		if seconds <= 0 {
+			return nil, fmt.Errorf("segmento %d: durata nulla o fine prima dell'inizio", i+1)
+		}
+		if seconds > remaining {
+			return nil, fmt.Errorf("segmento %d: supera la durata del periodo di %d secondi", i+1, seconds-remaining)
+		}
+
+		var activityType *string
+		if segment.ActivityType != "" {
+			activityType = &segments[i].ActivityType
+		}
+		parts = append(parts, SessionePeriodo{
+			ProjectID:    segment.ProjectID,
+			ActivityType: activityType,
+			Seconds:      seconds,
+			Timestamp:    FormatTimestamp(cursor),
+		})
+		cursor = cursor.Add(time.Duration(seconds) * time.Second)
+		remaining -= seconds
+	}
+
+	if remaining != 0 {
+		return nil, fmt.Errorf("i segmenti coprono %d secondi su %d: mancano %d secondi", period.Duration-remaining, period.Duration, remaining)
+	}
+	return parts, nil
+}
+
+// PendingSuspended restituisce la sospensione in attesa di attribuzione, o nil
+func (s *TrackingService) PendingSuspended() *IdlePeriod {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot().PendingSuspended
+}
+
+// AttributeSuspended attribuisce la sospensione pendente a un progetto o la scarta
+func (s *TrackingService) AttributeSuspended(projectID int, discard bool) error {
+	return s.attributePeriod(PeriodSuspended, projectID, discard)
+}
+
+// attributePeriod crea una sessione per il periodo pendente del tipo indicato, o lo scarta
+func (s *TrackingService) attributePeriod(periodType string, projectID int, discard bool) error {
+	// Un periodo scartato (pausa) non viene salvato come sessione
+	if discard {
+		return s.resolvePeriod(periodType, nil)
+	}
+
+	return s.resolvePeriod(periodType, func(period IdlePeriod, appName string) error {
+		if projectID <= 0 {
+			return fmt.Errorf("ID progetto non valido")
+		}
+
+		// Crea una sessione per il periodo
+		part := SessionePeriodo{
+			ProjectID: projectID,
+			Seconds:   period.Duration, // Duration è già in secondi
+			Timestamp: FormatTimestamp(period.StartTime),
+		}
+		return CreaSessioniPeriodo(s.db, appName, "off-computer", []SessionePeriodo{part}, period.ID)
+	})
+}
+
+// resolvePeriod salva con save il periodo pendente del tipo indicato (nil lo scarta) e,
+// se il salvataggio riesce, lo rimuove dai periodi in attesa
+func (s *TrackingService) resolvePeriod(periodType string, save func(period IdlePeriod, appName string) error) error {
+	s.mu.Lock()
+
+	// Si attribuisce sempre il periodo più vecchio del tipo richiesto
+	index := -1
+	for i, p := range s.pendingPeriods {
+		if p.Type == periodType {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		s.mu.Unlock()
+		if periodType == PeriodSuspended {
+			return fmt.Errorf("nessuna sospensione pendente")
+		}
+		return fmt.Errorf("nessun periodo idle pendente")
+	}
+	period := s.pendingPeriods[index]
+	appName := "Tempo Idle"
+	if periodType == PeriodSuspended {
+		appName = "Tempo Sospeso"
+	}
+
+	if save != nil {
+		// save rimuove il periodo dalla coda nel database insieme alle sessioni create
+		if err := save(period, appName); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	} else if period.ID > 0 {
+		if err := EliminaPeriodoPendente(s.db, period.ID); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+
+	s.pendingPeriods = append(s.pendingPeriods[:index], s.pendingPeriods[index+1:]...)
+	if err := s.loadPendingPeriods(); err != nil {
+		fmt.Printf("[IDLE] Errore caricamento periodi pendenti: %v\n", err)
+	}
+	if periodType == PeriodIdle && s.status == StatusAutoStopped {
+		s.status = StatusIdle
+	}
+
+	// Pulizia: se il tracking era già stato fermato (auto-stop), ferma il watcher
+	var stopped *TimeWatcher
+	if s.watcher != nil && !s.isActive() && s.status != StatusAutoStopped {
+		stopped = s.detachWatcher()
+	}
+	event := s.stateChanged()
+	s.mu.Unlock()
+
+	if stopped != nil {
+		stopped.Stop()
+	}
+
+	s.emit(event)
+	return nil
+}
+
+// SuspendHandling restituisce come vengono gestite le sospensioni (SuspendAsk o SuspendDiscard)
+func (s *TrackingService) SuspendHandling() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.suspendHandling
+}
+
+// SetSuspendHandling imposta come gestire le sospensioni e lo salva nel database
+func (s *TrackingService) SetSuspendHandling(mode string) error {
+	if mode != SuspendAsk && mode != SuspendDiscard {
+		return fmt.Errorf("gestione sospensioni non valida '%s'", mode)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.suspendHandling = mode
+	if s.db != nil {
+		return SetSetting(s.db, suspendHandlingSettingKey, mode)
+	}
+	return nil
+}
+
+// Shutdown chiude la sessione aperta e ferma ogni watcher (alla chiusura dell'app)
+func (s *TrackingService) Shutdown() {
+	s.mu.Lock()
+	active := s.isActive()
+	var stopped *TimeWatcher
+	if !active {
+		stopped = s.detachWatcher()
+	}
+	s.mu.Unlock()
+
+	if active {
+		if _, err := s.Stop(); err != nil {
+			fmt.Printf("[TRACK] Errore chiusura tracking: %v\n", err)
+		}
+	} else if stopped != nil {
+		stopped.Stop()
+	}
+}
+
+// === CALLBACK DEL WATCHER ===
+// Chiamate dalla goroutine del watcher: verificano che sia ancora quello corrente,
+// perché Stop lo scollega prima di attenderne la fine.
+
+// saveProgress salva periodicamente la sessione pendente
+func (s *TrackingService) saveProgress(watcher *TimeWatcher, totalSeconds int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watcher != watcher || !s.isActive() {
+		return nil
+	}
+
+	if err := UpdatePendingTracking(s.db, s.sessionID, totalSeconds); err != nil {
+		return err
+	}
+	return s.saveWatcherDetails(watcher, s.sessionID)
+}
+
+// autoStopOnIdle ferma automaticamente il tracking quando viene rilevato idle
+func (s *TrackingService) autoStopOnIdle(watcher *TimeWatcher) {
+	s.mu.Lock()
+
+	// Verifica che il tracking sia ancora attivo con questo watcher
+	if s.status != StatusTracking || s.watcher != watcher {
+		s.mu.Unlock()
+		fmt.Println("[IDLE-AUTOSTOP] Tracking già fermato o watcher diverso, skip")
+		return
+	}
+	sessionID := s.sessionID
+
+	// NON fermare il watcher qui: siamo nella sua goroutine e serve ancora
+	// per rilevare quando l'utente torna e proporre l'attribuzione dell'idle
+	finalSeconds := watcher.GetTotalActiveSeconds()
+
+	// Salva la sessione finale nel database
+	if sessionID > 0 && finalSeconds > 0 {
+		if err := s.saveWatcherDetails(watcher, sessionID); err != nil {
+			fmt.Printf("[IDLE-AUTOSTOP] Errore salvataggio dettagli sessione: %v\n", err)
+		}
+		// La sessione finisce con l'ultimo tempo attivo, non quando è scattato l'idle
+		err := FinalizePendingTracking(s.db, sessionID, finalSeconds, lastActiveEnd(watcher, s.clock.Now()))
+		if err != nil {
+			fmt.Printf("[IDLE-AUTOSTOP] Errore salvataggio sessione: %v\n", err)
+		} else {
+			fmt.Printf("[IDLE-AUTOSTOP] Sessione salvata: %d secondi (%d min)\n", finalSeconds, finalSeconds/60)
+		}
+	}
+
+	s.reset()
+	s.status = StatusAutoStopped
+	state := s.snapshot()
+	s.mu.Unlock()
+
+	fmt.Println("[IDLE-AUTOSTOP] Tracking fermato automaticamente per inattività")
+	s.emit(
+		TrackingEvent{Type: EventAutoStopped, State: state, Seconds: finalSeconds},
+		TrackingEvent{Type: EventStateChanged, State: state},
+	)
+}
+
+// onIdleReturn accoda il periodo idle appena concluso e notifica il ritorno dell'utente
+func (s *TrackingService) onIdleReturn(watcher *TimeWatcher, minutes int) {
+	s.mu.Lock()
+	if s.watcher != watcher {
+		s.mu.Unlock()
+		return
+	}
+	s.takeWatcherPeriods(watcher)
+	state := s.snapshot()
+	s.mu.Unlock()
+
+	if minutes > 0 {
+		s.emit(TrackingEvent{Type: EventIdleReturn, State: state, IdleMinutes: minutes})
+	}
+}
+
+// onSuspend scarta la sospensione rilevata o la propone per l'attribuzione
+func (s *TrackingService) onSuspend(watcher *TimeWatcher, period IdlePeriod) {
+	s.mu.Lock()
+	if s.watcher != watcher {
+		s.mu.Unlock()
+		return
+	}
+	if s.suspendHandling == SuspendDiscard {
+		watcher.ClearPendingSuspendedPeriod()
+		s.mu.Unlock()
+		fmt.Printf("[CLOCK] Sospensione di %d secondi scartata\n", period.Duration)
+		return
+	}
+	s.takeWatcherPeriods(watcher)
+	state := s.snapshot()
+	s.mu.Unlock()
+
+	s.emit(TrackingEvent{Type: EventSuspended, State: state, Period: &period})
+}
+
+// applyRule applica una regola automatica alla sessione in corso: se cambia progetto o tipo
+// di attività, chiude la sessione pendente all'istante corrente e ne apre una nuova
+func (s *TrackingService) applyRule(watcher *TimeWatcher, rule *AssignmentRule, at time.Time) {
+	s.mu.Lock()
+
+	if s.status != StatusTracking || s.watcher != watcher || s.project == nil {
+		s.mu.Unlock()
+		return
+	}
+
+	project := s.project
+	if rule.ProjectID != nil && *rule.ProjectID != project.ID {
+		newProject, err := TrovaProgettoById(s.db, *rule.ProjectID)
+		if err != nil {
+			s.mu.Unlock()
+			fmt.Printf("[RULES] Progetto della regola '%s' non trovato: %v\n", rule.Name, err)
+			return
+		}
+		project = newProject
+	}
+
+	activityType := s.activityType
+	if rule.ActivityType != nil {
+		activityType = rule.ActivityType
+	}
+
+	if project.ID == s.project.ID && sameActivityType(activityType, s.activityType) {
+		s.mu.Unlock()
+		return
+	}
+
+	if err := s.splitSession(project, activityType, at); err != nil {
+		s.mu.Unlock()
+		fmt.Printf("[RULES] Errore applicazione regola '%s': %v\n", rule.Name, err)
+		return
+	}
+
+	state := s.snapshot()
+	s.mu.Unlock()
+
+	fmt.Printf("[RULES] Regola '%s' applicata: nuova sessione ID %d\n", rule.Name, state.SessionID)
+	s.emit(
+		TrackingEvent{Type: EventSwitched, State: state, Rule: rule},
+		TrackingEvent{Type: EventStateChanged, State: state},
+	)
+}
+
+// splitSession chiude la sessione pendente corrente all'istante at e ne apre una nuova
+// per progetto e tipo di attività indicati, proseguendo con lo stesso watcher (lock tenuto)
+func (s *TrackingService) splitSession(project *Project, activityType *string, at time.Time) error {
+	oldSessionID := s.sessionID
+	var newSessionID int64
+
+	// Il watcher resta bloccato finché la divisione non è salvata: nessun tick va perso
+	err := s.watcher.CutSegment(at, func(segment WatcherSegment) error {
+		var err error
+		newSessionID, err = DividiSessionePendente(s.db, oldSessionID, segment.TotalSeconds, &project.ID, activityType, FormatTimestamp(at))
+		if err != nil {
+			return err
+		}
+
+		if err := SalvaUtilizzoApp(s.db, oldSessionID, segment.AppTimes); err != nil {
+			fmt.Printf("[TRACK] Errore salvataggio utilizzo app: %v\n", err)
+		}
+		if err := SalvaTimelineTitoli(s.db, oldSessionID, segment.TitleSpans); err != nil {
+			fmt.Printf("[TRACK] Errore salvataggio timeline titoli: %v\n", err)
+		}
+		if err := SalvaSegmentiSessione(s.db, oldSessionID, segment.Segments); err != nil {
+			fmt.Printf("[TRACK] Errore salvataggio tratti sessione: %v\n", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.project = project
+	s.activityType = activityType
+	s.sessionID = newSessionID
+	s.sessionStart = at
+	return nil
+}
+
+// Switch chiude la sessione in corso all'istante attuale e ne apre subito una nuova per
+// progetto e tipo di attività indicati, senza fermare il watcher: tra le due sessioni non
+// ci sono buchi né sovrapposizioni. Se il tracking era in pausa la pausa termina e il
+// tracking riprende sulla nuova sessione.
+func (s *TrackingService) Switch(projectID int, activityType *string) error {
+	s.mu.Lock()
+	if !s.isActive() || s.watcher == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("nessun tracking in corso")
+	}
+
+	project, err := TrovaProgettoById(s.db, projectID)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	wasPaused := s.status == StatusPaused
+	if !wasPaused && project.ID == s.project.ID && sameActivityType(activityType, s.activityType) {
+		s.mu.Unlock()
+		return nil
+	}
+
+	at := s.clock.Now()
+	if wasPaused {
+		if err := TerminaPausa(s.db, s.sessionID, at); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+
+	if err := s.splitSession(project, activityType, at); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	if wasPaused {
+		s.watcher.Resume()
+		s.status = StatusTracking
+		s.pausedAt = time.Time{}
+	}
+	state := s.snapshot()
+	s.mu.Unlock()
+
+	fmt.Printf("[TRACK] Cambio a progetto %s: nuova sessione ID %d\n", project.Name, state.SessionID)
+	s.emit(
+		TrackingEvent{Type: EventSwitched, State: state},
+		TrackingEvent{Type: EventStateChanged, State: state},
+	)
+	return nil
+}
+
+// saveWatcherDetails salva il tempo per applicazione e la timeline titoli raccolti dal watcher
+func (s *TrackingService) saveWatcherDetails(watcher *TimeWatcher, sessionID int64) error {
+	if err := SalvaUtilizzoApp(s.db, sessionID, watcher.GetStats()); err != nil {
+		return err
+	}
+	if err := SalvaSegmentiSessione(s.db, sessionID, watcher.GetSessionSegments()); err != nil {
+		return err
+	}
+	return SalvaTimelineTitoli(s.db, sessionID, watcher.GetTitleSpans())
+}
+
+// lastActiveEnd restituisce la fine dell'ultimo intervallo attivo del watcher,
+// o fallback se non ci sono intervalli
+func lastActiveEnd(watcher *TimeWatcher, fallback time.Time) time.Time {
+	intervals := watcher.GetActiveIntervals()
+	if len(intervals) == 0 {
+		return fallback
+	}
+	return intervals[len(intervals)-1].EndTime
+}
+
+// sameActivityType confronta due tipi di attività opzionali
+func sameActivityType(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,425 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// apriDBTest crea un database vuoto con lo schema aggiornato, chiuso alla fine del test
+func apriDBTest(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := InitDB(filepath.Join(t.TempDir(), "timetracker.db"))
+	if err != nil {
+		t.Fatalf("errore apertura database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestTrackingServicePeriodiPendentiDalDatabase(t *testing.T) {
+	db := apriDBTest(t)
+	service := NewTrackingService(db, NewManualClock(testStart))
+	var events []TrackingEvent
+	service.SetEventHandler(func(event TrackingEvent) { events = append(events, event) })
+
+	// Un periodo scritto nella tabella da fuori (es. importazione) compare solo dopo la rilettura
+	start := testStart.Add(-time.Hour).UTC()
+	period := IdlePeriod{Type: PeriodIdle, StartTime: start, EndTime: start.Add(20 * time.Minute), Duration: 1200}
+	if _, err := SalvaPeriodoPendente(db, period); err != nil {
+		t.Fatal(err)
+	}
+	if got := service.PendingPeriods(); len(got) != 0 {
+		t.Fatalf("periodi pendenti prima della rilettura = %d, attesi 0", len(got))
+	}
+
+	if err := service.ReloadPendingPeriods(); err != nil {
+		t.Fatalf("errore rilettura periodi pendenti: %v", err)
+	}
+	got := service.PendingPeriods()
+	if len(got) != 1 || got[0].ID == 0 || !got[0].StartTime.Equal(start) {
+		t.Fatalf("periodi pendenti dopo la rilettura = %+v, atteso il periodo importato", got)
+	}
+	if len(events) != 1 || events[0].State.PendingIdle == nil {
+		t.Errorf("eventi dopo la rilettura = %+v, atteso un cambio di stato con il periodo idle", events)
+	}
+
+	// Scartato dal servizio, il periodo sparisce anche dal database
+	if err := service.AttributeIdle(0, true); err != nil {
+		t.Fatalf("errore scarto periodo idle: %v", err)
+	}
+	if got := service.PendingPeriods(); len(got) != 0 {
+		t.Errorf("periodi pendenti dopo lo scarto = %d, attesi 0", len(got))
+	}
+	stored, err := CaricaPeriodiPendenti(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("periodi nel database dopo lo scarto = %d, attesi 0", len(stored))
+	}
+}
+
+func TestTrackingServiceStartConRegoleNonValide(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(db *sql.DB, projectID int64) error
+	}{
+		{"regex non valida", func(db *sql.DB, projectID int64) error {
+			_, err := db.Exec(`INSERT INTO assignment_rules (name, priority, enabled, title_pattern, project_id, mode) VALUES ('rotta', 1, 1, '(x', ?, 'auto')`, projectID)
+			return err
+		}},
+		{"regole illeggibili", func(db *sql.DB, projectID int64) error {
+			_, err := db.Exec(`DROP TABLE assignment_rules`)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := apriDBTest(t)
+			projectID, err := CreaProgetto(db, "Cliente", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.setup(db, projectID); err != nil {
+				t.Fatal(err)
+			}
+
+			user := utenteAttivo()
+			service := NewTrackingService(db, user.clock)
+			service.SetWatcherFactory(func() *TimeWatcher { return NewTimeWatcherWithSources(user, user) })
+
+			// Il tracking manuale con progetto esplicito parte comunque
+			if err := service.Start(int(projectID), nil); err != nil {
+				t.Fatalf("errore avvio tracking: %v", err)
+			}
+			if _, err := service.Stop(); err != nil {
+				t.Fatalf("errore stop tracking: %v", err)
+			}
+		})
+	}
+}
+
+// servizioSimulato è un TrackingService con il watcher guidato da un utente simulato
+type servizioSimulato struct {
+	*TrackingService
+	t       *testing.T
+	db      *sql.DB
+	user    *fakeUser
+	watcher *TimeWatcher
+	sim     *simulazione
+}
+
+// avviaServizioSimulato crea il servizio con due progetti e avvia il tracking sul primo;
+// restituisce anche gli ID dei progetti
+func avviaServizioSimulato(t *testing.T) (*servizioSimulato, int, int) {
+	t.Helper()
+	db := apriDBTest(t)
+	var ids []int
+	for _, name := range []string{"Cliente", "Interno"} {
+		id, err := CreaProgetto(db, name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, int(id))
+	}
+
+	s := &servizioSimulato{t: t, db: db, user: utenteAttivo()}
+	s.TrackingService = NewTrackingService(db, s.user.clock)
+	s.SetWatcherFactory(func() *TimeWatcher {
+		s.watcher = NewTimeWatcherWithSources(s.user, s.user)
+		s.watcher.tickDone = make(chan struct{})
+		return s.watcher
+	})
+	if err := s.Start(ids[0], nil); err != nil {
+		t.Fatalf("errore avvio tracking: %v", err)
+	}
+	s.sim = &simulazione{t: t, clock: s.user.clock, watcher: s.watcher, period: 5 * time.Second}
+	s.sim.next = s.user.clock.Elapsed() + s.sim.period
+	return s, ids[0], ids[1]
+}
+
+// sessione restituisce secondi, inizio e fine salvati di una sessione
+func (s *servizioSimulato) sessione(id int64) (int, string, string) {
+	s.t.Helper()
+	var seconds int
+	var start string
+	var end sql.NullString
+	err := s.db.QueryRow(`SELECT seconds, CAST(timestamp AS TEXT), CAST(ended_at AS TEXT) FROM sessions WHERE id = ?`, id).Scan(&seconds, &start, &end)
+	if err != nil {
+		s.t.Fatalf("sessione %d: %v", id, err)
+	}
+	return seconds, start, end.String
+}
+
+// istante restituisce il timestamp del database a offset dall'inizio della simulazione
+func istante(offset time.Duration) string {
+	return FormatTimestamp(testStart.Add(offset))
+}
+
+func TestTrackingServicePausaERipresa(t *testing.T) {
+	s, _, _ := avviaServizioSimulato(t)
+	sessionID := s.State().SessionID
+
+	s.sim.avanza(10 * time.Minute)
+	if err := s.Pause(); err != nil {
+		t.Fatalf("errore pausa: %v", err)
+	}
+	if err := s.Pause(); err == nil {
+		t.Error("pausa accettata con il tracking già in pausa")
+	}
+
+	// In pausa il tempo non si accumula
+	s.sim.avanza(5 * time.Minute)
+	if state := s.State(); state.Status != StatusPaused || state.ElapsedSeconds != 600 {
+		t.Errorf("stato in pausa = %s, %d secondi; attesi paused, 600", state.Status, state.ElapsedSeconds)
+	}
+
+	if err := s.Resume(); err != nil {
+		t.Fatalf("errore ripresa: %v", err)
+	}
+	if err := s.Resume(); err == nil {
+		t.Error("ripresa accettata con il tracking non in pausa")
+	}
+	s.sim.avanza(10 * time.Minute)
+
+	seconds, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seconds != 1200 {
+		t.Errorf("secondi attivi = %d, attesi 1200 (25 minuti meno 5 di pausa)", seconds)
+	}
+
+	saved, start, end := s.sessione(sessionID)
+	if saved != 1200 || start != istante(0) || end != istante(25*time.Minute) {
+		t.Errorf("sessione salvata = %d secondi, %s - %s", saved, start, end)
+	}
+	pauses, err := CaricaPauseSessione(s.db, int(sessionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pauses) != 1 || FormatTimestamp(pauses[0].StartTime) != istante(10*time.Minute) || FormatTimestamp(pauses[0].EndTime) != istante(15*time.Minute) {
+		t.Errorf("pause salvate = %+v, attesa una pausa dal minuto 10 al 15", pauses)
+	}
+}
+
+func TestTrackingServiceRecuperoDuranteLaPausa(t *testing.T) {
+	s, _, _ := avviaServizioSimulato(t)
+	sessionID := s.State().SessionID
+
+	s.sim.avanza(10 * time.Minute)
+	if err := s.Pause(); err != nil {
+		t.Fatalf("errore pausa: %v", err)
+	}
+	s.sim.avanza(20 * time.Minute)
+
+	// Crash durante la pausa: al riavvio la sessione si chiude all'inizio della pausa
+	t.Cleanup(s.watcher.Stop)
+	recovered, err := RecoverPendingTracking(s.db)
+	if err != nil || recovered != 1 {
+		t.Fatalf("sessioni recuperate = %d (%v), attesa 1", recovered, err)
+	}
+
+	saved, _, end := s.sessione(sessionID)
+	if saved != 600 || end != istante(10*time.Minute) {
+		t.Errorf("sessione recuperata = %d secondi, fine %s; attesi 600, %s", saved, end, istante(10*time.Minute))
+	}
+	pauses, err := CaricaPauseSessione(s.db, int(sessionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pauses) != 0 {
+		t.Errorf("pause dopo il recupero = %+v, la pausa mai ripresa non fa parte della sessione", pauses)
+	}
+	pending, err := GetAllPendingTracking(s.db)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("tracking pendente dopo il recupero = %+v (%v)", pending, err)
+	}
+}
+
+func TestTrackingServiceSwitch(t *testing.T) {
+	tests := []struct {
+		name   string
+		paused bool
+	}{
+		{"in corso", false},
+		{"in pausa", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, interno := avviaServizioSimulato(t)
+			firstID := s.State().SessionID
+
+			s.sim.avanza(10 * time.Minute)
+			switchAt := 10 * time.Minute
+			if tt.paused {
+				if err := s.Pause(); err != nil {
+					t.Fatal(err)
+				}
+				s.sim.avanza(5 * time.Minute)
+				switchAt += 5 * time.Minute
+			}
+
+			ricerca := "RICERCA"
+			if err := s.Switch(interno, &ricerca); err != nil {
+				t.Fatalf("errore cambio progetto: %v", err)
+			}
+			state := s.State()
+			if state.Status != StatusTracking || state.SessionID == firstID || state.Project.ID != interno || state.ActivityType == nil || *state.ActivityType != ricerca {
+				t.Fatalf("stato dopo il cambio = %+v", state)
+			}
+			if !state.StartTime.Equal(testStart.Add(switchAt)) {
+				t.Errorf("inizio nuova sessione = %v, atteso %v", state.StartTime, testStart.Add(switchAt))
+			}
+
+			s.sim.avanza(5 * time.Minute)
+			if _, err := s.Stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			// La vecchia sessione finisce esattamente dove inizia la nuova
+			oldSeconds, _, oldEnd := s.sessione(firstID)
+			newSeconds, newStart, newEnd := s.sessione(state.SessionID)
+			if oldSeconds != 600 || oldEnd != istante(switchAt) {
+				t.Errorf("sessione precedente = %d secondi, fine %s; attesi 600, %s", oldSeconds, oldEnd, istante(switchAt))
+			}
+			if newSeconds != 300 || newStart != istante(switchAt) || newEnd != istante(switchAt+5*time.Minute) {
+				t.Errorf("nuova sessione = %d secondi, %s - %s", newSeconds, newStart, newEnd)
+			}
+			if tt.paused {
+				pauses, err := CaricaPauseSessione(s.db, int(firstID))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(pauses) != 1 || FormatTimestamp(pauses[0].EndTime) != istante(switchAt) {
+					t.Errorf("pausa della sessione precedente = %+v, attesa chiusa al cambio", pauses)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitPeriod(t *testing.T) {
+	start := testStart.UTC()
+	period := IdlePeriod{Type: PeriodIdle, StartTime: start, EndTime: start.Add(time.Hour), Duration: 3600}
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name     string
+		segments []IdleSegment
+		want     []int // secondi di ogni sessione, nil se la divisione è rifiutata
+	}{
+		{"resto all'ultimo", []IdleSegment{{ProjectID: 1, Seconds: 1200}, {ProjectID: 2}}, []int{1200, 2400}},
+		{"orari di fine", []IdleSegment{{ProjectID: 1, EndTime: at(15)}, {ProjectID: 2, EndTime: at(60)}}, []int{900, 2700}},
+		{"durata e fine coincidenti", []IdleSegment{{ProjectID: 1, Seconds: 900, EndTime: at(15)}, {ProjectID: 2}}, []int{900, 2700}},
+		{"un solo segmento", []IdleSegment{{ProjectID: 1}}, []int{3600}},
+		{"divisione all'inizio", []IdleSegment{{ProjectID: 1, EndTime: at(0)}, {ProjectID: 2}}, nil},
+		{"divisione alla fine", []IdleSegment{{ProjectID: 1, EndTime: at(60)}}, []int{3600}},
+		{"divisione alla fine con segmento vuoto", []IdleSegment{{ProjectID: 1, EndTime: at(60)}, {ProjectID: 2}}, nil},
+		{"divisione oltre la fine", []IdleSegment{{ProjectID: 1, EndTime: at(61)}, {ProjectID: 2}}, nil},
+		{"durata oltre la fine", []IdleSegment{{ProjectID: 1, Seconds: 3601}}, nil},
+		{"fine prima dell'inizio", []IdleSegment{{ProjectID: 1, EndTime: at(-5)}, {ProjectID: 2}}, nil},
+		{"durata e fine diverse", []IdleSegment{{ProjectID: 1, Seconds: 600, EndTime: at(15)}, {ProjectID: 2}}, nil},
+		{"periodo non coperto", []IdleSegment{{ProjectID: 1, Seconds: 1200}, {ProjectID: 2, Seconds: 1200}}, nil},
+		{"durata mancante non all'ultimo", []IdleSegment{{ProjectID: 1}, {ProjectID: 2, Seconds: 1200}}, nil},
+		{"progetto mancante", []IdleSegment{{Seconds: 3600}}, nil},
+		{"durata negativa", []IdleSegment{{ProjectID: 1, Seconds: -60}, {ProjectID: 2}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := splitPeriod(period, tt.segments)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("divisione accettata: %+v", parts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("errore divisione: %v", err)
+			}
+			if len(parts) != len(tt.want) {
+				t.Fatalf("sessioni = %+v, attese %d", parts, len(tt.want))
+			}
+
+			// Ogni sessione inizia dove finisce la precedente
+			cursor := start
+			for i, part := range parts {
+				if part.Seconds != tt.want[i] || part.Timestamp != FormatTimestamp(cursor) || part.ProjectID != tt.segments[i].ProjectID {
+					t.Errorf("sessione %d = %+v, attesi %d secondi dalle %s", i, part, tt.want[i], FormatTimestamp(cursor))
+				}
+				cursor = cursor.Add(time.Duration(part.Seconds) * time.Second)
+			}
+		})
+	}
+}
+
+func TestTrackingServiceAttributeIdleSplit(t *testing.T) {
+	db := apriDBTest(t)
+	projectID, err := CreaProgetto(db, "Cliente", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewTrackingService(db, NewManualClock(testStart))
+	start := testStart.Add(-time.Hour).UTC()
+	if _, err := SalvaPeriodoPendente(db, IdlePeriod{Type: PeriodIdle, StartTime: start, EndTime: start.Add(time.Hour), Duration: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ReloadPendingPeriods(); err != nil {
+		t.Fatal(err)
+	}
+	contaSessioni := func() int {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	// Una divisione rifiutata non crea sessioni e lascia il periodo in attesa
+	err = service.AttributeIdleSplit([]IdleSegment{{ProjectID: int(projectID), EndTime: start.Add(61 * time.Minute)}, {ProjectID: int(projectID)}})
+	if err == nil {
+		t.Fatal("divisione oltre la fine del periodo accettata")
+	}
+	if service.PendingIdle() == nil || contaSessioni() != 0 {
+		t.Fatalf("dopo il rifiuto: periodo pendente %v, %d sessioni", service.PendingIdle(), contaSessioni())
+	}
+
+	progettazione := "PROGETTAZIONE"
+	segments := []IdleSegment{{ProjectID: int(projectID), ActivityType: progettazione, Seconds: 900}, {ProjectID: int(projectID)}}
+	if err := service.AttributeIdleSplit(segments); err != nil {
+		t.Fatalf("errore divisione periodo: %v", err)
+	}
+	if service.PendingIdle() != nil {
+		t.Error("periodo ancora pendente dopo la divisione")
+	}
+	stored, err := CaricaPeriodiPendenti(db)
+	if err != nil || len(stored) != 0 {
+		t.Errorf("periodi nel database dopo la divisione = %+v (%v)", stored, err)
+	}
+
+	rows, err := db.Query(`SELECT seconds, CAST(timestamp AS TEXT), CAST(ended_at AS TEXT), COALESCE(` + sessionActivitySQL + `, '') FROM sessions s ORDER BY timestamp`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var seconds int
+		var from, to, activity string
+		if err := rows.Scan(&seconds, &from, &to, &activity); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d %s %s %s", seconds, from, to, activity))
+	}
+	want := []string{
+		fmt.Sprintf("900 %s %s %s", FormatTimestamp(start), FormatTimestamp(start.Add(15*time.Minute)), progettazione),
+		fmt.Sprintf("2700 %s %s ", FormatTimestamp(start.Add(15*time.Minute)), FormatTimestamp(start.Add(time.Hour))),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sessioni create = %q, attese %q", got, want)
+	}
+}
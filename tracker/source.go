@@ -0,0 +1,53 @@
+package tracker
+
+import "fmt"
+
+// ActivitySource rileva l'applicazione in primo piano
+type ActivitySource interface {
+	// GetActiveProcessName ritorna il nome del processo della finestra attiva (es. "Code.exe")
+	GetActiveProcessName() (string, error)
+	// GetActiveWindow ritorna il titolo della finestra attiva
+	GetActiveWindow() (string, error)
+}
+
+// IdleSource rileva da quanto tempo l'utente non interagisce con il PC
+type IdleSource interface {
+	// GetIdleTime restituisce i secondi trascorsi dall'ultimo input
+	GetIdleTime() (int, error)
+}
+
+// unsupportedSource è usata quando la piattaforma non offre un backend di rilevamento
+type unsupportedSource struct{}
+
+// GetActiveWindow non è supportato su questa piattaforma
+func (unsupportedSource) GetActiveWindow() (string, error) {
+	return "", fmt.Errorf("rilevamento finestra attiva non supportato su questa piattaforma")
+}
+
+// GetActiveProcessName non è supportato su questa piattaforma
+func (unsupportedSource) GetActiveProcessName() (string, error) {
+	return "", fmt.Errorf("rilevamento processo attivo non supportato su questa piattaforma")
+}
+
+// GetIdleTime non è supportato su questa piattaforma
+func (unsupportedSource) GetIdleTime() (int, error) {
+	return 0, fmt.Errorf("rilevamento inattività non supportato su questa piattaforma")
+}
+
+// extractFileName estrae il nome del file dal path completo
+func extractFileName(path string) string {
+	// Trova l'ultima barra
+	lastSlash := -1
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '\\' || path[i] == '/' {
+			lastSlash = i
+			break
+		}
+	}
+
+	if lastSlash == -1 {
+		return path
+	}
+
+	return path[lastSlash+1:]
+}
@@ -0,0 +1,403 @@
+//go:build linux
+
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/screensaver"
+	"github.com/jezek/xgb/xproto"
+)
+
+var (
+	linuxSourcesOnce sync.Once
+	linuxActivity    ActivitySource
+	linuxIdle        IdleSource
+)
+
+// defaultSources restituisce le sorgenti della piattaforma corrente.
+// Il backend viene scelto una sola volta: X11 per la finestra attiva,
+// X screensaver o logind per l'inattività, con fallback a una sorgente non supportata.
+func defaultSources() (ActivitySource, IdleSource) {
+	linuxSourcesOnce.Do(func() {
+		linuxActivity, linuxIdle = unsupportedSource{}, unsupportedSource{}
+
+		x, err := newX11Source()
+		if err != nil {
+			fmt.Printf("[WATCHER] X11 non disponibile: %v\n", err)
+		} else {
+			linuxActivity = x
+			if x.hasScreensaver {
+				linuxIdle = x
+			}
+		}
+
+		if _, ok := linuxIdle.(unsupportedSource); ok {
+			logind, err := newLogindSource()
+			if err != nil {
+				fmt.Printf("[WATCHER] logind non disponibile: %v\n", err)
+			} else {
+				linuxIdle = logind
+			}
+		}
+
+		fmt.Printf("[WATCHER] Sorgenti Linux: attività=%T, inattività=%T\n", linuxActivity, linuxIdle)
+	})
+
+	return linuxActivity, linuxIdle
+}
+
+// x11RetryInterval è l'intervallo minimo tra due tentativi di riconnessione al server X
+const x11RetryInterval = 30 * time.Second
+
+// x11Display è una connessione al server X: finestra attiva e, se c'è l'estensione
+// screensaver, inattività
+type x11Display interface {
+	ActivitySource
+	IdleSource
+	Close()
+}
+
+// x11ConnError indica che la connessione al server X è caduta: le richieste successive
+// falliranno finché non ci si riconnette
+type x11ConnError struct {
+	what string
+	err  error
+}
+
+func (e *x11ConnError) Error() string {
+	return fmt.Sprintf("connessione X11 persa (%s): %v", e.what, e.err)
+}
+
+// erroreX11 descrive l'errore di una richiesta X11. Gli errori del protocollo (es. finestra
+// chiusa nel frattempo) sono normali; gli altri indicano che la connessione è caduta.
+func erroreX11(what string, err error) error {
+	if _, ok := err.(xgb.Error); ok {
+		return fmt.Errorf("errore lettura %s: %v", what, err)
+	}
+	return &x11ConnError{what: what, err: err}
+}
+
+// x11Source implementa ActivitySource (e IdleSource se c'è l'estensione screensaver) via X11.
+// Se la connessione al server X cade si riconnette, riprovando al più ogni x11RetryInterval;
+// finché la connessione manca l'inattività non viene rilevata e il tempo continua a essere tracciato.
+type x11Source struct {
+	mu             sync.Mutex
+	display        x11Display // nil se la connessione è caduta
+	connect        func() (x11Display, error)
+	clock          Clock
+	retryAt        time.Time // prima di questo istante non si riprova a connettersi
+	lastErr        error     // errore dell'ultimo tentativo di connessione
+	hasScreensaver bool
+	idleLost       bool // rilevamento idle sospeso per la connessione persa (già segnalato)
+}
+
+// newX11Source si connette al display indicato da $DISPLAY
+func newX11Source() (*x11Source, error) {
+	conn, err := newX11Conn()
+	if err != nil {
+		return nil, err
+	}
+
+	return &x11Source{
+		display:        conn,
+		connect:        func() (x11Display, error) { return newX11Conn() },
+		clock:          currentClock(),
+		hasScreensaver: conn.hasScreensaver,
+	}, nil
+}
+
+// usa esegue una richiesta sul display X. Se la connessione risulta caduta la chiude e
+// ne apre una nuova, su cui ripete la richiesta.
+func (s *x11Source) usa(request func(d x11Display) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.display != nil {
+		err := request(s.display)
+		if _, lost := err.(*x11ConnError); !lost {
+			return err
+		}
+		fmt.Printf("[WATCHER] %v: riconnessione\n", err)
+		s.display.Close()
+		s.display = nil
+		s.retryAt = time.Time{}
+	}
+
+	if s.clock.Now().Before(s.retryAt) {
+		return s.lastErr
+	}
+	display, err := s.connect()
+	if err != nil {
+		s.retryAt = s.clock.Now().Add(x11RetryInterval)
+		s.lastErr = &x11ConnError{what: "riconnessione", err: err}
+		return s.lastErr
+	}
+	fmt.Println("[WATCHER] Connessione X11 ripristinata")
+	s.display = display
+	return request(s.display)
+}
+
+// GetActiveWindow ritorna il titolo della finestra attualmente attiva
+func (s *x11Source) GetActiveWindow() (string, error) {
+	var title string
+	err := s.usa(func(d x11Display) (err error) {
+		title, err = d.GetActiveWindow()
+		return err
+	})
+	return title, err
+}
+
+// GetActiveProcessName ritorna il nome dell'eseguibile della finestra attiva
+func (s *x11Source) GetActiveProcessName() (string, error) {
+	var name string
+	err := s.usa(func(d x11Display) (err error) {
+		name, err = d.GetActiveProcessName()
+		return err
+	})
+	return name, err
+}
+
+// GetIdleTime restituisce da quanto tempo (in secondi) non c'è input. Senza connessione al
+// server X l'inattività non è rilevabile: come senza backend, vale 0 finché la connessione non torna.
+func (s *x11Source) GetIdleTime() (int, error) {
+	var idle int
+	err := s.usa(func(d x11Display) (err error) {
+		idle, err = d.GetIdleTime()
+		return err
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, lost := err.(*x11ConnError); lost {
+		if !s.idleLost {
+			fmt.Printf("[IDLE] %v: rilevamento idle sospeso fino alla riconnessione\n", err)
+			s.idleLost = true
+		}
+		return 0, nil
+	}
+	if err == nil && s.idleLost {
+		fmt.Println("[IDLE] Connessione X11 ripristinata: rilevamento idle riattivato")
+		s.idleLost = false
+	}
+	return idle, err
+}
+
+// x11Conn è una connessione al server X
+type x11Conn struct {
+	conn           *xgb.Conn
+	root           xproto.Window
+	atomActive     xproto.Atom
+	atomPID        xproto.Atom
+	atomName       xproto.Atom
+	atomUTF8       xproto.Atom
+	hasScreensaver bool
+}
+
+// newX11Conn si connette al display indicato da $DISPLAY
+func newX11Conn() (*x11Conn, error) {
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &x11Conn{
+		conn: conn,
+		root: xproto.Setup(conn).DefaultScreen(conn).Root,
+	}
+
+	atoms := []struct {
+		name string
+		dst  *xproto.Atom
+	}{
+		{"_NET_ACTIVE_WINDOW", &c.atomActive},
+		{"_NET_WM_PID", &c.atomPID},
+		{"_NET_WM_NAME", &c.atomName},
+		{"UTF8_STRING", &c.atomUTF8},
+	}
+
+	for _, a := range atoms {
+		reply, err := xproto.InternAtom(conn, false, uint16(len(a.name)), a.name).Reply()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("errore atom %s: %v", a.name, err)
+		}
+		*a.dst = reply.Atom
+	}
+
+	if err := screensaver.Init(conn); err == nil {
+		c.hasScreensaver = true
+	}
+
+	return c, nil
+}
+
+// Close chiude la connessione
+func (c *x11Conn) Close() {
+	c.conn.Close()
+}
+
+// activeWindow ritorna la finestra attiva secondo il window manager (EWMH)
+func (c *x11Conn) activeWindow() (xproto.Window, error) {
+	prop, err := xproto.GetProperty(c.conn, false, c.root, c.atomActive, xproto.AtomWindow, 0, 1).Reply()
+	if err != nil {
+		return 0, erroreX11("_NET_ACTIVE_WINDOW", err)
+	}
+	if len(prop.Value) < 4 {
+		return 0, fmt.Errorf("nessuna finestra attiva")
+	}
+
+	win := xproto.Window(xgb.Get32(prop.Value))
+	if win == 0 {
+		return 0, fmt.Errorf("nessuna finestra attiva")
+	}
+	return win, nil
+}
+
+// GetActiveWindow ritorna il titolo della finestra attualmente attiva
+func (c *x11Conn) GetActiveWindow() (string, error) {
+	win, err := c.activeWindow()
+	if err != nil {
+		return "", err
+	}
+
+	// Preferisci _NET_WM_NAME (UTF-8), poi WM_NAME
+	prop, err := xproto.GetProperty(c.conn, false, win, c.atomName, c.atomUTF8, 0, 1024).Reply()
+	if err != nil || len(prop.Value) == 0 {
+		prop, err = xproto.GetProperty(c.conn, false, win, xproto.AtomWmName, xproto.AtomString, 0, 1024).Reply()
+		if err != nil {
+			return "", erroreX11("titolo finestra", err)
+		}
+	}
+
+	title := string(prop.Value)
+	if title == "" {
+		return "", fmt.Errorf("finestra senza titolo")
+	}
+
+	return title, nil
+}
+
+// GetActiveProcessName ritorna il nome dell'eseguibile della finestra attiva
+func (c *x11Conn) GetActiveProcessName() (string, error) {
+	win, err := c.activeWindow()
+	if err != nil {
+		return "", err
+	}
+
+	prop, err := xproto.GetProperty(c.conn, false, win, c.atomPID, xproto.AtomCardinal, 0, 1).Reply()
+	if err != nil {
+		return "", erroreX11("_NET_WM_PID", err)
+	}
+	if len(prop.Value) < 4 {
+		return "", fmt.Errorf("impossibile ottenere PID")
+	}
+
+	pid := xgb.Get32(prop.Value)
+	if pid == 0 {
+		return "", fmt.Errorf("impossibile ottenere PID")
+	}
+
+	return processNameFromPID(pid)
+}
+
+// GetIdleTime restituisce da quanto tempo (in secondi) non c'è input, via estensione X screensaver
+func (c *x11Conn) GetIdleTime() (int, error) {
+	if !c.hasScreensaver {
+		return 0, fmt.Errorf("estensione X screensaver non disponibile")
+	}
+
+	info, err := screensaver.QueryInfo(c.conn, xproto.Drawable(c.root)).Reply()
+	if err != nil {
+		return 0, erroreX11("XScreenSaverQueryInfo", err)
+	}
+
+	return int(info.MsSinceUserInput / 1000), nil
+}
+
+// processNameFromPID risolve il nome dell'eseguibile da /proc/<pid>/exe
+func processNameFromPID(pid uint32) (string, error) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err == nil {
+		// Il kernel aggiunge " (deleted)" se il binario è stato sostituito (es. aggiornamento)
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)")), nil
+	}
+
+	// Processi di altri utenti: ripiega sul nome breve del processo
+	comm, commErr := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if commErr != nil {
+		return "", fmt.Errorf("impossibile ottenere path processo: %v", err)
+	}
+
+	return strings.TrimSpace(string(comm)), nil
+}
+
+// logindSource implementa IdleSource tramite l'IdleHint della sessione logind
+type logindSource struct {
+	session dbus.BusObject
+	clock   Clock // orologio con cui misurare l'idle dall'IdleSinceHint
+}
+
+// newLogindSource si collega alla sessione logind del processo corrente
+func newLogindSource() (*logindSource, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &logindSource{
+		session: conn.Object("org.freedesktop.login1", "/org/freedesktop/login1/session/auto"),
+		clock:   currentClock(),
+	}
+
+	// Verifica subito che la proprietà sia leggibile
+	if _, err := s.session.GetProperty("org.freedesktop.login1.Session.IdleHint"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetIdleTime restituisce da quanto tempo (in secondi) la sessione è segnalata come inattiva.
+// logind conosce solo lo stato idle impostato dal desktop environment, quindi il valore
+// resta 0 finché l'ambiente grafico non dichiara la sessione inattiva.
+func (s *logindSource) GetIdleTime() (int, error) {
+	hint, err := s.session.GetProperty("org.freedesktop.login1.Session.IdleHint")
+	if err != nil {
+		return 0, fmt.Errorf("errore lettura IdleHint: %v", err)
+	}
+
+	idle, ok := hint.Value().(bool)
+	if !ok {
+		return 0, fmt.Errorf("IdleHint in formato inatteso: %v", hint)
+	}
+	if !idle {
+		return 0, nil
+	}
+
+	since, err := s.session.GetProperty("org.freedesktop.login1.Session.IdleSinceHint")
+	if err != nil {
+		return 0, fmt.Errorf("errore lettura IdleSinceHint: %v", err)
+	}
+
+	usec, ok := since.Value().(uint64)
+	if !ok || usec == 0 {
+		return 0, nil
+	}
+
+	idleSince := time.UnixMicro(int64(usec))
+	seconds := int(wallSub(s.clock.Now(), idleSince).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+
+	return seconds, nil
+}
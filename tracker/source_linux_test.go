@@ -0,0 +1,152 @@
+package tracker
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/jezek/xgb/xproto"
+)
+
+// fakeSession simula le proprietà di una sessione logind
+type fakeSession struct {
+	dbus.BusObject
+	props map[string]interface{}
+}
+
+// GetProperty restituisce la proprietà simulata
+func (s *fakeSession) GetProperty(p string) (dbus.Variant, error) {
+	value, ok := s.props[p]
+	if !ok {
+		return dbus.Variant{}, fmt.Errorf("proprietà %s non disponibile", p)
+	}
+	return dbus.MakeVariant(value), nil
+}
+
+func TestLogindSourceGetIdleTime(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	session := &fakeSession{props: map[string]interface{}{
+		"org.freedesktop.login1.Session.IdleHint":      false,
+		"org.freedesktop.login1.Session.IdleSinceHint": uint64(start.UnixMicro()),
+	}}
+	source := &logindSource{session: session, clock: clock}
+
+	// Sessione attiva: nessun idle anche se IdleSinceHint è impostato
+	clock.Advance(10 * time.Minute)
+	if got, err := source.GetIdleTime(); err != nil || got != 0 {
+		t.Errorf("GetIdleTime con sessione attiva = %d, %v; atteso 0", got, err)
+	}
+
+	// Sessione inattiva: l'idle si misura con l'orologio della sorgente
+	session.props["org.freedesktop.login1.Session.IdleHint"] = true
+	if got, err := source.GetIdleTime(); err != nil || got != 600 {
+		t.Errorf("GetIdleTime con sessione inattiva = %d, %v; atteso 600", got, err)
+	}
+
+	// IdleSinceHint nel futuro (orologi non allineati): mai un idle negativo
+	session.props["org.freedesktop.login1.Session.IdleSinceHint"] = uint64(start.Add(time.Hour).UnixMicro())
+	if got, err := source.GetIdleTime(); err != nil || got != 0 {
+		t.Errorf("GetIdleTime con IdleSinceHint futuro = %d, %v; atteso 0", got, err)
+	}
+
+	delete(session.props, "org.freedesktop.login1.Session.IdleHint")
+	if _, err := source.GetIdleTime(); err == nil {
+		t.Error("GetIdleTime senza IdleHint: atteso un errore")
+	}
+}
+
+// fakeDisplay simula una connessione al server X
+type fakeDisplay struct {
+	process string
+	idle    int
+	err     error // restituito da ogni richiesta
+	closed  bool
+}
+
+func (d *fakeDisplay) GetActiveProcessName() (string, error) { return d.process, d.err }
+func (d *fakeDisplay) GetActiveWindow() (string, error)      { return d.process + " - titolo", d.err }
+func (d *fakeDisplay) GetIdleTime() (int, error)             { return d.idle, d.err }
+func (d *fakeDisplay) Close()                                { d.closed = true }
+
+func TestX11SourceRiconnessione(t *testing.T) {
+	clock := NewManualClock(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	first := &fakeDisplay{process: "code", idle: 5}
+	var next *fakeDisplay // nil: il server X non è raggiungibile
+	connects := 0
+	source := &x11Source{
+		display: first,
+		connect: func() (x11Display, error) {
+			connects++
+			if next == nil {
+				return nil, fmt.Errorf("impossibile connettersi a :0")
+			}
+			return next, nil
+		},
+		clock:          clock,
+		hasScreensaver: true,
+	}
+	attendi := func(process string, idle int) {
+		t.Helper()
+		if got, err := source.GetActiveProcessName(); err != nil || got != process {
+			t.Errorf("processo = %q (%v), atteso %q", got, err, process)
+		}
+		if got, err := source.GetIdleTime(); err != nil || got != idle {
+			t.Errorf("idle = %d (%v), atteso %d", got, err, idle)
+		}
+	}
+	attendi("code", 5)
+
+	// Un errore del protocollo (es. finestra chiusa) non fa riconnettere
+	first.err = fmt.Errorf("BadWindow")
+	if _, err := source.GetActiveProcessName(); err == nil || connects != 0 || first.closed {
+		t.Errorf("errore del protocollo: %v, connessioni %d, chiusa %v", err, connects, first.closed)
+	}
+
+	// Connessione persa con il server non raggiungibile: le richieste falliscono e l'idle vale 0
+	first.err = &x11ConnError{what: "_NET_ACTIVE_WINDOW", err: io.EOF}
+	if _, err := source.GetActiveProcessName(); err == nil {
+		t.Error("processo letto senza connessione")
+	}
+	if !first.closed || connects != 1 {
+		t.Errorf("dopo la perdita: chiusa %v, connessioni %d; attese chiusura e un tentativo", first.closed, connects)
+	}
+	if got, err := source.GetIdleTime(); err != nil || got != 0 {
+		t.Errorf("idle senza connessione = %d (%v), atteso 0 senza errore", got, err)
+	}
+	if connects != 1 {
+		t.Errorf("tentativi di connessione prima dell'intervallo = %d, atteso 1", connects)
+	}
+
+	// Il server torna raggiungibile, ma si riprova solo dopo l'intervallo
+	next = &fakeDisplay{process: "firefox", idle: 12}
+	clock.Advance(x11RetryInterval - time.Second)
+	if _, err := source.GetActiveProcessName(); err == nil || connects != 1 {
+		t.Errorf("riconnessione prima dell'intervallo: %v, connessioni %d", err, connects)
+	}
+	clock.Advance(time.Second)
+	attendi("firefox", 12)
+	if connects != 2 {
+		t.Errorf("connessioni = %d, attese 2", connects)
+	}
+
+	// Se il server è raggiungibile la riconnessione è immediata e la richiesta ripetuta
+	second := next
+	next = &fakeDisplay{process: "gimp", idle: 1}
+	second.err = &x11ConnError{what: "XScreenSaverQueryInfo", err: io.EOF}
+	attendi("gimp", 1)
+	if !second.closed || connects != 3 {
+		t.Errorf("riconnessione immediata: chiusa %v, connessioni %d", second.closed, connects)
+	}
+}
+
+func TestErroreX11(t *testing.T) {
+	if _, lost := erroreX11("_NET_WM_PID", io.EOF).(*x11ConnError); !lost {
+		t.Error("connessione chiusa non riconosciuta come persa")
+	}
+	if _, lost := erroreX11("_NET_WM_PID", xproto.WindowError{}).(*x11ConnError); lost {
+		t.Error("errore del protocollo riconosciuto come connessione persa")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows && !linux
+
+package tracker
+
+// defaultSources restituisce le sorgenti della piattaforma corrente
+func defaultSources() (ActivitySource, IdleSource) {
+	return unsupportedSource{}, unsupportedSource{}
+}
@@ -0,0 +1,140 @@
+//go:build windows
+
+package tracker
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	PROCESS_QUERY_INFORMATION = 0x0400
+	PROCESS_VM_READ           = 0x0010
+)
+
+var (
+	user32                       = syscall.NewLazyDLL("user32.dll")
+	procGetForegroundWin         = user32.NewProc("GetForegroundWindow")
+	procGetWindowText            = user32.NewProc("GetWindowTextW")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procGetLastInputInfo         = user32.NewProc("GetLastInputInfo")
+
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procGetTickCount = kernel32.NewProc("GetTickCount")
+
+	psapi                       = syscall.NewLazyDLL("psapi.dll")
+	procGetProcessImageFileName = psapi.NewProc("GetProcessImageFileNameW")
+)
+
+// LASTINPUTINFO struct per GetLastInputInfo
+type LASTINPUTINFO struct {
+	CbSize uint32
+	DwTime uint32
+}
+
+// win32Source implementa ActivitySource e IdleSource tramite le API Win32
+type win32Source struct{}
+
+// defaultSources restituisce le sorgenti della piattaforma corrente
+func defaultSources() (ActivitySource, IdleSource) {
+	return win32Source{}, win32Source{}
+}
+
+// GetActiveWindow ritorna il titolo della finestra attualmente attiva
+func (win32Source) GetActiveWindow() (string, error) {
+	// Ottieni handle della finestra attiva
+	hwnd, _, _ := procGetForegroundWin.Call()
+	if hwnd == 0 {
+		return "", fmt.Errorf("nessuna finestra attiva")
+	}
+
+	// Buffer per il titolo (max 256 caratteri)
+	buf := make([]uint16, 256)
+
+	// Ottieni il titolo della finestra
+	procGetWindowText.Call(
+		hwnd,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+	)
+
+	// Converti da UTF-16 a string
+	title := syscall.UTF16ToString(buf)
+
+	if title == "" {
+		return "", fmt.Errorf("finestra senza titolo")
+	}
+
+	return title, nil
+}
+
+// GetActiveProcessName ritorna il nome del processo attivo
+func (win32Source) GetActiveProcessName() (string, error) {
+	// Ottieni handle della finestra attiva
+	hwnd, _, _ := procGetForegroundWin.Call()
+	if hwnd == 0 {
+		return "", fmt.Errorf("nessuna finestra attiva")
+	}
+
+	// Ottieni Process ID dalla finestra
+	var pid uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+
+	if pid == 0 {
+		return "", fmt.Errorf("impossibile ottenere PID")
+	}
+
+	// Apri il processo
+	handle, err := syscall.OpenProcess(PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, false, pid)
+	if err != nil {
+		return "", fmt.Errorf("impossibile aprire processo: %v", err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	// Buffer per il path
+	buf := make([]uint16, 260)
+	size := uint32(len(buf))
+
+	// Ottieni il path completo dell'exe
+	ret, _, _ := procGetProcessImageFileName.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(size),
+	)
+
+	if ret == 0 {
+		return "", fmt.Errorf("impossibile ottenere path processo")
+	}
+
+	// Converti il path
+	fullPath := syscall.UTF16ToString(buf)
+
+	// Estrai solo il nome del file (es. "Code.exe" da "C:\...\Code.exe")
+	processName := extractFileName(fullPath)
+
+	return processName, nil
+}
+
+// GetIdleTime restituisce da quanto tempo (in secondi) il PC è idle
+func (win32Source) GetIdleTime() (int, error) {
+	var lastInputInfo LASTINPUTINFO
+	lastInputInfo.CbSize = uint32(unsafe.Sizeof(lastInputInfo))
+
+	// Chiama GetLastInputInfo
+	ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&lastInputInfo)))
+	if ret == 0 {
+		return 0, fmt.Errorf("errore GetLastInputInfo: %v", err)
+	}
+
+	// Ottieni il tick count corrente (millisecondi da avvio sistema)
+	currentTick, _, _ := procGetTickCount.Call()
+
+	// Calcola la differenza in millisecondi
+	idleMillis := uint32(currentTick) - lastInputInfo.DwTime
+
+	// Converti in secondi
+	idleSeconds := int(idleMillis / 1000)
+
+	return idleSeconds, nil
+}
@@ -0,0 +1,275 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// === TIMESHEET XLSX ===
+
+var nomiMesi = [...]string{"Gennaio", "Febbraio", "Marzo", "Aprile", "Maggio", "Giugno",
+	"Luglio", "Agosto", "Settembre", "Ottobre", "Novembre", "Dicembre"}
+
+var nomiGiorni = [...]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"}
+
+// nessunTipoAttivita è la colonna del riepilogo per le sessioni senza tipo di attività
+const nessunTipoAttivita = "Nessun tipo"
+
+// timesheet raccoglie le ore del periodo per giorno e progetto e per progetto e tipo di attività
+type timesheet struct {
+	days       map[string]map[string]float64 // giorno locale ("2006-01-02") -> progetto -> ore
+	activities map[string]map[string]float64 // progetto -> tipo di attività -> ore
+	types      map[string]bool
+}
+
+// aggiungi somma le ore di una sessione a un giorno
+func (t *timesheet) aggiungi(day, project, activityType string, hours float64) {
+	if t.days[day] == nil {
+		t.days[day] = make(map[string]float64)
+	}
+	t.days[day][project] += hours
+	if t.activities[project] == nil {
+		t.activities[project] = make(map[string]float64)
+	}
+	t.activities[project][activityType] += hours
+	t.types[activityType] = true
+}
+
+// EsportaTimesheetXLSX scrive in w una cartella di lavoro Excel con le ore dal giorno startDate
+// al giorno endDate inclusi ("2006-01-02"): un foglio di riepilogo con le ore per progetto e tipo
+// di attività e un foglio per mese, con i giorni sulle righe e i progetti sulle colonne.
+// Una sessione a cavallo della mezzanotte è divisa tra i giorni in proporzione alla durata.
+func EsportaTimesheetXLSX(db *sql.DB, w io.Writer, startDate, endDate string) error {
+	loc := TimeZone()
+	first, err := time.ParseInLocation("2006-01-02", startDate, loc)
+	if err != nil {
+		return fmt.Errorf("data di inizio non valida '%s': %v", startDate, err)
+	}
+	last, err := time.ParseInLocation("2006-01-02", endDate, loc)
+	if err != nil {
+		return fmt.Errorf("data di fine non valida '%s': %v", endDate, err)
+	}
+	if last.Before(first) {
+		return fmt.Errorf("la data di fine precede quella di inizio")
+	}
+
+	sessions, err := CaricaSessioniDettagliate(db, startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	ts := &timesheet{
+		days:       make(map[string]map[string]float64),
+		activities: make(map[string]map[string]float64),
+		types:      make(map[string]bool),
+	}
+	for _, s := range sessions {
+		if err := ripartisciSessione(ts, s, startDate, endDate); err != nil {
+			return err
+		}
+	}
+
+	sheets := []xlsxSheet{foglioRiepilogo(ts, first, last)}
+	for month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, loc); !month.After(last); month = month.AddDate(0, 1, 0) {
+		sheets = append(sheets, foglioMese(ts, month, first, last))
+	}
+
+	if err := scriviXLSX(w, sheets); err != nil {
+		return err
+	}
+	fmt.Printf("[DB] Timesheet esportato: %d sessioni, %d fogli mensili (%s - %s)\n", len(sessions), len(sheets)-1, startDate, endDate)
+	return nil
+}
+
+// ripartisciSessione divide le ore di una sessione tra i giorni locali che attraversa, in
+// proporzione all'intervallo reale, tenendo solo quelli del periodo
+func ripartisciSessione(ts *timesheet, s SessionDetail, startDate, endDate string) error {
+	start, err := parseTimestamp(s.Timestamp)
+	if err != nil {
+		return fmt.Errorf("errore lettura inizio sessione %d: %v", s.ID, err)
+	}
+	end := start.Add(time.Duration(s.Seconds) * time.Second)
+	if s.EndedAt != "" {
+		if end, err = parseTimestamp(s.EndedAt); err != nil {
+			return fmt.Errorf("errore lettura fine sessione %d: %v", s.ID, err)
+		}
+	}
+
+	activityType := nessunTipoAttivita
+	if s.ActivityType != nil {
+		activityType = *s.ActivityType
+	}
+	hours := float64(s.Seconds) / 3600
+
+	if !end.After(start) {
+		if day := giornoLocale(start).Format("2006-01-02"); day >= startDate && day <= endDate {
+			ts.aggiungi(day, s.ProjectName, activityType, hours)
+		}
+		return nil
+	}
+
+	total := end.Sub(start)
+	for current := start; current.Before(end); {
+		day := giornoLocale(current)
+		next := day.AddDate(0, 0, 1)
+		if next.After(end) {
+			next = end
+		}
+		if key := day.Format("2006-01-02"); key >= startDate && key <= endDate {
+			ts.aggiungi(key, s.ProjectName, activityType, hours*float64(next.Sub(current))/float64(total))
+		}
+		current = next
+	}
+	return nil
+}
+
+// chiaviOrdinate restituisce le chiavi in ordine alfabetico, con last (se presente) in fondo
+func chiaviOrdinate(set map[string]bool, last string) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		if key != last {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if set[last] {
+		keys = append(keys, last)
+	}
+	return keys
+}
+
+// intestazioneTimesheet restituisce titolo e riga vuota che precedono l'intestazione dei fogli
+func intestazioneTimesheet(title string) [][]xlsxCell {
+	return [][]xlsxCell{{{Value: title, Style: xlsxStyleHeader}}, nil}
+}
+
+// foglioRiepilogo genera il foglio con le ore per progetto (righe) e tipo di attività (colonne)
+func foglioRiepilogo(ts *timesheet, first, last time.Time) xlsxSheet {
+	projectSet := make(map[string]bool)
+	for project := range ts.activities {
+		projectSet[project] = true
+	}
+	projects := chiaviOrdinate(projectSet, "Nessun progetto")
+	types := chiaviOrdinate(ts.types, nessunTipoAttivita)
+
+	title := fmt.Sprintf("Ore per progetto e tipo di attività dal %s al %s", first.Format("02/01/2006"), last.Format("02/01/2006"))
+	rows := intestazioneTimesheet(title)
+	headerRow := len(rows)
+
+	header := []xlsxCell{{Value: "Progetto", Style: xlsxStyleHeader}}
+	for _, t := range types {
+		header = append(header, xlsxCell{Value: t, Style: xlsxStyleHeader})
+	}
+	header = append(header, xlsxCell{Value: "Totale", Style: xlsxStyleHeader})
+	rows = append(rows, header)
+
+	columnTotals := make([]float64, len(types)+1)
+	for _, project := range projects {
+		r := len(rows)
+		row := []xlsxCell{{Value: project}}
+		rowTotal := 0.0
+		for i, t := range types {
+			hours, ok := ts.activities[project][t]
+			if !ok {
+				row = append(row, xlsxCell{})
+				continue
+			}
+			row = append(row, xlsxCell{Value: hours, Style: xlsxStyleHours})
+			rowTotal += hours
+			columnTotals[i] += hours
+		}
+		columnTotals[len(types)] += rowTotal
+		row = append(row, cellaSomma(1, r, len(types), r, rowTotal, xlsxStyleHoursBold))
+		rows = append(rows, row)
+	}
+	rows = append(rows, rigaTotali(headerRow+1, len(rows)-1, 1, columnTotals))
+
+	widths := []float64{30}
+	for range types {
+		widths = append(widths, 15)
+	}
+	return xlsxSheet{Name: "Riepilogo", Rows: rows, Widths: append(widths, 12), FrozenRows: headerRow + 1}
+}
+
+// foglioMese genera il foglio di un mese: un giorno per riga (solo quelli del periodo), un
+// progetto per colonna e i totali per giorno e per progetto
+func foglioMese(ts *timesheet, month, first, last time.Time) xlsxSheet {
+	var days []time.Time
+	for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+		if !day.Before(first) && !day.After(last) {
+			days = append(days, day)
+		}
+	}
+
+	projectSet := make(map[string]bool)
+	for _, day := range days {
+		for project := range ts.days[day.Format("2006-01-02")] {
+			projectSet[project] = true
+		}
+	}
+	projects := chiaviOrdinate(projectSet, "Nessun progetto")
+
+	name := fmt.Sprintf("%s %d", nomiMesi[month.Month()-1], month.Year())
+	rows := intestazioneTimesheet(name)
+	headerRow := len(rows)
+
+	header := []xlsxCell{{Value: "Data", Style: xlsxStyleHeader}, {Value: "Giorno", Style: xlsxStyleHeader}}
+	for _, project := range projects {
+		header = append(header, xlsxCell{Value: project, Style: xlsxStyleHeader})
+	}
+	header = append(header, xlsxCell{Value: "Totale", Style: xlsxStyleHeader})
+	rows = append(rows, header)
+
+	columnTotals := make([]float64, len(projects)+1)
+	for _, day := range days {
+		r := len(rows)
+		hoursByProject := ts.days[day.Format("2006-01-02")]
+		row := []xlsxCell{{Value: day, Style: xlsxStyleDate}, {Value: nomiGiorni[day.Weekday()]}}
+		dayTotal := 0.0
+		for i, project := range projects {
+			hours, ok := hoursByProject[project]
+			if !ok {
+				row = append(row, xlsxCell{})
+				continue
+			}
+			row = append(row, xlsxCell{Value: hours, Style: xlsxStyleHours})
+			dayTotal += hours
+			columnTotals[i] += hours
+		}
+		columnTotals[len(projects)] += dayTotal
+		row = append(row, cellaSomma(2, r, len(projects)+1, r, dayTotal, xlsxStyleHoursBold))
+		rows = append(rows, row)
+	}
+	rows = append(rows, rigaTotali(headerRow+1, len(rows)-1, 2, columnTotals))
+
+	widths := []float64{12, 8}
+	for range projects {
+		widths = append(widths, 18)
+	}
+	return xlsxSheet{Name: name, Rows: rows, Widths: append(widths, 12), FrozenRows: headerRow + 1}
+}
+
+// cellaSomma restituisce una cella con la formula SUM dell'intervallo (colonne e righe da 0,
+// estremi inclusi) e il risultato già calcolato; un intervallo vuoto vale 0
+func cellaSomma(fromCol, fromRow, toCol, toRow int, value float64, style int) xlsxCell {
+	if toCol < fromCol || toRow < fromRow {
+		return xlsxCell{Value: 0.0, Style: style}
+	}
+	formula := fmt.Sprintf("SUM(%s:%s)", cellaXLSX(fromCol, fromRow), cellaXLSX(toCol, toRow))
+	return xlsxCell{Value: value, Formula: formula, Style: style}
+}
+
+// rigaTotali genera la riga "Totale" con la somma delle righe da fromRow a toRow per ogni
+// colonna, a partire da firstCol
+func rigaTotali(fromRow, toRow, firstCol int, totals []float64) []xlsxCell {
+	row := make([]xlsxCell, firstCol-1, firstCol+len(totals))
+	row = append(row, xlsxCell{Value: "Totale", Style: xlsxStyleHeader})
+	for i, total := range totals {
+		col := firstCol + i
+		row = append(row, cellaSomma(col, fromRow, col, toRow, total, xlsxStyleHoursBold))
+	}
+	return row
+}
@@ -0,0 +1,279 @@
+package tracker
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRipartisciSessione(t *testing.T) {
+	t.Cleanup(func() { SetTimeZone("") })
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	rome := TimeZone()
+	at := func(month time.Month, d, h, m int) time.Time { return time.Date(2026, month, d, h, m, 0, 0, rome) }
+	progettazione := "PROGETTAZIONE"
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		seconds    int  // 0 = durata reale dell'intervallo
+		running    bool // in corso: senza ended_at, la fine è inizio più secondi
+		from, to   string
+		want       map[string]float64 // giorno -> ore
+	}{
+		{"nello stesso giorno", at(3, 2, 9, 0), at(3, 2, 10, 30), 0, false, "2026-03-02", "2026-03-02",
+			map[string]float64{"2026-03-02": 1.5}},
+		{"a cavallo della mezzanotte", at(3, 1, 23, 0), at(3, 2, 1, 0), 0, false, "2026-03-01", "2026-03-02",
+			map[string]float64{"2026-03-01": 1, "2026-03-02": 1}},
+		{"ore attive ripartite in proporzione", at(3, 1, 23, 0), at(3, 2, 1, 0), 3600, false, "2026-03-01", "2026-03-02",
+			map[string]float64{"2026-03-01": 0.5, "2026-03-02": 0.5}},
+		{"solo i giorni del periodo", at(3, 1, 23, 0), at(3, 2, 1, 0), 0, false, "2026-03-02", "2026-03-02",
+			map[string]float64{"2026-03-02": 1}},
+		{"in corso", at(3, 1, 23, 30), time.Time{}, 3600, true, "2026-03-01", "2026-03-02",
+			map[string]float64{"2026-03-01": 0.5, "2026-03-02": 0.5}},
+		{"senza durata", at(3, 2, 9, 0), time.Time{}, 0, true, "2026-03-02", "2026-03-02",
+			map[string]float64{"2026-03-02": 0}},
+		// Il 29 marzo 2026 alle 2:00 si passa all'ora legale: dalla mezzanotte alle 3:30 passano 2,5 ore
+		{"passaggio all'ora legale", at(3, 28, 23, 0), at(3, 29, 3, 30), 0, false, "2026-03-28", "2026-03-29",
+			map[string]float64{"2026-03-28": 1, "2026-03-29": 2.5}},
+		// Il 25 ottobre 2026 alle 3:00 si torna all'ora solare: il giorno dura 25 ore
+		{"ritorno all'ora solare", at(10, 24, 23, 0), at(10, 26, 1, 0), 0, false, "2026-10-24", "2026-10-26",
+			map[string]float64{"2026-10-24": 1, "2026-10-25": 25, "2026-10-26": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seconds := tt.seconds
+			if seconds == 0 && !tt.end.IsZero() {
+				seconds = int(tt.end.Sub(tt.start).Seconds())
+			}
+			s := SessionDetail{ID: 1, Seconds: seconds, ProjectName: "Cliente", ActivityType: &progettazione, Timestamp: FormatTimestamp(tt.start)}
+			if !tt.running {
+				s.EndedAt = FormatTimestamp(tt.end)
+			}
+
+			ts := &timesheet{
+				days:       make(map[string]map[string]float64),
+				activities: make(map[string]map[string]float64),
+				types:      make(map[string]bool),
+			}
+			if err := ripartisciSessione(ts, s, tt.from, tt.to); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]float64)
+			total := 0.0
+			for day, projects := range ts.days {
+				got[day] = projects["Cliente"]
+				total += projects["Cliente"]
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ore per giorno = %v, attese %v", got, tt.want)
+			}
+			for day, hours := range tt.want {
+				if math.Abs(got[day]-hours) > 1e-9 {
+					t.Errorf("ore del %s = %v, attese %v", day, got[day], hours)
+				}
+			}
+			if activity := ts.activities["Cliente"][progettazione]; math.Abs(activity-total) > 1e-9 {
+				t.Errorf("ore per tipo di attività = %v, attese %v", activity, total)
+			}
+		})
+	}
+}
+
+// foglioXML è il contenuto di xl/worksheets/sheetN.xml letto dal test
+type foglioXML struct {
+	Rows []struct {
+		Cells []struct {
+			Ref     string `xml:"r,attr"`
+			Value   string `xml:"v"`
+			Formula string `xml:"f"`
+			Text    string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// leggiXLSX verifica che la cartella di lavoro sia uno zip con parti XML ben formate e
+// restituisce i nomi dei fogli e, per ogni foglio, il valore (o la formula) di ogni cella
+func leggiXLSX(t *testing.T, data []byte) ([]string, []map[string]string) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("XLSX non è uno zip valido: %v", err)
+	}
+
+	parts := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s non è XML ben formato: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = content
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if parts[name] == nil {
+			t.Fatalf("parte %s mancante", name)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &workbook); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var sheets []map[string]string
+	for i, sheet := range workbook.Sheets {
+		names = append(names, sheet.Name)
+		content := parts["xl/worksheets/sheet"+strconv.Itoa(i+1)+".xml"]
+		if content == nil {
+			t.Fatalf("foglio %d (%s) mancante", i+1, sheet.Name)
+		}
+		var parsed foglioXML
+		if err := xml.Unmarshal(content, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		cells := make(map[string]string)
+		for _, row := range parsed.Rows {
+			for _, c := range row.Cells {
+				switch {
+				case c.Formula != "":
+					cells[c.Ref] = "=" + c.Formula + " " + c.Value
+				case c.Text != "":
+					cells[c.Ref] = c.Text
+				default:
+					cells[c.Ref] = c.Value
+				}
+			}
+		}
+		sheets = append(sheets, cells)
+	}
+	return names, sheets
+}
+
+func TestEsportaTimesheetXLSXPiuMesi(t *testing.T) {
+	t.Cleanup(func() { SetTimeZone("") })
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	db := apriDBTest(t)
+	projectID, err := CreaProgetto(db, "Cliente & Co", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(month time.Month, d, h int) time.Time { return time.Date(2026, month, d, h, 0, 0, 0, TimeZone()) }
+	sessions := []struct {
+		start    time.Time
+		hours    int
+		activity interface{}
+	}{
+		{at(1, 31, 23), 2, nil}, // a cavallo tra gennaio e febbraio
+		{at(3, 2, 9), 2, "PROGETTAZIONE"},
+		{at(3, 3, 9), 1, "PROGETTAZIONE"}, // fuori dal periodo
+	}
+	for _, s := range sessions {
+		_, err := db.Exec(`INSERT INTO sessions (app_name, seconds, project_id, activity_type_id, timestamp, ended_at)
+			VALUES ('Code.exe', ?, ?, (SELECT id FROM activity_types WHERE name = ?), ?, ?)`,
+			s.hours*3600, projectID, s.activity, FormatTimestamp(s.start), FormatTimestamp(s.start.Add(time.Duration(s.hours)*time.Hour)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EsportaTimesheetXLSX(db, &buf, "2026-01-30", "2026-03-02"); err != nil {
+		t.Fatal(err)
+	}
+	names, sheets := leggiXLSX(t, buf.Bytes())
+
+	wantNames := []string{"Riepilogo", "Gennaio 2026", "Febbraio 2026", "Marzo 2026"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("fogli = %q, attesi %q", names, wantNames)
+	}
+
+	serial := func(month time.Month, d int) string {
+		return strconv.FormatFloat(dataSerialeXLSX(time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)), 'f', -1, 64)
+	}
+	want := []map[string]string{
+		{
+			"A1": "Ore per progetto e tipo di attività dal 30/01/2026 al 02/03/2026",
+			"A3": "Progetto", "B3": "PROGETTAZIONE", "C3": nessunTipoAttivita, "D3": "Totale",
+			"A4": "Cliente & Co", "B4": "2", "C4": "2", "D4": "=SUM(B4:C4) 4",
+			"A5": "Totale", "B5": "=SUM(B4:B4) 2", "C5": "=SUM(C4:C4) 2", "D5": "=SUM(D4:D4) 4",
+		},
+		{
+			"A1": "Gennaio 2026", "A3": "Data", "B3": "Giorno", "C3": "Cliente & Co", "D3": "Totale",
+			"A4": serial(1, 30), "B4": "ven", "D4": "=SUM(C4:C4) 0",
+			"A5": serial(1, 31), "B5": "sab", "C5": "1", "D5": "=SUM(C5:C5) 1",
+			"B6": "Totale", "C6": "=SUM(C4:C5) 1", "D6": "=SUM(D4:D5) 1",
+		},
+		{
+			"A1": "Febbraio 2026", "C3": "Cliente & Co",
+			"A4": serial(2, 1), "B4": "dom", "C4": "1",
+			"A31": serial(2, 28), "B31": "sab",
+			"B32": "Totale", "C32": "=SUM(C4:C31) 1", "D32": "=SUM(D4:D31) 1",
+		},
+		{
+			"A1": "Marzo 2026", "C3": "Cliente & Co",
+			"A4": serial(3, 1), "A5": serial(3, 2), "B5": "lun", "C5": "2",
+			"B6": "Totale", "C6": "=SUM(C4:C5) 2", "D6": "=SUM(D4:D5) 2",
+		},
+	}
+	for i, cells := range want {
+		for ref, value := range cells {
+			if got := sheets[i][ref]; got != value {
+				t.Errorf("%s!%s = %q, atteso %q", names[i], ref, got, value)
+			}
+		}
+	}
+	if _, ok := sheets[3]["A6"]; ok {
+		t.Errorf("%s: giorni oltre la fine del periodo: %q", names[3], sheets[3]["A6"])
+	}
+	if _, ok := sheets[1]["A7"]; ok {
+		t.Errorf("%s: righe oltre il totale: %q", names[1], sheets[1]["A7"])
+	}
+}
+
+func TestEsportaTimesheetXLSXDateNonValide(t *testing.T) {
+	db := apriDBTest(t)
+	tests := []struct{ from, to string }{
+		{"2026-13-01", "2026-12-31"},
+		{"2026-01-01", "31/12/2026"},
+		{"2026-03-02", "2026-03-01"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := EsportaTimesheetXLSX(db, &buf, tt.from, tt.to); err == nil {
+			t.Errorf("periodo %s - %s accettato", tt.from, tt.to)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("periodo %s - %s: scritti %d byte", tt.from, tt.to, buf.Len())
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package tracker
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// timeZoneSettingKey è la chiave in settings del fuso orario configurato (nome IANA)
+const timeZoneSettingKey = "time_zone"
+
+// timestampLayout è il formato dei timestamp salvati nel database: RFC3339 in UTC
+const timestampLayout = "2006-01-02T15:04:05Z"
+
+// localLayout è il formato dei timestamp in ora locale scambiati con l'interfaccia
+const localLayout = "2006-01-02 15:04:05"
+
+// sqlTimestamp è il formato strftime equivalente a timestampLayout, per i calcoli in SQL
+const sqlTimestamp = `'%Y-%m-%dT%H:%M:%SZ'`
+
+// fuso orario configurato: giorni, settimane e mesi si calcolano in questo fuso
+var (
+	zone     = time.Local
+	zoneName = ""
+	zoneMu   sync.RWMutex
+)
+
+func init() {
+	// Senza database IANA disponibile resta il fuso locale di sistema
+	SetTimeZone("")
+}
+
+// systemTimeZoneName restituisce il nome IANA del fuso di sistema (quello di time.Local),
+// o una stringa vuota se non è possibile ricavarlo
+func systemTimeZoneName() string {
+	if name := os.Getenv("TZ"); name != "" {
+		if _, err := time.LoadLocation(name); err == nil {
+			return name
+		}
+	}
+	if name := platformTimeZoneName(); name != "" {
+		if _, err := time.LoadLocation(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// SetTimeZone imposta il fuso orario del pacchetto (nome IANA, es. "Europe/Rome").
+// Una stringa vuota ripristina il fuso di sistema; se il suo nome IANA non è noto si usa
+// time.Local e le sessioni vengono registrate senza fuso.
+func SetTimeZone(name string) error {
+	if name == "" {
+		name = systemTimeZoneName()
+	}
+	if name == "" {
+		zoneMu.Lock()
+		defer zoneMu.Unlock()
+		zone = time.Local
+		zoneName = ""
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("fuso orario non valido '%s': %v", name, err)
+	}
+
+	zoneMu.Lock()
+	defer zoneMu.Unlock()
+	zone = loc
+	zoneName = name
+	return nil
+}
+
+// TimeZone restituisce il fuso orario configurato
+func TimeZone() *time.Location {
+	zoneMu.RLock()
+	defer zoneMu.RUnlock()
+	return zone
+}
+
+// TimeZoneName restituisce il nome IANA del fuso orario configurato, vuoto se è il fuso di
+// sistema e il suo nome non è noto
+func TimeZoneName() string {
+	zoneMu.RLock()
+	defer zoneMu.RUnlock()
+	return zoneName
+}
+
+// CaricaFusoOrario applica il fuso orario salvato nelle impostazioni
+func CaricaFusoOrario(db *sql.DB) error {
+	name, err := GetSetting(db, timeZoneSettingKey)
+	if err != nil {
+		return err
+	}
+	return SetTimeZone(name)
+}
+
+// SalvaFusoOrario valida, salva e applica il fuso orario (vuoto = fuso di sistema)
+func SalvaFusoOrario(db *sql.DB, name string) error {
+	if err := SetTimeZone(name); err != nil {
+		return err
+	}
+	return SetSetting(db, timeZoneSettingKey, name)
+}
+
+// FormatTimestamp formatta un istante per il database (UTC RFC3339)
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// FormatLocal formatta un istante in ora locale del fuso configurato ("2006-01-02 15:04:05")
+func FormatLocal(t time.Time) string {
+	return t.In(TimeZone()).Format(localLayout)
+}
+
+// ToLocal converte un timestamp del database in ora locale del fuso configurato.
+// Restituisce il valore invariato se non è un timestamp riconosciuto.
+func ToLocal(timestamp string) string {
+	if timestamp == "" {
+		return ""
+	}
+	t, err := parseTimestamp(timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return FormatLocal(t)
+}
+
+// NormalizzaTimestamp converte un timestamp (RFC3339 o in ora locale del fuso configurato)
+// nel formato del database
+func NormalizzaTimestamp(timestamp string) (string, error) {
+	t, err := parseTimestamp(timestamp)
+	if err != nil {
+		return "", err
+	}
+	return FormatTimestamp(t), nil
+}
+
+// giornoLocale restituisce la mezzanotte locale del giorno di t nel fuso configurato
+func giornoLocale(t time.Time) time.Time {
+	t = t.In(TimeZone())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// intervalloGiorni restituisce gli estremi UTC [inizio, fine) dei giorni locali da startDate
+// a endDate inclusi ("2006-01-02"), calcolati nel fuso configurato: con l'ora legale un
+// giorno può durare 23 o 25 ore
+func intervalloGiorni(startDate, endDate string) (string, string, error) {
+	loc := TimeZone()
+	start, err := time.ParseInLocation("2006-01-02", startDate, loc)
+	if err != nil {
+		return "", "", fmt.Errorf("data di inizio non valida '%s': %v", startDate, err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", endDate, loc)
+	if err != nil {
+		return "", "", fmt.Errorf("data di fine non valida '%s': %v", endDate, err)
+	}
+	return FormatTimestamp(start), FormatTimestamp(end.AddDate(0, 0, 1)), nil
+}
+
+// intervalloOggi restituisce gli estremi UTC [inizio, fine) del giorno locale corrente
+func intervalloOggi() (string, string) {
+	today := giornoLocale(now())
+	return FormatTimestamp(today), FormatTimestamp(today.AddDate(0, 0, 1))
+}
+
+// intervalloSettimana restituisce gli estremi UTC [inizio, fine) della settimana corrente,
+// dalla domenica precedente (o dalla domenica di una settimana fa, se oggi è domenica)
+func intervalloSettimana() (string, string) {
+	today := giornoLocale(now())
+	nextSunday := today.AddDate(0, 0, (7-int(today.Weekday()))%7)
+	return FormatTimestamp(nextSunday.AddDate(0, 0, -7)), FormatTimestamp(today.AddDate(0, 0, 1))
+}
+
+// intervalloMese restituisce gli estremi UTC [inizio, fine) del mese locale corrente
+func intervalloMese() (string, string) {
+	today := giornoLocale(now())
+	first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	return FormatTimestamp(first), FormatTimestamp(first.AddDate(0, 1, 0))
+}
+
+// NormalizzaTimestampEsportato converte un timestamp letto da un export nel formato del database.
+// Dalla versione 1.1 gli export sono in UTC RFC3339; nei precedenti (legacy) i timestamp sono
+// in ora locale anche quando terminano con "Z".
+func NormalizzaTimestampEsportato(timestamp string, legacy bool) (string, error) {
+	if !legacy {
+		return NormalizzaTimestamp(timestamp)
+	}
+	t, ok := parseLegacyTimestamp(timestamp, TimeZone())
+	if !ok {
+		return "", fmt.Errorf("formato timestamp non riconosciuto: %s", timestamp)
+	}
+	return FormatTimestamp(t), nil
+}
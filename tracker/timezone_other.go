@@ -0,0 +1,23 @@
+//go:build !windows
+
+package tracker
+
+import (
+	"os"
+	"strings"
+)
+
+// platformTimeZoneName ricava il nome IANA del fuso di sistema da /etc/localtime, che su Linux
+// e macOS è un collegamento al file del fuso (es. /usr/share/zoneinfo/Europe/Rome), o
+// da /etc/timezone
+func platformTimeZoneName() string {
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.LastIndex(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return ""
+}
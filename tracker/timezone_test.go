@@ -0,0 +1,73 @@
+package tracker
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestWindowsTimeZonesNomiIANA(t *testing.T) {
+	for windows, iana := range windowsTimeZones {
+		if _, err := time.LoadLocation(iana); err != nil {
+			t.Errorf("%q -> %q: %v", windows, iana, err)
+		}
+	}
+}
+
+func TestSetTimeZoneSistema(t *testing.T) {
+	t.Cleanup(func() { SetTimeZone("") })
+
+	t.Setenv("TZ", "America/New_York")
+	if err := SetTimeZone(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := TimeZoneName(); got != "America/New_York" {
+		t.Errorf("TimeZoneName() = %q, want America/New_York", got)
+	}
+}
+
+func TestSetTimeZoneSistemaSenzaNome(t *testing.T) {
+	t.Cleanup(func() { SetTimeZone("") })
+	t.Setenv("TZ", "Inesistente/Fuso")
+	if systemTimeZoneName() != "" {
+		t.Skip("il nome del fuso di sistema è noto")
+	}
+
+	// Senza nome noto resta time.Local, senza ricadere su un fuso predefinito
+	if err := SetTimeZone("Europe/Rome"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTimeZone(""); err != nil {
+		t.Fatal(err)
+	}
+	if TimeZone() != time.Local || TimeZoneName() != "" {
+		t.Errorf("fuso = %v %q, want Local senza nome", TimeZone(), TimeZoneName())
+	}
+}
+
+func TestMigrateTimestampsUTCFusoDiSistema(t *testing.T) {
+	db, conn := apriDBVersione(t, 8)
+
+	if _, err := db.Exec(`INSERT INTO sessions (app_name, seconds, activity_type, timestamp) VALUES ('Code.exe', 60, 'RICERCA', '2026-03-02 09:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyMigration(conn, migrations[8]); err != nil {
+		t.Fatal(err)
+	}
+
+	var timestamp string
+	var timeZone sql.NullString
+	if err := db.QueryRow(`SELECT CAST(timestamp AS TEXT), time_zone FROM sessions`).Scan(&timestamp, &timeZone); err != nil {
+		t.Fatal(err)
+	}
+
+	// Conversione ed etichetta usano lo stesso fuso di sistema
+	want := FormatTimestamp(time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local))
+	if timestamp != want {
+		t.Errorf("timestamp = %s, want %s", timestamp, want)
+	}
+	if name := systemTimeZoneName(); timeZone.String != name || timeZone.Valid != (name != "") {
+		t.Errorf("time_zone = %v, want %q", timeZone, name)
+	}
+}
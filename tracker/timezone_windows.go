@@ -0,0 +1,42 @@
+//go:build windows
+
+package tracker
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDynamicTimeZoneInformation = kernel32.NewProc("GetDynamicTimeZoneInformation")
+
+// systemTime corrisponde alla struct SYSTEMTIME
+type systemTime struct {
+	Year, Month, DayOfWeek, Day, Hour, Minute, Second, Milliseconds uint16
+}
+
+// dynamicTimeZoneInformation corrisponde alla struct DYNAMIC_TIME_ZONE_INFORMATION
+type dynamicTimeZoneInformation struct {
+	Bias                        int32
+	StandardName                [32]uint16
+	StandardDate                systemTime
+	StandardBias                int32
+	DaylightName                [32]uint16
+	DaylightDate                systemTime
+	DaylightBias                int32
+	TimeZoneKeyName             [128]uint16
+	DynamicDaylightTimeDisabled uint8
+}
+
+// timeZoneIDInvalid è il valore restituito da GetDynamicTimeZoneInformation in caso di errore
+const timeZoneIDInvalid = 0xFFFFFFFF
+
+// platformTimeZoneName converte il fuso di Windows (es. "W. Europe Standard Time") nel nome
+// IANA corrispondente
+func platformTimeZoneName() string {
+	var info dynamicTimeZoneInformation
+	ret, _, _ := procGetDynamicTimeZoneInformation.Call(uintptr(unsafe.Pointer(&info)))
+	if uint32(ret) == timeZoneIDInvalid {
+		return ""
+	}
+	return windowsTimeZones[syscall.UTF16ToString(info.TimeZoneKeyName[:])]
+}
@@ -0,0 +1,207 @@
+package tracker
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// titleCaptureSettingKey è la chiave in settings con la configurazione della timeline titoli
+const titleCaptureSettingKey = "title_capture"
+
+// titleMask sostituisce le parti di titolo che corrispondono a una maschera
+const titleMask = "***"
+
+// TitleCaptureSettings configura la registrazione dei titoli delle finestre (opt-in)
+type TitleCaptureSettings struct {
+	Enabled           bool     `json:"enabled"`            // registra la timeline dei titoli
+	ProcessOnly       bool     `json:"process_only"`       // registra solo il processo, mai il titolo
+	ExcludedProcesses []string `json:"excluded_processes"` // processi mai registrati (es. "KeePass.exe")
+	MaskPatterns      []string `json:"mask_patterns"`      // regex le cui corrispondenze vengono mascherate
+}
+
+// WindowTitleSpan rappresenta un intervallo continuo con la stessa finestra in primo piano
+type WindowTitleSpan struct {
+	ID          int
+	SessionID   int
+	ProcessName string
+	Title       string
+	StartTime   time.Time
+	EndTime     time.Time
+}
+
+// TitleRedactor applica le regole di privacy ai titoli prima che vengano registrati
+type TitleRedactor struct {
+	processOnly bool
+	excluded    map[string]bool
+	masks       []*regexp.Regexp
+}
+
+// NewTitleRedactor compila le regole di privacy
+func NewTitleRedactor(settings TitleCaptureSettings) (*TitleRedactor, error) {
+	r := &TitleRedactor{
+		processOnly: settings.ProcessOnly,
+		excluded:    make(map[string]bool),
+	}
+
+	for _, p := range settings.ExcludedProcesses {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			r.excluded[strings.ToLower(p)] = true
+		}
+	}
+
+	for _, pattern := range settings.MaskPatterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("maschera titolo non valida '%s': %v", pattern, err)
+		}
+		r.masks = append(r.masks, re)
+	}
+
+	return r, nil
+}
+
+// Redact restituisce il titolo da registrare per un processo.
+// Il secondo valore è false se il processo è escluso e non va registrato affatto.
+func (r *TitleRedactor) Redact(processName, title string) (string, bool) {
+	if r.excluded[strings.ToLower(processName)] {
+		return "", false
+	}
+	if r.processOnly {
+		return "", true
+	}
+
+	for _, re := range r.masks {
+		title = re.ReplaceAllString(title, titleMask)
+	}
+	return title, true
+}
+
+// CaricaImpostazioniTitoli legge la configurazione della timeline titoli (disattivata se assente)
+func CaricaImpostazioniTitoli(db *sql.DB) (TitleCaptureSettings, error) {
+	var settings TitleCaptureSettings
+
+	value, err := GetSetting(db, titleCaptureSettingKey)
+	if err != nil {
+		return settings, err
+	}
+	if value == "" {
+		return settings, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &settings); err != nil {
+		return settings, fmt.Errorf("errore lettura impostazioni titoli: %v", err)
+	}
+	return settings, nil
+}
+
+// SalvaImpostazioniTitoli valida e salva la configurazione della timeline titoli
+func SalvaImpostazioniTitoli(db *sql.DB, settings TitleCaptureSettings) error {
+	// Rifiuta regex non valide prima di salvarle
+	if _, err := NewTitleRedactor(settings); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("errore serializzazione impostazioni titoli: %v", err)
+	}
+
+	return SetSetting(db, titleCaptureSettingKey, string(data))
+}
+
+// SalvaTimelineTitoli sostituisce la timeline titoli salvata per una sessione
+func SalvaTimelineTitoli(db *sql.DB, sessionID int64, spans []WindowTitleSpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore avvio salvataggio timeline titoli: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM window_title_spans WHERE session_id = ?`, sessionID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("errore pulizia timeline titoli: %v", err)
+	}
+
+	insertSQL := `INSERT INTO window_title_spans (session_id, process_name, title, start_time, end_time) VALUES (?, ?, ?, ?, ?)`
+	for _, span := range spans {
+		_, err := tx.Exec(insertSQL, sessionID, span.ProcessName, span.Title,
+			FormatTimestamp(span.StartTime), FormatTimestamp(span.EndTime))
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("errore salvataggio timeline titoli: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("errore commit timeline titoli: %v", err)
+	}
+
+	fmt.Printf("[DB] Timeline titoli salvata - Session ID: %d, Intervalli: %d\n", sessionID, len(spans))
+	return nil
+}
+
+// CaricaTimelineTitoli carica la timeline titoli di una sessione
+func CaricaTimelineTitoli(db *sql.DB, sessionID int) ([]WindowTitleSpan, error) {
+	query := `
+	SELECT id, session_id, process_name, title, start_time, end_time
+	FROM window_title_spans
+	WHERE session_id = ?
+	ORDER BY start_time ASC
+	`
+
+	return caricaTimelineTitoli(db, query, sessionID)
+}
+
+// CaricaTimelineTitoliPeriodo carica la timeline titoli in un intervallo di giorni locali (estremi inclusi)
+func CaricaTimelineTitoliPeriodo(db *sql.DB, startDate, endDate string) ([]WindowTitleSpan, error) {
+	query := `
+	SELECT id, session_id, process_name, title, start_time, end_time
+	FROM window_title_spans
+	WHERE start_time >= ? AND start_time < ?
+	ORDER BY start_time ASC
+	`
+
+	start, end, err := intervalloGiorni(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return caricaTimelineTitoli(db, query, start, end)
+}
+
+// caricaTimelineTitoli esegue una query sulla timeline titoli
+func caricaTimelineTitoli(db *sql.DB, query string, args ...interface{}) ([]WindowTitleSpan, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("errore query timeline titoli: %v", err)
+	}
+	defer rows.Close()
+
+	var spans []WindowTitleSpan
+	for rows.Next() {
+		var span WindowTitleSpan
+		var startTime, endTime string
+		if err := rows.Scan(&span.ID, &span.SessionID, &span.ProcessName, &span.Title, &startTime, &endTime); err != nil {
+			return nil, err
+		}
+		if span.StartTime, err = parseTimestamp(startTime); err != nil {
+			return nil, err
+		}
+		if span.EndTime, err = parseTimestamp(endTime); err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+
+	return spans, nil
+}
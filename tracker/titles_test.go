@@ -0,0 +1,111 @@
+package tracker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTitleRedactor(t *testing.T) {
+	type titolo struct {
+		process, title string
+		want           string
+		recorded       bool
+	}
+	tests := []struct {
+		name     string
+		settings TitleCaptureSettings
+		titles   []titolo
+	}{
+		{
+			name:     "senza regole",
+			settings: TitleCaptureSettings{Enabled: true},
+			titles:   []titolo{{"Code.exe", "main.go - tracker", "main.go - tracker", true}},
+		},
+		{
+			name: "maschere",
+			settings: TitleCaptureSettings{Enabled: true, MaskPatterns: []string{
+				`[\w.]+@[\w.]+`, `(?i)fattura \d+`, "  ",
+			}},
+			titles: []titolo{
+				{"OUTLOOK.EXE", "Posta in arrivo - mario.rossi@example.com", "Posta in arrivo - ***", true},
+				{"OUTLOOK.EXE", "Re: FATTURA 2026 e Fattura 17 - a@b.it", "Re: *** e *** - ***", true},
+				{"Code.exe", "main.go - tracker", "main.go - tracker", true},
+			},
+		},
+		{
+			name:     "maschere applicate in ordine",
+			settings: TitleCaptureSettings{Enabled: true, MaskPatterns: []string{`segreto`, `\*\*\* \d+`}},
+			titles:   []titolo{{"notepad.exe", "progetto segreto 42", "progetto ***", true}},
+		},
+		{
+			name:     "processi esclusi",
+			settings: TitleCaptureSettings{Enabled: true, ExcludedProcesses: []string{" KeePass.exe ", "", "1Password.exe"}},
+			titles: []titolo{
+				{"KeePass.exe", "Database.kdbx", "", false},
+				{"keepass.EXE", "Database.kdbx", "", false},
+				{"1password.exe", "Vault", "", false},
+				{"Code.exe", "main.go", "main.go", true},
+			},
+		},
+		{
+			name:     "solo processo",
+			settings: TitleCaptureSettings{Enabled: true, ProcessOnly: true, MaskPatterns: []string{`main`}},
+			titles:   []titolo{{"Code.exe", "main.go - tracker", "", true}},
+		},
+		{
+			name:     "escluso anche in solo processo",
+			settings: TitleCaptureSettings{Enabled: true, ProcessOnly: true, ExcludedProcesses: []string{"KeePass.exe"}},
+			titles:   []titolo{{"KeePass.exe", "Database.kdbx", "", false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := NewTitleRedactor(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, title := range tt.titles {
+				got, recorded := redactor.Redact(title.process, title.title)
+				if got != title.want || recorded != title.recorded {
+					t.Errorf("Redact(%q, %q) = %q, %v; atteso %q, %v", title.process, title.title, got, recorded, title.want, title.recorded)
+				}
+			}
+		})
+	}
+}
+
+func TestImpostazioniTitoli(t *testing.T) {
+	db := apriDBTest(t)
+
+	// Senza impostazioni salvate la timeline è disattivata
+	settings, err := CaricaImpostazioniTitoli(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Enabled {
+		t.Errorf("timeline titoli attiva senza impostazioni salvate: %+v", settings)
+	}
+
+	// Una maschera non valida viene rifiutata senza toccare le impostazioni salvate
+	if _, err := NewTitleRedactor(TitleCaptureSettings{MaskPatterns: []string{"(x"}}); err == nil {
+		t.Error("maschera non valida accettata dal redattore")
+	}
+	if err := SalvaImpostazioniTitoli(db, TitleCaptureSettings{Enabled: true, MaskPatterns: []string{"(x"}}); err == nil {
+		t.Error("maschera non valida salvata")
+	}
+	if value, _ := GetSetting(db, titleCaptureSettingKey); value != "" {
+		t.Errorf("impostazioni salvate dopo il rifiuto: %s", value)
+	}
+
+	want := TitleCaptureSettings{Enabled: true, ExcludedProcesses: []string{"KeePass.exe"}, MaskPatterns: []string{`\d{6}`}}
+	if err := SalvaImpostazioniTitoli(db, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CaricaImpostazioniTitoli(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("impostazioni rilette = %+v, attese %+v", got, want)
+	}
+}
@@ -3,216 +3,231 @@ package tracker
 import (
 	"fmt"
 	"sync"
-	"syscall"
 	"time"
-	"unsafe"
 )
 
+// Tipi di periodo in attesa di attribuzione
 const (
-	PROCESS_QUERY_INFORMATION = 0x0400
-	PROCESS_VM_READ           = 0x0010
+	PeriodIdle      = "idle"      // utente inattivo (nessun input oltre la soglia)
+	PeriodSuspended = "suspended" // computer sospeso/ibernato o orologio spostato in avanti
 )
 
-var (
-	user32                       = syscall.NewLazyDLL("user32.dll")
-	procGetForegroundWin         = user32.NewProc("GetForegroundWindow")
-	procGetWindowText            = user32.NewProc("GetWindowTextW")
-	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
-	procGetLastInputInfo         = user32.NewProc("GetLastInputInfo")
+// clockDriftThreshold è lo scarto minimo tra orologio di sistema e tempo monotono
+// tra due tick oltre il quale si considera avvenuta una sospensione o un salto dell'orologio
+const clockDriftThreshold = 30 * time.Second
 
-	kernel32            = syscall.NewLazyDLL("kernel32.dll")
-	procGetTickCount    = kernel32.NewProc("GetTickCount")
+// IdlePeriod rappresenta un periodo di inattività
+type IdlePeriod struct {
+	ID        int64  // ID nella coda dei periodi pendenti, 0 se non ancora salvato
+	Type      string // PeriodIdle o PeriodSuspended
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  int // secondi
+}
 
-	psapi                       = syscall.NewLazyDLL("psapi.dll")
-	procGetProcessImageFileName = psapi.NewProc("GetProcessImageFileNameW")
-)
+// wallSub restituisce a - b secondo l'orologio di sistema, ignorando la lettura monotona
+// che Go associa a time.Now() (e che su alcuni sistemi esclude le sospensioni)
+func wallSub(a, b time.Time) time.Duration {
+	return a.Round(0).Sub(b.Round(0))
+}
 
-// LASTINPUTINFO struct per GetLastInputInfo
-type LASTINPUTINFO struct {
-	CbSize uint32
-	DwTime uint32
+// AppSession rappresenta una sessione di utilizzo di un'applicazione
+type AppSession struct {
+	AppName   string
+	StartTime time.Time
+	Duration  int // secondi
 }
 
-// GetActiveWindow ritorna il titolo della finestra attualmente attiva
-func GetActiveWindow() (string, error) {
-	// Ottieni handle della finestra attiva
-	hwnd, _, _ := procGetForegroundWin.Call()
-	if hwnd == 0 {
-		return "", fmt.Errorf("nessuna finestra attiva")
-	}
+// SaveCallback è la funzione chiamata per salvare periodicamente i dati
+type SaveCallback func(totalSeconds int) error
 
-	// Buffer per il titolo (max 256 caratteri)
-	buf := make([]uint16, 256)
+// OnIdleCallback è la funzione chiamata quando viene rilevato l'idle
+type OnIdleCallback func()
 
-	// Ottieni il titolo della finestra
-	procGetWindowText.Call(
-		hwnd,
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(len(buf)),
-	)
+// OnIdleReturnCallback è la funzione chiamata quando l'utente torna dall'idle
+type OnIdleReturnCallback func(minutes int)
 
-	// Converti da UTF-16 a string
-	title := syscall.UTF16ToString(buf)
+// OnSuspendCallback è la funzione chiamata quando viene rilevata una sospensione
+type OnSuspendCallback func(period IdlePeriod)
 
-	if title == "" {
-		return "", fmt.Errorf("finestra senza titolo")
-	}
+// ActivityCallback è la funzione chiamata a ogni tick attivo con l'app e il titolo in primo piano
+type ActivityCallback func(processName, title string, at time.Time)
 
-	return title, nil
+// ActiveInterval è un intervallo di attività continua su un'applicazione, delimitato dagli
+// istanti reali registrati dal watcher. Il tempo attivo è la somma delle durate degli intervalli.
+type ActiveInterval struct {
+	AppName   string
+	StartTime time.Time
+	EndTime   time.Time
 }
 
-// GetActiveProcessName ritorna il nome del processo attivo
-func GetActiveProcessName() (string, error) {
-	// Ottieni handle della finestra attiva
-	hwnd, _, _ := procGetForegroundWin.Call()
-	if hwnd == 0 {
-		return "", fmt.Errorf("nessuna finestra attiva")
-	}
-
-	// Ottieni Process ID dalla finestra
-	var pid uint32
-	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+// Duration restituisce la durata dell'intervallo
+func (i ActiveInterval) Duration() time.Duration {
+	return wallSub(i.EndTime, i.StartTime)
+}
 
-	if pid == 0 {
-		return "", fmt.Errorf("impossibile ottenere PID")
-	}
+// WatcherSegment contiene i dati raccolti dal watcher per una parte di sessione
+type WatcherSegment struct {
+	TotalSeconds int
+	AppTimes     map[string]int
+	Intervals    []ActiveInterval
+	Segments     []SessionSegment
+	TitleSpans   []WindowTitleSpan
+}
 
-	// Apri il processo
-	handle, err := syscall.OpenProcess(PROCESS_QUERY_INFORMATION|PROCESS_VM_READ, false, pid)
-	if err != nil {
-		return "", fmt.Errorf("impossibile aprire processo: %v", err)
+// appendActive aggiunge l'intervallo [start, end] all'elenco, estendendo l'ultimo se è
+// contiguo e della stessa applicazione. Gli intervalli vuoti vengono ignorati.
+func appendActive(intervals []ActiveInterval, appName string, start, end time.Time) []ActiveInterval {
+	if !end.After(start) {
+		return intervals
 	}
-	defer syscall.CloseHandle(handle)
-
-	// Buffer per il path
-	buf := make([]uint16, 260)
-	size := uint32(len(buf))
-
-	// Ottieni il path completo dell'exe
-	ret, _, _ := procGetProcessImageFileName.Call(
-		uintptr(handle),
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(size),
-	)
-
-	if ret == 0 {
-		return "", fmt.Errorf("impossibile ottenere path processo")
+	if n := len(intervals); n > 0 {
+		last := &intervals[n-1]
+		if last.AppName == appName && last.EndTime.Equal(start) {
+			last.EndTime = end
+			return intervals
+		}
 	}
-
-	// Converti il path
-	fullPath := syscall.UTF16ToString(buf)
-
-	// Estrai solo il nome del file (es. "Code.exe" da "C:\...\Code.exe")
-	processName := extractFileName(fullPath)
-
-	return processName, nil
+	return append(intervals, ActiveInterval{AppName: appName, StartTime: start, EndTime: end})
 }
 
-// extractFileName estrae il nome del file dal path completo
-func extractFileName(path string) string {
-	// Trova l'ultima barra
-	lastSlash := -1
-	for i := len(path) - 1; i >= 0; i-- {
-		if path[i] == '\\' || path[i] == '/' {
-			lastSlash = i
-			break
+// trimActiveAfter taglia gli intervalli all'istante at, scartando il tempo successivo
+func trimActiveAfter(intervals []ActiveInterval, at time.Time) []ActiveInterval {
+	for n := len(intervals); n > 0; n = len(intervals) {
+		last := &intervals[n-1]
+		if !last.StartTime.Before(at) {
+			intervals = intervals[:n-1]
+			continue
 		}
+		if last.EndTime.After(at) {
+			last.EndTime = at
+		}
+		break
 	}
-
-	if lastSlash == -1 {
-		return path
-	}
-
-	return path[lastSlash+1:]
+	return intervals
 }
 
-// GetIdleTime restituisce da quanto tempo (in secondi) il PC è idle
-func GetIdleTime() (int, error) {
-	var lastInputInfo LASTINPUTINFO
-	lastInputInfo.CbSize = uint32(unsafe.Sizeof(lastInputInfo))
-
-	// Chiama GetLastInputInfo
-	ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&lastInputInfo)))
-	if ret == 0 {
-		return 0, fmt.Errorf("errore GetLastInputInfo: %v", err)
+// sumActive restituisce i secondi attivi totali degli intervalli
+func sumActive(intervals []ActiveInterval) int {
+	var total time.Duration
+	for _, interval := range intervals {
+		total += interval.Duration()
 	}
-
-	// Ottieni il tick count corrente (millisecondi da avvio sistema)
-	currentTick, _, _ := procGetTickCount.Call()
-
-	// Calcola la differenza in millisecondi
-	idleMillis := uint32(currentTick) - lastInputInfo.DwTime
-
-	// Converti in secondi
-	idleSeconds := int(idleMillis / 1000)
-
-	return idleSeconds, nil
+	return int(total.Round(time.Second) / time.Second)
 }
 
-// IdlePeriod rappresenta un periodo di inattività
-type IdlePeriod struct {
-	StartTime time.Time
-	EndTime   time.Time
-	Duration  int // secondi
-}
-
-// AppSession rappresenta una sessione di utilizzo di un'applicazione
-type AppSession struct {
-	AppName   string
-	StartTime time.Time
-	Duration  int // secondi
+// appTotals restituisce i secondi attivi per applicazione
+func appTotals(intervals []ActiveInterval) map[string]int {
+	durations := make(map[string]time.Duration)
+	for _, interval := range intervals {
+		durations[interval.AppName] += interval.Duration()
+	}
+	result := make(map[string]int, len(durations))
+	for app, d := range durations {
+		result[app] = int(d.Round(time.Second) / time.Second)
+	}
+	return result
 }
 
-// SaveCallback è la funzione chiamata per salvare periodicamente i dati
-type SaveCallback func(totalSeconds int) error
-
-// OnIdleCallback è la funzione chiamata quando viene rilevato l'idle
-type OnIdleCallback func()
-
-// OnIdleReturnCallback è la funzione chiamata quando l'utente torna dall'idle
-type OnIdleReturnCallback func(minutes int)
-
 // TimeWatcher traccia il tempo delle applicazioni
 type TimeWatcher struct {
-	mu                   sync.Mutex     // mutex per proteggere accesso concorrente
-	appTimes             map[string]int // nome app -> secondi (per statistiche dettagliate)
-	sessions             []AppSession   // sessioni dettagliate con timestamp
-	currentApp           string         // app correntemente tracciata
-	currentStartTime     time.Time      // quando è iniziata la sessione corrente
+	mu                   sync.Mutex       // mutex per proteggere accesso concorrente
+	intervals            []ActiveInterval // intervalli attivi: da questi derivano totale e tempi per app
+	excluded             []SessionSegment // tratti esclusi dal conteggio (idle, pause, sospensioni)
+	sessions             []AppSession     // sessioni dettagliate con timestamp
+	currentApp           string           // app correntemente tracciata
+	currentStartTime     time.Time        // quando è iniziata la sessione corrente
 	stopChan             chan bool
 	running              bool
-	stopOnce             sync.Once   // previene doppia chiusura del canale
-	idleThreshold        int         // soglia idle in secondi (es. 300 = 5 minuti)
-	isIdle               bool        // stato idle corrente
-	idleStartTime        time.Time   // quando è iniziato l'idle corrente
-	pendingIdlePeriod    *IdlePeriod // periodo idle in attesa di attribuzione
-	trackingStartTime    time.Time   // quando è iniziato il tracking (per sessione unica)
-	totalActiveSeconds   int         // secondi totali attivi (escluso idle)
-	saveCallback         SaveCallback // callback per salvataggio periodico
-	saveInterval         int          // intervallo salvataggio in secondi (default 300 = 5 min)
-	lastSaveSeconds      int          // secondi all'ultimo salvataggio
-	onIdleCallback       OnIdleCallback // callback chiamata quando viene rilevato idle
+	stopOnce             sync.Once            // previene doppia chiusura del canale
+	idleThreshold        int                  // soglia idle in secondi (es. 300 = 5 minuti)
+	isIdle               bool                 // stato idle corrente
+	idleStartTime        time.Time            // quando è iniziato l'idle corrente
+	pendingIdlePeriod    *IdlePeriod          // periodo idle in attesa di attribuzione
+	trackingStartTime    time.Time            // quando è iniziato il tracking (per sessione unica)
+	saveCallback         SaveCallback         // callback per salvataggio periodico
+	saveInterval         int                  // intervallo salvataggio in secondi (default 300 = 5 min)
+	lastSaveSeconds      int                  // secondi all'ultimo salvataggio
+	onIdleCallback       OnIdleCallback       // callback chiamata quando viene rilevato idle
 	onIdleReturnCallback OnIdleReturnCallback // callback chiamata quando l'utente torna dall'idle
+	activitySource       ActivitySource       // rilevamento app in primo piano
+	idleSource           IdleSource           // rilevamento inattività
+	clock                Clock                // orologio (sostituibile per simulare il tempo)
+	titleRedactor        *TitleRedactor       // se non nil registra la timeline dei titoli (opt-in)
+	titleSpans           []WindowTitleSpan    // timeline compressa dei titoli della sessione
+	titleSpanOpen        bool                 // l'ultimo intervallo può ancora essere esteso
+	onActivityCallback   ActivityCallback     // callback chiamata a ogni tick attivo (es. regole)
+	paused               bool                 // in pausa: i tick non accumulano tempo
+	lastTickTime         time.Time            // fine dell'ultimo tempo accreditato (o ignorato per idle/pausa)
+	lastCheckWall        time.Time            // orologio di sistema all'ultimo tick (rilevamento sospensioni)
+	lastCheckMono        time.Duration        // tempo monotono all'ultimo tick
+	idleOffsetSeconds    int                  // secondi di sospensione inclusi nell'idle riportato dal sistema
+	idleSuspendedSeconds int                  // secondi di sospensione durante l'idle corrente
+	pendingSuspended     *IdlePeriod          // sospensione in attesa di attribuzione
+	onSuspendCallback    OnSuspendCallback    // callback chiamata quando viene rilevata una sospensione
+	tickDone             chan struct{}        // se non nil riceve un segnale dopo ogni tick elaborato (test)
 }
 
-// NewTimeWatcher crea un nuovo watcher
+// NewTimeWatcher crea un nuovo watcher con le sorgenti della piattaforma corrente
 func NewTimeWatcher() *TimeWatcher {
+	return NewTimeWatcherWithSources(nil, nil)
+}
+
+// NewTimeWatcherWithSources crea un nuovo watcher con sorgenti di rilevamento specifiche.
+// Una sorgente nil viene sostituita da quella della piattaforma corrente.
+func NewTimeWatcherWithSources(activity ActivitySource, idle IdleSource) *TimeWatcher {
+	if activity == nil || idle == nil {
+		defaultActivity, defaultIdle := defaultSources()
+		if activity == nil {
+			activity = defaultActivity
+		}
+		if idle == nil {
+			idle = defaultIdle
+		}
+	}
+
 	return &TimeWatcher{
-		appTimes:           make(map[string]int),
-		sessions:           []AppSession{},
-		currentApp:         "",
-		currentStartTime:   time.Time{},
-		stopChan:           make(chan bool),
-		running:            false,
-		idleThreshold:      300, // default: 5 minuti
-		isIdle:             false,
-		pendingIdlePeriod:  nil,
-		trackingStartTime:  time.Time{},
-		totalActiveSeconds: 0,
-		saveCallback:       nil,
-		saveInterval:       300, // default: 5 minuti
-		lastSaveSeconds:    0,
+		sessions:          []AppSession{},
+		currentApp:        "",
+		currentStartTime:  time.Time{},
+		stopChan:          make(chan bool),
+		running:           false,
+		idleThreshold:     300, // default: 5 minuti
+		isIdle:            false,
+		pendingIdlePeriod: nil,
+		trackingStartTime: time.Time{},
+		saveCallback:      nil,
+		saveInterval:      300, // default: 5 minuti
+		lastSaveSeconds:   0,
+		activitySource:    activity,
+		idleSource:        idle,
+		clock:             currentClock(),
+	}
+}
+
+// SetClock imposta l'orologio usato dal watcher (da chiamare prima di Start)
+func (w *TimeWatcher) SetClock(c Clock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if c == nil {
+		c = SystemClock
 	}
+	w.clock = c
+}
+
+// SetTitleRedactor attiva la registrazione della timeline titoli con le regole di privacy indicate
+// (nil la disattiva). Da chiamare prima di Start.
+func (w *TimeWatcher) SetTitleRedactor(redactor *TitleRedactor) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.titleRedactor = redactor
+}
+
+// SetOnActivityCallback imposta la callback chiamata a ogni tick attivo
+func (w *TimeWatcher) SetOnActivityCallback(callback ActivityCallback) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onActivityCallback = callback
 }
 
 // SetSaveCallback imposta la callback per il salvataggio periodico
@@ -254,19 +269,36 @@ func (w *TimeWatcher) Start(intervalSeconds int) {
 	}
 
 	w.running = true
-	w.trackingStartTime = time.Now() // Memorizza quando è iniziato il tracking
-	w.totalActiveSeconds = 0         // Reset contatore
-	w.lastSaveSeconds = 0            // Reset ultimo salvataggio
-	w.stopOnce = sync.Once{}         // Reset stopOnce per permettere nuove chiamate a Stop
+	w.trackingStartTime = w.clock.Now() // Memorizza quando è iniziato il tracking
+	w.intervals = nil                   // Reset intervalli attivi
+	w.excluded = nil
+	w.lastSaveSeconds = 0    // Reset ultimo salvataggio
+	w.stopOnce = sync.Once{} // Reset stopOnce per permettere nuove chiamate a Stop
+	w.lastTickTime = w.trackingStartTime
+	w.lastCheckWall = w.trackingStartTime
+	w.lastCheckMono = w.clock.Elapsed()
 	saveInterval := w.saveInterval
 	saveCallback := w.saveCallback
+	activitySource := w.activitySource
+	idleSource := w.idleSource
+	clock := w.clock
+	tickDone := w.tickDone
 	w.mu.Unlock()
 
 	fmt.Printf("[WATCHER] Avviato (intervallo: %d secondi, auto-save ogni %d secondi)\n", intervalSeconds, saveInterval)
 
+	// Senza un backend per l'inattività (es. Linux senza X11 né logind) il rilevamento idle
+	// è disattivato: il tempo viene comunque tracciato sull'app attiva
+	if _, ok := idleSource.(unsupportedSource); ok {
+		fmt.Println("[IDLE] Rilevamento inattività non supportato su questa piattaforma: rilevamento idle disattivato")
+		idleSource = nil
+	}
+
+	// Il ticker è creato prima della goroutine: il primo tick è misurato dall'avvio
+	ticker := clock.NewTicker(time.Duration(intervalSeconds) * time.Second)
+
 	// Goroutine per il tracking
 	go func() {
-		ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
 		defer ticker.Stop()
 
 		for {
@@ -274,126 +306,189 @@ func (w *TimeWatcher) Start(intervalSeconds int) {
 			case <-w.stopChan:
 				fmt.Println("[WATCHER] Fermato")
 				return
-			case <-ticker.C:
-				// Leggi soglia idle corrente (può essere aggiornata)
-				w.mu.Lock()
-				currentIdleThreshold := w.idleThreshold
-				w.mu.Unlock()
-
-				// Controlla idle time
-				idleTime, err := GetIdleTime()
-				if err != nil {
-					fmt.Printf("[IDLE] Errore rilevamento idle: %v\n", err)
-					continue
+			case <-ticker.C():
+				w.tick(clock, activitySource, idleSource, saveInterval, saveCallback)
+				if tickDone != nil {
+					tickDone <- struct{}{}
 				}
+			}
+		}
+	}()
+}
 
-				w.mu.Lock()
-				// Se idle time supera la soglia, PC è inattivo
-				if idleTime >= currentIdleThreshold {
-					// Se non era già in idle, registra inizio periodo idle
-					var idleCallback OnIdleCallback
-					if !w.isIdle {
-						w.isIdle = true
-						// Calcola il vero inizio dell'idle sottraendo il tempo già trascorso
-						w.idleStartTime = time.Now().Add(-time.Duration(idleTime) * time.Second)
-
-						// CORREZIONE: Sottrai il tempo idle che è stato erroneamente contato come attivo
-						// Durante il periodo prima di rilevare l'idle, continuavamo a tracciare
-						// ma l'utente era già inattivo
-						w.totalActiveSeconds -= idleTime
-						if w.totalActiveSeconds < 0 {
-							w.totalActiveSeconds = 0
-						}
-
-						idleCallback = w.onIdleCallback // Cattura callback prima di unlock
-						fmt.Printf("[IDLE] Sistema inattivo da %d secondi (soglia: %d sec), inizio idle: %s, secondi attivi corretti: %d\n",
-							idleTime, currentIdleThreshold, w.idleStartTime.Format("15:04:05"), w.totalActiveSeconds)
-					}
-					w.mu.Unlock()
-
-					// Chiama callback DOPO unlock per evitare deadlock
-					if idleCallback != nil {
-						fmt.Println("[IDLE] Chiamata callback onIdle...")
-						idleCallback()
-					}
-
-					// NON tracciare quando idle
-					continue
-				}
+// tick elabora un tick del watcher: sospensioni, idle, app attiva e salvataggio periodico
+func (w *TimeWatcher) tick(clock Clock, activitySource ActivitySource, idleSource IdleSource, saveInterval int, saveCallback SaveCallback) {
+	// Confronta orologio di sistema e tempo monotono: sospensioni e salti dell'orologio
+	w.mu.Lock()
+	suspended := w.checkClock(clock.Now(), clock.Elapsed())
+	suspendCallback := w.onSuspendCallback
+	w.mu.Unlock()
+	if suspended != nil && suspendCallback != nil {
+		suspendCallback(*suspended)
+	}
 
-				// Se era in idle ed è tornato attivo
-				var idleReturnCallback OnIdleReturnCallback
-				var idleMinutes int
-				if w.isIdle {
-					w.isIdle = false
-					endTime := time.Now()
-					duration := int(endTime.Sub(w.idleStartTime).Seconds())
-					idleMinutes = duration / 60
-
-					// Crea periodo idle in attesa di attribuzione
-					w.pendingIdlePeriod = &IdlePeriod{
-						StartTime: w.idleStartTime,
-						EndTime:   endTime,
-						Duration:  duration,
-					}
-
-					// Cattura callback prima di unlock
-					idleReturnCallback = w.onIdleReturnCallback
-
-					fmt.Printf("[IDLE] Sistema riattivato - periodo idle: %d minuti (dal %s al %s)\n",
-						idleMinutes,
-						w.idleStartTime.Format("15:04:05"),
-						endTime.Format("15:04:05"))
-				}
-				w.mu.Unlock()
+	// Leggi soglia idle corrente (può essere aggiornata)
+	w.mu.Lock()
+	currentIdleThreshold := w.idleThreshold
+	paused := w.paused
+	w.mu.Unlock()
 
-				// Chiama callback DOPO unlock per evitare deadlock
-				if idleReturnCallback != nil && idleMinutes > 0 {
-					fmt.Println("[IDLE] Chiamata callback onIdleReturn...")
-					idleReturnCallback(idleMinutes)
-				}
+	// In pausa non si accumula tempo e non si rileva idle
+	if paused {
+		w.mu.Lock()
+		w.lastTickTime = clock.Now()
+		w.mu.Unlock()
+		return
+	}
 
-				// Sistema attivo: rileva app e traccia
-				processName, err := GetActiveProcessName()
-				if err != nil {
-					continue
-				}
+	// Controlla idle time (sempre 0 se il rilevamento è disattivato)
+	idleTime := 0
+	if idleSource != nil {
+		var err error
+		idleTime, err = idleSource.GetIdleTime()
+		if err != nil {
+			fmt.Printf("[IDLE] Errore rilevamento idle: %v\n", err)
+			return
+		}
+	}
 
-				w.mu.Lock()
-				// Accumula tempo totale attivo (per la sessione unica)
-				w.totalActiveSeconds += intervalSeconds
-
-				// Accumula tempo per app (per statistiche dettagliate)
-				w.appTimes[processName] += intervalSeconds
-
-				// Aggiorna app corrente (solo per info)
-				w.currentApp = processName
-
-				totalActive := w.totalActiveSeconds
-				lastSave := w.lastSaveSeconds
-				appTime := w.appTimes[processName]
-				w.mu.Unlock()
-
-				fmt.Printf("[TRACK] %s: %d sec | Totale sessione: %d sec (%d min)\n",
-					processName, appTime,
-					totalActive, totalActive/60)
-
-				// Salvataggio periodico (ogni saveInterval secondi)
-				if saveCallback != nil && (totalActive-lastSave) >= saveInterval {
-					err := saveCallback(totalActive)
-					if err != nil {
-						fmt.Printf("[AUTOSAVE] Errore salvataggio: %v\n", err)
-					} else {
-						w.mu.Lock()
-						w.lastSaveSeconds = totalActive
-						w.mu.Unlock()
-						fmt.Printf("[AUTOSAVE] Salvato automaticamente: %d secondi (%d min)\n",
-							totalActive, totalActive/60)
-					}
-				}
-			}
+	w.mu.Lock()
+	// Dopo una sospensione il sistema include nell'idle anche il tempo sospeso,
+	// finché non arriva un nuovo input
+	if w.idleOffsetSeconds > 0 {
+		if idleTime >= w.idleOffsetSeconds {
+			idleTime -= w.idleOffsetSeconds
+		} else {
+			w.idleOffsetSeconds = 0
 		}
-	}()
+	}
+
+	// Se idle time supera la soglia, PC è inattivo
+	if idleTime >= currentIdleThreshold {
+		// Se non era già in idle, registra inizio periodo idle
+		var idleCallback OnIdleCallback
+		if !w.isIdle {
+			w.isIdle = true
+			// Calcola il vero inizio dell'idle sottraendo il tempo già trascorso
+			w.idleStartTime = clock.Now().Add(-time.Duration(idleTime) * time.Second)
+
+			// CORREZIONE: il tempo accreditato dopo l'ultimo input non era attività.
+			// Gli intervalli vengono tagliati al vero inizio dell'idle
+			w.intervals = trimActiveAfter(w.intervals, w.idleStartTime)
+			w.excluded = append(w.excluded, SessionSegment{Type: SegmentIdle, StartTime: w.idleStartTime})
+
+			// La timeline titoli si interrompe al vero inizio dell'idle
+			w.closeTitleSpan(w.idleStartTime)
+
+			idleCallback = w.onIdleCallback // Cattura callback prima di unlock
+			fmt.Printf("[IDLE] Sistema inattivo da %d secondi (soglia: %d sec), inizio idle: %s, secondi attivi corretti: %d\n",
+				idleTime, currentIdleThreshold, w.idleStartTime.Format("15:04:05"), sumActive(w.intervals))
+		}
+		w.mu.Unlock()
+
+		// Chiama callback DOPO unlock per evitare deadlock
+		if idleCallback != nil {
+			fmt.Println("[IDLE] Chiamata callback onIdle...")
+			idleCallback()
+		}
+
+		// NON tracciare quando idle
+		w.mu.Lock()
+		w.lastTickTime = clock.Now()
+		w.mu.Unlock()
+		return
+	}
+
+	// Se era in idle ed è tornato attivo
+	var idleReturnCallback OnIdleReturnCallback
+	var idleMinutes int
+	if w.isIdle {
+		// L'idle finisce con l'ultimo input, non con il tick che lo rileva:
+		// da lì riparte il tempo attivo
+		idleMinutes = w.finishIdle(clock.Now().Add(-time.Duration(idleTime) * time.Second))
+
+		// Cattura callback prima di unlock
+		idleReturnCallback = w.onIdleReturnCallback
+	}
+	w.mu.Unlock()
+
+	// Chiama callback DOPO unlock per evitare deadlock
+	if idleReturnCallback != nil {
+		fmt.Println("[IDLE] Chiamata callback onIdleReturn...")
+		idleReturnCallback(idleMinutes)
+	}
+
+	// Sistema attivo: rileva app e traccia
+	processName, err := activitySource.GetActiveProcessName()
+	if err != nil {
+		return
+	}
+
+	// Titolo finestra solo se serve: timeline (filtrata dalle regole di privacy) o callback
+	w.mu.Lock()
+	redactor := w.titleRedactor
+	activityCallback := w.onActivityCallback
+	w.mu.Unlock()
+	var rawTitle string
+	if redactor != nil || activityCallback != nil {
+		rawTitle, _ = activitySource.GetActiveWindow()
+	}
+	recordTitle := false
+	var title string
+	if redactor != nil {
+		title, recordTitle = redactor.Redact(processName, rawTitle)
+	}
+
+	w.mu.Lock()
+	// Aggiorna la timeline titoli
+	tickTime := clock.Now()
+	if recordTitle {
+		w.extendTitleSpan(processName, title, w.lastTickTime, tickTime)
+	} else {
+		w.closeTitleSpan(tickTime)
+	}
+
+	// Accredita il tempo reale dall'ultimo tick, non l'intervallo nominale:
+	// tick ritardati o saltati (errori di rilevamento) non perdono tempo
+	w.intervals = appendActive(w.intervals, processName, w.lastTickTime, tickTime)
+	w.lastTickTime = tickTime
+
+	// Aggiorna app corrente (solo per info)
+	w.currentApp = processName
+
+	totalActive := sumActive(w.intervals)
+	lastSave := w.lastSaveSeconds
+	appTime := appTotals(w.intervals)[processName]
+	w.mu.Unlock()
+
+	fmt.Printf("[TRACK] %s: %d sec | Totale sessione: %d sec (%d min)\n",
+		processName, appTime,
+		totalActive, totalActive/60)
+
+	// Chiama callback DOPO unlock (può a sua volta usare il watcher, es. CutSegment)
+	if activityCallback != nil {
+		activityCallback(processName, rawTitle, tickTime)
+
+		// La callback può aver iniziato un nuovo segmento: rileggi i contatori
+		w.mu.Lock()
+		totalActive = sumActive(w.intervals)
+		lastSave = w.lastSaveSeconds
+		w.mu.Unlock()
+	}
+
+	// Salvataggio periodico (ogni saveInterval secondi)
+	if saveCallback != nil && (totalActive-lastSave) >= saveInterval {
+		err := saveCallback(totalActive)
+		if err != nil {
+			fmt.Printf("[AUTOSAVE] Errore salvataggio: %v\n", err)
+		} else {
+			w.mu.Lock()
+			w.lastSaveSeconds = totalActive
+			w.mu.Unlock()
+			fmt.Printf("[AUTOSAVE] Salvato automaticamente: %d secondi (%d min)\n",
+				totalActive, totalActive/60)
+		}
+	}
 }
 
 // Stop ferma il tracciamento
@@ -405,41 +500,392 @@ func (w *TimeWatcher) Stop() {
 		return
 	}
 
+	w.mu.Unlock()
+
+	// Usa sync.Once per prevenire doppia chiusura/invio sul canale.
+	// L'invio attende che la goroutine abbia finito il tick corrente.
+	w.stopOnce.Do(func() {
+		w.stopChan <- true
+	})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Accredita il tempo dall'ultimo tick fino allo stop e chiude una pausa in corso
+	stopTime := w.clock.Now()
+	w.creditUntil(stopTime)
+	if w.paused {
+		w.closeExcluded(SegmentPaused, stopTime)
+	}
+
 	// Crea una singola sessione con il tempo totale accumulato
-	if w.totalActiveSeconds > 0 {
+	if totalActive := sumActive(w.intervals); totalActive > 0 {
 		w.sessions = []AppSession{
 			{
 				AppName:   "Sessione di lavoro", // Nome generico per la sessione unica
 				StartTime: w.trackingStartTime,
-				Duration:  w.totalActiveSeconds,
+				Duration:  totalActive,
 			},
 		}
 		fmt.Printf("[TRACK] Sessione unica salvata: %d secondi (%d min) dal %s\n",
-			w.totalActiveSeconds, w.totalActiveSeconds/60,
+			totalActive, totalActive/60,
 			w.trackingStartTime.Format("15:04:05"))
 	}
 
 	w.running = false
-	w.mu.Unlock()
+}
 
-	// Usa sync.Once per prevenire doppia chiusura/invio sul canale
-	w.stopOnce.Do(func() {
-		w.stopChan <- true
-	})
+// creditUntil accredita all'app corrente il tempo trascorso dall'ultimo tick fino ad at,
+// se il watcher sta tracciando attività (lock tenuto)
+func (w *TimeWatcher) creditUntil(at time.Time) {
+	if !w.running || w.paused || w.isIdle || w.currentApp == "" {
+		return
+	}
+	w.intervals = appendActive(w.intervals, w.currentApp, w.lastTickTime, at)
+	if at.After(w.lastTickTime) {
+		w.lastTickTime = at
+	}
+}
+
+// finishIdle chiude l'idle in corso all'istante endTime e crea il periodo in attesa
+// di attribuzione. Restituisce i minuti di idle (lock tenuto).
+func (w *TimeWatcher) finishIdle(endTime time.Time) int {
+	w.isIdle = false
+	if endTime.Before(w.idleStartTime) {
+		endTime = w.idleStartTime
+	}
+	w.closeExcluded(SegmentIdle, endTime)
+	if endTime.After(w.lastTickTime) {
+		w.lastTickTime = endTime
+	}
+
+	// Il tempo sospeso durante l'idle viene proposto a parte come sospensione
+	duration := int(wallSub(endTime, w.idleStartTime).Seconds()) - w.idleSuspendedSeconds
+	if duration < 0 {
+		duration = 0
+	}
+	w.idleSuspendedSeconds = 0
+	idleMinutes := duration / 60
+
+	// Crea periodo idle in attesa di attribuzione
+	w.pendingIdlePeriod = &IdlePeriod{
+		Type:      PeriodIdle,
+		StartTime: w.idleStartTime,
+		EndTime:   endTime,
+		Duration:  duration,
+	}
+
+	fmt.Printf("[IDLE] Sistema riattivato - periodo idle: %d minuti (dal %s al %s)\n",
+		idleMinutes,
+		w.idleStartTime.Format("15:04:05"),
+		endTime.Format("15:04:05"))
+	return idleMinutes
+}
+
+// CloseIdle chiude l'idle in corso all'istante corrente, come se l'utente fosse tornato
+// (es. avvia un nuovo tracking o chiude l'app). Restituisce il periodo creato, o nil.
+func (w *TimeWatcher) CloseIdle() *IdlePeriod {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.isIdle {
+		return nil
+	}
+	w.finishIdle(w.clock.Now())
+	return w.pendingIdlePeriod
+}
+
+// checkClock confronta l'avanzamento dell'orologio di sistema con il tempo monotono dall'ultimo
+// tick. Uno scarto in avanti è una sospensione (o un salto in avanti dell'orologio): viene
+// registrato come periodo sospeso, che non conta come attivo né come idle. Uno scarto
+// all'indietro è una correzione dell'orologio: i riferimenti interni vengono riallineati.
+// Restituisce il periodo sospeso rilevato, o nil (lock tenuto).
+func (w *TimeWatcher) checkClock(wall time.Time, mono time.Duration) *IdlePeriod {
+	prevWall := w.lastCheckWall
+	prevMono := w.lastCheckMono
+	w.lastCheckWall = wall
+	w.lastCheckMono = mono
+	if prevWall.IsZero() {
+		return nil
+	}
+
+	drift := wallSub(wall, prevWall) - (mono - prevMono)
+	switch {
+	case drift >= clockDriftThreshold:
+		seconds := int(drift.Seconds())
+		// Il tempo sospeso non è attività: il credito parziale riparte dal risveglio
+		w.lastTickTime = w.lastTickTime.Add(drift)
+		w.idleOffsetSeconds += seconds
+		if w.isIdle {
+			w.idleSuspendedSeconds += seconds
+		}
+
+		// In pausa il tempo non conta comunque: niente da attribuire
+		if w.paused {
+			fmt.Printf("[CLOCK] Sospensione di %d secondi durante la pausa\n", seconds)
+			return nil
+		}
+
+		// Nei tratti della sessione la sospensione interrompe l'eventuale idle in corso
+		if w.isIdle {
+			w.closeExcluded(SegmentIdle, prevWall)
+		}
+		w.excluded = append(w.excluded, SessionSegment{Type: SegmentSuspended, StartTime: prevWall, EndTime: prevWall.Add(drift)})
+		if w.isIdle {
+			w.excluded = append(w.excluded, SessionSegment{Type: SegmentIdle, StartTime: prevWall.Add(drift)})
+		}
+
+		period := IdlePeriod{
+			Type:      PeriodSuspended,
+			StartTime: prevWall,
+			EndTime:   prevWall.Add(drift),
+			Duration:  seconds,
+		}
+		if w.pendingSuspended != nil {
+			// Più sospensioni non ancora attribuite: un unico periodo dalla prima all'ultima
+			period.StartTime = w.pendingSuspended.StartTime
+			period.Duration += w.pendingSuspended.Duration
+		}
+		w.pendingSuspended = &period
+
+		fmt.Printf("[CLOCK] Sospensione o salto in avanti dell'orologio: %d secondi (dal %s al %s)\n",
+			seconds, prevWall.Format("15:04:05"), period.EndTime.Format("15:04:05"))
+		return &period
+
+	case drift <= -clockDriftThreshold:
+		// Orologio spostato indietro: riporta i riferimenti nella nuova scala
+		w.lastTickTime = w.lastTickTime.Add(drift)
+		if w.isIdle {
+			w.idleStartTime = w.idleStartTime.Add(drift)
+		}
+		fmt.Printf("[CLOCK] Orologio di sistema spostato indietro di %d secondi\n", int(-drift.Seconds()))
+	}
+
+	return nil
+}
+
+// SetOnSuspendCallback imposta la callback chiamata quando viene rilevata una sospensione
+func (w *TimeWatcher) SetOnSuspendCallback(callback OnSuspendCallback) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onSuspendCallback = callback
+}
+
+// GetPendingSuspendedPeriod restituisce la sospensione in attesa di attribuzione
+func (w *TimeWatcher) GetPendingSuspendedPeriod() *IdlePeriod {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pendingSuspended
+}
+
+// ClearPendingSuspendedPeriod rimuove la sospensione pendente
+func (w *TimeWatcher) ClearPendingSuspendedPeriod() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pendingSuspended = nil
+}
+
+// Pause sospende il conteggio del tempo finché non viene chiamato Resume
+func (w *TimeWatcher) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused {
+		return
+	}
+	now := w.clock.Now()
+	w.creditUntil(now)
+	w.paused = true
+	w.excluded = append(w.excluded, SessionSegment{Type: SegmentPaused, StartTime: now})
+	w.closeTitleSpan(now)
+	fmt.Println("[WATCHER] In pausa")
+}
+
+// Resume riprende il conteggio dopo una pausa
+func (w *TimeWatcher) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paused {
+		return
+	}
+	w.paused = false
+	w.lastTickTime = w.clock.Now()
+	w.closeExcluded(SegmentPaused, w.lastTickTime)
+	fmt.Println("[WATCHER] Ripreso")
+}
+
+// IsPaused indica se il watcher è in pausa
+func (w *TimeWatcher) IsPaused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
 }
 
 // GetStats ritorna le statistiche
 func (w *TimeWatcher) GetStats() map[string]int {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	// Crea una copia per evitare race condition
-	result := make(map[string]int, len(w.appTimes))
-	for k, v := range w.appTimes {
-		result[k] = v
+	return appTotals(w.intervals)
+}
+
+// closeExcluded chiude all'istante at l'ultimo tratto escluso aperto del tipo indicato,
+// scartandolo se resta vuoto (lock tenuto)
+func (w *TimeWatcher) closeExcluded(segmentType string, at time.Time) {
+	for i := len(w.excluded) - 1; i >= 0; i-- {
+		segment := &w.excluded[i]
+		if segment.Type != segmentType || !segment.EndTime.IsZero() {
+			continue
+		}
+		if !at.After(segment.StartTime) {
+			w.excluded = append(w.excluded[:i], w.excluded[i+1:]...)
+			return
+		}
+		segment.EndTime = at
+		return
+	}
+}
+
+// closeOpenSegments restituisce una copia dei tratti con quelli aperti chiusi all'istante at
+func closeOpenSegments(segments []SessionSegment, at time.Time) []SessionSegment {
+	result := make([]SessionSegment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.EndTime.IsZero() {
+			if !at.After(segment.StartTime) {
+				continue
+			}
+			segment.EndTime = at
+		}
+		result = append(result, segment)
+	}
+	return result
+}
+
+// GetSessionSegments restituisce i tratti ordinati della sessione: attivi, idle, pause e
+// sospensioni. Una pausa in corso ha EndTime zero.
+func (w *TimeWatcher) GetSessionSegments() []SessionSegment {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return sessionLayout(w.intervals, w.excluded)
+}
+
+// GetActiveIntervals restituisce una copia degli intervalli attivi registrati
+func (w *TimeWatcher) GetActiveIntervals() []ActiveInterval {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([]ActiveInterval, len(w.intervals))
+	copy(result, w.intervals)
+	return result
+}
+
+// extendTitleSpan estende l'ultimo intervallo se la finestra è la stessa, altrimenti ne apre uno nuovo.
+// Va chiamata con w.mu bloccato.
+func (w *TimeWatcher) extendTitleSpan(processName, title string, start, end time.Time) {
+	if n := len(w.titleSpans); n > 0 && w.titleSpanOpen {
+		last := &w.titleSpans[n-1]
+		if last.ProcessName == processName && last.Title == title {
+			last.EndTime = end
+			return
+		}
+		// Il nuovo intervallo parte dove finisce il precedente, senza sovrapposizioni
+		start = last.EndTime
+	}
+
+	w.titleSpans = append(w.titleSpans, WindowTitleSpan{
+		ProcessName: processName,
+		Title:       title,
+		StartTime:   start,
+		EndTime:     end,
+	})
+	w.titleSpanOpen = true
+}
+
+// closeTitleSpan chiude l'intervallo aperto all'istante indicato, scartandolo se inizia dopo.
+// Va chiamata con w.mu bloccato.
+func (w *TimeWatcher) closeTitleSpan(at time.Time) {
+	if !w.titleSpanOpen {
+		return
 	}
+	w.titleSpanOpen = false
+
+	n := len(w.titleSpans)
+	last := &w.titleSpans[n-1]
+	if !last.StartTime.Before(at) {
+		w.titleSpans = w.titleSpans[:n-1]
+		return
+	}
+	if last.EndTime.After(at) {
+		last.EndTime = at
+	}
+}
+
+// GetTitleSpans restituisce una copia della timeline titoli registrata
+func (w *TimeWatcher) GetTitleSpans() []WindowTitleSpan {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([]WindowTitleSpan, len(w.titleSpans))
+	copy(result, w.titleSpans)
 	return result
 }
 
+// CutSegment chiude i dati raccolti fino all'istante at e li passa a commit; se commit
+// non restituisce errore azzera i contatori, così il tracking prosegue senza interruzioni
+// su una nuova sessione (es. cambio di progetto o tipo attività). commit viene chiamata
+// con il lock del watcher tenuto: non deve usare il watcher.
+// Il tempo trascorso dall'ultimo tick fino ad at va al segmento chiuso, il resto al successivo.
+func (w *TimeWatcher) CutSegment(at time.Time, commit func(segment WatcherSegment) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	intervals := make([]ActiveInterval, len(w.intervals))
+	copy(intervals, w.intervals)
+	credited := w.running && !w.paused && !w.isIdle && w.currentApp != ""
+	if credited {
+		intervals = appendActive(intervals, w.currentApp, w.lastTickTime, at)
+	}
+
+	titleSpans := make([]WindowTitleSpan, len(w.titleSpans))
+	copy(titleSpans, w.titleSpans)
+	if w.titleSpanOpen && len(titleSpans) > 0 && at.After(titleSpans[len(titleSpans)-1].EndTime) {
+		titleSpans[len(titleSpans)-1].EndTime = at
+	}
+
+	segment := WatcherSegment{
+		TotalSeconds: sumActive(intervals),
+		AppTimes:     appTotals(intervals),
+		Intervals:    intervals,
+		Segments:     sessionLayout(intervals, closeOpenSegments(w.excluded, at)),
+		TitleSpans:   titleSpans,
+	}
+	if err := commit(segment); err != nil {
+		return err
+	}
+
+	w.intervals = nil
+	w.excluded = nil
+	if w.paused {
+		// La pausa in corso prosegue sul nuovo segmento
+		w.excluded = []SessionSegment{{Type: SegmentPaused, StartTime: at}}
+	}
+	w.lastSaveSeconds = 0
+	w.titleSpans = nil
+	w.titleSpanOpen = false
+	w.trackingStartTime = at
+	if credited && at.After(w.lastTickTime) {
+		w.lastTickTime = at
+	}
+
+	return nil
+}
+
+// SampleActivity legge subito processo e titolo della finestra in primo piano
+// (stringhe vuote se non disponibili)
+func (w *TimeWatcher) SampleActivity() (string, string) {
+	processName, err := w.activitySource.GetActiveProcessName()
+	if err != nil {
+		return "", ""
+	}
+	title, _ := w.activitySource.GetActiveWindow()
+	return processName, title
+}
+
 // GetPendingIdlePeriod restituisce il periodo idle in attesa di attribuzione
 func (w *TimeWatcher) GetPendingIdlePeriod() *IdlePeriod {
 	w.mu.Lock()
@@ -475,7 +921,7 @@ func (w *TimeWatcher) GetSessions() []AppSession {
 func (w *TimeWatcher) GetTotalActiveSeconds() int {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.totalActiveSeconds
+	return sumActive(w.intervals)
 }
 
 // GetTrackingStartTime restituisce quando è iniziato il tracking
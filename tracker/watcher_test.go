@@ -0,0 +1,473 @@
+package tracker
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// === SORGENTI FINTE E SIMULAZIONE ===
+
+// inputInterval è la cadenza degli input simulati dell'utente quando è attivo
+const inputInterval = 15 * time.Second
+
+// testStart è l'inizio delle simulazioni
+var testStart = time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+
+// assenza è un periodo senza input dell'utente, come offset dall'inizio della simulazione
+type assenza struct {
+	start, end time.Duration
+}
+
+// fakeUser simula gli input dell'utente e l'applicazione in primo piano.
+// Implementa ActivitySource e IdleSource.
+type fakeUser struct {
+	mu        sync.Mutex
+	clock     *ManualClock
+	assenze   []assenza
+	apps      []string      // app in primo piano, a rotazione
+	appEvery  time.Duration // cambio di app (0 = sempre la prima)
+	failEvery int           // una lettura dell'app su failEvery fallisce (0 = mai)
+	lookups   int
+}
+
+// lastInput restituisce l'ultimo input: gli input cadono ogni inputInterval
+// dall'inizio della simulazione, tranne che nei periodi di assenza
+func (u *fakeUser) lastInput(now time.Time) time.Time {
+	elapsed := now.Sub(testStart)
+	last := elapsed - elapsed%inputInterval
+	for _, a := range u.assenze {
+		if last > a.start && last < a.end {
+			last = a.start
+		}
+	}
+	return testStart.Add(last)
+}
+
+// GetIdleTime implementa IdleSource: l'idle segue l'orologio di sistema e, come quello
+// reale, include il tempo di sospensione
+func (u *fakeUser) GetIdleTime() (int, error) {
+	now := u.clock.Now()
+	return int(now.Sub(u.lastInput(now)).Seconds()), nil
+}
+
+// GetActiveProcessName implementa ActivitySource
+func (u *fakeUser) GetActiveProcessName() (string, error) {
+	u.mu.Lock()
+	u.lookups++
+	failed := u.failEvery > 0 && u.lookups%u.failEvery == 0
+	u.mu.Unlock()
+	if failed {
+		return "", fmt.Errorf("processo non disponibile")
+	}
+
+	if u.appEvery == 0 {
+		return u.apps[0], nil
+	}
+	step := int(u.clock.Now().Sub(testStart) / u.appEvery)
+	return u.apps[step%len(u.apps)], nil
+}
+
+// GetActiveWindow implementa ActivitySource
+func (u *fakeUser) GetActiveWindow() (string, error) {
+	return "", nil
+}
+
+// simulazione fa avanzare un ManualClock un tick alla volta, aspettando che il watcher
+// abbia elaborato ogni tick prima di proseguire
+type simulazione struct {
+	t       *testing.T
+	clock   *ManualClock
+	watcher *TimeWatcher
+	period  time.Duration
+	next    time.Duration // prossima scadenza del ticker, in tempo monotono
+}
+
+// avviaSimulazione crea un watcher con le sorgenti dell'utente simulato e lo avvia con
+// tick ogni intervalSeconds; setup (se non nil) configura il watcher prima dell'avvio
+func avviaSimulazione(t *testing.T, u *fakeUser, intervalSeconds int, setup func(w *TimeWatcher)) *simulazione {
+	t.Helper()
+	w := NewTimeWatcherWithSources(u, u)
+	w.SetClock(u.clock)
+	w.tickDone = make(chan struct{})
+	if setup != nil {
+		setup(w)
+	}
+
+	s := &simulazione{t: t, clock: u.clock, watcher: w, period: time.Duration(intervalSeconds) * time.Second}
+	s.next = u.clock.Elapsed() + s.period
+	w.Start(intervalSeconds)
+	return s
+}
+
+// avanza fa passare d di tempo simulato con i tick puntuali
+func (s *simulazione) avanza(d time.Duration) {
+	s.t.Helper()
+	s.muovi(d, 0)
+}
+
+// avanzaInRitardo fa passare d di tempo simulato in un solo passo: se supera la scadenza
+// del ticker simula un tick elaborato in ritardo (d deve essere minore di due intervalli)
+func (s *simulazione) avanzaInRitardo(d time.Duration) {
+	s.t.Helper()
+	s.muovi(d, s.period-time.Second)
+}
+
+// muovi fa passare d di tempo simulato. Ogni Advance si ferma al più maxLate dopo la
+// prossima scadenza del ticker, così ne attraversa una sola e nessun tick viene scartato;
+// dopo ogni scadenza aspetta che il watcher abbia elaborato il tick.
+func (s *simulazione) muovi(d, maxLate time.Duration) {
+	s.t.Helper()
+	for d > 0 {
+		step := d
+		if limit := s.next + maxLate - s.clock.Elapsed(); step > limit {
+			step = limit
+		}
+		s.clock.Advance(step)
+		d -= step
+		if s.clock.Elapsed() >= s.next {
+			s.attendiTick()
+			s.next += s.period
+		}
+	}
+}
+
+// avanzaFino fa avanzare l'orologio di sistema fino a offset dall'inizio della simulazione
+func (s *simulazione) avanzaFino(offset time.Duration) {
+	s.t.Helper()
+	s.avanza(testStart.Add(offset).Sub(s.clock.Now()))
+}
+
+// attendiTick aspetta che la goroutine del watcher abbia elaborato il tick
+func (s *simulazione) attendiTick() {
+	s.t.Helper()
+	select {
+	case <-s.watcher.tickDone:
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("il watcher non ha elaborato il tick")
+	}
+}
+
+// utenteAttivo restituisce un utente che usa sempre la stessa app, con le assenze indicate
+func utenteAttivo(assenze ...assenza) *fakeUser {
+	return &fakeUser{clock: NewManualClock(testStart), assenze: assenze, apps: []string{"Code.exe"}}
+}
+
+// === IDLE E SALVATAGGIO ===
+
+func TestWatcherIdleSottoSoglia(t *testing.T) {
+	u := utenteAttivo(assenza{10 * time.Minute, 14 * time.Minute})
+	idleCalls := 0
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+		w.SetIdleThreshold(300)
+		w.SetOnIdleCallback(func() { idleCalls++ })
+	})
+
+	s.avanzaFino(20 * time.Minute)
+	s.watcher.Stop()
+
+	if got, want := s.watcher.GetTotalActiveSeconds(), 1200; got != want {
+		t.Errorf("secondi attivi = %d, attesi %d: un'assenza sotto soglia resta tempo attivo", got, want)
+	}
+	if idleCalls != 0 {
+		t.Errorf("callback idle chiamata %d volte, attese 0", idleCalls)
+	}
+	if p := s.watcher.GetPendingIdlePeriod(); p != nil {
+		t.Errorf("periodo idle inatteso: %+v", *p)
+	}
+}
+
+func TestWatcherIdleERipresa(t *testing.T) {
+	u := utenteAttivo(assenza{10 * time.Minute, 30 * time.Minute})
+	idleCalls := 0
+	var returnMinutes []int
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+		w.SetIdleThreshold(300)
+		w.SetOnIdleCallback(func() { idleCalls++ })
+		w.SetOnIdleReturnCallback(func(minutes int) { returnMinutes = append(returnMinutes, minutes) })
+	})
+
+	// La soglia viene superata a 15 minuti: l'idle parte comunque dall'ultimo input
+	s.avanzaFino(20 * time.Minute)
+	if idleCalls != 1 {
+		t.Fatalf("callback idle chiamata %d volte, attesa 1", idleCalls)
+	}
+	if got, want := s.watcher.GetTotalActiveSeconds(), 600; got != want {
+		t.Errorf("secondi attivi durante l'idle = %d, attesi %d", got, want)
+	}
+
+	s.avanzaFino(40 * time.Minute)
+	s.watcher.Stop()
+
+	if len(returnMinutes) != 1 || returnMinutes[0] != 20 {
+		t.Errorf("callback di ritorno = %v, attesa una chiamata con 20 minuti", returnMinutes)
+	}
+	if got, want := s.watcher.GetTotalActiveSeconds(), 1200; got != want {
+		t.Errorf("secondi attivi = %d, attesi %d", got, want)
+	}
+
+	p := s.watcher.GetPendingIdlePeriod()
+	if p == nil {
+		t.Fatal("nessun periodo idle in attesa di attribuzione")
+	}
+	if !p.StartTime.Equal(testStart.Add(10*time.Minute)) || !p.EndTime.Equal(testStart.Add(30*time.Minute)) || p.Duration != 1200 {
+		t.Errorf("periodo idle = %s - %s (%d sec), atteso 09:10:00 - 09:30:00 (1200 sec)",
+			p.StartTime.Format("15:04:05"), p.EndTime.Format("15:04:05"), p.Duration)
+	}
+}
+
+func TestWatcherSogliaIdle(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		wantIdle  bool
+	}{
+		{"sotto la soglia", 311, false},
+		{"alla soglia", 310, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Nessun input dalle 09:05:00 alle 09:10:15: l'idle massimo riportato è 310 secondi,
+			// al tick delle 09:10:10
+			u := utenteAttivo(assenza{5 * time.Minute, 10*time.Minute + 15*time.Second})
+			s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) { w.SetIdleThreshold(tt.threshold) })
+			s.avanzaFino(15 * time.Minute)
+			s.watcher.Stop()
+
+			if gotIdle := s.watcher.GetPendingIdlePeriod() != nil; gotIdle != tt.wantIdle {
+				t.Errorf("idle rilevato = %v, atteso %v", gotIdle, tt.wantIdle)
+			}
+			want := 900
+			if tt.wantIdle {
+				want = 585 // idle dalle 09:05:00 al ritorno delle 09:10:15
+			}
+			if got := s.watcher.GetTotalActiveSeconds(); got != want {
+				t.Errorf("secondi attivi = %d, attesi %d", got, want)
+			}
+		})
+	}
+}
+
+func TestWatcherSalvataggioAutomatico(t *testing.T) {
+	u := utenteAttivo()
+	var saved []int
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+		w.SetSaveCallback(func(totalSeconds int) error {
+			saved = append(saved, totalSeconds)
+			return nil
+		}, 60)
+	})
+
+	s.avanzaFino(5*time.Minute + 30*time.Second)
+	s.watcher.Stop()
+
+	want := []int{60, 120, 180, 240, 300}
+	if fmt.Sprint(saved) != fmt.Sprint(want) {
+		t.Errorf("salvataggi = %v, attesi %v", saved, want)
+	}
+}
+
+func TestWatcherSalvataggioAutomaticoRiprovaDopoErrore(t *testing.T) {
+	u := utenteAttivo()
+	var attempts []int
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+		w.SetSaveCallback(func(totalSeconds int) error {
+			attempts = append(attempts, totalSeconds)
+			if len(attempts) == 1 {
+				return fmt.Errorf("database occupato")
+			}
+			return nil
+		}, 60)
+	})
+
+	s.avanzaFino(2*time.Minute + 5*time.Second)
+	s.watcher.Stop()
+
+	// Il primo salvataggio fallisce: si riprova al tick successivo, poi si riparte dall'ultimo riuscito
+	want := []int{60, 65, 125}
+	if fmt.Sprint(attempts) != fmt.Sprint(want) {
+		t.Errorf("tentativi di salvataggio = %v, attesi %v", attempts, want)
+	}
+}
+
+func TestWatcherIdleNonSupportato(t *testing.T) {
+	// Anche con un'assenza oltre soglia, senza backend per l'inattività il tempo viene tracciato
+	u := utenteAttivo(assenza{5 * time.Minute, 15 * time.Minute})
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+		w.idleSource = unsupportedSource{}
+		w.SetIdleThreshold(300)
+	})
+
+	s.avanzaFino(20 * time.Minute)
+	s.watcher.Stop()
+
+	if got, want := s.watcher.GetTotalActiveSeconds(), 1200; got != want {
+		t.Errorf("secondi attivi = %d, attesi %d", got, want)
+	}
+	if p := s.watcher.GetPendingIdlePeriod(); p != nil {
+		t.Errorf("periodo idle inatteso: %+v", *p)
+	}
+}
+
+// === SOSPENSIONE ===
+
+func TestWatcherSospensioneCompensaIdle(t *testing.T) {
+	tests := []struct {
+		name       string
+		assenza    assenza // nessun input dall'inizio della sospensione (10 minuti)
+		wantIdle   bool
+		idleStart  time.Duration
+		idleEnd    time.Duration
+		wantActive int
+	}{
+		// Al risveglio il sistema riporta oltre un'ora di idle, ma 2 minuti restano sotto soglia
+		{"ritorno entro la soglia", assenza{10 * time.Minute, 72 * time.Minute}, false, 0, 0, 1800},
+		// L'idle parte dal risveglio, non dall'ultimo input prima della sospensione
+		{"ritorno oltre la soglia", assenza{10 * time.Minute, 80 * time.Minute}, true, 70 * time.Minute, 80 * time.Minute, 1200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := utenteAttivo(tt.assenza)
+			var suspended []IdlePeriod
+			s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+				w.SetIdleThreshold(300)
+				w.SetOnSuspendCallback(func(period IdlePeriod) { suspended = append(suspended, period) })
+			})
+
+			// Sospensione di un'ora: l'orologio di sistema avanza, quello monotono no
+			s.avanzaFino(10 * time.Minute)
+			s.clock.Set(s.clock.Now().Add(time.Hour))
+			s.avanzaFino(90 * time.Minute)
+			s.watcher.Stop()
+
+			if len(suspended) != 1 {
+				t.Fatalf("sospensioni rilevate = %d, attesa 1", len(suspended))
+			}
+			if p := suspended[0]; !p.StartTime.Equal(testStart.Add(10*time.Minute)) || p.Duration != 3600 {
+				t.Errorf("sospensione = dal %s, %d sec; attesa dalle 09:10:00, 3600 sec", p.StartTime.Format("15:04:05"), p.Duration)
+			}
+
+			p := s.watcher.GetPendingIdlePeriod()
+			if gotIdle := p != nil; gotIdle != tt.wantIdle {
+				t.Fatalf("idle rilevato = %v, atteso %v", gotIdle, tt.wantIdle)
+			}
+			if p != nil && (!p.StartTime.Equal(testStart.Add(tt.idleStart)) || !p.EndTime.Equal(testStart.Add(tt.idleEnd))) {
+				t.Errorf("periodo idle = %s - %s, atteso %s - %s",
+					p.StartTime.Format("15:04:05"), p.EndTime.Format("15:04:05"),
+					testStart.Add(tt.idleStart).Format("15:04:05"), testStart.Add(tt.idleEnd).Format("15:04:05"))
+			}
+			if got := s.watcher.GetTotalActiveSeconds(); got != tt.wantActive {
+				t.Errorf("secondi attivi = %d, attesi %d", got, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestWatcherSalvataggioDopoSospensione(t *testing.T) {
+	u := utenteAttivo()
+	var saved []int
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) {
+		w.SetSaveCallback(func(totalSeconds int) error {
+			saved = append(saved, totalSeconds)
+			return nil
+		}, 60)
+	})
+
+	// Il tempo sospeso non conta: il salvataggio segue i tick, non l'orologio di sistema
+	s.avanzaFino(50 * time.Second)
+	s.clock.Set(s.clock.Now().Add(time.Hour))
+	s.avanza(70 * time.Second)
+	s.watcher.Stop()
+
+	want := []int{60, 120}
+	if fmt.Sprint(saved) != fmt.Sprint(want) {
+		t.Errorf("salvataggi = %v, attesi %v", saved, want)
+	}
+}
+
+// === GIORNATA DI LAVORO ===
+
+// TestWatcherGiornataSenzaScarti simula una giornata di lavoro di 8 ore (cambi di applicazione,
+// errori di rilevamento, tick ritardati, idle, pausa, sospensione del computer, cambio di
+// progetto) e verifica che il tempo attivo calcolato non abbia scarti
+func TestWatcherGiornataSenzaScarti(t *testing.T) {
+	u := &fakeUser{
+		clock: NewManualClock(testStart),
+		assenze: []assenza{
+			{1 * time.Hour, 1*time.Hour + 2*time.Minute},  // sotto soglia: resta attivo
+			{2 * time.Hour, 2*time.Hour + 20*time.Minute}, // idle
+		},
+		apps:      []string{"Code.exe", "chrome.exe", "EXCEL.EXE"},
+		appEvery:  7 * time.Minute,
+		failEvery: 13,
+	}
+	s := avviaSimulazione(t, u, 5, func(w *TimeWatcher) { w.SetIdleThreshold(300) })
+
+	// Passi irregolari: i tick arrivano in ritardo
+	rng := rand.New(rand.NewSource(1))
+	runUntil := func(offset time.Duration) {
+		target := testStart.Add(offset)
+		for s.clock.Now().Before(target) {
+			step := time.Duration(1+rng.Intn(9)) * time.Second
+			if remaining := target.Sub(s.clock.Now()); step > remaining {
+				step = remaining
+			}
+			s.avanzaInRitardo(step)
+		}
+	}
+
+	// Pausa pranzo
+	runUntil(3 * time.Hour)
+	s.watcher.Pause()
+	runUntil(3*time.Hour + 45*time.Minute)
+	s.watcher.Resume()
+
+	// Sospensione di un'ora: l'orologio di sistema avanza, quello monotono no
+	runUntil(4*time.Hour + 30*time.Minute)
+	s.clock.Set(s.clock.Now().Add(time.Hour))
+
+	// Cambio di progetto a metà tick
+	runUntil(6*time.Hour + 2*time.Second)
+	var segments []WatcherSegment
+	err := s.watcher.CutSegment(s.clock.Now(), func(segment WatcherSegment) error {
+		segments = append(segments, segment)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("errore taglio segmento: %v", err)
+	}
+
+	runUntil(8 * time.Hour)
+	s.watcher.Stop()
+	segments = append(segments, WatcherSegment{
+		TotalSeconds: s.watcher.GetTotalActiveSeconds(),
+		AppTimes:     s.watcher.GetStats(),
+		Intervals:    s.watcher.GetActiveIntervals(),
+	})
+
+	total := 0
+	for i, segment := range segments {
+		appTotal := 0
+		for _, seconds := range segment.AppTimes {
+			appTotal += seconds
+		}
+		if appTotal != segment.TotalSeconds {
+			t.Errorf("segmento %d: somma per app %d, totale %d", i+1, appTotal, segment.TotalSeconds)
+		}
+		for j := 1; j < len(segment.Intervals); j++ {
+			if segment.Intervals[j].StartTime.Before(segment.Intervals[j-1].EndTime) {
+				t.Errorf("segmento %d: intervalli sovrapposti %v e %v", i+1, segment.Intervals[j-1], segment.Intervals[j])
+			}
+		}
+		total += segment.TotalSeconds
+	}
+
+	expected := int((8*time.Hour - 20*time.Minute - 45*time.Minute - time.Hour).Seconds())
+	if total != expected {
+		t.Errorf("tempo attivo %d secondi, atteso %d: scarto di %d secondi", total, expected, total-expected)
+	}
+}
@@ -0,0 +1,213 @@
+package tracker
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// === SCRITTURA XLSX ===
+//
+// Sottoinsieme minimo di Office Open XML per generare cartelle di lavoro Excel senza librerie
+// esterne: testi inline, numeri, date, formule e un foglio di stili fisso.
+
+// Stili delle celle (indici di cellXfs in xlsxStyles)
+const (
+	xlsxStyleNormal    = 0
+	xlsxStyleHeader    = 1 // grassetto
+	xlsxStyleDate      = 2 // gg/mm/aaaa
+	xlsxStyleHours     = 3 // due decimali
+	xlsxStyleHoursBold = 4 // due decimali, grassetto
+)
+
+// xlsxCell è una cella: Value è string, float64 o time.Time (data); con Formula, Value è il
+// risultato già calcolato mostrato finché il foglio non viene ricalcolato
+type xlsxCell struct {
+	Value   interface{}
+	Formula string
+	Style   int
+}
+
+// xlsxSheet è un foglio di lavoro
+type xlsxSheet struct {
+	Name       string
+	Rows       [][]xlsxCell // una riga vuota lascia uno spazio
+	Widths     []float64    // larghezza delle colonne in caratteri (0 = predefinita)
+	FrozenRows int          // righe di intestazione bloccate durante lo scorrimento
+}
+
+// colonnaXLSX restituisce la lettera della colonna (0 = "A", 26 = "AA")
+func colonnaXLSX(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// cellaXLSX restituisce il riferimento di una cella (colonna e riga da 0)
+func cellaXLSX(col, row int) string {
+	return colonnaXLSX(col) + strconv.Itoa(row+1)
+}
+
+// dataSerialeXLSX converte una data nel numero seriale di Excel (giorni dal 30/12/1899)
+func dataSerialeXLSX(t time.Time) float64 {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return date.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+// scriviXLSX scrive in w una cartella di lavoro con i fogli indicati
+func scriviXLSX(w io.Writer, sheets []xlsxSheet) error {
+	zw := zip.NewWriter(w)
+
+	type part struct {
+		name    string
+		content []byte
+	}
+	parts := []part{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", []byte(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`)},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, part{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxWorksheet(sheet)})
+	}
+
+	for _, f := range parts {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("errore scrittura XLSX (%s): %v", f.name, err)
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return fmt.Errorf("errore scrittura XLSX (%s): %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("errore scrittura XLSX: %v", err)
+	}
+	return nil
+}
+
+// xlsxContentTypes genera [Content_Types].xml
+func xlsxContentTypes(sheetCount int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheetCount; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.Bytes()
+}
+
+// xlsxWorkbook genera xl/workbook.xml; le formule vengono ricalcolate all'apertura
+func xlsxWorkbook(sheets []xlsxSheet) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(sheet.Name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets><calcPr calcId="0" fullCalcOnLoad="1"/></workbook>`)
+	return b.Bytes()
+}
+
+// xlsxWorkbookRels genera xl/_rels/workbook.xml.rels: un riferimento per foglio, poi gli stili
+func xlsxWorkbookRels(sheetCount int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheetCount; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheetCount+1)
+	b.WriteString(`</Relationships>`)
+	return b.Bytes()
+}
+
+// xlsxWorksheet genera xl/worksheets/sheetN.xml
+func xlsxWorksheet(sheet xlsxSheet) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	if sheet.FrozenRows > 0 {
+		fmt.Fprintf(&b, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="%d" topLeftCell="%s" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`,
+			sheet.FrozenRows, cellaXLSX(0, sheet.FrozenRows))
+	}
+
+	if len(sheet.Widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, width := range sheet.Widths {
+			if width > 0 {
+				fmt.Fprintf(&b, `<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(width, 'f', -1, 64))
+			}
+		}
+		b.WriteString(`</cols>`)
+	}
+
+	b.WriteString(`<sheetData>`)
+	for r, row := range sheet.Rows {
+		if len(row) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			if cell.Value == nil && cell.Formula == "" {
+				continue
+			}
+			ref := cellaXLSX(c, r)
+			switch v := cell.Value.(type) {
+			case string:
+				fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, cell.Style)
+				xml.EscapeText(&b, []byte(v))
+				b.WriteString(`</t></is></c>`)
+			case time.Time:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.Style, strconv.FormatFloat(dataSerialeXLSX(v), 'f', -1, 64))
+			default:
+				fmt.Fprintf(&b, `<c r="%s" s="%d">`, ref, cell.Style)
+				if cell.Formula != "" {
+					b.WriteString(`<f>`)
+					xml.EscapeText(&b, []byte(cell.Formula))
+					b.WriteString(`</f>`)
+				}
+				if number, ok := v.(float64); ok {
+					fmt.Fprintf(&b, `<v>%s</v>`, strconv.FormatFloat(number, 'f', -1, 64))
+				}
+				b.WriteString(`</c>`)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.Bytes()
+}
+
+// xlsxStyles contiene i formati usati dalle celle, nell'ordine delle costanti xlsxStyle*
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="dd/mm/yyyy"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="2" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
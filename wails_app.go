@@ -14,13 +14,21 @@ import (
 
 // App struct per Wails - espone metodi al frontend
 type App struct {
-	ctx context.Context
-	db  *sql.DB
+	ctx      context.Context
+	db       *sql.DB
+	clock    tracker.Clock
+	tracking *tracker.TrackingService
 }
 
 // NewApp crea una nuova istanza App
 func NewApp() *App {
-	return &App{}
+	return newAppWithClock(tracker.SystemClock)
+}
+
+// newAppWithClock crea una nuova istanza App con un orologio specifico
+func newAppWithClock(clock tracker.Clock) *App {
+	tracker.SetClock(clock)
+	return &App{clock: clock}
 }
 
 // startup viene chiamato all'avvio dell'app
@@ -28,9 +36,19 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 }
 
-// SetDB imposta il database
+// SetDB imposta il database e crea il servizio di tracking (carica anche la soglia idle)
 func (a *App) SetDB(db *sql.DB) {
 	a.db = db
+	a.tracking = tracker.NewTrackingService(db, a.clock)
+	a.tracking.SetEventHandler(a.handleTrackingEvent)
+}
+
+// shutdown viene chiamato alla chiusura dell'app
+func (a *App) shutdown(ctx context.Context) {
+	// Ferma tracking se attivo
+	if a.tracking != nil {
+		a.tracking.Shutdown()
+	}
 }
 
 // === PROGETTI ===
@@ -59,9 +77,9 @@ func (a *App) GetProjects() ([]ProjectData, error) {
 			ID:          p.ID,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
+			CreatedAt:   tracker.ToLocal(p.CreatedAt),
 			Archived:    p.Archived,
-			ClosedAt:    p.ClosedAt,
+			ClosedAt:    tracker.ToLocal(p.ClosedAt),
 			NoteText:    p.NoteText,
 		})
 	}
@@ -81,9 +99,9 @@ func (a *App) GetArchivedProjects() ([]ProjectData, error) {
 			ID:          p.ID,
 			Name:        p.Name,
 			Description: p.Description,
-			CreatedAt:   p.CreatedAt,
+			CreatedAt:   tracker.ToLocal(p.CreatedAt),
 			Archived:    p.Archived,
-			ClosedAt:    p.ClosedAt,
+			ClosedAt:    tracker.ToLocal(p.ClosedAt),
 			NoteText:    p.NoteText,
 		})
 	}
@@ -134,23 +152,66 @@ func (a *App) GetProjectReport(projectID int) (map[string]interface{}, error) {
 
 // SessionData rappresenta una sessione
 type SessionData struct {
-	ID           int     `json:"id"`
-	AppName      string  `json:"app_name"`
-	Seconds      int     `json:"seconds"`
-	ProjectID    *int    `json:"project_id,omitempty"`
-	ProjectName  string  `json:"project_name"`
-	SessionType  string  `json:"session_type"`
-	ActivityType *string `json:"activity_type,omitempty"`
-	Timestamp    string  `json:"timestamp"`
+	ID           int                 `json:"id"`
+	AppName      string              `json:"app_name"`
+	Seconds      int                 `json:"seconds"`
+	ProjectID    *int                `json:"project_id,omitempty"`
+	ProjectName  string              `json:"project_name"`
+	SessionType  string              `json:"session_type"`
+	ActivityType *string             `json:"activity_type,omitempty"`
+	Timestamp    string              `json:"timestamp"`           // ora locale del fuso configurato
+	EndedAt      string              `json:"ended_at,omitempty"`  // vuoto se la sessione è in corso
+	TimeZone     string              `json:"time_zone,omitempty"` // fuso in cui è stata registrata
+	Pauses       []PauseIntervalData `json:"pauses,omitempty"`
+	Segments     []SegmentData       `json:"segments,omitempty"`
+}
+
+// PauseIntervalData rappresenta una pausa all'interno di una sessione
+type PauseIntervalData struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time,omitempty"` // vuoto se la pausa è in corso
 }
 
-// GetSessions restituisce le sessioni in un periodo
+// SegmentData rappresenta un tratto di una sessione registrata dal tracking
+type SegmentData struct {
+	Type      string `json:"type"` // "active", "idle", "paused" o "suspended"
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time,omitempty"` // vuoto se il tratto è in corso
+}
+
+// GetSessions restituisce le sessioni in un periodo (con le relative pause, per la timeline)
 func (a *App) GetSessions(startDate, endDate string) ([]SessionData, error) {
 	sessions, err := tracker.CaricaSessioniDettagliate(a.db, startDate, endDate)
 	if err != nil {
 		return nil, err
 	}
 
+	pauses, err := tracker.CaricaPausePeriodo(a.db, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	pausesBySession := make(map[int][]PauseIntervalData)
+	for _, p := range pauses {
+		data := PauseIntervalData{StartTime: tracker.FormatLocal(p.StartTime)}
+		if !p.EndTime.IsZero() {
+			data.EndTime = tracker.FormatLocal(p.EndTime)
+		}
+		pausesBySession[p.SessionID] = append(pausesBySession[p.SessionID], data)
+	}
+
+	segments, err := tracker.CaricaSegmentiPeriodo(a.db, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	segmentsBySession := make(map[int][]SegmentData)
+	for _, seg := range segments {
+		data := SegmentData{Type: seg.Type, StartTime: tracker.FormatLocal(seg.StartTime)}
+		if !seg.EndTime.IsZero() {
+			data.EndTime = tracker.FormatLocal(seg.EndTime)
+		}
+		segmentsBySession[seg.SessionID] = append(segmentsBySession[seg.SessionID], data)
+	}
+
 	var result []SessionData
 	for _, s := range sessions {
 		result = append(result, SessionData{
@@ -161,7 +222,11 @@ func (a *App) GetSessions(startDate, endDate string) ([]SessionData, error) {
 			ProjectName:  s.ProjectName,
 			SessionType:  s.SessionType,
 			ActivityType: s.ActivityType,
-			Timestamp:    s.Timestamp,
+			Timestamp:    tracker.ToLocal(s.Timestamp),
+			EndedAt:      tracker.ToLocal(s.EndedAt),
+			TimeZone:     s.TimeZone,
+			Pauses:       pausesBySession[s.ID],
+			Segments:     segmentsBySession[s.ID],
 		})
 	}
 	return result, nil
@@ -212,7 +277,9 @@ func (a *App) GetSessionById(sessionID int) (*SessionData, error) {
 		ProjectName:  session.ProjectName,
 		SessionType:  session.SessionType,
 		ActivityType: session.ActivityType,
-		Timestamp:    session.Timestamp,
+		Timestamp:    tracker.ToLocal(session.Timestamp),
+		EndedAt:      tracker.ToLocal(session.EndedAt),
+		TimeZone:     session.TimeZone,
 	}, nil
 }
 
@@ -225,15 +292,29 @@ type ActivityTypeData struct {
 	ColorVariant float64 `json:"color_variant"`
 	Pattern      string  `json:"pattern"`
 	DisplayOrder int     `json:"display_order"`
+	Archived     bool    `json:"archived"`
 }
 
-// GetActivityTypes restituisce tutti i tipi di attività
+// GetActivityTypes restituisce i tipi di attività attivi
 func (a *App) GetActivityTypes() ([]ActivityTypeData, error) {
 	types, err := tracker.CaricaTipiAttivita(a.db)
 	if err != nil {
 		return nil, err
 	}
+	return toActivityTypeData(types), nil
+}
+
+// GetArchivedActivityTypes restituisce i tipi di attività archiviati
+func (a *App) GetArchivedActivityTypes() ([]ActivityTypeData, error) {
+	types, err := tracker.CaricaTipiAttivitaArchiviati(a.db)
+	if err != nil {
+		return nil, err
+	}
+	return toActivityTypeData(types), nil
+}
 
+// toActivityTypeData converte i tipi di attività per il frontend
+func toActivityTypeData(types []tracker.ActivityType) []ActivityTypeData {
 	var result []ActivityTypeData
 	for _, t := range types {
 		result = append(result, ActivityTypeData{
@@ -242,9 +323,10 @@ func (a *App) GetActivityTypes() ([]ActivityTypeData, error) {
 			ColorVariant: t.ColorVariant,
 			Pattern:      t.Pattern,
 			DisplayOrder: t.DisplayOrder,
+			Archived:     t.Archived,
 		})
 	}
-	return result, nil
+	return result
 }
 
 // CreateActivityType crea un nuovo tipo di attività
@@ -257,9 +339,14 @@ func (a *App) UpdateActivityType(id int, name string, colorVariant float64, patt
 	return tracker.AggiornaTipoAttivita(a.db, id, name, colorVariant, pattern, displayOrder)
 }
 
-// DeleteActivityType elimina un tipo di attività
-func (a *App) DeleteActivityType(id int) error {
-	return tracker.EliminaTipoAttivita(a.db, id)
+// ArchiveActivityType archivia un tipo di attività
+func (a *App) ArchiveActivityType(id int) error {
+	return tracker.ArchivaTipoAttivita(a.db, id)
+}
+
+// ReactivateActivityType riattiva un tipo di attività archiviato
+func (a *App) ReactivateActivityType(id int) error {
+	return tracker.RiattivaTipoAttivita(a.db, id)
 }
 
 // ReorderActivityTypes aggiorna l'ordine dei tipi di attività
@@ -276,149 +363,214 @@ func (a *App) ReorderActivityTypes(updates []map[string]int) error {
 
 // TrackingState rappresenta lo stato del tracking
 type TrackingState struct {
-	IsTracking      bool    `json:"is_tracking"`
-	ProjectID       *int    `json:"project_id,omitempty"`
-	ProjectName     string  `json:"project_name,omitempty"`
-	ActivityType    *string `json:"activity_type,omitempty"`
-	StartTime       string  `json:"start_time,omitempty"`
-	ElapsedSeconds  int     `json:"elapsed_seconds"`
-	SessionID       int64   `json:"session_id,omitempty"`
+	IsTracking     bool    `json:"is_tracking"`
+	Status         string  `json:"status"`
+	ProjectID      *int    `json:"project_id,omitempty"`
+	ProjectName    string  `json:"project_name,omitempty"`
+	ActivityType   *string `json:"activity_type,omitempty"`
+	StartTime      string  `json:"start_time,omitempty"`
+	ElapsedSeconds int     `json:"elapsed_seconds"`
+	SessionID      int64   `json:"session_id,omitempty"`
+	PausedAt       string  `json:"paused_at,omitempty"`
+	HasPendingIdle bool    `json:"has_pending_idle"`
+	HasSuspended   bool    `json:"has_suspended"`
 }
 
-// GetTrackingState restituisce lo stato corrente del tracking
-func (a *App) GetTrackingState() TrackingState {
-	globalStateMu.Lock()
-	defer globalStateMu.Unlock()
-
+// toTrackingState converte lo stato del servizio per il frontend
+func toTrackingState(snapshot tracker.TrackingSnapshot) TrackingState {
 	state := TrackingState{
-		IsTracking: globalIsTracking,
-		SessionID:  globalPendingSessionID,
+		IsTracking:     snapshot.Status == tracker.StatusTracking || snapshot.Status == tracker.StatusPaused,
+		Status:         string(snapshot.Status),
+		SessionID:      snapshot.SessionID,
+		ElapsedSeconds: snapshot.ElapsedSeconds,
+		HasPendingIdle: snapshot.PendingIdle != nil,
+		HasSuspended:   snapshot.PendingSuspended != nil,
 	}
 
-	if globalIsTracking && globalCurrentProject != nil {
-		state.ProjectID = &globalCurrentProject.ID
-		state.ProjectName = globalCurrentProject.Name
+	if snapshot.Project != nil {
+		state.ProjectID = &snapshot.Project.ID
+		state.ProjectName = snapshot.Project.Name
+		state.ActivityType = snapshot.ActivityType
 	}
-
-	if globalWatcher != nil {
-		state.ElapsedSeconds = globalWatcher.GetTotalActiveSeconds()
+	if !snapshot.StartTime.IsZero() {
+		state.StartTime = tracker.FormatLocal(snapshot.StartTime)
+	}
+	if !snapshot.PausedAt.IsZero() {
+		state.PausedAt = tracker.FormatLocal(snapshot.PausedAt)
 	}
 
 	return state
 }
 
-// StartTracking avvia il tracking per un progetto
+// GetTrackingState restituisce lo stato corrente del tracking
+func (a *App) GetTrackingState() TrackingState {
+	return toTrackingState(a.tracking.State())
+}
+
+// StartTracking avvia il tracking per un progetto.
+// Se projectID <= 0 o activityType è nil, i valori mancanti vengono presi dalla prima
+// regola automatica che corrisponde all'applicazione in primo piano.
 func (a *App) StartTracking(projectID int, activityType *string) error {
-	project, err := tracker.TrovaProgettoById(a.db, projectID)
-	if err != nil {
-		return err
-	}
+	return a.tracking.Start(projectID, activityType)
+}
 
-	// Crea sessione pendente
-	startTime := time.Now().Format("2006-01-02 15:04:05")
-	sessionID, err := tracker.StartPendingTracking(a.db, &projectID, activityType, startTime)
-	if err != nil {
-		return err
-	}
+// StopTracking ferma il tracking corrente
+func (a *App) StopTracking() (int, error) {
+	return a.tracking.Stop()
+}
 
-	// Crea watcher
-	watcher := tracker.NewTimeWatcher()
-	idleMinutes := GetGlobalIdleThreshold()
-	watcher.SetIdleThreshold(idleMinutes * 60) // Converti minuti in secondi
+// SwitchTracking passa a un altro progetto o tipo di attività senza fermare il timer:
+// la sessione corrente si chiude e la nuova inizia nello stesso istante
+func (a *App) SwitchTracking(projectID int, activityType *string) error {
+	return a.tracking.Switch(projectID, activityType)
+}
 
-	// Imposta callback per salvataggio periodico
-	watcher.SetSaveCallback(func(totalSeconds int) error {
-		return tracker.UpdatePendingTracking(a.db, sessionID, totalSeconds)
-	}, 300) // Ogni 5 minuti
+// PauseTracking mette in pausa il tracking corrente senza chiudere la sessione
+func (a *App) PauseTracking() error {
+	return a.tracking.Pause()
+}
 
-	// Imposta callback per auto-stop quando viene rilevato idle
-	watcher.SetOnIdleCallback(func() {
-		a.autoStopOnIdle(watcher, sessionID)
-	})
+// ResumeTracking riprende il tracking in pausa
+func (a *App) ResumeTracking() error {
+	return a.tracking.Resume()
+}
 
-	// Imposta callback per notifica quando l'utente torna dall'idle
-	watcher.SetOnIdleReturnCallback(func(minutes int) {
-		// Invia notifica toast Windows
-		a.ShowIdleNotification(minutes)
-		// Prova anche a portare la finestra in primo piano
-		a.BringWindowToFront()
-	})
+// handleTrackingEvent inoltra gli eventi del servizio di tracking al frontend
+func (a *App) handleTrackingEvent(event tracker.TrackingEvent) {
+	switch event.Type {
+	case tracker.EventStateChanged:
+		runtime.EventsEmit(a.ctx, "tracking-state-changed", toTrackingState(event.State))
 
-	watcher.Start(5)
+	case tracker.EventAutoStopped:
+		runtime.EventsEmit(a.ctx, "tracking-auto-stopped", map[string]interface{}{
+			"seconds": event.Seconds,
+			"reason":  "idle",
+		})
 
-	// Aggiorna stato globale
-	SetGlobalTrackingState(watcher, project, true, sessionID)
+	case tracker.EventSwitched:
+		data := map[string]interface{}{
+			"session_id":    event.State.SessionID,
+			"project_id":    event.State.Project.ID,
+			"activity_type": event.State.ActivityType,
+		}
+		if event.Rule != nil {
+			data["rule"] = event.Rule.Name
+		}
+		runtime.EventsEmit(a.ctx, "tracking-switched", data)
 
-	return nil
-}
+	case tracker.EventRuleSuggestion:
+		runtime.EventsEmit(a.ctx, "rule-suggestion", toAssignmentRuleData(*event.Rule))
 
-// autoStopOnIdle ferma automaticamente il tracking quando viene rilevato idle
-func (a *App) autoStopOnIdle(watcher *tracker.TimeWatcher, sessionID int64) {
-	globalStateMu.Lock()
-	defer globalStateMu.Unlock()
+	case tracker.EventSuspended:
+		runtime.EventsEmit(a.ctx, "tracking-suspended", toIdlePeriodData(event.Period))
 
-	// Verifica che il tracking sia ancora attivo con questo watcher
-	if !globalIsTracking || globalWatcher != watcher {
-		fmt.Println("[IDLE-AUTOSTOP] Tracking già fermato o watcher diverso, skip")
-		return
+	case tracker.EventIdleReturn:
+		// Invia notifica toast Windows
+		a.ShowIdleNotification(event.IdleMinutes)
+		// Prova anche a portare la finestra in primo piano
+		a.BringWindowToFront()
 	}
+}
 
-	// Ferma il watcher (non blocca perché chiamato dalla goroutine del watcher stesso)
-	// NON chiamare watcher.Stop() qui perché siamo già dentro la goroutine
-	finalSeconds := watcher.GetTotalActiveSeconds()
+// === REGOLE DI ASSEGNAZIONE ===
 
-	// Salva la sessione finale nel database
-	if sessionID > 0 && finalSeconds > 0 {
-		err := tracker.FinalizePendingTracking(a.db, sessionID, finalSeconds)
-		if err != nil {
-			fmt.Printf("[IDLE-AUTOSTOP] Errore salvataggio sessione: %v\n", err)
-		} else {
-			fmt.Printf("[IDLE-AUTOSTOP] Sessione salvata: %d secondi (%d min)\n", finalSeconds, finalSeconds/60)
-		}
+// AssignmentRuleData rappresenta una regola di assegnazione automatica
+type AssignmentRuleData struct {
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Priority     int     `json:"priority"`
+	Enabled      bool    `json:"enabled"`
+	ProcessName  string  `json:"process_name"`
+	TitlePattern string  `json:"title_pattern"`
+	TimeFrom     string  `json:"time_from"`
+	TimeTo       string  `json:"time_to"`
+	ProjectID    *int    `json:"project_id,omitempty"`
+	ActivityType *string `json:"activity_type,omitempty"`
+	Mode         string  `json:"mode"`
+}
+
+// toAssignmentRuleData converte una regola per il frontend
+func toAssignmentRuleData(r tracker.AssignmentRule) AssignmentRuleData {
+	return AssignmentRuleData{
+		ID:           r.ID,
+		Name:         r.Name,
+		Priority:     r.Priority,
+		Enabled:      r.Enabled,
+		ProcessName:  r.ProcessName,
+		TitlePattern: r.TitlePattern,
+		TimeFrom:     r.TimeFrom,
+		TimeTo:       r.TimeTo,
+		ProjectID:    r.ProjectID,
+		ActivityType: r.ActivityType,
+		Mode:         r.Mode,
 	}
+}
 
-	// Reset stato globale (tracking fermato) MA mantieni il watcher per il pending idle
-	globalIsTracking = false
-	globalCurrentProject = nil
-	// NON azzerare globalWatcher - serve per rilevare quando l'utente torna e mostrare il modale idle
-	// globalWatcher = nil
-	globalPendingSessionID = 0
+// fromAssignmentRuleData converte una regola ricevuta dal frontend
+func fromAssignmentRuleData(r AssignmentRuleData) tracker.AssignmentRule {
+	return tracker.AssignmentRule{
+		ID:           r.ID,
+		Name:         r.Name,
+		Priority:     r.Priority,
+		Enabled:      r.Enabled,
+		ProcessName:  r.ProcessName,
+		TitlePattern: r.TitlePattern,
+		TimeFrom:     r.TimeFrom,
+		TimeTo:       r.TimeTo,
+		ProjectID:    r.ProjectID,
+		ActivityType: r.ActivityType,
+		Mode:         r.Mode,
+	}
+}
 
-	// Emetti evento al frontend per notificare l'auto-stop
-	runtime.EventsEmit(a.ctx, "tracking-auto-stopped", map[string]interface{}{
-		"seconds": finalSeconds,
-		"reason":  "idle",
-	})
+// GetRules restituisce tutte le regole di assegnazione
+func (a *App) GetRules() ([]AssignmentRuleData, error) {
+	rules, err := tracker.CaricaRegole(a.db)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("[IDLE-AUTOSTOP] Tracking fermato automaticamente per inattività")
+	var result []AssignmentRuleData
+	for _, r := range rules {
+		result = append(result, toAssignmentRuleData(r))
+	}
+	return result, nil
 }
 
-// StopTracking ferma il tracking corrente
-func (a *App) StopTracking() (int, error) {
-	globalStateMu.Lock()
-	defer globalStateMu.Unlock()
+// CreateRule crea una nuova regola (attiva dal prossimo avvio del tracking)
+func (a *App) CreateRule(rule AssignmentRuleData) (int64, error) {
+	return tracker.CreaRegola(a.db, fromAssignmentRuleData(rule))
+}
 
-	if !globalIsTracking || globalWatcher == nil {
-		return 0, fmt.Errorf("nessun tracking in corso")
-	}
+// UpdateRule aggiorna una regola (attiva dal prossimo avvio del tracking)
+func (a *App) UpdateRule(rule AssignmentRuleData) error {
+	return tracker.AggiornaRegola(a.db, fromAssignmentRuleData(rule))
+}
 
-	globalWatcher.Stop()
-	finalSeconds := globalWatcher.GetTotalActiveSeconds()
+// DeleteRule elimina una regola
+func (a *App) DeleteRule(ruleID int) error {
+	return tracker.EliminaRegola(a.db, ruleID)
+}
 
-	if globalPendingSessionID > 0 {
-		err := tracker.FinalizePendingTracking(a.db, globalPendingSessionID, finalSeconds)
+// TestRules mostra quale regola verrebbe applicata a un'app, un titolo e un orario ("HH:MM",
+// vuoto = adesso) senza modificare nulla. Restituisce nil se nessuna regola corrisponde.
+func (a *App) TestRules(processName, title, at string) (*AssignmentRuleData, error) {
+	when := a.clock.Now()
+	if at != "" {
+		t, err := time.Parse("15:04", at)
 		if err != nil {
-			return 0, err
+			return nil, fmt.Errorf("orario non valido '%s' (formato HH:MM)", at)
 		}
+		when = time.Date(when.Year(), when.Month(), when.Day(), t.Hour(), t.Minute(), 0, 0, when.Location())
 	}
 
-	// Reset stato
-	globalIsTracking = false
-	globalCurrentProject = nil
-	globalWatcher = nil
-	globalPendingSessionID = 0
+	rule, err := tracker.ValutaRegole(a.db, tracker.RuleContext{ProcessName: processName, Title: title, Time: when})
+	if err != nil || rule == nil {
+		return nil, err
+	}
 
-	return finalSeconds, nil
+	data := toAssignmentRuleData(*rule)
+	return &data, nil
 }
 
 // === STATISTICHE ===
@@ -438,101 +590,240 @@ func (a *App) GetMonthStats() (map[string]int, error) {
 	return tracker.CaricaSessioniMese(a.db)
 }
 
+// GetSessionAppUsage restituisce il tempo per applicazione di una sessione
+func (a *App) GetSessionAppUsage(sessionID int) (map[string]int, error) {
+	return tracker.CaricaUtilizzoAppSessione(a.db, sessionID)
+}
+
+// GetProjectAppUsage restituisce il tempo per applicazione di un progetto
+func (a *App) GetProjectAppUsage(projectID int) (map[string]int, error) {
+	return tracker.CaricaUtilizzoAppProgetto(a.db, projectID)
+}
+
+// GetAppUsage restituisce il tempo per applicazione in un periodo
+func (a *App) GetAppUsage(startDate, endDate string) (map[string]int, error) {
+	return tracker.CaricaUtilizzoAppPeriodo(a.db, startDate, endDate)
+}
+
+// === TIMELINE TITOLI FINESTRE ===
+
+// TitleCaptureSettingsData rappresenta le impostazioni della timeline titoli
+type TitleCaptureSettingsData struct {
+	Enabled           bool     `json:"enabled"`
+	ProcessOnly       bool     `json:"process_only"`
+	ExcludedProcesses []string `json:"excluded_processes"`
+	MaskPatterns      []string `json:"mask_patterns"`
+}
+
+// WindowTitleSpanData rappresenta un intervallo della timeline titoli
+type WindowTitleSpanData struct {
+	SessionID   int    `json:"session_id"`
+	ProcessName string `json:"process_name"`
+	Title       string `json:"title"`
+	StartTime   string `json:"start_time"`
+	EndTime     string `json:"end_time"`
+}
+
+// GetTitleCaptureSettings restituisce le impostazioni della timeline titoli
+func (a *App) GetTitleCaptureSettings() (TitleCaptureSettingsData, error) {
+	settings, err := tracker.CaricaImpostazioniTitoli(a.db)
+	if err != nil {
+		return TitleCaptureSettingsData{}, err
+	}
+
+	return TitleCaptureSettingsData{
+		Enabled:           settings.Enabled,
+		ProcessOnly:       settings.ProcessOnly,
+		ExcludedProcesses: settings.ExcludedProcesses,
+		MaskPatterns:      settings.MaskPatterns,
+	}, nil
+}
+
+// SetTitleCaptureSettings salva le impostazioni della timeline titoli (valide dal prossimo avvio del tracking)
+func (a *App) SetTitleCaptureSettings(settings TitleCaptureSettingsData) error {
+	return tracker.SalvaImpostazioniTitoli(a.db, tracker.TitleCaptureSettings{
+		Enabled:           settings.Enabled,
+		ProcessOnly:       settings.ProcessOnly,
+		ExcludedProcesses: settings.ExcludedProcesses,
+		MaskPatterns:      settings.MaskPatterns,
+	})
+}
+
+// GetSessionTitleTimeline restituisce la timeline titoli di una sessione
+func (a *App) GetSessionTitleTimeline(sessionID int) ([]WindowTitleSpanData, error) {
+	spans, err := tracker.CaricaTimelineTitoli(a.db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return toWindowTitleSpanData(spans), nil
+}
+
+// GetTitleTimeline restituisce la timeline titoli in un periodo
+func (a *App) GetTitleTimeline(startDate, endDate string) ([]WindowTitleSpanData, error) {
+	spans, err := tracker.CaricaTimelineTitoliPeriodo(a.db, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return toWindowTitleSpanData(spans), nil
+}
+
+// toWindowTitleSpanData converte la timeline titoli per il frontend
+func toWindowTitleSpanData(spans []tracker.WindowTitleSpan) []WindowTitleSpanData {
+	var result []WindowTitleSpanData
+	for _, span := range spans {
+		result = append(result, WindowTitleSpanData{
+			SessionID:   span.SessionID,
+			ProcessName: span.ProcessName,
+			Title:       span.Title,
+			StartTime:   tracker.FormatLocal(span.StartTime),
+			EndTime:     tracker.FormatLocal(span.EndTime),
+		})
+	}
+	return result
+}
+
 // === IDLE TIME MANAGEMENT ===
 
 // IdlePeriodData rappresenta un periodo di inattività pendente
 type IdlePeriodData struct {
 	HasPending bool   `json:"has_pending"`
+	ID         int64  `json:"id,omitempty"`
+	Type       string `json:"type,omitempty"` // "idle" o "suspended"
+	Date       string `json:"date,omitempty"`
 	Minutes    int    `json:"minutes"`
+	Seconds    int    `json:"seconds"`
 	StartTime  string `json:"start_time"`
 	EndTime    string `json:"end_time"`
 }
 
-// CheckIdlePeriod verifica se c'è un periodo idle pendente
-func (a *App) CheckIdlePeriod() IdlePeriodData {
-	globalStateMu.Lock()
-	defer globalStateMu.Unlock()
-
-	if globalWatcher == nil {
-		return IdlePeriodData{HasPending: false}
-	}
-
-	idlePeriod := globalWatcher.GetPendingIdlePeriod()
-	if idlePeriod == nil {
+// toIdlePeriodData converte un periodo pendente per il frontend
+func toIdlePeriodData(period *tracker.IdlePeriod) IdlePeriodData {
+	if period == nil {
 		return IdlePeriodData{HasPending: false}
 	}
 
+	// Orari in ora locale del fuso configurato
+	start := period.StartTime.In(tracker.TimeZone())
+	end := period.EndTime.In(tracker.TimeZone())
 	return IdlePeriodData{
 		HasPending: true,
-		Minutes:    idlePeriod.Duration / 60, // Duration is in seconds
-		StartTime:  idlePeriod.StartTime.Format("15:04"),
-		EndTime:    idlePeriod.EndTime.Format("15:04"),
+		ID:         period.ID,
+		Type:       period.Type,
+		Date:       start.Format("2006-01-02"),
+		Minutes:    period.Duration / 60, // Duration is in seconds
+		Seconds:    period.Duration,
+		StartTime:  start.Format("15:04"),
+		EndTime:    end.Format("15:04"),
+	}
+}
+
+// CheckIdlePeriod verifica se c'è un periodo idle pendente
+func (a *App) CheckIdlePeriod() IdlePeriodData {
+	return toIdlePeriodData(a.tracking.PendingIdle())
+}
+
+// GetPendingIdlePeriods restituisce tutti i periodi idle e sospesi in attesa di attribuzione,
+// anche quelli rimasti da esecuzioni precedenti
+func (a *App) GetPendingIdlePeriods() []IdlePeriodData {
+	periods := a.tracking.PendingPeriods()
+	result := make([]IdlePeriodData, 0, len(periods))
+	for i := range periods {
+		result = append(result, toIdlePeriodData(&periods[i]))
 	}
+	return result
 }
 
 // AttributeIdle attribuisce il tempo idle a un progetto o come pausa
 func (a *App) AttributeIdle(projectID int, isBreak bool) error {
-	globalStateMu.Lock()
-	defer globalStateMu.Unlock()
+	return a.tracking.AttributeIdle(projectID, isBreak)
+}
 
-	if globalWatcher == nil {
-		return fmt.Errorf("nessun watcher disponibile")
-	}
+// IdleSplitSegmentData rappresenta una parte del periodo idle da attribuire
+type IdleSplitSegmentData struct {
+	ProjectID    int    `json:"project_id"`
+	ActivityType string `json:"activity_type"`
+	Seconds      int    `json:"seconds"`  // 0 se si usa end_time o per il tempo rimanente
+	EndTime      string `json:"end_time"` // "HH:MM" o "HH:MM:SS", vuoto se non usato
+}
 
-	idlePeriod := globalWatcher.GetPendingIdlePeriod()
-	if idlePeriod == nil {
+// AttributeIdleSplit divide il tempo idle tra più progetti e tipi di attività.
+// I segmenti sono in ordine cronologico e devono coprire l'intero periodo.
+func (a *App) AttributeIdleSplit(segments []IdleSplitSegmentData) error {
+	period := a.tracking.PendingIdle()
+	if period == nil {
 		return fmt.Errorf("nessun periodo idle pendente")
 	}
 
-	if isBreak {
-		// Registra come pausa (non viene salvato come sessione)
-		globalWatcher.ClearPendingIdlePeriod()
-		// Pulizia: se il tracking era già stato fermato (auto-stop), ferma il watcher
-		if !globalIsTracking {
-			globalWatcher.Stop()
-			globalWatcher = nil
+	split := make([]tracker.IdleSegment, 0, len(segments))
+	for i, segment := range segments {
+		idleSegment := tracker.IdleSegment{
+			ProjectID:    segment.ProjectID,
+			ActivityType: segment.ActivityType,
+			Seconds:      segment.Seconds,
+		}
+		if segment.EndTime != "" {
+			t, err := time.Parse("15:04:05", segment.EndTime)
+			if err != nil {
+				if t, err = time.Parse("15:04", segment.EndTime); err != nil {
+					return fmt.Errorf("segmento %d: orario di fine non valido '%s' (formato HH:MM)", i+1, segment.EndTime)
+				}
+			}
+			start := period.StartTime.In(tracker.TimeZone())
+			end := time.Date(start.Year(), start.Month(), start.Day(), t.Hour(), t.Minute(), t.Second(), 0, start.Location())
+			if end.Before(start) {
+				end = end.AddDate(0, 0, 1) // periodo a cavallo della mezzanotte
+			}
+			idleSegment.EndTime = end
 		}
-		return nil
+		split = append(split, idleSegment)
 	}
 
-	// Attribuisci al progetto
-	if projectID <= 0 {
-		return fmt.Errorf("ID progetto non valido")
-	}
+	return a.tracking.AttributeIdleSplit(split)
+}
 
-	// Crea una sessione per il tempo idle
-	seconds := idlePeriod.Duration // Duration è già in secondi
-	timestamp := idlePeriod.StartTime.Format("2006-01-02 15:04:05")
-	err := tracker.CreaSessione(a.db, "Tempo Idle", seconds, &projectID, "off-computer", nil, timestamp)
-	if err != nil {
-		return err
-	}
+// CheckSuspendedPeriod verifica se c'è una sospensione del computer (o un salto in avanti
+// dell'orologio) in attesa di attribuzione
+func (a *App) CheckSuspendedPeriod() IdlePeriodData {
+	return toIdlePeriodData(a.tracking.PendingSuspended())
+}
 
-	globalWatcher.ClearPendingIdlePeriod()
-	// Pulizia: se il tracking era già stato fermato (auto-stop), ferma il watcher
-	if !globalIsTracking {
-		globalWatcher.Stop()
-		globalWatcher = nil
-	}
-	return nil
+// AttributeSuspended attribuisce il tempo sospeso a un progetto o lo scarta
+func (a *App) AttributeSuspended(projectID int, discard bool) error {
+	return a.tracking.AttributeSuspended(projectID, discard)
+}
+
+// GetSuspendHandling restituisce come vengono gestite le sospensioni ("ask" o "discard")
+func (a *App) GetSuspendHandling() string {
+	return a.tracking.SuspendHandling()
+}
+
+// SetSuspendHandling imposta come gestire le sospensioni: "ask" le propone per l'attribuzione,
+// "discard" le scarta automaticamente
+func (a *App) SetSuspendHandling(mode string) error {
+	return a.tracking.SetSuspendHandling(mode)
 }
 
 // SetIdleThreshold imposta la soglia di inattività in minuti
 func (a *App) SetIdleThreshold(minutes int) {
-	if minutes < 1 {
-		minutes = 1
-	}
-	SetGlobalIdleThreshold(minutes)
-
-	// Se il watcher è attivo, aggiorna anche la sua soglia
-	if globalWatcher != nil {
-		globalWatcher.SetIdleThreshold(minutes * 60)
+	if err := a.tracking.SetIdleThreshold(minutes); err != nil {
+		fmt.Printf("[IDLE] Errore salvataggio soglia: %v\n", err)
 	}
 }
 
 // GetIdleThreshold ritorna la soglia di inattività corrente in minuti
 func (a *App) GetIdleThreshold() int {
-	return GetGlobalIdleThreshold()
+	return a.tracking.IdleThreshold()
+}
+
+// GetTimeZone restituisce il fuso orario configurato (nome IANA, vuoto se è quello di sistema senza nome noto)
+func (a *App) GetTimeZone() string {
+	return tracker.TimeZoneName()
+}
+
+// SetTimeZone imposta il fuso orario in cui calcolare giorni, settimane e mesi
+// (nome IANA, es. "Europe/Rome"; vuoto = fuso di sistema)
+func (a *App) SetTimeZone(name string) error {
+	return tracker.SalvaFusoOrario(a.db, name)
 }
 
 // BringWindowToFront porta la finestra dell'applicazione in primo piano
@@ -550,288 +841,142 @@ func (a *App) RestoreNormalWindow() {
 	runtime.WindowSetAlwaysOnTop(a.ctx, false)
 }
 
-// === EXPORT/IMPORT ===
+// === INTEGRITÀ DATI ===
 
-// ExportDataResult rappresenta i dati esportati
-type ExportDataResult struct {
-	ExportDate    string                   `json:"export_date"`
-	Version       string                   `json:"version"`
-	Projects      []map[string]interface{} `json:"projects"`
-	Sessions      []map[string]interface{} `json:"sessions"`
-	Notes         []map[string]interface{} `json:"notes"`
-	ActivityTypes []map[string]interface{} `json:"activity_types"`
+// IntegrityIssueData rappresenta un problema di integrità per il frontend
+type IntegrityIssueData struct {
+	Type        string `json:"type"`
+	SessionID   int    `json:"session_id,omitempty"`
+	OtherID     int    `json:"other_id,omitempty"`
+	Description string `json:"description"`
+	Fix         string `json:"fix,omitempty"` // vuoto se va corretto a mano
 }
 
-// ExportData esporta tutti i dati
-func (a *App) ExportData() (*ExportDataResult, error) {
-	result := &ExportDataResult{
-		ExportDate: time.Now().Format("2006-01-02 15:04:05"),
-		Version:    "1.0",
-	}
-
-	// Esporta progetti
-	rows, err := a.db.Query("SELECT id, name, description, created_at, archived, COALESCE(closed_at, '') FROM projects")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id int
-		var name, description, createdAt, closedAt string
-		var archived int
-		rows.Scan(&id, &name, &description, &createdAt, &archived, &closedAt)
-		project := map[string]interface{}{
-			"id":          id,
-			"name":        name,
-			"description": description,
-			"created_at":  createdAt,
-			"archived":    archived == 1,
-		}
-		if closedAt != "" {
-			project["closed_at"] = closedAt
-		}
-		result.Projects = append(result.Projects, project)
-	}
-
-	// Esporta sessioni
-	rows, err = a.db.Query("SELECT id, app_name, seconds, project_id, session_type, activity_type, timestamp FROM sessions")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id, seconds int
-		var appName, sessionType, timestamp string
-		var projectID sql.NullInt64
-		var activityType sql.NullString
-		rows.Scan(&id, &appName, &seconds, &projectID, &sessionType, &activityType, &timestamp)
-		session := map[string]interface{}{
-			"id":           id,
-			"app_name":     appName,
-			"seconds":      seconds,
-			"session_type": sessionType,
-			"timestamp":    timestamp,
-		}
-		if projectID.Valid {
-			session["project_id"] = projectID.Int64
-		}
-		if activityType.Valid {
-			session["activity_type"] = activityType.String
-		}
-		result.Sessions = append(result.Sessions, session)
-	}
+// IntegrityReportData rappresenta l'esito del controllo di integrità
+type IntegrityReportData struct {
+	Issues  []IntegrityIssueData `json:"issues"`
+	Fixable int                  `json:"fixable"`
+	Applied bool                 `json:"applied"`
+}
 
-	// Esporta note
-	rows, err = a.db.Query("SELECT id, project_id, note_text, timestamp FROM notes")
+// CheckIntegrity controlla sovrapposizioni e coerenza delle sessioni. Con fix false
+// restituisce l'anteprima delle correzioni, con fix true le applica.
+func (a *App) CheckIntegrity(fix bool) (*IntegrityReportData, error) {
+	report, err := tracker.CheckIntegrity(a.db, fix)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id, projectID int
-		var noteText, timestamp string
-		rows.Scan(&id, &projectID, &noteText, &timestamp)
-		result.Notes = append(result.Notes, map[string]interface{}{
-			"id":         id,
-			"project_id": projectID,
-			"note_text":  noteText,
-			"timestamp":  timestamp,
-		})
-	}
 
-	// Esporta tipi attività
-	rows, err = a.db.Query("SELECT id, name, color_variant, pattern, display_order FROM activity_types")
-	if err != nil {
-		return nil, err
+	result := &IntegrityReportData{
+		Issues:  make([]IntegrityIssueData, 0, len(report.Issues)),
+		Fixable: report.Fixable,
+		Applied: report.Applied,
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id, displayOrder int
-		var name, pattern string
-		var colorVariant float64
-		rows.Scan(&id, &name, &colorVariant, &pattern, &displayOrder)
-		result.ActivityTypes = append(result.ActivityTypes, map[string]interface{}{
-			"id":            id,
-			"name":          name,
-			"color_variant": colorVariant,
-			"pattern":       pattern,
-			"display_order": displayOrder,
+	for _, issue := range report.Issues {
+		result.Issues = append(result.Issues, IntegrityIssueData{
+			Type:        issue.Type,
+			SessionID:   issue.SessionID,
+			OtherID:     issue.OtherID,
+			Description: issue.Description,
+			Fix:         issue.Fix,
 		})
 	}
-
 	return result, nil
 }
 
-// ImportData importa i dati da un backup
-func (a *App) ImportData(data ExportDataResult) error {
-	tx, err := a.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	// Elimina dati esistenti
-	tx.Exec("DELETE FROM pending_tracking")
-	tx.Exec("DELETE FROM notes")
-	tx.Exec("DELETE FROM sessions")
-	tx.Exec("DELETE FROM projects")
-	tx.Exec("DELETE FROM activity_types")
+// === EXPORT/IMPORT ===
 
-	// Mappa vecchi ID -> nuovi ID per i progetti
-	projectIDMap := make(map[int]int64)
+// ExportData esporta tutti i dati nel formato di backup corrente (tracker.BackupVersion)
+func (a *App) ExportData() (*tracker.Backup, error) {
+	return tracker.EsportaBackup(a.db)
+}
 
-	// Importa progetti
-	for _, p := range data.Projects {
-		name := p["name"].(string)
-		description := ""
-		if d, ok := p["description"].(string); ok {
-			description = d
-		}
-		archived := 0
-		if a, ok := p["archived"].(bool); ok && a {
-			archived = 1
-		}
-		var closedAt interface{}
-		if c, ok := p["closed_at"].(string); ok && c != "" {
-			closedAt = c
-		}
+// ImportCountsData rappresenta l'esito dell'importazione per un tipo di dato
+type ImportCountsData struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+}
 
-		result, err := tx.Exec(
-			"INSERT INTO projects (name, description, archived, closed_at) VALUES (?, ?, ?, ?)",
-			name, description, archived, closedAt,
-		)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-		newID, _ := result.LastInsertId()
-		oldID := int(p["id"].(float64))
-		projectIDMap[oldID] = newID
-	}
-
-	// Importa sessioni
-	for _, s := range data.Sessions {
-		appName := s["app_name"].(string)
-		seconds := int(s["seconds"].(float64))
-		sessionType := s["session_type"].(string)
-		timestamp := s["timestamp"].(string)
-
-		var projectID *int64
-		if pid, ok := s["project_id"].(float64); ok {
-			if newPID, exists := projectIDMap[int(pid)]; exists {
-				projectID = &newPID
-			}
-		}
+// ImportConflictData rappresenta un elemento del backup in conflitto con i dati locali
+type ImportConflictData struct {
+	Entity      string `json:"entity"`
+	Description string `json:"description"`
+}
 
-		var activityType *string
-		if at, ok := s["activity_type"].(string); ok {
-			activityType = &at
-		}
+// ImportReportData rappresenta l'esito (o l'anteprima) di un'importazione
+type ImportReportData struct {
+	Projects      ImportCountsData     `json:"projects"`
+	ActivityTypes ImportCountsData     `json:"activity_types"`
+	Sessions      ImportCountsData     `json:"sessions"`
+	Notes         ImportCountsData     `json:"notes"`
+	Settings      ImportCountsData     `json:"settings"`
+	IdlePeriods   ImportCountsData     `json:"idle_periods"`
+	Conflicts     []ImportConflictData `json:"conflicts"`
+	DryRun        bool                 `json:"dry_run"`
+}
 
-		_, err := tx.Exec(
-			"INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)",
-			appName, seconds, projectID, sessionType, activityType, timestamp,
-		)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+// ImportData unisce un backup (contenuto JSON del file) ai dati esistenti. Con dryRun true
+// restituisce solo l'anteprima di inserimenti, aggiornamenti, duplicati e conflitti.
+func (a *App) ImportData(content string, dryRun bool) (*ImportReportData, error) {
+	backup, err := tracker.LeggiBackup([]byte(content))
+	if err != nil {
+		return nil, err
 	}
 
-	// Importa note
-	for _, n := range data.Notes {
-		oldProjectID := int(n["project_id"].(float64))
-		noteText := n["note_text"].(string)
-		timestamp := n["timestamp"].(string)
-
-		newProjectID, exists := projectIDMap[oldProjectID]
-		if !exists {
-			continue
-		}
-
-		_, err := tx.Exec(
-			"INSERT INTO notes (project_id, note_text, timestamp) VALUES (?, ?, ?)",
-			newProjectID, noteText, timestamp,
-		)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	report, err := tracker.ImportaBackup(a.db, backup, dryRun)
+	if err != nil {
+		return nil, err
 	}
 
-	// Importa tipi attività
-	for _, at := range data.ActivityTypes {
-		name := at["name"].(string)
-		colorVariant := at["color_variant"].(float64)
-		pattern := "solid"
-		if p, ok := at["pattern"].(string); ok {
-			pattern = p
-		}
-		displayOrder := 0
-		if d, ok := at["display_order"].(float64); ok {
-			displayOrder = int(d)
-		}
-
-		_, err := tx.Exec(
-			"INSERT INTO activity_types (name, color_variant, pattern, display_order) VALUES (?, ?, ?, ?)",
-			name, colorVariant, pattern, displayOrder,
-		)
-		if err != nil {
-			tx.Rollback()
-			return err
+	// I periodi idle importati vanno subito nella coda da attribuire, senza riavviare l'app
+	if !dryRun {
+		if err := a.tracking.ReloadPendingPeriods(); err != nil {
+			fmt.Printf("[IDLE] Errore aggiornamento periodi pendenti dopo l'importazione: %v\n", err)
 		}
 	}
+	return toImportReportData(report), nil
+}
 
-	return tx.Commit()
+// toImportReportData converte l'esito dell'importazione per il frontend
+func toImportReportData(report *tracker.ImportReport) *ImportReportData {
+	counts := func(c tracker.ImportCounts) ImportCountsData {
+		return ImportCountsData{Inserted: c.Inserted, Updated: c.Updated, Skipped: c.Skipped}
+	}
+	result := &ImportReportData{
+		Projects:      counts(report.Projects),
+		ActivityTypes: counts(report.ActivityTypes),
+		Sessions:      counts(report.Sessions),
+		Notes:         counts(report.Notes),
+		Settings:      counts(report.Settings),
+		IdlePeriods:   counts(report.IdlePeriods),
+		Conflicts:     make([]ImportConflictData, 0, len(report.Conflicts)),
+		DryRun:        report.DryRun,
+	}
+	for _, c := range report.Conflicts {
+		result.Conflicts = append(result.Conflicts, ImportConflictData{Entity: c.Entity, Description: c.Description})
+	}
+	return result
 }
 
 // === SALVATAGGIO REPORT ===
 
-// SaveReportJSON salva il report in formato JSON
+// SaveReportJSON salva il report del progetto nel formato di backup, reimportabile con
+// ImportProjectJSON
 func (a *App) SaveReportJSON(projectID int) (string, error) {
-	// Genera il report
-	report, err := tracker.GeneraReportChiusura(a.db, projectID)
+	backup, err := tracker.EsportaProgetto(a.db, projectID)
 	if err != nil {
 		return "", err
 	}
 
-	// Aggiungi metadati per reimportazione
-	report["export_type"] = "project_report"
-	report["export_date"] = time.Now().Format("2006-01-02 15:04:05")
-	report["version"] = "1.0"
-
-	// Recupera sessioni del progetto per backup completo
-	sessions, err := tracker.CaricaSessioniDettagliate(a.db, "2000-01-01", "2099-12-31")
-	if err == nil {
-		var projectSessions []map[string]interface{}
-		for _, s := range sessions {
-			if s.ProjectID != nil && *s.ProjectID == projectID {
-				projectSessions = append(projectSessions, map[string]interface{}{
-					"id":            s.ID,
-					"app_name":      s.AppName,
-					"seconds":       s.Seconds,
-					"project_id":    s.ProjectID,
-					"session_type":  s.SessionType,
-					"activity_type": s.ActivityType,
-					"timestamp":     s.Timestamp,
-				})
-			}
-		}
-		report["sessions"] = projectSessions
-	}
-
-	// Converti in JSON
-	jsonData, err := json.MarshalIndent(report, "", "  ")
+	jsonData, err := json.MarshalIndent(backup, "", "  ")
 	if err != nil {
 		return "", err
 	}
 
 	// Chiedi all'utente dove salvare
-	projectName := report["project_name"].(string)
-	defaultName := fmt.Sprintf("Report_%s_%s.json", projectName, time.Now().Format("2006-01-02"))
+	projectName := backup.Projects[0].Name
+	defaultName := fmt.Sprintf("Report_%s_%s.json", projectName, a.clock.Now().Format("2006-01-02"))
 
 	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
 		DefaultFilename: defaultName,
@@ -875,15 +1020,15 @@ func (a *App) SaveReportText(projectID int) (string, error) {
 	}
 	startDate := ""
 	if s, ok := report["start_date"].(string); ok {
-		startDate = s
+		startDate = tracker.ToLocal(s)
 	}
 	endDate := ""
 	if e, ok := report["end_date"].(string); ok {
-		endDate = e
+		endDate = tracker.ToLocal(e)
 	}
 	closedAt := ""
 	if c, ok := report["closed_at"].(string); ok {
-		closedAt = c
+		closedAt = tracker.ToLocal(c)
 	}
 
 	// Costruisci il testo del report
@@ -905,10 +1050,10 @@ func (a *App) SaveReportText(projectID int) (string, error) {
 		}
 	}
 
-	text += fmt.Sprintf("\n\nGenerato da PrendiTempo il %s\n", time.Now().Format("02/01/2006 15:04"))
+	text += fmt.Sprintf("\n\nGenerato da PrendiTempo il %s\n", a.clock.Now().In(tracker.TimeZone()).Format("02/01/2006 15:04"))
 
 	// Chiedi all'utente dove salvare
-	defaultName := fmt.Sprintf("Report_%s_%s.txt", projectName, time.Now().Format("2006-01-02"))
+	defaultName := fmt.Sprintf("Report_%s_%s.txt", projectName, a.clock.Now().Format("2006-01-02"))
 
 	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
 		DefaultFilename: defaultName,
@@ -933,13 +1078,27 @@ func (a *App) SaveReportText(projectID int) (string, error) {
 	return filePath, nil
 }
 
-// ImportProjectJSON importa un progetto da file JSON
-func (a *App) ImportProjectJSON() (string, error) {
-	// Chiedi all'utente di selezionare il file
-	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Seleziona Report JSON da Importare",
+// === ESPORTAZIONE CSV ===
+
+// CSVExportOptionsData rappresenta le opzioni dell'esportazione CSV per il frontend
+type CSVExportOptionsData struct {
+	StartDate      string   `json:"start_date"`
+	EndDate        string   `json:"end_date"`
+	ProjectID      *int     `json:"project_id"`
+	Columns        []string `json:"columns"`
+	DurationFormat string   `json:"duration_format"`
+	Locale         string   `json:"locale"`
+}
+
+// ExportSessionsCSV esporta in CSV le sessioni del periodo nel file scelto dall'utente
+func (a *App) ExportSessionsCSV(options CSVExportOptionsData) (string, error) {
+	defaultName := fmt.Sprintf("Sessioni_%s_%s.csv", options.StartDate, options.EndDate)
+
+	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		DefaultFilename: defaultName,
+		Title:           "Esporta Sessioni CSV",
 		Filters: []runtime.FileFilter{
-			{DisplayName: "JSON Files (*.json)", Pattern: "*.json"},
+			{DisplayName: "CSV Files (*.csv)", Pattern: "*.csv"},
 		},
 	})
 	if err != nil {
@@ -949,139 +1108,104 @@ func (a *App) ImportProjectJSON() (string, error) {
 		return "", nil // Utente ha annullato
 	}
 
-	// Leggi il file
-	jsonData, err := os.ReadFile(filePath)
+	file, err := os.Create(filePath)
 	if err != nil {
-		return "", fmt.Errorf("errore lettura file: %v", err)
+		return "", err
 	}
-
-	// Parse del JSON
-	var reportData map[string]interface{}
-	if err := json.Unmarshal(jsonData, &reportData); err != nil {
-		return "", fmt.Errorf("errore parsing JSON: %v", err)
+	_, err = tracker.EsportaSessioniCSV(a.db, file, tracker.CSVOptions{
+		StartDate:      options.StartDate,
+		EndDate:        options.EndDate,
+		ProjectID:      options.ProjectID,
+		Columns:        options.Columns,
+		DurationFormat: options.DurationFormat,
+		Locale:         options.Locale,
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-
-	// Verifica che sia un report valido
-	exportType, ok := reportData["export_type"].(string)
-	if !ok || exportType != "project_report" {
-		return "", fmt.Errorf("file non valido: non è un report di progetto PrendiTempo")
+	if err != nil {
+		os.Remove(filePath) // Non lasciare un file incompleto
+		return "", err
 	}
 
-	// Estrai dati progetto
-	projectName, ok := reportData["project_name"].(string)
-	if !ok || projectName == "" {
-		return "", fmt.Errorf("nome progetto mancante nel file")
-	}
+	return filePath, nil
+}
 
-	projectDesc := ""
-	if desc, ok := reportData["project_description"].(string); ok {
-		projectDesc = desc
-	}
+// === ESPORTAZIONE TIMESHEET ===
 
-	// Verifica se il progetto esiste già
-	existingProject, _ := tracker.TrovaProgetto(a.db, projectName)
-	if existingProject != nil {
-		// Aggiungi suffisso per evitare conflitti
-		projectName = fmt.Sprintf("%s (Importato %s)", projectName, time.Now().Format("02-01-2006 15:04"))
-	}
+// ExportTimesheetXLSX esporta il timesheet Excel del periodo nel file scelto dall'utente
+func (a *App) ExportTimesheetXLSX(startDate, endDate string) (string, error) {
+	defaultName := fmt.Sprintf("Timesheet_%s_%s.xlsx", startDate, endDate)
 
-	// Crea il nuovo progetto
-	tx, err := a.db.Begin()
+	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		DefaultFilename: defaultName,
+		Title:           "Esporta Timesheet Excel",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Excel Files (*.xlsx)", Pattern: "*.xlsx"},
+		},
+	})
 	if err != nil {
 		return "", err
 	}
+	if filePath == "" {
+		return "", nil // Utente ha annullato
+	}
 
-	result, err := tx.Exec(
-		"INSERT INTO projects (name, description, archived, closed_at) VALUES (?, ?, 0, NULL)",
-		projectName, projectDesc,
-	)
+	file, err := os.Create(filePath)
 	if err != nil {
-		tx.Rollback()
-		return "", fmt.Errorf("errore creazione progetto: %v", err)
+		return "", err
+	}
+	err = tracker.EsportaTimesheetXLSX(a.db, file, startDate, endDate)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-
-	newProjectID, err := result.LastInsertId()
 	if err != nil {
-		tx.Rollback()
+		os.Remove(filePath) // Non lasciare un file incompleto
 		return "", err
 	}
 
-	// Importa sessioni
-	sessionsImported := 0
-	if sessions, ok := reportData["sessions"].([]interface{}); ok {
-		for _, s := range sessions {
-			session, ok := s.(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			appName := ""
-			if an, ok := session["app_name"].(string); ok {
-				appName = an
-			}
-
-			seconds := 0
-			if sec, ok := session["seconds"].(float64); ok {
-				seconds = int(sec)
-			}
-
-			sessionType := "manual"
-			if st, ok := session["session_type"].(string); ok {
-				sessionType = st
-			}
-
-			var activityType *string
-			if at, ok := session["activity_type"].(string); ok && at != "" {
-				activityType = &at
-			}
-
-			timestamp := time.Now().Format("2006-01-02 15:04:05")
-			if ts, ok := session["timestamp"].(string); ok && ts != "" {
-				timestamp = ts
-			}
+	return filePath, nil
+}
 
-			_, err := tx.Exec(
-				"INSERT INTO sessions (app_name, seconds, project_id, session_type, activity_type, timestamp) VALUES (?, ?, ?, ?, ?, ?)",
-				appName, seconds, newProjectID, sessionType, activityType, timestamp,
-			)
-			if err == nil {
-				sessionsImported++
-			}
-		}
+// ImportProjectJSON importa un report di progetto (anche nei formati precedenti la 2.0)
+func (a *App) ImportProjectJSON() (string, error) {
+	// Chiedi all'utente di selezionare il file
+	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Seleziona Report JSON da Importare",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "JSON Files (*.json)", Pattern: "*.json"},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if filePath == "" {
+		return "", nil // Utente ha annullato
 	}
 
-	// Importa note
-	notesImported := 0
-	if notes, ok := reportData["notes"].([]interface{}); ok {
-		for _, n := range notes {
-			note, ok := n.(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			noteText := ""
-			if nt, ok := note["note_text"].(string); ok {
-				noteText = nt
-			}
-
-			timestamp := time.Now().Format("2006-01-02 15:04:05")
-			if ts, ok := note["timestamp"].(string); ok && ts != "" {
-				timestamp = ts
-			}
+	// Leggi il file
+	jsonData, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("errore lettura file: %v", err)
+	}
 
-			_, err := tx.Exec(
-				"INSERT INTO notes (project_id, note_text, timestamp) VALUES (?, ?, ?)",
-				newProjectID, noteText, timestamp,
-			)
-			if err == nil {
-				notesImported++
-			}
-		}
+	backup, err := tracker.LeggiBackup(jsonData)
+	if err != nil {
+		return "", err
+	}
+	if backup.ExportType != tracker.ExportProject {
+		return "", fmt.Errorf("file non valido: non è un report di progetto PrendiTempo")
 	}
 
-	if err := tx.Commit(); err != nil {
+	// Il progetto viene unito a quello con lo stesso nome, se esiste
+	report, err := tracker.ImportaBackup(a.db, backup, false)
+	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("Progetto '%s' importato con successo!\n%d sessioni e %d note ripristinate.", projectName, sessionsImported, notesImported), nil
+	message := fmt.Sprintf("Progetto '%s' importato con successo!\n%d sessioni e %d note ripristinate.", backup.Projects[0].Name, report.Sessions.Inserted, report.Notes.Inserted)
+	if len(report.Conflicts) > 0 {
+		message += fmt.Sprintf("\n%d conflitti: mantenuti i dati locali.", len(report.Conflicts))
+	}
+	return message, nil
 }